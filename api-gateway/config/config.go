@@ -1,18 +1,32 @@
 package config
 
 import (
-	"fmt"
+	"log/slog"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
 
 	"github.com/caarlos0/env"
 )
 
 type Config struct {
-	ServerPort        string `env:"SERVER_PORT" envDefault:"8080"`
-	ServerHost        string `env:"SERVER_HOST" envDefault:"0.0.0.0"`
-	ProductServiceURL string `env:"PRODUCT_SERVICE_URL" envDefault:"http://product-service:8081"`
-	OrderServiceURL   string `env:"ORDER_SERVICE_URL" envDefault:"http://order-service:8082"`
-	AppEnv            string `env:"APP_ENV" envDefault:"development"`
-	LogLevel          string `env:"LOG_LEVEL" envDefault:"debug"`
+	ServerPort          string        `env:"SERVER_PORT" envDefault:"8080"`
+	ServerHost          string        `env:"SERVER_HOST" envDefault:"0.0.0.0"`
+	ProductServiceURL   string        `env:"PRODUCT_SERVICE_URL" envDefault:"http://product-service:8081"`
+	OrderServiceURL     string        `env:"ORDER_SERVICE_URL" envDefault:"http://order-service:8082"`
+	InventoryServiceURL string        `env:"INVENTORY_SERVICE_URL" envDefault:"http://inventory-service:8084"`
+	AppEnv              string        `env:"APP_ENV" envDefault:"development"`
+	LogLevel            string        `env:"LOG_LEVEL" envDefault:"debug"`
+	OtelExporter        string        `env:"OTEL_EXPORTER" envDefault:"none"`
+	OtelEndpoint        string        `env:"OTEL_EXPORTER_OTLP_ENDPOINT" envDefault:"otel-collector:4317"`
+	OtelFilePath        string        `env:"OTEL_FILE_PATH" envDefault:"traces.json"`
+	OtelSampleRatio     float64       `env:"OTEL_SAMPLE_RATIO" envDefault:"1"`
+	TLSCertFile         string        `env:"TLS_CERT_FILE"`
+	TLSKeyFile          string        `env:"TLS_KEY_FILE"`
+	TLSCAFile           string        `env:"TLS_CA_FILE"`
+	TLSReloadInterval   time.Duration `env:"TLS_RELOAD_INTERVAL" envDefault:"1m"`
+	AuthJWTSecret       string        `env:"AUTH_JWT_SECRET" secret:"true"`
 }
 
 func LoadConfig() (Config, error) {
@@ -20,6 +34,40 @@ func LoadConfig() (Config, error) {
 	if err := env.Parse(&cfg); err != nil {
 		return cfg, err
 	}
-	fmt.Println(cfg)
 	return cfg, nil
 }
+
+// LogValue renders the configuration for structured logs, keyed by
+// environment variable. Fields tagged secret:"true" and credentials embedded
+// in URLs are masked.
+func (c Config) LogValue() slog.Value {
+	v := reflect.ValueOf(c)
+	t := v.Type()
+	attrs := make([]slog.Attr, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("env"), ",")
+		if key == "" {
+			key = field.Name
+		}
+		value := v.Field(i).Interface()
+		if field.Tag.Get("secret") == "true" {
+			value = "[REDACTED]"
+		} else if s, ok := value.(string); ok {
+			value = redactURL(s)
+		}
+		attrs = append(attrs, slog.Any(key, value))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func redactURL(s string) string {
+	if !strings.Contains(s, "://") {
+		return s
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	return u.Redacted()
+}
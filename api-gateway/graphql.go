@@ -0,0 +1,342 @@
+package main
+
+import (
+	"api-gateway/auth"
+	"api-gateway/graphql"
+	"api-gateway/logging"
+	"api-gateway/render"
+	"bytes"
+	"context"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+)
+
+//go:embed schema.graphql
+var schemaSDL string
+
+var schema = newSchema()
+
+// maxGraphQLBody bounds the size of a GraphQL request.
+const maxGraphQLBody = 1 << 20
+
+// upstreamHeaders are copied from the GraphQL request to every upstream call.
+var upstreamHeaders = []string{auth.CustomerHeader, auth.RolesHeader, logging.RequestIDHeader}
+
+type requestKey struct{}
+
+// requestState is what resolvers need from the HTTP request: the headers to
+// forward and the loaders, which live for one request.
+type requestState struct {
+	header   http.Header
+	products *graphql.Loader[string, map[string]any]
+}
+
+func state(ctx context.Context) *requestState {
+	return ctx.Value(requestKey{}).(*requestState)
+}
+
+// handleGraphQL serves POST requests with a JSON body, GET requests with the
+// query in the URL, and the schema SDL on GET without a query.
+func handleGraphQL(w http.ResponseWriter, r *http.Request) {
+	var req graphql.Request
+	switch r.Method {
+	case http.MethodGet:
+		q := r.URL.Query()
+		if q.Get("query") == "" {
+			w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+			io.WriteString(w, schema.SDL())
+			return
+		}
+		req.Query, req.OperationName = q.Get("query"), q.Get("operationName")
+		if vars := q.Get("variables"); vars != "" {
+			if err := json.Unmarshal([]byte(vars), &req.Variables); err != nil {
+				render.Error(w, r, http.StatusBadRequest, "invalid variables: "+err.Error())
+				return
+			}
+		}
+		// GET must not change anything. A document that does not parse
+		// is left to Execute to report.
+		if kind, err := graphql.OperationType(req); err == nil && kind != "query" {
+			render.Error(w, r, http.StatusMethodNotAllowed, "mutations must use POST")
+			return
+		}
+	case http.MethodPost:
+		if err := json.NewDecoder(io.LimitReader(r.Body, maxGraphQLBody)).Decode(&req); err != nil {
+			render.Error(w, r, http.StatusBadRequest, "invalid request body: "+err.Error())
+			return
+		}
+	}
+
+	st := &requestState{header: http.Header{}}
+	for _, h := range upstreamHeaders {
+		if v := r.Header.Get(h); v != "" {
+			st.header.Set(h, v)
+		}
+	}
+	st.products = graphql.NewLoader(fetchProducts)
+	ctx := context.WithValue(r.Context(), requestKey{}, st)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(schema.Execute(ctx, req))
+}
+
+// newSchema resolves the schema against API v2 of the services, which shows
+// amounts as Money like the schema does.
+func newSchema() *graphql.Schema {
+	s := graphql.MustParseSchema(schemaSDL)
+
+	s.Resolve("Query", "products", func(ctx context.Context, p graphql.ResolveParams) (any, error) {
+		query := url.Values{}
+		if category, ok := p.Args["category"].(string); ok {
+			query.Set("category", category)
+		}
+		var products []map[string]any
+		if err := callUpstream(ctx, http.MethodGet, cfg.ProductServiceURL, "/v2/products?"+query.Encode(), nil, &products); err != nil {
+			return nil, err
+		}
+		for _, product := range products {
+			state(ctx).products.Prime(product["id"].(string), product)
+		}
+		return products, nil
+	})
+	s.Resolve("Query", "product", func(ctx context.Context, p graphql.ResolveParams) (any, error) {
+		return state(ctx).products.Load(ctx, p.Args["id"].(string)), nil
+	})
+	s.Resolve("Query", "orders", func(ctx context.Context, p graphql.ResolveParams) (any, error) {
+		var orders []map[string]any
+		err := callUpstream(ctx, http.MethodGet, cfg.OrderServiceURL, "/v2/orders", nil, &orders)
+		return orders, err
+	})
+	s.Resolve("Query", "order", func(ctx context.Context, p graphql.ResolveParams) (any, error) {
+		var order map[string]any
+		err := callUpstream(ctx, http.MethodGet, cfg.OrderServiceURL, "/v2/orders/"+url.PathEscape(p.Args["id"].(string)), nil, &order)
+		return present(order, err)
+	})
+
+	s.Resolve("Mutation", "createProduct", func(ctx context.Context, p graphql.ResolveParams) (any, error) {
+		var product map[string]any
+		err := callUpstream(ctx, http.MethodPost, cfg.ProductServiceURL, "/v2/products", upstreamBody(p.Args["input"]), &product)
+		return product, err
+	})
+	s.Resolve("Mutation", "updateProduct", func(ctx context.Context, p graphql.ResolveParams) (any, error) {
+		id := p.Args["id"].(string)
+		input := upstreamBody(p.Args["input"])
+		input["id"] = id
+		var product map[string]any
+		err := callUpstream(ctx, http.MethodPut, cfg.ProductServiceURL, "/v2/products/"+url.PathEscape(id), input, &product)
+		return product, err
+	})
+	s.Resolve("Mutation", "deleteProduct", func(ctx context.Context, p graphql.ResolveParams) (any, error) {
+		err := callUpstream(ctx, http.MethodDelete, cfg.ProductServiceURL, "/v2/products/"+url.PathEscape(p.Args["id"].(string)), nil, nil)
+		return err == nil, err
+	})
+	s.Resolve("Mutation", "createOrder", func(ctx context.Context, p graphql.ResolveParams) (any, error) {
+		var order map[string]any
+		err := callUpstream(ctx, http.MethodPost, cfg.OrderServiceURL, "/v2/orders", upstreamOrder(p.Args["input"]), &order)
+		return order, err
+	})
+	s.Resolve("Mutation", "updateOrder", func(ctx context.Context, p graphql.ResolveParams) (any, error) {
+		id := p.Args["id"].(string)
+		input := upstreamOrder(p.Args["input"])
+		input["id"] = id
+		var order map[string]any
+		err := callUpstream(ctx, http.MethodPut, cfg.OrderServiceURL, "/v2/orders/"+url.PathEscape(id), input, &order)
+		return order, err
+	})
+	s.Resolve("Mutation", "deleteOrder", func(ctx context.Context, p graphql.ResolveParams) (any, error) {
+		err := callUpstream(ctx, http.MethodDelete, cfg.OrderServiceURL, "/v2/orders/"+url.PathEscape(p.Args["id"].(string)), nil, nil)
+		return err == nil, err
+	})
+
+	s.Resolve("Order", "products", func(ctx context.Context, p graphql.ResolveParams) (any, error) {
+		order := p.Source.(map[string]any)
+		ids := stringList(order["product_ids"])
+		items, _ := order["items"].([]any)
+		for _, item := range items {
+			if item, ok := item.(map[string]any); ok {
+				if id, ok := item["product_id"].(string); ok && !slices.Contains(ids, id) {
+					ids = append(ids, id)
+				}
+			}
+		}
+		return state(ctx).products.LoadMany(ctx, ids), nil
+	})
+	s.Resolve("OrderItem", "product", func(ctx context.Context, p graphql.ResolveParams) (any, error) {
+		id, _ := p.Source.(map[string]any)["product_id"].(string)
+		return state(ctx).products.Load(ctx, id), nil
+	})
+	s.Resolve("OrderItem", "variant", func(ctx context.Context, p graphql.ResolveParams) (any, error) {
+		item := p.Source.(map[string]any)
+		sku, _ := item["sku"].(string)
+		if sku == "" {
+			return nil, nil
+		}
+		id, _ := item["product_id"].(string)
+		product := state(ctx).products.Load(ctx, id)
+		return graphql.Thunk(func() (any, error) {
+			p, err := product()
+			if p == nil || err != nil {
+				return nil, err
+			}
+			variants, _ := p.(map[string]any)["variants"].([]any)
+			for _, v := range variants {
+				if v, _ := v.(map[string]any); v["sku"] == sku {
+					return v, nil
+				}
+			}
+			return nil, nil
+		}), nil
+	})
+	return s
+}
+
+// fetchProducts loads a batch of products, with stock, in one call.
+func fetchProducts(ctx context.Context, ids []string) (map[string]map[string]any, error) {
+	var products []map[string]any
+	// v2 takes each ID as a value of its own, so IDs may hold commas
+	path := "/v2/products?" + url.Values{"ids": ids}.Encode()
+	if err := callUpstream(ctx, http.MethodGet, cfg.ProductServiceURL, path, nil, &products); err != nil {
+		return nil, err
+	}
+	byID := make(map[string]map[string]any, len(products))
+	for _, product := range products {
+		if id, ok := product["id"].(string); ok {
+			byID[id] = product
+		}
+	}
+	return byID, nil
+}
+
+// errNotFound marks an upstream 404; single-object queries turn it into null.
+var errNotFound = errors.New("not found")
+
+// callUpstream sends a JSON request to a service with the caller's identity
+// and decodes the JSON answer into out, keeping numbers exact.
+func callUpstream(ctx context.Context, method, base, path string, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		b, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(b)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, strings.TrimRight(base, "/")+path, reader)
+	if err != nil {
+		return err
+	}
+	req.Header = state(ctx).header.Clone()
+	req.Header.Set("Accept", "application/json")
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return fmt.Errorf("upstream unavailable: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusNotFound:
+		return errNotFound
+	case resp.StatusCode >= 400:
+		var envelope render.ErrorBody
+		if err := json.NewDecoder(io.LimitReader(resp.Body, 1<<16)).Decode(&envelope); err != nil || envelope.Error.Message == "" {
+			return errors.New(http.StatusText(resp.StatusCode))
+		}
+		return errors.New(envelope.Error.Message)
+	case out == nil || resp.StatusCode == http.StatusNoContent:
+		return nil
+	}
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	return dec.Decode(out)
+}
+
+// present maps a missing object to null.
+func present(obj map[string]any, err error) (any, error) {
+	if errors.Is(err, errNotFound) {
+		return nil, nil
+	}
+	if err != nil || obj["id"] == "" || obj["id"] == nil {
+		return nil, err
+	}
+	return obj, nil
+}
+
+// upstreamBody converts a GraphQL input object to the services' snake_case
+// JSON. Attribute maps are user data and keep their keys.
+func upstreamBody(input any) map[string]any {
+	body, _ := snakeKeys(input).(map[string]any)
+	return body
+}
+
+// upstreamOrder is upstreamBody for an OrderInput. v2 lists everything
+// ordered in items, so productIds are sent as items of one.
+func upstreamOrder(input any) map[string]any {
+	body := upstreamBody(input)
+	ids, _ := body["product_ids"].([]any)
+	delete(body, "product_ids")
+	if len(ids) == 0 {
+		return body
+	}
+	items, _ := body["items"].([]any)
+	for _, id := range ids {
+		items = append(items, map[string]any{"product_id": id, "quantity": 1})
+	}
+	body["items"] = items
+	return body
+}
+
+func snakeKeys(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			if k == "attributes" {
+				out[k] = item
+				continue
+			}
+			out[snake(k)] = snakeKeys(item)
+		}
+		return out
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = snakeKeys(item)
+		}
+		return out
+	}
+	return v
+}
+
+func snake(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if r >= 'A' && r <= 'Z' {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r += 'a' - 'A'
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func stringList(v any) []string {
+	list, _ := v.([]any)
+	out := make([]string, 0, len(list))
+	for _, item := range list {
+		if s, ok := item.(string); ok {
+			out = append(out, s)
+		}
+	}
+	return out
+}
@@ -0,0 +1,109 @@
+package graphql
+
+// Executable documents
+
+type document struct {
+	operations []*operation
+	fragments  map[string]*fragment
+}
+
+type operation struct {
+	kind       string // "query" or "mutation"
+	name       string
+	variables  []*variableDef
+	selections []selection
+	pos        int
+}
+
+type variableDef struct {
+	name         string
+	typ          *typeRef
+	defaultValue value
+}
+
+type fragment struct {
+	name          string
+	typeCondition string
+	selections    []selection
+	pos           int
+}
+
+// selection is a *field, *fragmentSpread or *inlineFragment.
+type selection interface{}
+
+type field struct {
+	alias      string
+	name       string
+	args       []*argument
+	directives []*directive
+	selections []selection
+	pos        int
+}
+
+func (f *field) responseKey() string {
+	if f.alias != "" {
+		return f.alias
+	}
+	return f.name
+}
+
+type argument struct {
+	name  string
+	value value
+}
+
+type directive struct {
+	name string
+	args []*argument
+}
+
+type fragmentSpread struct {
+	name       string
+	directives []*directive
+	pos        int
+}
+
+type inlineFragment struct {
+	typeCondition string
+	directives    []*directive
+	selections    []selection
+	pos           int
+}
+
+// value is a literal or variable in a document: *variable, int64, float64,
+// string, bool, nil, enumValue, []value or *objectValue.
+type value interface{}
+
+type variable struct{ name string }
+
+type enumValue string
+
+type objectValue struct {
+	fields []*argument
+}
+
+// Type references, shared by documents and schemas
+
+type typeRef struct {
+	name    string // named type, empty for lists
+	elem    *typeRef
+	nonNull bool
+}
+
+func (t *typeRef) String() string {
+	s := t.name
+	if t.elem != nil {
+		s = "[" + t.elem.String() + "]"
+	}
+	if t.nonNull {
+		s += "!"
+	}
+	return s
+}
+
+// nullable returns t without its non-null marker.
+func (t *typeRef) nullable() *typeRef {
+	c := *t
+	c.nonNull = false
+	return &c
+}
@@ -0,0 +1,274 @@
+package graphql
+
+import (
+	"fmt"
+	"math"
+	"slices"
+)
+
+// coerceVariables checks the request variables against their declarations
+// and applies defaults.
+func (e *executor) coerceVariables(op *operation, input map[string]any) (map[string]any, error) {
+	vars := map[string]any{}
+	for _, def := range op.variables {
+		raw, ok := input[def.name]
+		switch {
+		case !ok && def.defaultValue != nil:
+			v, err := e.coerceLiteral(def.typ, def.defaultValue)
+			if err != nil {
+				return nil, fmt.Errorf("variable $%s: %w", def.name, err)
+			}
+			vars[def.name] = v
+		case !ok && def.typ.nonNull:
+			return nil, fmt.Errorf("variable $%s of type %s was not provided", def.name, def.typ)
+		case ok:
+			v, err := e.coerceJSON(def.typ, raw)
+			if err != nil {
+				return nil, fmt.Errorf("variable $%s: %w", def.name, err)
+			}
+			vars[def.name] = v
+		}
+	}
+	return vars, nil
+}
+
+// coerceJSON converts a variable value decoded from JSON.
+func (e *executor) coerceJSON(typ *typeRef, v any) (any, error) {
+	if v == nil {
+		if typ.nonNull {
+			return nil, fmt.Errorf("expected a non-null %s", typ)
+		}
+		return nil, nil
+	}
+	if typ.elem != nil {
+		list, ok := v.([]any)
+		if !ok {
+			list = []any{v}
+		}
+		out := make([]any, len(list))
+		for i, item := range list {
+			c, err := e.coerceJSON(typ.elem, item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = c
+		}
+		return out, nil
+	}
+	t := e.schema.types[typ.name]
+	switch {
+	case t.kind == kindInput:
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return nil, fmt.Errorf("expected an object for %s", t.name)
+		}
+		return coerceInputObject(e, t, obj, e.coerceJSON)
+	case t.kind == kindEnum:
+		if s, ok := v.(string); ok && slices.Contains(t.enumValues, s) {
+			return s, nil
+		}
+	case t.name == "Int":
+		if f, ok := v.(float64); ok && f == math.Trunc(f) && math.Abs(f) <= math.MaxInt32 {
+			return int(f), nil
+		}
+	case t.name == "Float":
+		if f, ok := v.(float64); ok {
+			return f, nil
+		}
+	case t.name == "String":
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case t.name == "ID":
+		switch v := v.(type) {
+		case string:
+			return v, nil
+		case float64:
+			if v == math.Trunc(v) {
+				return fmt.Sprint(int64(v)), nil
+			}
+		}
+	case t.name == "Boolean":
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	default:
+		return v, nil
+	}
+	return nil, fmt.Errorf("cannot use %v as %s", v, t.name)
+}
+
+// coerceLiteral converts a value written in the query, substituting
+// variables.
+func (e *executor) coerceLiteral(typ *typeRef, v value) (any, error) {
+	if ref, ok := v.(*variable); ok {
+		val, ok := e.vars[ref.name]
+		if (!ok || val == nil) && typ.nonNull {
+			return nil, fmt.Errorf("variable $%s must not be null", ref.name)
+		}
+		return val, nil
+	}
+	if v == nil {
+		if typ.nonNull {
+			return nil, fmt.Errorf("expected a non-null %s", typ)
+		}
+		return nil, nil
+	}
+	if typ.elem != nil {
+		list, ok := v.([]value)
+		if !ok {
+			list = []value{v}
+		}
+		out := make([]any, len(list))
+		for i, item := range list {
+			c, err := e.coerceLiteral(typ.elem, item)
+			if err != nil {
+				return nil, err
+			}
+			out[i] = c
+		}
+		return out, nil
+	}
+	t := e.schema.types[typ.name]
+	switch {
+	case t.kind == kindInput:
+		obj, ok := v.(*objectValue)
+		if !ok {
+			return nil, fmt.Errorf("expected an object for %s", t.name)
+		}
+		fields := make(map[string]value, len(obj.fields))
+		for _, f := range obj.fields {
+			fields[f.name] = f.value
+		}
+		return coerceInputObject(e, t, fields, e.coerceLiteral)
+	case t.kind == kindEnum:
+		if s, ok := v.(enumValue); ok && slices.Contains(t.enumValues, string(s)) {
+			return string(s), nil
+		}
+	case t.name == "Int":
+		if n, ok := v.(int64); ok && n >= math.MinInt32 && n <= math.MaxInt32 {
+			return int(n), nil
+		}
+	case t.name == "Float":
+		switch n := v.(type) {
+		case int64:
+			return float64(n), nil
+		case float64:
+			return n, nil
+		}
+	case t.name == "String":
+		if s, ok := v.(string); ok {
+			return s, nil
+		}
+	case t.name == "ID":
+		switch n := v.(type) {
+		case string:
+			return n, nil
+		case int64:
+			return fmt.Sprint(n), nil
+		}
+	case t.name == "Boolean":
+		if b, ok := v.(bool); ok {
+			return b, nil
+		}
+	default:
+		return literalToGo(v, e.vars), nil
+	}
+	return nil, fmt.Errorf("cannot use %v as %s", v, t.name)
+}
+
+// coerceInputObject coerces the fields of an input object with the given
+// per-value function, applying defaults and rejecting unknown fields.
+func coerceInputObject[V any](e *executor, t *typeDef, fields map[string]V, coerce func(*typeRef, V) (any, error)) (map[string]any, error) {
+	out := map[string]any{}
+	for name := range fields {
+		if !slices.ContainsFunc(t.inputFields, func(d *inputValueDef) bool { return d.name == name }) {
+			return nil, fmt.Errorf("unknown field %q in %s", name, t.name)
+		}
+	}
+	for _, d := range t.inputFields {
+		raw, ok := fields[d.name]
+		switch {
+		case ok:
+			v, err := coerce(d.typ, raw)
+			if err != nil {
+				return nil, fmt.Errorf("%s.%s: %w", t.name, d.name, err)
+			}
+			out[d.name] = v
+		case d.hasDefault:
+			v, err := e.coerceLiteral(d.typ, d.defaultValue)
+			if err != nil {
+				return nil, err
+			}
+			out[d.name] = v
+		case d.typ.nonNull:
+			return nil, fmt.Errorf("%s.%s of type %s is required", t.name, d.name, d.typ)
+		}
+	}
+	return out, nil
+}
+
+// coerceArgs coerces the arguments of a field against their definitions.
+func (e *executor) coerceArgs(defs []*inputValueDef, args []*argument) (map[string]any, error) {
+	out := map[string]any{}
+	for _, d := range defs {
+		var arg *argument
+		for _, a := range args {
+			if a.name == d.name {
+				arg = a
+			}
+		}
+		if ref, ok := arg.valueOrNil().(*variable); ok {
+			if _, provided := e.vars[ref.name]; !provided {
+				arg = nil
+			}
+		}
+		switch {
+		case arg != nil:
+			v, err := e.coerceLiteral(d.typ, arg.value)
+			if err != nil {
+				return nil, fmt.Errorf("argument %q: %w", d.name, err)
+			}
+			out[d.name] = v
+		case d.hasDefault:
+			v, err := e.coerceLiteral(d.typ, d.defaultValue)
+			if err != nil {
+				return nil, err
+			}
+			out[d.name] = v
+		case d.typ.nonNull:
+			return nil, fmt.Errorf("argument %q of type %s is required", d.name, d.typ)
+		}
+	}
+	return out, nil
+}
+
+func (a *argument) valueOrNil() value {
+	if a == nil {
+		return nil
+	}
+	return a.value
+}
+
+// literalToGo converts a literal for a custom scalar.
+func literalToGo(v value, vars map[string]any) any {
+	switch v := v.(type) {
+	case *variable:
+		return vars[v.name]
+	case enumValue:
+		return string(v)
+	case []value:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = literalToGo(item, vars)
+		}
+		return out
+	case *objectValue:
+		out := map[string]any{}
+		for _, f := range v.fields {
+			out[f.name] = literalToGo(f.value, vars)
+		}
+		return out
+	}
+	return v
+}
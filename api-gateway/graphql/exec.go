@@ -0,0 +1,553 @@
+package graphql
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"strings"
+	"unicode"
+)
+
+// Request is a GraphQL request as sent over HTTP.
+type Request struct {
+	Query         string         `json:"query"`
+	OperationName string         `json:"operationName"`
+	Variables     map[string]any `json:"variables"`
+}
+
+// Response carries the result. Data is absent when the request failed before
+// execution started.
+type Response struct {
+	Data   any      `json:"data,omitempty"`
+	Errors []*Error `json:"errors,omitempty"`
+}
+
+type Location struct {
+	Line   int `json:"line"`
+	Column int `json:"column"`
+}
+
+type Error struct {
+	Message   string     `json:"message"`
+	Locations []Location `json:"locations,omitempty"`
+	Path      []any      `json:"path,omitempty"`
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// invalid marks a value that became null through a non-null field; it makes
+// the nearest nullable parent null.
+var invalid = &struct{ invalid bool }{true}
+
+type executor struct {
+	schema *Schema
+	src    string
+	doc    *document
+	vars   map[string]any
+	errs   []*Error
+}
+
+// Execute runs one operation of req. Query fields are resolved level by level
+// so that loaders can batch each level; mutation fields run one after the
+// other.
+func (s *Schema) Execute(ctx context.Context, req Request) *Response {
+	doc, err := parseQuery(req.Query)
+	if err != nil {
+		return &Response{Errors: []*Error{asError(err)}}
+	}
+	op, err := pickOperation(doc, req.OperationName)
+	if err != nil {
+		return &Response{Errors: []*Error{asError(err)}}
+	}
+	e := &executor{schema: s, src: req.Query, doc: doc}
+	root := s.types[s.query]
+	if op.kind == "mutation" {
+		if s.mutation == "" {
+			return &Response{Errors: []*Error{e.errorAt(op.pos, "schema does not support mutations")}}
+		}
+		root = s.types[s.mutation]
+	}
+	if errs := e.validate(op, root); len(errs) > 0 {
+		return &Response{Errors: errs}
+	}
+	if e.vars, err = e.coerceVariables(op, req.Variables); err != nil {
+		return &Response{Errors: []*Error{asError(err)}}
+	}
+
+	data := e.executeObjects(ctx, root, op.selections, []any{nil}, [][]any{nil}, op.kind == "mutation")[0]
+	if data == invalid {
+		return &Response{Data: json.RawMessage("null"), Errors: e.errs}
+	}
+	return &Response{Data: data, Errors: e.errs}
+}
+
+// OperationType returns the type of the operation req would run, "query" or
+// "mutation", parsing the document as Execute does.
+func OperationType(req Request) (string, error) {
+	doc, err := parseQuery(req.Query)
+	if err != nil {
+		return "", err
+	}
+	op, err := pickOperation(doc, req.OperationName)
+	if err != nil {
+		return "", err
+	}
+	return op.kind, nil
+}
+
+func pickOperation(doc *document, name string) (*operation, error) {
+	if name == "" {
+		if len(doc.operations) > 1 {
+			return nil, &Error{Message: "operationName is required when the document has several operations"}
+		}
+		return doc.operations[0], nil
+	}
+	for _, op := range doc.operations {
+		if op.name == name {
+			return op, nil
+		}
+	}
+	return nil, &Error{Message: fmt.Sprintf("unknown operation %q", name)}
+}
+
+func asError(err error) *Error {
+	if e, ok := err.(*Error); ok {
+		return e
+	}
+	return &Error{Message: err.Error()}
+}
+
+func (e *executor) errorAt(pos int, format string, args ...any) *Error {
+	line, col := position(e.src, pos)
+	return &Error{Message: fmt.Sprintf(format, args...), Locations: []Location{{line, col}}}
+}
+
+func (e *executor) fieldError(f *field, path []any, err error) {
+	ge := e.errorAt(f.pos, "%s", err.Error())
+	ge.Path = path
+	e.errs = append(e.errs, ge)
+}
+
+// collectedField is every field of a selection set sharing one response key.
+type collectedField struct {
+	key    string
+	fields []*field
+	def    *fieldDef // nil for __typename
+}
+
+func (c *collectedField) selections() []selection {
+	var sels []selection
+	for _, f := range c.fields {
+		sels = append(sels, f.selections...)
+	}
+	return sels
+}
+
+func (e *executor) collect(t *typeDef, sels []selection) []*collectedField {
+	var out []*collectedField
+	index := map[string]*collectedField{}
+	visited := map[string]bool{}
+	var walk func([]selection)
+	walk = func(sels []selection) {
+		for _, sel := range sels {
+			switch sel := sel.(type) {
+			case *field:
+				if e.skipped(sel.directives) {
+					continue
+				}
+				key := sel.responseKey()
+				if c, ok := index[key]; ok {
+					c.fields = append(c.fields, sel)
+					continue
+				}
+				c := &collectedField{key: key, fields: []*field{sel}, def: t.fields[sel.name]}
+				index[key] = c
+				out = append(out, c)
+			case *fragmentSpread:
+				if e.skipped(sel.directives) || visited[sel.name] {
+					continue
+				}
+				visited[sel.name] = true
+				if frag := e.doc.fragments[sel.name]; frag.typeCondition == t.name {
+					walk(frag.selections)
+				}
+			case *inlineFragment:
+				if !e.skipped(sel.directives) && (sel.typeCondition == "" || sel.typeCondition == t.name) {
+					walk(sel.selections)
+				}
+			}
+		}
+	}
+	walk(sels)
+	return out
+}
+
+// skipped evaluates @skip and @include.
+func (e *executor) skipped(dirs []*directive) bool {
+	for _, d := range dirs {
+		for _, a := range d.args {
+			if a.name != "if" {
+				continue
+			}
+			v, _ := e.coerceLiteral(&typeRef{name: "Boolean", nonNull: true}, a.value)
+			if b, _ := v.(bool); (d.name == "skip" && b) || (d.name == "include" && !b) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// executeObjects runs a selection set against several objects of type t at
+// once and returns an ordered map per object, or invalid.
+func (e *executor) executeObjects(ctx context.Context, t *typeDef, sels []selection, sources []any, paths [][]any, serial bool) []any {
+	fields := e.collect(t, sels)
+	results := make([]*orderedMap, len(sources))
+	for i := range results {
+		results[i] = &orderedMap{}
+	}
+	run := func(fields []*collectedField) {
+		values := make([][]any, len(fields))
+		for fi, c := range fields {
+			values[fi] = make([]any, len(sources))
+			for i, src := range sources {
+				values[fi][i] = e.resolve(ctx, t, c, src, appendPath(paths[i], c.key))
+			}
+		}
+		// Resolve deferred values only now, so loaders see every key of
+		// this level before they fetch.
+		for fi, c := range fields {
+			for i, v := range values[fi] {
+				if th, ok := v.(Thunk); ok {
+					values[fi][i] = e.force(c, th, appendPath(paths[i], c.key))
+				}
+			}
+		}
+		for fi, c := range fields {
+			typ := &typeRef{name: "String", nonNull: true}
+			if c.def != nil {
+				typ = c.def.typ
+			}
+			childPaths := make([][]any, len(sources))
+			for i := range sources {
+				childPaths[i] = appendPath(paths[i], c.key)
+			}
+			for i, v := range e.complete(ctx, typ, c.selections(), values[fi], childPaths) {
+				results[i].set(c.key, v)
+			}
+		}
+	}
+	if serial {
+		for _, c := range fields {
+			run([]*collectedField{c})
+		}
+	} else {
+		run(fields)
+	}
+
+	out := make([]any, len(sources))
+	for i, m := range results {
+		out[i] = m
+		if m.hasInvalid() {
+			out[i] = invalid
+		}
+	}
+	return out
+}
+
+func (e *executor) resolve(ctx context.Context, t *typeDef, c *collectedField, source any, path []any) (v any) {
+	f := c.fields[0]
+	if f.name == "__typename" {
+		return t.name
+	}
+	args, err := e.coerceArgs(c.def.args, f.args)
+	if err != nil {
+		e.fieldError(f, path, err)
+		return invalid
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			e.fieldError(f, path, fmt.Errorf("internal error: %v", r))
+			v = invalid
+		}
+	}()
+	resolve := c.def.resolve
+	if resolve == nil {
+		resolve = defaultResolver(f.name)
+	}
+	v, err = resolve(ctx, ResolveParams{Source: source, Args: args})
+	if err != nil {
+		e.fieldError(f, path, err)
+		return invalid
+	}
+	return v
+}
+
+func (e *executor) force(c *collectedField, th Thunk, path []any) (v any) {
+	defer func() {
+		if r := recover(); r != nil {
+			e.fieldError(c.fields[0], path, fmt.Errorf("internal error: %v", r))
+			v = invalid
+		}
+	}()
+	v, err := th()
+	if err != nil {
+		e.fieldError(c.fields[0], path, err)
+		return invalid
+	}
+	return v
+}
+
+// complete turns resolved values into response values according to typ.
+func (e *executor) complete(ctx context.Context, typ *typeRef, sels []selection, values []any, paths [][]any) []any {
+	if typ.nonNull {
+		out := e.completeNullable(ctx, typ.nullable(), sels, values, paths)
+		for i, v := range out {
+			if isNull(v) {
+				e.errs = append(e.errs, &Error{Message: "Cannot return null for non-nullable field", Path: paths[i]})
+				out[i] = invalid
+			}
+		}
+		return out
+	}
+	out := e.completeNullable(ctx, typ, sels, values, paths)
+	for i, v := range out {
+		if v == invalid {
+			out[i] = nil
+		}
+	}
+	return out
+}
+
+// completeNullable completes values of a nullable type. Entries stay invalid
+// when a non-null part of them is null.
+func (e *executor) completeNullable(ctx context.Context, typ *typeRef, sels []selection, values []any, paths [][]any) []any {
+	out := make([]any, len(values))
+	if typ.elem != nil {
+		type slot struct{ list, index int }
+		var items []any
+		var itemPaths [][]any
+		var slots []slot
+		for i, v := range values {
+			if isNull(v) || v == invalid {
+				out[i] = v
+				continue
+			}
+			list, ok := toList(v)
+			if !ok {
+				e.errs = append(e.errs, &Error{Message: "expected a list", Path: paths[i]})
+				out[i] = invalid
+				continue
+			}
+			out[i] = make([]any, len(list))
+			for j, item := range list {
+				items = append(items, item)
+				itemPaths = append(itemPaths, appendPath(paths[i], j))
+				slots = append(slots, slot{i, j})
+			}
+		}
+		for k, v := range e.complete(ctx, typ.elem, sels, items, itemPaths) {
+			s := slots[k]
+			if v == invalid {
+				out[s.list] = invalid
+			} else if list, ok := out[s.list].([]any); ok {
+				list[s.index] = v
+			}
+		}
+		return out
+	}
+
+	t := e.schema.types[typ.name]
+	if t.kind == kindObject {
+		var sources []any
+		var objPaths [][]any
+		var owners []int
+		for i, v := range values {
+			if isNull(v) || v == invalid {
+				out[i] = v
+				continue
+			}
+			sources = append(sources, v)
+			objPaths = append(objPaths, paths[i])
+			owners = append(owners, i)
+		}
+		if len(sources) > 0 {
+			for k, v := range e.executeObjects(ctx, t, sels, sources, objPaths, false) {
+				out[owners[k]] = v
+			}
+		}
+		return out
+	}
+	for i, v := range values {
+		if isNull(v) || v == invalid {
+			out[i] = v
+			continue
+		}
+		s, err := serialize(t, v)
+		if err != nil {
+			e.errs = append(e.errs, &Error{Message: err.Error(), Path: paths[i]})
+			out[i] = invalid
+			continue
+		}
+		out[i] = s
+	}
+	return out
+}
+
+func serialize(t *typeDef, v any) (any, error) {
+	if n, ok := v.(json.Number); ok {
+		if i, err := n.Int64(); err == nil {
+			v = i
+		} else {
+			f, _ := n.Float64()
+			v = f
+		}
+	}
+	rv := reflect.ValueOf(v)
+	switch t.name {
+	case "Int":
+		switch {
+		case rv.CanInt():
+			return rv.Int(), nil
+		case rv.CanUint():
+			return int64(rv.Uint()), nil
+		case rv.CanFloat() && rv.Float() == float64(int64(rv.Float())):
+			return int64(rv.Float()), nil
+		}
+	case "Float":
+		switch {
+		case rv.CanInt():
+			return float64(rv.Int()), nil
+		case rv.CanFloat():
+			return rv.Float(), nil
+		}
+	case "String", "ID":
+		switch {
+		case rv.Kind() == reflect.String:
+			return rv.String(), nil
+		case t.name == "ID" && rv.CanInt():
+			return fmt.Sprint(rv.Int()), nil
+		}
+	case "Boolean":
+		if rv.Kind() == reflect.Bool {
+			return rv.Bool(), nil
+		}
+	default:
+		if t.kind == kindEnum {
+			if s, ok := v.(string); ok && slices.Contains(t.enumValues, s) {
+				return s, nil
+			}
+			break
+		}
+		// Custom scalars are passed through as JSON
+		return v, nil
+	}
+	return nil, fmt.Errorf("cannot represent %v as %s", v, t.name)
+}
+
+// defaultResolver reads a field from a decoded JSON object, trying the field
+// name as given and in snake_case.
+func defaultResolver(name string) FieldResolver {
+	snake := toSnake(name)
+	return func(ctx context.Context, p ResolveParams) (any, error) {
+		m, ok := p.Source.(map[string]any)
+		if !ok {
+			return nil, nil
+		}
+		if v, ok := m[name]; ok {
+			return v, nil
+		}
+		return m[snake], nil
+	}
+}
+
+func toSnake(s string) string {
+	var b strings.Builder
+	for i, r := range s {
+		if unicode.IsUpper(r) {
+			if i > 0 {
+				b.WriteByte('_')
+			}
+			r = unicode.ToLower(r)
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+func toList(v any) ([]any, bool) {
+	if list, ok := v.([]any); ok {
+		return list, true
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return nil, false
+	}
+	list := make([]any, rv.Len())
+	for i := range list {
+		list[i] = rv.Index(i).Interface()
+	}
+	return list, true
+}
+
+// isNull reports a nil value, including typed nils such as a nil map.
+func isNull(v any) bool {
+	if v == nil {
+		return true
+	}
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Map, reflect.Pointer, reflect.Slice, reflect.Interface:
+		return rv.IsNil()
+	}
+	return false
+}
+
+func appendPath(path []any, elem any) []any {
+	return append(path[:len(path):len(path)], elem)
+}
+
+// orderedMap is a response object; its keys keep the order of the query.
+type orderedMap struct {
+	keys   []string
+	values []any
+}
+
+func (m *orderedMap) set(key string, v any) {
+	m.keys = append(m.keys, key)
+	m.values = append(m.values, v)
+}
+
+func (m *orderedMap) hasInvalid() bool {
+	for _, v := range m.values {
+		if v == invalid {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *orderedMap) MarshalJSON() ([]byte, error) {
+	var b bytes.Buffer
+	b.WriteByte('{')
+	for i, k := range m.keys {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		key, _ := json.Marshal(k)
+		b.Write(key)
+		b.WriteByte(':')
+		v, err := json.Marshal(m.values[i])
+		if err != nil {
+			return nil, err
+		}
+		b.Write(v)
+	}
+	b.WriteByte('}')
+	return b.Bytes(), nil
+}
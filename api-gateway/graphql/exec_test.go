@@ -0,0 +1,439 @@
+package graphql
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"sync"
+	"testing"
+)
+
+const testSDL = `
+enum Color { RED GREEN }
+
+input ProductInput {
+  name: String!
+  price: Float = 1.5
+  tags: [String!]
+}
+
+type Product {
+  id: ID!
+  name: String
+  unitPrice: Float
+  color: Color
+  owner: User
+  strictOwner: User!
+}
+
+type User {
+  id: ID!
+  name: String!
+}
+
+type Query {
+  product(id: ID!): Product
+  products(limit: Int = 2): [Product!]
+  echo(input: ProductInput, color: Color, ids: [ID!], n: Int): String
+  fail: String
+  failHard: String!
+  panics: String
+  slow(name: String!): String
+}
+
+type Mutation {
+  step(name: String!): String
+}
+`
+
+type ctxKey struct{}
+
+// testEnv is the state behind testSchema's resolvers.
+type testEnv struct {
+	mu      sync.Mutex
+	log     []string
+	fetches [][]string
+}
+
+func (env *testEnv) record(s string) {
+	env.mu.Lock()
+	defer env.mu.Unlock()
+	env.log = append(env.log, s)
+}
+
+var testProducts = []map[string]any{
+	{"id": "1", "name": "Lamp", "unit_price": 12.5, "color": "RED", "owner_id": "u1"},
+	{"id": "2", "name": "Desk", "unit_price": 80, "color": "GREEN", "owner_id": "u2"},
+	{"id": "3", "name": nil, "unit_price": 3, "color": "BLUE", "owner_id": "u1"},
+	{"id": "4", "name": "Chair", "unit_price": 40, "owner_id": "gone"},
+}
+
+var testUsers = map[string]map[string]any{
+	"u1": {"id": "u1", "name": "Ann"},
+	"u2": {"id": "u2", "name": nil},
+}
+
+func testSchema(t *testing.T) (*Schema, *testEnv) {
+	t.Helper()
+	s, err := ParseSchema(testSDL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	env := &testEnv{}
+	s.Resolve("Query", "product", func(ctx context.Context, p ResolveParams) (any, error) {
+		for _, prod := range testProducts {
+			if prod["id"] == p.Args["id"] {
+				return prod, nil
+			}
+		}
+		return nil, nil
+	})
+	s.Resolve("Query", "products", func(ctx context.Context, p ResolveParams) (any, error) {
+		return testProducts[:p.Args["limit"].(int)], nil
+	})
+	s.Resolve("Query", "echo", func(ctx context.Context, p ResolveParams) (any, error) {
+		b, err := json.Marshal(p.Args)
+		return string(b), err
+	})
+	s.Resolve("Query", "fail", func(ctx context.Context, p ResolveParams) (any, error) {
+		return nil, errors.New("boom")
+	})
+	s.Resolve("Query", "failHard", func(ctx context.Context, p ResolveParams) (any, error) {
+		return nil, errors.New("hard boom")
+	})
+	s.Resolve("Query", "panics", func(ctx context.Context, p ResolveParams) (any, error) {
+		panic("oops")
+	})
+	slow := func(ctx context.Context, p ResolveParams) (any, error) {
+		name := p.Args["name"].(string)
+		env.record("start " + name)
+		return Thunk(func() (any, error) {
+			env.record("done " + name)
+			return name, nil
+		}), nil
+	}
+	s.Resolve("Query", "slow", slow)
+	s.Resolve("Mutation", "step", slow)
+	owner := func(ctx context.Context, p ResolveParams) (any, error) {
+		loader := ctx.Value(ctxKey{}).(*Loader[string, map[string]any])
+		return loader.Load(ctx, p.Source.(map[string]any)["owner_id"].(string)), nil
+	}
+	s.Resolve("Product", "owner", owner)
+	s.Resolve("Product", "strictOwner", owner)
+	return s, env
+}
+
+// run executes req with a fresh user loader and returns the response as
+// JSON.
+func run(t *testing.T, s *Schema, env *testEnv, req Request) string {
+	t.Helper()
+	loader := NewLoader(func(ctx context.Context, keys []string) (map[string]map[string]any, error) {
+		env.mu.Lock()
+		env.fetches = append(env.fetches, keys)
+		env.mu.Unlock()
+		out := map[string]map[string]any{}
+		for _, k := range keys {
+			if u, ok := testUsers[k]; ok {
+				out[k] = u
+			}
+		}
+		return out, nil
+	})
+	ctx := context.WithValue(context.Background(), ctxKey{}, loader)
+	b, err := json.Marshal(s.Execute(ctx, req))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestExecute(t *testing.T) {
+	tests := []struct {
+		name string
+		req  Request
+		want string
+	}{
+		{
+			"default resolver reads snake_case keys",
+			Request{Query: `{ product(id: 1) { id name unitPrice color } }`},
+			`{"data":{"product":{"id":"1","name":"Lamp","unitPrice":12.5,"color":"RED"}}}`,
+		},
+		{
+			"aliases, fragments and __typename keep query order",
+			Request{Query: `
+				{ b: product(id: "2") { ...F t: __typename } a: product(id: "1") { ... on Product { name } id } }
+				fragment F on Product { name id }`},
+			`{"data":{"b":{"name":"Desk","id":"2","t":"Product"},"a":{"name":"Lamp","id":"1"}}}`,
+		},
+		{
+			"fields of one key are merged",
+			Request{Query: `{ product(id: 1) { id } product(id: 1) { name } }`},
+			`{"data":{"product":{"id":"1","name":"Lamp"}}}`,
+		},
+		{
+			"missing object is null",
+			Request{Query: `{ product(id: 9) { id } }`},
+			`{"data":{"product":null}}`,
+		},
+		{
+			"argument default",
+			Request{Query: `{ products { id } }`},
+			`{"data":{"products":[{"id":"1"},{"id":"2"}]}}`,
+		},
+		{
+			"skip and include",
+			Request{
+				Query:     `query($s: Boolean!) { product(id: 1) { id @skip(if: $s) name @include(if: $s) color @include(if: false) } }`,
+				Variables: map[string]any{"s": true},
+			},
+			`{"data":{"product":{"name":"Lamp"}}}`,
+		},
+		{
+			"resolver error nulls a nullable field",
+			Request{Query: `{ fail product(id: 1) { id } }`},
+			`{"data":{"fail":null,"product":{"id":"1"}},"errors":[{"message":"boom","locations":[{"line":1,"column":3}],"path":["fail"]}]}`,
+		},
+		{
+			"resolver error on a non-null root field nulls data",
+			Request{Query: `{ product(id: 1) { id } failHard }`},
+			`{"data":null,"errors":[{"message":"hard boom","locations":[{"line":1,"column":25}],"path":["failHard"]}]}`,
+		},
+		{
+			"null in a non-null field nulls the nearest nullable parent",
+			Request{Query: `{ products(limit: 3) { id name } product(id: 2) { id owner { name } } }`},
+			`{"data":{"products":[{"id":"1","name":"Lamp"},{"id":"2","name":"Desk"},{"id":"3","name":null}],"product":{"id":"2","owner":null}},"errors":[{"message":"Cannot return null for non-nullable field","path":["product","owner","name"]}]}`,
+		},
+		{
+			"null list item of a non-null type nulls the list",
+			Request{Query: `{ products(limit: 4) { id strictOwner { id } } }`},
+			`{"data":{"products":null},"errors":[{"message":"Cannot return null for non-nullable field","path":["products",3,"strictOwner"]}]}`,
+		},
+		{
+			"enum values outside the type are errors",
+			Request{Query: `{ product(id: 3) { color } }`},
+			`{"data":{"product":{"color":null}},"errors":[{"message":"cannot represent BLUE as Color","path":["product","color"]}]}`,
+		},
+		{
+			"panicking resolver",
+			Request{Query: `{ panics }`},
+			`{"data":{"panics":null},"errors":[{"message":"internal error: oops","locations":[{"line":1,"column":3}],"path":["panics"]}]}`,
+		},
+		{
+			"operation picked by name",
+			Request{Query: `query A { product(id: 1) { id } } query B { product(id: 2) { id } }`, OperationName: "B"},
+			`{"data":{"product":{"id":"2"}}}`,
+		},
+		{
+			"several operations without a name",
+			Request{Query: `query A { fail } query B { fail }`},
+			`{"errors":[{"message":"operationName is required when the document has several operations"}]}`,
+		},
+		{
+			"syntax errors are reported before execution",
+			Request{Query: `{ fail`},
+			`{"errors":[{"message":"Syntax Error: expected name, found \"\u003cEOF\u003e\"","locations":[{"line":1,"column":7}]}]}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, env := testSchema(t)
+			if got := run(t, s, env, tt.req); got != tt.want {
+				t.Errorf("got  %s\nwant %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteVariables(t *testing.T) {
+	const query = `query($in: ProductInput, $c: Color = GREEN, $ids: [ID!], $n: Int) { echo(input: $in, color: $c, ids: $ids, n: $n) }`
+	tests := []struct {
+		name string
+		vars map[string]any
+		want string
+	}{
+		{
+			"defaults of variables and input fields",
+			map[string]any{"in": map[string]any{"name": "x"}},
+			`{"color":"GREEN","input":{"name":"x","price":1.5}}`,
+		},
+		{
+			"single value is coerced to a list and numbers to IDs",
+			map[string]any{"ids": float64(7), "n": float64(3), "c": "RED"},
+			`{"color":"RED","ids":["7"],"n":3}`,
+		},
+		{
+			"explicit null",
+			map[string]any{"c": nil, "in": nil},
+			`{"color":null,"input":null}`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, env := testSchema(t)
+			var resp struct {
+				Data   struct{ Echo string }
+				Errors []*Error
+			}
+			if err := json.Unmarshal([]byte(run(t, s, env, Request{Query: query, Variables: tt.vars})), &resp); err != nil {
+				t.Fatal(err)
+			}
+			if len(resp.Errors) > 0 {
+				t.Fatalf("errors: %v", resp.Errors[0])
+			}
+			if resp.Data.Echo != tt.want {
+				t.Errorf("args = %s, want %s", resp.Data.Echo, tt.want)
+			}
+		})
+	}
+}
+
+func TestExecuteVariableErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		vars  map[string]any
+		want  string
+	}{
+		{`query($id: ID!) { product(id: $id) { id } }`, nil, "variable $id of type ID! was not provided"},
+		{`query($id: ID!) { product(id: $id) { id } }`, map[string]any{"id": nil}, "variable $id: expected a non-null ID!"},
+		{`query($n: Int) { echo(n: $n) }`, map[string]any{"n": 1.5}, "variable $n: cannot use 1.5 as Int"},
+		{`query($n: Int) { echo(n: $n) }`, map[string]any{"n": float64(1 << 40)}, "variable $n: cannot use 1.099511627776e+12 as Int"},
+		{`query($c: Color) { echo(color: $c) }`, map[string]any{"c": "BLUE"}, "variable $c: cannot use BLUE as Color"},
+		{`query($in: ProductInput) { echo(input: $in) }`, map[string]any{"in": map[string]any{}}, "variable $in: ProductInput.name of type String! is required"},
+		{`query($in: ProductInput) { echo(input: $in) }`, map[string]any{"in": map[string]any{"name": "x", "size": 1}}, `variable $in: unknown field "size" in ProductInput`},
+		{`query($in: ProductInput) { echo(input: $in) }`, map[string]any{"in": "x"}, "variable $in: expected an object for ProductInput"},
+		{`query($ids: [ID!]) { echo(ids: $ids) }`, map[string]any{"ids": []any{"1", nil}}, "variable $ids: expected a non-null ID!"},
+	}
+	for _, tt := range tests {
+		s, env := testSchema(t)
+		want := fmt.Sprintf(`{"errors":[{"message":%q}]}`, tt.want)
+		if got := run(t, s, env, Request{Query: tt.query, Variables: tt.vars}); got != want {
+			t.Errorf("%s %v:\ngot  %s\nwant %s", tt.query, tt.vars, got, want)
+		}
+	}
+}
+
+func TestExecuteArgumentErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		want  string
+	}{
+		{`{ echo(n: "3") }`, `argument \"n\": cannot use 3 as Int`},
+		{`{ echo(n: 3000000000) }`, `argument \"n\": cannot use 3000000000 as Int`},
+		{`{ echo(color: "RED") }`, `argument \"color\": cannot use RED as Color`},
+		{`{ echo(input: {price: 2}) }`, `argument \"input\": ProductInput.name of type String! is required`},
+		{`{ product(id: null) { id } }`, `argument \"id\": expected a non-null ID!`},
+	}
+	for _, tt := range tests {
+		s, env := testSchema(t)
+		want := `{"data":{"` + fieldName(tt.query) + `":null},"errors":[{"message":"` + tt.want + `","locations":[{"line":1,"column":3}],"path":["` + fieldName(tt.query) + `"]}]}`
+		if got := run(t, s, env, Request{Query: tt.query}); got != want {
+			t.Errorf("%s:\ngot  %s\nwant %s", tt.query, got, want)
+		}
+	}
+}
+
+// fieldName returns the first field name of a shorthand query.
+func fieldName(query string) string {
+	doc, err := parseQuery(query)
+	if err != nil {
+		panic(err)
+	}
+	return doc.operations[0].selections[0].(*field).name
+}
+
+func TestLoaderBatchesEachLevel(t *testing.T) {
+	s, env := testSchema(t)
+	got := run(t, s, env, Request{Query: `{
+		products(limit: 4) { id owner { id } }
+		product(id: 1) { owner { id } }
+	}`})
+	want := `{"data":{"products":[{"id":"1","owner":{"id":"u1"}},{"id":"2","owner":{"id":"u2"}},{"id":"3","owner":{"id":"u1"}},{"id":"4","owner":null}],"product":{"owner":{"id":"u1"}}}}`
+	if got != want {
+		t.Errorf("got  %s\nwant %s", got, want)
+	}
+	// Both root fields are at the same level, so every owner is fetched in
+	// one call and each key only once.
+	if len(env.fetches) != 1 {
+		t.Fatalf("fetched %d times: %v", len(env.fetches), env.fetches)
+	}
+	if keys := env.fetches[0]; !slices.Equal(keys, []string{"u1", "u2", "gone"}) {
+		t.Errorf("fetched keys %v", keys)
+	}
+}
+
+func TestLoader(t *testing.T) {
+	var calls [][]int
+	fetchErr := errors.New("down")
+	l := NewLoader(func(ctx context.Context, keys []int) (map[int]string, error) {
+		calls = append(calls, keys)
+		if slices.Contains(keys, 13) {
+			return nil, fetchErr
+		}
+		out := map[int]string{}
+		for _, k := range keys {
+			if k > 0 {
+				out[k] = fmt.Sprint("v", k)
+			}
+		}
+		return out, nil
+	})
+	ctx := context.Background()
+	l.Prime(5, "primed")
+	one, many, primed := l.Load(ctx, 1), l.LoadMany(ctx, []int{2, 1, -1}), l.Load(ctx, 5)
+
+	if v, err := many(); err != nil || !slices.Equal(v.([]any), []any{"v2", "v1"}) {
+		t.Errorf("LoadMany = %v, %v", v, err)
+	}
+	if v, err := one(); v != "v1" || err != nil {
+		t.Errorf("Load(1) = %v, %v", v, err)
+	}
+	if v, err := primed(); v != "primed" || err != nil {
+		t.Errorf("Load(5) = %v, %v", v, err)
+	}
+	if v, err := l.Load(ctx, -1)(); v != nil || err != nil {
+		t.Errorf("Load(-1) = %v, %v, want a cached null", v, err)
+	}
+	if len(calls) != 1 || !slices.Equal(calls[0], []int{1, 2, -1}) {
+		t.Errorf("fetch calls %v, want one for [1 2 -1]", calls)
+	}
+
+	if _, err := l.Load(ctx, 13)(); !errors.Is(err, fetchErr) {
+		t.Errorf("Load(13) error %v, want %v", err, fetchErr)
+	}
+}
+
+func TestMutationFieldsRunInOrder(t *testing.T) {
+	s, env := testSchema(t)
+	got := run(t, s, env, Request{Query: `mutation { a: step(name: "a") b: step(name: "b") }`})
+	if want := `{"data":{"a":"a","b":"b"}}`; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+	if want := []string{"start a", "done a", "start b", "done b"}; !slices.Equal(env.log, want) {
+		t.Errorf("mutation ran %v, want %v", env.log, want)
+	}
+
+	s, env = testSchema(t)
+	run(t, s, env, Request{Query: `{ a: slow(name: "a") b: slow(name: "b") }`})
+	if want := []string{"start a", "start b", "done a", "done b"}; !slices.Equal(env.log, want) {
+		t.Errorf("query ran %v, want %v", env.log, want)
+	}
+}
+
+func TestExecuteMutationWithoutMutationType(t *testing.T) {
+	s := MustParseSchema(`type Query { a: String }`)
+	resp := s.Execute(context.Background(), Request{Query: `mutation { a }`})
+	if len(resp.Errors) != 1 || resp.Errors[0].Message != "schema does not support mutations" || resp.Data != nil {
+		t.Errorf("response = %+v", resp)
+	}
+}
+
+func TestResolveUnknownFieldPanics(t *testing.T) {
+	defer func() {
+		if r := recover(); r != "graphql: no field Query.nope" {
+			t.Errorf("recovered %v", r)
+		}
+	}()
+	MustParseSchema(`type Query { a: String }`).Resolve("Query", "nope", nil)
+}
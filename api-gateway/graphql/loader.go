@@ -0,0 +1,102 @@
+package graphql
+
+import (
+	"context"
+	"sync"
+)
+
+// Loader batches the keys requested while one level of a query is resolved
+// into a single fetch, and caches results for the rest of the request. Create
+// one per request.
+type Loader[K comparable, V any] struct {
+	fetch func(ctx context.Context, keys []K) (map[K]V, error)
+
+	mu      sync.Mutex
+	pending []K
+	done    map[K]loaded[V]
+}
+
+type loaded[V any] struct {
+	value V
+	found bool
+	err   error
+}
+
+// NewLoader returns a loader around fetch, which returns the values it found
+// for keys. Keys missing from its result load as null.
+func NewLoader[K comparable, V any](fetch func(ctx context.Context, keys []K) (map[K]V, error)) *Loader[K, V] {
+	return &Loader[K, V]{fetch: fetch, done: map[K]loaded[V]{}}
+}
+
+// Load queues key and returns a Thunk for its value.
+func (l *Loader[K, V]) Load(ctx context.Context, key K) Thunk {
+	l.queue(key)
+	return func() (any, error) {
+		r := l.get(ctx, key)
+		if r.err != nil || !r.found {
+			return nil, r.err
+		}
+		return r.value, nil
+	}
+}
+
+// LoadMany queues keys and returns a Thunk for a list of their values; keys
+// that are not found are left out.
+func (l *Loader[K, V]) LoadMany(ctx context.Context, keys []K) Thunk {
+	for _, key := range keys {
+		l.queue(key)
+	}
+	return func() (any, error) {
+		values := make([]any, 0, len(keys))
+		for _, key := range keys {
+			r := l.get(ctx, key)
+			if r.err != nil {
+				return nil, r.err
+			}
+			if r.found {
+				values = append(values, r.value)
+			}
+		}
+		return values, nil
+	}
+}
+
+// Prime caches a value fetched some other way, such as from a list call.
+func (l *Loader[K, V]) Prime(key K, value V) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.done[key] = loaded[V]{value: value, found: true}
+}
+
+func (l *Loader[K, V]) queue(key K) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if _, ok := l.done[key]; !ok {
+		l.pending = append(l.pending, key)
+	}
+}
+
+// get returns the result for key, fetching every pending key first if it is
+// not known yet.
+func (l *Loader[K, V]) get(ctx context.Context, key K) loaded[V] {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if r, ok := l.done[key]; ok {
+		return r
+	}
+	keys := make([]K, 0, len(l.pending))
+	seen := map[K]bool{}
+	for _, k := range append(l.pending, key) {
+		if _, ok := l.done[k]; !ok && !seen[k] {
+			seen[k] = true
+			keys = append(keys, k)
+		}
+	}
+	l.pending = nil
+	values, err := l.fetch(ctx, keys)
+	for _, k := range keys {
+		v, found := values[k]
+		l.done[k] = loaded[V]{value: v, found: found, err: err}
+	}
+	return l.done[key]
+}
@@ -0,0 +1,188 @@
+package graphql
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestParseQuery(t *testing.T) {
+	doc, err := parseQuery(`
+		# a comment before the operation
+		query Product($id: ID!, $tags: [String!] = ["a", "b"]) @cached {
+			p: product(id: $id) {
+				...Fields
+				... on Product @include(if: true) { price }
+				name @skip(if: false)
+			}
+		}
+		mutation Remove { deleteProduct(id: "1") }
+		fragment Fields on Product { id, name }
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(doc.operations) != 2 {
+		t.Fatalf("got %d operations, want 2", len(doc.operations))
+	}
+	q, m := doc.operations[0], doc.operations[1]
+	if q.kind != "query" || q.name != "Product" || m.kind != "mutation" || m.name != "Remove" {
+		t.Errorf("operations = %s %s, %s %s", q.kind, q.name, m.kind, m.name)
+	}
+	if len(q.variables) != 2 {
+		t.Fatalf("got %d variables, want 2", len(q.variables))
+	}
+	if got := q.variables[0].typ.String(); got != "ID!" {
+		t.Errorf("$id has type %s, want ID!", got)
+	}
+	if got := q.variables[1].typ.String(); got != "[String!]" {
+		t.Errorf("$tags has type %s, want [String!]", got)
+	}
+	if def, ok := q.variables[1].defaultValue.([]value); !ok || len(def) != 2 {
+		t.Errorf("$tags default = %#v", q.variables[1].defaultValue)
+	}
+
+	f := q.selections[0].(*field)
+	if f.alias != "p" || f.name != "product" || f.responseKey() != "p" {
+		t.Errorf("field = %+v", f)
+	}
+	if v, ok := f.args[0].value.(*variable); !ok || v.name != "id" {
+		t.Errorf("argument id = %#v", f.args[0].value)
+	}
+	if spread, ok := f.selections[0].(*fragmentSpread); !ok || spread.name != "Fields" {
+		t.Errorf("first selection = %#v", f.selections[0])
+	}
+	if inline, ok := f.selections[1].(*inlineFragment); !ok || inline.typeCondition != "Product" || len(inline.directives) != 1 {
+		t.Errorf("second selection = %#v", f.selections[1])
+	}
+	if frag := doc.fragments["Fields"]; frag == nil || frag.typeCondition != "Product" || len(frag.selections) != 2 {
+		t.Errorf("fragment Fields = %#v", frag)
+	}
+}
+
+func TestParseQueryShorthand(t *testing.T) {
+	doc, err := parseQuery(`{ products { id } }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if op := doc.operations[0]; op.kind != "query" || op.name != "" {
+		t.Errorf("operation = %s %q, want an anonymous query", op.kind, op.name)
+	}
+}
+
+func TestParseValues(t *testing.T) {
+	doc, err := parseQuery(`{ f(i: -12, x: 1.5e3, s: "a\"bé\n", b: true, n: null, e: RED, l: [1 2], o: {k: "v"}) }`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	args := doc.operations[0].selections[0].(*field).args
+	want := []any{int64(-12), 1500.0, "a\"bé\n", true, nil, enumValue("RED")}
+	for i, w := range want {
+		if args[i].value != w {
+			t.Errorf("argument %s = %#v, want %#v", args[i].name, args[i].value, w)
+		}
+	}
+	if l, ok := args[6].value.([]value); !ok || len(l) != 2 || l[1] != int64(2) {
+		t.Errorf("list = %#v", args[6].value)
+	}
+	if o, ok := args[7].value.(*objectValue); !ok || o.fields[0].name != "k" || o.fields[0].value != "v" {
+		t.Errorf("object = %#v", args[7].value)
+	}
+}
+
+func TestParseQueryErrors(t *testing.T) {
+	tests := []struct {
+		query string
+		msg   string
+		line  int
+		col   int
+	}{
+		{`{ products { id }`, `Syntax Error: expected name, found "<EOF>"`, 1, 18},
+		{"{\n  a(x: $)\n}", `Syntax Error: expected name, found ")"`, 2, 9},
+		{`{ a(s: "open) }`, "Syntax Error: unterminated string", 1, 8},
+		{`{ a(s: "\q") }`, `Syntax Error: invalid escape \q`, 1, 8},
+		{`{ a(n: 1.) }`, "Syntax Error: invalid number", 1, 8},
+		{`{ a(n: 99999999999999999999) }`, "Syntax Error: invalid integer 99999999999999999999", 1, 8},
+		{`{ a.b }`, `Syntax Error: unexpected '.'`, 1, 4},
+		{`{ a ~ }`, `Syntax Error: unexpected character '~'`, 1, 5},
+		{`{ }`, `Syntax Error: expected a selection, found "}"`, 1, 3},
+		{`subscription { a }`, `Syntax Error: expected an operation or fragment, found "subscription"`, 1, 1},
+		{`fragment F Product { a }`, `Syntax Error: expected "on", found "Product"`, 1, 12},
+		{`fragment F on T { a } fragment F on T { b } { a }`, `Syntax Error: fragment "F" is defined more than once`, 1, 23},
+		{`query($a: Int = $b) { a }`, `Syntax Error: expected a value, found "$"`, 1, 17},
+		{`fragment F on T { a }`, "document contains no operations", 0, 0},
+	}
+	for _, tt := range tests {
+		_, err := parseQuery(tt.query)
+		if err == nil {
+			t.Errorf("%q: no error", tt.query)
+			continue
+		}
+		e := asError(err)
+		if e.Message != tt.msg {
+			t.Errorf("%q: error %q, want %q", tt.query, e.Message, tt.msg)
+		}
+		if tt.line == 0 {
+			if len(e.Locations) != 0 {
+				t.Errorf("%q: locations %v, want none", tt.query, e.Locations)
+			}
+			continue
+		}
+		if len(e.Locations) != 1 || e.Locations[0] != (Location{tt.line, tt.col}) {
+			t.Errorf("%q: locations %v, want %d:%d", tt.query, e.Locations, tt.line, tt.col)
+		}
+	}
+}
+
+func TestOperationType(t *testing.T) {
+	const doc = `query A { products { id } } mutation B { deleteProduct(id: "1") }`
+	tests := []struct {
+		req  Request
+		want string
+		err  string
+	}{
+		{Request{Query: `{ products { id } }`}, "query", ""},
+		{Request{Query: "# leading comment\nmutation { deleteProduct(id: \"1\") }"}, "mutation", ""},
+		{Request{Query: doc, OperationName: "A"}, "query", ""},
+		{Request{Query: doc, OperationName: "B"}, "mutation", ""},
+		{Request{Query: doc}, "", "operationName is required"},
+		{Request{Query: doc, OperationName: "C"}, "", `unknown operation "C"`},
+		{Request{Query: `{`}, "", "Syntax Error"},
+	}
+	for _, tt := range tests {
+		got, err := OperationType(tt.req)
+		if tt.err != "" {
+			if err == nil || !strings.Contains(err.Error(), tt.err) {
+				t.Errorf("%q/%q: error %v, want %q", tt.req.Query, tt.req.OperationName, err, tt.err)
+			}
+			continue
+		}
+		if err != nil || got != tt.want {
+			t.Errorf("%q/%q = %q, %v, want %q", tt.req.Query, tt.req.OperationName, got, err, tt.want)
+		}
+	}
+}
+
+func TestParseSchema(t *testing.T) {
+	tests := []struct {
+		sdl string
+		err string
+	}{
+		{`type Query { a: String }`, ""},
+		{`schema { query: Root } type Root { a: String }`, ""},
+		{`type Query { a: Missing }`, "field Query.a has invalid type Missing"},
+		{`input In { a: Int } type Query { a: In }`, "field Query.a has invalid type In"},
+		{`type Out { a: Int } type Query { a(o: Out): Int }`, "Query.a(o) has invalid input type Out"},
+		{`type Query { a: Int } type Query { b: Int }`, "type Query is defined more than once"},
+		{`type Mutation { a: Int }`, "root type Query is not an object type"},
+		{`interface Node { id: ID }`, `unsupported definition "interface"`},
+	}
+	for _, tt := range tests {
+		_, err := ParseSchema(tt.sdl)
+		switch {
+		case tt.err == "" && err != nil:
+			t.Errorf("%q: %v", tt.sdl, err)
+		case tt.err != "" && (err == nil || err.Error() != tt.err):
+			t.Errorf("%q: error %v, want %q", tt.sdl, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,333 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+)
+
+type kind int
+
+const (
+	kindScalar kind = iota
+	kindObject
+	kindInput
+	kindEnum
+)
+
+type typeDef struct {
+	kind        kind
+	name        string
+	fields      map[string]*fieldDef
+	inputFields []*inputValueDef
+	enumValues  []string
+}
+
+type fieldDef struct {
+	name    string
+	args    []*inputValueDef
+	typ     *typeRef
+	resolve FieldResolver
+}
+
+type inputValueDef struct {
+	name         string
+	typ          *typeRef
+	defaultValue value
+	hasDefault   bool
+}
+
+// ResolveParams is passed to field resolvers. Source is the value of the
+// parent object; Args holds the field arguments coerced to Go values: string
+// for String, ID and enums, int for Int, float64 for Float, bool, []any for
+// lists and map[string]any for input objects. Custom scalars arrive as the
+// decoded JSON.
+type ResolveParams struct {
+	Source any
+	Args   map[string]any
+}
+
+// FieldResolver returns the value of a field. It may return a Thunk to defer
+// the work until every field at the same depth has been resolved, which is
+// how loaders batch their fetches.
+type FieldResolver func(ctx context.Context, p ResolveParams) (any, error)
+
+// Thunk is a deferred field value.
+type Thunk func() (any, error)
+
+// Schema is an executable schema: types parsed from SDL plus the resolvers
+// bound to their fields. Fields without a resolver read the same-named key,
+// in snake_case, of a map[string]any source.
+type Schema struct {
+	types    map[string]*typeDef
+	query    string
+	mutation string
+	sdl      string
+}
+
+// ParseSchema parses type, input, enum, scalar and schema definitions.
+// Interfaces, unions and directives definitions are not supported.
+func ParseSchema(sdl string) (*Schema, error) {
+	p, err := newParser(sdl)
+	if err != nil {
+		return nil, err
+	}
+	s := &Schema{types: map[string]*typeDef{}, sdl: sdl}
+	for _, name := range []string{"Int", "Float", "String", "Boolean", "ID"} {
+		s.types[name] = &typeDef{kind: kindScalar, name: name}
+	}
+	for p.tok.kind != tokEOF {
+		if err := p.description(); err != nil {
+			return nil, err
+		}
+		keyword, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if keyword == "schema" {
+			if err := s.parseSchemaDef(p); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		name, err := p.name()
+		if err != nil {
+			return nil, err
+		}
+		if _, dup := s.types[name]; dup {
+			return nil, fmt.Errorf("type %s is defined more than once", name)
+		}
+		if _, err := p.directives(); err != nil {
+			return nil, err
+		}
+		t := &typeDef{name: name}
+		switch keyword {
+		case "scalar":
+			t.kind = kindScalar
+		case "type":
+			t.kind = kindObject
+			err = p.fieldDefs(t)
+		case "input":
+			t.kind = kindInput
+			err = p.inputFieldDefs(t)
+		case "enum":
+			t.kind = kindEnum
+			err = p.enumValueDefs(t)
+		default:
+			return nil, fmt.Errorf("unsupported definition %q", keyword)
+		}
+		if err != nil {
+			return nil, err
+		}
+		s.types[name] = t
+	}
+	if s.query == "" {
+		s.query = "Query"
+	}
+	if _, ok := s.types["Mutation"]; ok && s.mutation == "" {
+		s.mutation = "Mutation"
+	}
+	return s, s.check()
+}
+
+// MustParseSchema is ParseSchema for schemas embedded in the program.
+func MustParseSchema(sdl string) *Schema {
+	s, err := ParseSchema(sdl)
+	if err != nil {
+		panic("graphql: " + err.Error())
+	}
+	return s
+}
+
+// Resolve binds fn to a field. Binding a field the schema does not define is
+// a programming error and panics.
+func (s *Schema) Resolve(typeName, fieldName string, fn FieldResolver) {
+	t, ok := s.types[typeName]
+	if !ok || t.kind != kindObject || t.fields[fieldName] == nil {
+		panic(fmt.Sprintf("graphql: no field %s.%s", typeName, fieldName))
+	}
+	t.fields[fieldName].resolve = fn
+}
+
+// SDL returns the schema source.
+func (s *Schema) SDL() string {
+	return s.sdl
+}
+
+func (s *Schema) parseSchemaDef(p *parser) error {
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for !p.peek("}") {
+		op, err := p.name()
+		if err != nil {
+			return err
+		}
+		if err := p.expect(":"); err != nil {
+			return err
+		}
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		switch op {
+		case "query":
+			s.query = name
+		case "mutation":
+			s.mutation = name
+		default:
+			return fmt.Errorf("unsupported operation type %q", op)
+		}
+	}
+	return p.advance()
+}
+
+// check makes sure every referenced type exists and has the right kind.
+func (s *Schema) check() error {
+	for _, name := range []string{s.query, s.mutation} {
+		if t := s.types[name]; name != "" && (t == nil || t.kind != kindObject) {
+			return fmt.Errorf("root type %s is not an object type", name)
+		}
+	}
+	for _, t := range s.types {
+		for _, f := range t.fields {
+			if ft := s.named(f.typ); ft == nil || ft.kind == kindInput {
+				return fmt.Errorf("field %s.%s has invalid type %s", t.name, f.name, f.typ)
+			}
+			if err := s.checkInputs(t.name+"."+f.name, f.args); err != nil {
+				return err
+			}
+		}
+		if err := s.checkInputs(t.name, t.inputFields); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (s *Schema) checkInputs(owner string, defs []*inputValueDef) error {
+	for _, d := range defs {
+		if it := s.named(d.typ); it == nil || it.kind == kindObject {
+			return fmt.Errorf("%s(%s) has invalid input type %s", owner, d.name, d.typ)
+		}
+	}
+	return nil
+}
+
+// named returns the type definition at the bottom of t.
+func (s *Schema) named(t *typeRef) *typeDef {
+	for t.elem != nil {
+		t = t.elem
+	}
+	return s.types[t.name]
+}
+
+// description skips an optional description string.
+func (p *parser) description() error {
+	if p.tok.kind == tokString {
+		return p.advance()
+	}
+	return nil
+}
+
+func (p *parser) fieldDefs(t *typeDef) error {
+	t.fields = map[string]*fieldDef{}
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for !p.peek("}") {
+		if err := p.description(); err != nil {
+			return err
+		}
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		f := &fieldDef{name: name}
+		if ok, err := p.skip("("); err != nil {
+			return err
+		} else if ok {
+			for !p.peek(")") {
+				arg, err := p.inputValueDef()
+				if err != nil {
+					return err
+				}
+				f.args = append(f.args, arg)
+			}
+			if err := p.advance(); err != nil {
+				return err
+			}
+		}
+		if err := p.expect(":"); err != nil {
+			return err
+		}
+		if f.typ, err = p.typeRef(); err != nil {
+			return err
+		}
+		if _, err := p.directives(); err != nil {
+			return err
+		}
+		t.fields[name] = f
+	}
+	return p.advance()
+}
+
+func (p *parser) inputFieldDefs(t *typeDef) error {
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for !p.peek("}") {
+		d, err := p.inputValueDef()
+		if err != nil {
+			return err
+		}
+		t.inputFields = append(t.inputFields, d)
+	}
+	return p.advance()
+}
+
+func (p *parser) inputValueDef() (*inputValueDef, error) {
+	if err := p.description(); err != nil {
+		return nil, err
+	}
+	name, err := p.name()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(":"); err != nil {
+		return nil, err
+	}
+	d := &inputValueDef{name: name}
+	if d.typ, err = p.typeRef(); err != nil {
+		return nil, err
+	}
+	if ok, err := p.skip("="); err != nil {
+		return nil, err
+	} else if ok {
+		d.hasDefault = true
+		if d.defaultValue, err = p.value(true); err != nil {
+			return nil, err
+		}
+	}
+	_, err = p.directives()
+	return d, err
+}
+
+func (p *parser) enumValueDefs(t *typeDef) error {
+	if err := p.expect("{"); err != nil {
+		return err
+	}
+	for !p.peek("}") {
+		if err := p.description(); err != nil {
+			return err
+		}
+		name, err := p.name()
+		if err != nil {
+			return err
+		}
+		if _, err := p.directives(); err != nil {
+			return err
+		}
+		t.enumValues = append(t.enumValues, name)
+	}
+	return p.advance()
+}
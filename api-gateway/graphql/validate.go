@@ -0,0 +1,104 @@
+package graphql
+
+import "slices"
+
+// validate checks op against the schema before anything runs: fields and
+// arguments exist, leaf and object fields are selected correctly, fragments
+// exist and apply, and every variable used is declared.
+func (e *executor) validate(op *operation, root *typeDef) []*Error {
+	var errs []*Error
+	declared := map[string]bool{}
+	for _, v := range op.variables {
+		declared[v.name] = true
+		if t := e.schema.named(v.typ); t == nil || t.kind == kindObject {
+			errs = append(errs, e.errorAt(op.pos, "variable $%s has invalid input type %s", v.name, v.typ))
+		}
+	}
+	checkArgs := func(pos int, args []*argument) {
+		for _, a := range args {
+			walkVariables(a.value, func(name string) {
+				if !declared[name] {
+					errs = append(errs, e.errorAt(pos, "variable $%s is not defined", name))
+				}
+			})
+		}
+	}
+
+	var walk func(t *typeDef, sels []selection, visiting []string)
+	walk = func(t *typeDef, sels []selection, visiting []string) {
+		for _, sel := range sels {
+			switch sel := sel.(type) {
+			case *field:
+				for _, d := range sel.directives {
+					checkArgs(sel.pos, d.args)
+				}
+				if sel.name == "__typename" {
+					if len(sel.selections) > 0 {
+						errs = append(errs, e.errorAt(sel.pos, "field \"__typename\" must not have a selection"))
+					}
+					continue
+				}
+				def := t.fields[sel.name]
+				if def == nil {
+					errs = append(errs, e.errorAt(sel.pos, "Cannot query field %q on type %q", sel.name, t.name))
+					continue
+				}
+				checkArgs(sel.pos, sel.args)
+				for _, a := range sel.args {
+					if !slices.ContainsFunc(def.args, func(d *inputValueDef) bool { return d.name == a.name }) {
+						errs = append(errs, e.errorAt(sel.pos, "unknown argument %q on field %s.%s", a.name, t.name, sel.name))
+					}
+				}
+				for _, d := range def.args {
+					if d.typ.nonNull && !d.hasDefault && !slices.ContainsFunc(sel.args, func(a *argument) bool { return a.name == d.name }) {
+						errs = append(errs, e.errorAt(sel.pos, "argument %q of type %s is required on field %s.%s", d.name, d.typ, t.name, sel.name))
+					}
+				}
+				ft := e.schema.named(def.typ)
+				switch {
+				case ft.kind == kindObject && len(sel.selections) == 0:
+					errs = append(errs, e.errorAt(sel.pos, "field %q of type %s must have a selection of subfields", sel.name, def.typ))
+				case ft.kind != kindObject && len(sel.selections) > 0:
+					errs = append(errs, e.errorAt(sel.pos, "field %q must not have a selection since type %s has no subfields", sel.name, def.typ))
+				case ft.kind == kindObject:
+					walk(ft, sel.selections, visiting)
+				}
+			case *fragmentSpread:
+				frag := e.doc.fragments[sel.name]
+				switch {
+				case frag == nil:
+					errs = append(errs, e.errorAt(sel.pos, "unknown fragment %q", sel.name))
+				case slices.Contains(visiting, sel.name):
+					errs = append(errs, e.errorAt(sel.pos, "fragment %q spreads itself", sel.name))
+				case frag.typeCondition != t.name:
+					errs = append(errs, e.errorAt(sel.pos, "fragment %q on %s cannot be spread on %s", sel.name, frag.typeCondition, t.name))
+				default:
+					walk(t, frag.selections, append(visiting, sel.name))
+				}
+			case *inlineFragment:
+				if sel.typeCondition != "" && sel.typeCondition != t.name {
+					errs = append(errs, e.errorAt(sel.pos, "inline fragment on %s cannot be spread on %s", sel.typeCondition, t.name))
+					continue
+				}
+				walk(t, sel.selections, visiting)
+			}
+		}
+	}
+	walk(root, op.selections, nil)
+	return errs
+}
+
+func walkVariables(v value, fn func(string)) {
+	switch v := v.(type) {
+	case *variable:
+		fn(v.name)
+	case []value:
+		for _, item := range v {
+			walkVariables(item, fn)
+		}
+	case *objectValue:
+		for _, f := range v.fields {
+			walkVariables(f.value, fn)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+package graphql
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		query string
+		want  []string
+	}{
+		{`{ nope }`, []string{`1:3 Cannot query field "nope" on type "Query"`}},
+		{`{ product(id: 1) { id nope } }`, []string{`1:23 Cannot query field "nope" on type "Product"`}},
+		{`mutation { products { id } }`, []string{`1:12 Cannot query field "products" on type "Mutation"`}},
+		{`{ products(first: 1) { id } }`, []string{`1:3 unknown argument "first" on field Query.products`}},
+		{`{ product { id } }`, []string{`1:3 argument "id" of type ID! is required on field Query.product`}},
+		{`{ product(id: 1) }`, []string{`1:3 field "product" of type Product must have a selection of subfields`}},
+		{`{ product(id: 1) { id { x } } }`, []string{`1:20 field "id" must not have a selection since type ID! has no subfields`}},
+		{`{ __typename { x } }`, []string{`1:3 field "__typename" must not have a selection`}},
+		{`{ product(id: $id) { id } }`, []string{`1:3 variable $id is not defined`}},
+		{`{ fail @include(if: $on) }`, []string{`1:3 variable $on is not defined`}},
+		{`{ echo(input: {name: $n, tags: [$t]}) }`, []string{`1:3 variable $n is not defined`, `1:3 variable $t is not defined`}},
+		{`query($p: Product) { fail }`, []string{`1:1 variable $p has invalid input type Product`}},
+		{`query($p: Nope) { fail }`, []string{`1:1 variable $p has invalid input type Nope`}},
+		{`{ product(id: 1) { ...F } }`, []string{`1:20 unknown fragment "F"`}},
+		{`{ product(id: 1) { ...F } } fragment F on User { id }`, []string{`1:20 fragment "F" on User cannot be spread on Product`}},
+		{`{ product(id: 1) { ...F } } fragment F on Product { ...F }`, []string{`1:53 fragment "F" spreads itself`}},
+		{`{ product(id: 1) { ... on User { id } } }`, []string{`1:20 inline fragment on User cannot be spread on Product`}},
+		{
+			`{ nope product { owner { nope } } }`,
+			[]string{
+				`1:3 Cannot query field "nope" on type "Query"`,
+				`1:8 argument "id" of type ID! is required on field Query.product`,
+				`1:26 Cannot query field "nope" on type "User"`,
+			},
+		},
+	}
+	for _, tt := range tests {
+		s, _ := testSchema(t)
+		resp := s.Execute(context.Background(), Request{Query: tt.query})
+		if resp.Data != nil {
+			t.Errorf("%s: executed despite validation errors", tt.query)
+		}
+		var got []string
+		for _, e := range resp.Errors {
+			got = append(got, formatError(e))
+		}
+		if len(got) != len(tt.want) {
+			t.Errorf("%s:\ngot  %q\nwant %q", tt.query, got, tt.want)
+			continue
+		}
+		for i := range got {
+			if got[i] != tt.want[i] {
+				t.Errorf("%s:\ngot  %q\nwant %q", tt.query, got[i], tt.want[i])
+			}
+		}
+	}
+}
+
+func TestValidateAcceptsValidDocuments(t *testing.T) {
+	queries := []string{
+		`{ __typename product(id: 1) { __typename ...F ... { id } ... on Product { name } } } fragment F on Product { owner { name } }`,
+		`query($id: ID!, $skip: Boolean = false) { product(id: $id) { id @skip(if: $skip) } }`,
+		`query($in: ProductInput) { echo(input: $in) }`,
+		`{ products { ...A } } fragment A on Product { ...B } fragment B on Product { id }`,
+	}
+	for _, q := range queries {
+		s, _ := testSchema(t)
+		if errs := validateQuery(t, s, q); len(errs) > 0 {
+			t.Errorf("%s: %v", q, errs[0])
+		}
+	}
+}
+
+func validateQuery(t *testing.T, s *Schema, query string) []*Error {
+	t.Helper()
+	doc, err := parseQuery(query)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := &executor{schema: s, src: query, doc: doc}
+	return e.validate(doc.operations[0], s.types[s.query])
+}
+
+func formatError(e *Error) string {
+	if len(e.Locations) == 0 {
+		return e.Message
+	}
+	return fmt.Sprintf("%d:%d %s", e.Locations[0].Line, e.Locations[0].Column, e.Message)
+}
@@ -1,10 +1,18 @@
 package main
 
 import (
+	"api-gateway/auth"
 	"api-gateway/config"
+	"api-gateway/logging"
+	"api-gateway/metrics"
+	"api-gateway/render"
+	"api-gateway/tlsconfig"
+	"api-gateway/tracing"
+	"context"
 	"encoding/json"
 	"fmt"
 	"log"
+	"log/slog"
 	"net/http"
 	"net/http/httputil"
 	"net/url"
@@ -14,6 +22,7 @@ import (
 
 var cfg config.Config
 var err error
+var transport http.RoundTripper
 
 func main() {
 	// Load configuration
@@ -21,19 +30,85 @@ func main() {
 	if err != nil {
 		log.Fatal("Cannot load config:", err)
 	}
+	logging.New("api-gateway", cfg.LogLevel)
+	slog.Info("configuration loaded", "config", cfg)
+
+	// Set up tracing
+	shutdownTracing, err := tracing.Init(context.Background(), "api-gateway", cfg)
+	if err != nil {
+		logging.Fatal("cannot set up tracing", "error", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// Load TLS material
+	certs, err := tlsconfig.New(tlsconfig.Files{
+		CertFile: cfg.TLSCertFile,
+		KeyFile:  cfg.TLSKeyFile,
+		CAFile:   cfg.TLSCAFile,
+	})
+	if err != nil {
+		logging.Fatal("cannot load TLS files", "error", err)
+	}
+	go certs.Watch(context.Background(), cfg.TLSReloadInterval)
+
+	// Upstream calls present the gateway certificate and verify upstreams
+	// against the CA when TLS is configured (use https:// service URLs).
+	upstream := http.DefaultTransport.(*http.Transport).Clone()
+	if certs.ClientEnabled() {
+		upstream.TLSClientConfig = certs.ClientConfig()
+	}
+	transport = tracing.Transport(upstream)
+
+	// Bearer tokens become identity headers for upstream services
+	var verifier *auth.Verifier
+	if cfg.AuthJWTSecret != "" {
+		verifier = auth.NewVerifier(cfg.AuthJWTSecret)
+	} else {
+		slog.Warn("AUTH_JWT_SECRET is not set, all requests are anonymous")
+	}
+
 	// Initialize router
 	router := mux.NewRouter()
+	router.Use(tracing.Middleware("api-gateway"))
+	router.Use(logging.Middleware)
+	router.Use(metrics.Middleware)
+	router.Use(auth.Middleware(verifier))
+	router.NotFoundHandler = http.HandlerFunc(render.NotFound)
+	router.MethodNotAllowedHandler = http.HandlerFunc(render.MethodNotAllowed)
 
 	// Add health check endpoint
 	router.HandleFunc("/health", healthCheck).Methods("GET")
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
 
 	// Routes
-	router.PathPrefix("/products").HandlerFunc(handleProduct)
-	router.PathPrefix("/orders").HandlerFunc(handleOrder)
+	router.HandleFunc("/graphql", handleGraphQL).Methods("GET", "POST")
+	router.HandleFunc("/openapi.json", handleOpenAPI).Methods("GET")
+	// REST resources, by path or with a version prefix (/v2/orders); an
+	// unversioned path may name the version in Accept instead
+	for _, resource := range []struct {
+		prefix  string
+		handler http.HandlerFunc
+	}{
+		{"/products", handleProduct},
+		{"/categories", handleProduct},
+		{"/orders", handleOrder},
+		{"/carts", handleOrder},
+		{"/coupons", handleOrder},
+		{"/customers", handleOrder},
+		{"/payments", handleOrder},
+		{"/webhooks", handleOrder},
+	} {
+		router.PathPrefix(resource.prefix).HandlerFunc(versioned(resource.handler))
+		router.PathPrefix("/v{version:[0-9]+}" + resource.prefix).HandlerFunc(versioned(resource.handler))
+	}
+	router.PathPrefix("/inventory").HandlerFunc(handleInventory)
 
 	serverAddr := fmt.Sprintf("%s:%s", cfg.ServerHost, cfg.ServerPort)
-	log.Printf("API Gateway is running on %s", serverAddr)
-	log.Fatal(http.ListenAndServe(serverAddr, router))
+	slog.Info("API Gateway is running", "addr", serverAddr, "tls", certs.ServerEnabled())
+	server := &http.Server{Addr: serverAddr, Handler: router}
+	if err := certs.ListenAndServe(server); err != nil {
+		logging.Fatal("server stopped", "error", err)
+	}
 }
 
 func healthCheck(w http.ResponseWriter, r *http.Request) {
@@ -47,6 +122,8 @@ func handleProduct(w http.ResponseWriter, r *http.Request) {
 	// Using the service name defined in docker-compose
 	productServiceURL, _ := url.Parse(cfg.ProductServiceURL)
 	proxy := httputil.NewSingleHostReverseProxy(productServiceURL)
+	proxy.Transport = transport
+	proxy.ErrorHandler = proxyError
 	proxy.ServeHTTP(w, r)
 }
 
@@ -54,5 +131,24 @@ func handleOrder(w http.ResponseWriter, r *http.Request) {
 	// Using the service name defined in docker-compose
 	orderServiceURL, _ := url.Parse(cfg.OrderServiceURL)
 	proxy := httputil.NewSingleHostReverseProxy(orderServiceURL)
+	proxy.Transport = transport
+	proxy.ErrorHandler = proxyError
 	proxy.ServeHTTP(w, r)
 }
+
+// handleInventory proxies to inventory-service's HTTP/JSON transcoding of
+// the InventoryService gRPC API.
+func handleInventory(w http.ResponseWriter, r *http.Request) {
+	inventoryServiceURL, _ := url.Parse(cfg.InventoryServiceURL)
+	proxy := httputil.NewSingleHostReverseProxy(inventoryServiceURL)
+	proxy.Transport = transport
+	proxy.ErrorHandler = proxyError
+	proxy.ServeHTTP(w, r)
+}
+
+// proxyError logs a failed upstream call with the request's context, so the
+// line carries its request and trace IDs, and answers 502.
+func proxyError(w http.ResponseWriter, r *http.Request, err error) {
+	slog.ErrorContext(r.Context(), "upstream request failed", "upstream", r.URL.Host, "error", err)
+	render.Error(w, r, http.StatusBadGateway, "upstream service unavailable")
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"api-gateway/render"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+)
+
+// serviceOnlyPaths are described by each service but not reachable through
+// the gateway, which answers them itself or not at all.
+var serviceOnlyPaths = []string{"/health", "/metrics", "/openapi.json"}
+
+// componentSections are the parts of components merged from the services.
+var componentSections = []string{"schemas", "parameters", "responses", "headers"}
+
+// handleOpenAPI serves one OpenAPI document for the public REST API, merged
+// from the documents the product and order services publish. Paths and
+// components come from each service in turn; a component both define is
+// taken from the first. A service that cannot be reached fails the request
+// rather than serving a partial description.
+func handleOpenAPI(w http.ResponseWriter, r *http.Request) {
+	merged := map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       "Go-Microservices API",
+			"description": "Products, categories, orders, carts, coupons and webhooks behind the API gateway. A bearer token identifies the caller; the gateway sets the caller identity headers from it and drops any the client sends. A version is chosen by a path prefix, such as /v2/orders, or by Accept, such as application/vnd.gomicroservices.v2+json; without either, v1 is served.",
+		},
+		"servers": []any{map[string]any{"url": "/"}},
+		"paths":   map[string]any{},
+		"components": map[string]any{
+			"securitySchemes": map[string]any{
+				"bearerAuth": map[string]any{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+		"security": []any{map[string]any{"bearerAuth": []any{}}, map[string]any{}},
+	}
+	var tags []any
+	for _, base := range []string{cfg.ProductServiceURL, cfg.OrderServiceURL} {
+		doc, err := fetchOpenAPI(r.Context(), base)
+		if err != nil {
+			slog.ErrorContext(r.Context(), "cannot fetch API description", "upstream", base, "error", err)
+			render.Error(w, r, http.StatusBadGateway, "API description unavailable")
+			return
+		}
+		if info, ok := doc["info"].(map[string]any); ok {
+			if _, ok := merged["info"].(map[string]any)["version"]; !ok {
+				merged["info"].(map[string]any)["version"] = info["version"]
+			}
+		}
+		paths, _ := doc["paths"].(map[string]any)
+		for path, item := range paths {
+			if !slices.Contains(serviceOnlyPaths, path) {
+				merged["paths"].(map[string]any)[path] = item
+			}
+		}
+		components, _ := doc["components"].(map[string]any)
+		for _, section := range componentSections {
+			from, _ := components[section].(map[string]any)
+			if len(from) == 0 {
+				continue
+			}
+			to, ok := merged["components"].(map[string]any)[section].(map[string]any)
+			if !ok {
+				to = make(map[string]any)
+				merged["components"].(map[string]any)[section] = to
+			}
+			for name, v := range from {
+				if _, ok := to[name]; !ok {
+					to[name] = v
+				}
+			}
+		}
+		docTags, _ := doc["tags"].([]any)
+		for _, tag := range docTags {
+			if !slices.ContainsFunc(tags, func(t any) bool { return tagName(t) == tagName(tag) }) {
+				tags = append(tags, tag)
+			}
+		}
+	}
+	merged["tags"] = tags
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(merged)
+}
+
+// fetchOpenAPI gets the OpenAPI document a service serves.
+func fetchOpenAPI(ctx context.Context, base string) (map[string]any, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, strings.TrimRight(base, "/")+"/openapi.json", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+	resp, err := (&http.Client{Transport: transport}).Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	var doc map[string]any
+	dec := json.NewDecoder(resp.Body)
+	dec.UseNumber()
+	if err := dec.Decode(&doc); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func tagName(tag any) any {
+	if t, ok := tag.(map[string]any); ok {
+		return t["name"]
+	}
+	return nil
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"mime"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// versionPrefix matches the version prefix of a path, such as /v2/.
+var versionPrefix = regexp.MustCompile(`^/v[0-9]+/`)
+
+// vendorType matches the versioned media type, application/vnd.gomicroservices.v2+json.
+var vendorType = regexp.MustCompile(`^application/vnd\.gomicroservices\.v([0-9]+)\+json$`)
+
+// versioned routes a request for an unversioned path to the API version its
+// Accept header asks for by adding the version prefix the services serve. A
+// version in the path wins over one in Accept, and without either the
+// services answer with their first version.
+func versioned(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Add("Vary", "Accept")
+		if !versionPrefix.MatchString(r.URL.Path) {
+			if version, ok := acceptVersion(r.Header.Get("Accept")); ok {
+				prefix := "/v" + strconv.Itoa(version)
+				r.URL.Path = prefix + r.URL.Path
+				if r.URL.RawPath != "" {
+					r.URL.RawPath = prefix + r.URL.RawPath
+				}
+			}
+		}
+		next(w, r)
+	}
+}
+
+// acceptVersion returns the first API version named in an Accept header,
+// either as application/vnd.gomicroservices.v2+json or as a version
+// parameter, as in application/json; version=2.
+func acceptVersion(accept string) (int, bool) {
+	for _, part := range strings.Split(accept, ",") {
+		typ, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		if m := vendorType.FindStringSubmatch(typ); m != nil {
+			if version, err := strconv.Atoi(m[1]); err == nil && version > 0 {
+				return version, true
+			}
+		}
+		if v, ok := params["version"]; ok {
+			if version, err := strconv.Atoi(strings.TrimPrefix(v, "v")); err == nil && version > 0 {
+				return version, true
+			}
+		}
+	}
+	return 0, false
+}
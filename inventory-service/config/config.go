@@ -1,12 +1,41 @@
 package config
 
-import "github.com/caarlos0/env/v10"
+import (
+	"log/slog"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/caarlos0/env/v10"
+)
 
 type Config struct {
-	GrpcPort string `env:"GRPC_PORT" envDefault:"50051"`
-	GrpcHost string `env:"GRPC_HOST" envDefault:"0.0.0.0"`
-	AppEnv   string `env:"APP_ENV" envDefault:"development"`
-	LogLevel string `env:"LOG_LEVEL" envDefault:"info"`
+	GrpcPort             string        `env:"GRPC_PORT" envDefault:"50051"`
+	GrpcHost             string        `env:"GRPC_HOST" envDefault:"0.0.0.0"`
+	HttpPort             string        `env:"HTTP_PORT" envDefault:"8084"`
+	HttpHost             string        `env:"HTTP_HOST" envDefault:"0.0.0.0"`
+	MetricsPort          string        `env:"METRICS_PORT" envDefault:"9090"`
+	MetricsHost          string        `env:"METRICS_HOST" envDefault:"0.0.0.0"`
+	AppEnv               string        `env:"APP_ENV" envDefault:"development"`
+	LogLevel             string        `env:"LOG_LEVEL" envDefault:"info"`
+	OtelExporter         string        `env:"OTEL_EXPORTER" envDefault:"none"`
+	OtelEndpoint         string        `env:"OTEL_EXPORTER_OTLP_ENDPOINT" envDefault:"otel-collector:4317"`
+	OtelFilePath         string        `env:"OTEL_FILE_PATH" envDefault:"traces.json"`
+	OtelSampleRatio      float64       `env:"OTEL_SAMPLE_RATIO" envDefault:"1"`
+	TLSCertFile          string        `env:"TLS_CERT_FILE"`
+	TLSKeyFile           string        `env:"TLS_KEY_FILE"`
+	TLSCAFile            string        `env:"TLS_CA_FILE"`
+	TLSReloadInterval    time.Duration `env:"TLS_RELOAD_INTERVAL" envDefault:"1m"`
+	GrpcKeepaliveMinTime time.Duration `env:"GRPC_KEEPALIVE_MIN_TIME" envDefault:"10s"`
+	GrpcMaxConnectionAge time.Duration `env:"GRPC_MAX_CONNECTION_AGE" envDefault:"5m"`
+	EventBroker          string        `env:"EVENT_BROKER" envDefault:"inprocess"`
+	EventBrokerURL       string        `env:"EVENT_BROKER_URL"`
+	EventTopicPrefix     string        `env:"EVENT_TOPIC_PREFIX" envDefault:"events."`
+	EventRelayInterval   time.Duration `env:"EVENT_RELAY_INTERVAL" envDefault:"1s"`
+	EventRelayBatch      int           `env:"EVENT_RELAY_BATCH" envDefault:"100"`
+	EventOutboxLimit     int           `env:"EVENT_OUTBOX_LIMIT" envDefault:"10000"`
+	EventPublishTimeout  time.Duration `env:"EVENT_PUBLISH_TIMEOUT" envDefault:"5s"`
 }
 
 func LoadConfig() (Config, error) {
@@ -16,3 +45,38 @@ func LoadConfig() (Config, error) {
 	}
 	return cfg, nil
 }
+
+// LogValue renders the configuration for structured logs, keyed by
+// environment variable. Fields tagged secret:"true" and credentials embedded
+// in URLs are masked.
+func (c Config) LogValue() slog.Value {
+	v := reflect.ValueOf(c)
+	t := v.Type()
+	attrs := make([]slog.Attr, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("env"), ",")
+		if key == "" {
+			key = field.Name
+		}
+		value := v.Field(i).Interface()
+		if field.Tag.Get("secret") == "true" {
+			value = "[REDACTED]"
+		} else if s, ok := value.(string); ok {
+			value = redactURL(s)
+		}
+		attrs = append(attrs, slog.Any(key, value))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func redactURL(s string) string {
+	if !strings.Contains(s, "://") {
+		return s
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	return u.Redacted()
+}
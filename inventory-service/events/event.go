@@ -0,0 +1,39 @@
+// Package events records domain events in an outbox as part of the state
+// change that caused them, and relays them to a message broker.
+package events
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// Event types shared by all services.
+const (
+	ProductCreated = "ProductCreated"
+	StockAdjusted  = "StockAdjusted"
+	OrderPlaced    = "OrderPlaced"
+	OrderCancelled = "OrderCancelled"
+	// OrderStatusChanged accompanies every status transition, including the
+	// one to cancelled.
+	OrderStatusChanged = "OrderStatusChanged"
+)
+
+// Event is the envelope published for every domain event. ID is assigned when
+// the event is recorded and stays the same across redeliveries, so consumers
+// use it to drop duplicates.
+type Event struct {
+	ID          string          `json:"id"`
+	Type        string          `json:"type"`
+	Source      string          `json:"source"`
+	AggregateID string          `json:"aggregate_id"`
+	OccurredAt  time.Time       `json:"occurred_at"`
+	Data        json.RawMessage `json:"data"`
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
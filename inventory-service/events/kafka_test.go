@@ -0,0 +1,236 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// kafkaProxy stands in for a Kafka REST Proxy, keeping the records it
+// accepts by topic.
+type kafkaProxy struct {
+	t *testing.T
+
+	mu      sync.Mutex
+	topics  map[string][]kafkaRecord
+	failing int // requests still to answer with 500
+}
+
+func newKafkaProxy(t *testing.T) (*kafkaProxy, *httptest.Server) {
+	p := &kafkaProxy{t: t, topics: map[string][]kafkaRecord{}}
+	srv := httptest.NewServer(p)
+	t.Cleanup(srv.Close)
+	return p, srv
+}
+
+func (p *kafkaProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	topic, ok := strings.CutPrefix(r.URL.EscapedPath(), "/topics/")
+	if r.Method != http.MethodPost || !ok {
+		http.NotFound(w, r)
+		return
+	}
+	if ct := r.Header.Get("Content-Type"); ct != "application/vnd.kafka.json.v2+json" {
+		p.t.Errorf("Content-Type = %q", ct)
+	}
+	if accept := r.Header.Get("Accept"); accept != "application/vnd.kafka.v2+json" {
+		p.t.Errorf("Accept = %q", accept)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.failing > 0 {
+		p.failing--
+		w.WriteHeader(http.StatusInternalServerError)
+		io.WriteString(w, `{"error_code":50001,"message":"broker unavailable"}`)
+		return
+	}
+	var in kafkaRecords
+	if err := json.NewDecoder(r.Body).Decode(&in); err != nil {
+		w.WriteHeader(http.StatusUnprocessableEntity)
+		return
+	}
+	p.topics[topic] = append(p.topics[topic], in.Records...)
+	w.Header().Set("Content-Type", "application/vnd.kafka.v2+json")
+	io.WriteString(w, `{"offsets":[{"partition":0,"offset":`+strconv.Itoa(len(p.topics[topic])-1)+`}]}`)
+}
+
+func (p *kafkaProxy) records(topic string) []kafkaRecord {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return append([]kafkaRecord(nil), p.topics[topic]...)
+}
+
+func testEvent(id, typ, aggregateID string) Event {
+	return Event{
+		ID:          id,
+		Type:        typ,
+		Source:      "test",
+		AggregateID: aggregateID,
+		OccurredAt:  time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC),
+		Data:        json.RawMessage(`{"id":"` + aggregateID + `"}`),
+	}
+}
+
+func sameEvent(t *testing.T, got, want Event) {
+	t.Helper()
+	g, _ := json.Marshal(got)
+	w, _ := json.Marshal(want)
+	if string(g) != string(w) {
+		t.Errorf("event = %s, want %s", g, w)
+	}
+}
+
+func TestKafkaPublish(t *testing.T) {
+	proxy, srv := newKafkaProxy(t)
+	k, err := NewKafka(srv.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer k.Close()
+
+	ev := testEvent("e1", OrderPlaced, "o1")
+	if err := k.Publish(context.Background(), "events.OrderPlaced", ev); err != nil {
+		t.Fatal(err)
+	}
+	records := proxy.records("events.OrderPlaced")
+	if len(records) != 1 {
+		t.Fatalf("got %d records, want 1", len(records))
+	}
+	if records[0].Key != "o1" {
+		t.Errorf("key = %q, want the aggregate ID", records[0].Key)
+	}
+	sameEvent(t, records[0].Value, ev)
+
+	// Topics are escaped into the path
+	if err := k.Publish(context.Background(), "a/b c", ev); err != nil {
+		t.Fatal(err)
+	}
+	if n := len(proxy.records("a%2Fb%20c")); n != 1 {
+		t.Errorf("got %d records on the escaped topic, want 1", n)
+	}
+}
+
+func TestKafkaPublishErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		status  int
+		body    string
+		message string
+	}{
+		{"error status", http.StatusInternalServerError, `{"message":"broker unavailable"}`, "broker unavailable"},
+		{"unknown topic", http.StatusNotFound, `{"error_code":40401,"message":"Topic not found"}`, "404"},
+		{"partition error", http.StatusOK, `{"offsets":[{"partition":2,"offset":null,"error_code":1,"error":"leader not available"}]}`, "partition 2: leader not available"},
+		{"malformed response", http.StatusOK, `{"offsets":`, "bad response"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(tt.status)
+				io.WriteString(w, tt.body)
+			}))
+			defer srv.Close()
+			k, _ := NewKafka(srv.URL)
+			err := k.Publish(context.Background(), "events.OrderPlaced", testEvent("e1", OrderPlaced, "o1"))
+			if err == nil || !strings.Contains(err.Error(), tt.message) {
+				t.Errorf("error = %v, want one mentioning %q", err, tt.message)
+			}
+		})
+	}
+
+	t.Run("proxy down", func(t *testing.T) {
+		srv := httptest.NewServer(http.NotFoundHandler())
+		srv.Close()
+		k, _ := NewKafka(srv.URL)
+		if err := k.Publish(context.Background(), "events.OrderPlaced", testEvent("e1", OrderPlaced, "o1")); err == nil {
+			t.Error("published to a closed proxy")
+		}
+	})
+
+	t.Run("deadline", func(t *testing.T) {
+		block := make(chan struct{})
+		srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-block
+		}))
+		defer srv.Close()
+		defer close(block)
+		k, _ := NewKafka(srv.URL)
+		ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+		defer cancel()
+		if err := k.Publish(ctx, "events.OrderPlaced", testEvent("e1", OrderPlaced, "o1")); err == nil {
+			t.Error("publish outlived its context")
+		}
+	})
+}
+
+func TestNewKafka(t *testing.T) {
+	for _, u := range []string{"http://localhost:8082", "https://proxy.example.com/kafka/"} {
+		if _, err := NewKafka(u); err != nil {
+			t.Errorf("NewKafka(%q) = %v", u, err)
+		}
+	}
+	for _, u := range []string{"", "localhost:8082", "nats://localhost:4222", "http://", "http://%zz"} {
+		if _, err := NewKafka(u); err == nil {
+			t.Errorf("NewKafka(%q) accepted it", u)
+		}
+	}
+}
+
+// TestRelayToKafka runs the relay against a proxy that fails at first: every
+// event arrives once it recovers, in the order recorded, and leaves the
+// outbox.
+func TestRelayToKafka(t *testing.T) {
+	proxy, srv := newKafkaProxy(t)
+	proxy.failing = 3
+	k, _ := NewKafka(srv.URL)
+
+	outbox := NewOutbox("test")
+	for i := 0; i < 5; i++ {
+		if err := outbox.Record(OrderPlaced, "o"+strconv.Itoa(i), map[string]int{"n": i}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	recorded := outbox.Pending(10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	relay := &Relay{Outbox: outbox, Broker: k, TopicPrefix: "events.", Interval: 5 * time.Millisecond, Batch: 2, PublishTimeout: time.Second}
+	done := make(chan struct{})
+	go func() {
+		relay.Run(ctx)
+		close(done)
+	}()
+
+	deadline := time.Now().Add(5 * time.Second)
+	for outbox.Len() > 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := outbox.Len(); n != 0 {
+		t.Fatalf("%d events still pending", n)
+	}
+	// Recorded after the relay drained the outbox, so it must wake up
+	if err := outbox.Record(OrderCancelled, "o0", nil); err != nil {
+		t.Fatal(err)
+	}
+	for len(proxy.records("events.OrderCancelled")) == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	cancel()
+	<-done
+
+	records := proxy.records("events.OrderPlaced")
+	if len(records) != len(recorded) {
+		t.Fatalf("got %d records, want %d", len(records), len(recorded))
+	}
+	for i, r := range records {
+		sameEvent(t, r.Value, recorded[i])
+	}
+	if n := len(proxy.records("events.OrderCancelled")); n != 1 {
+		t.Errorf("got %d OrderCancelled records, want 1", n)
+	}
+}
@@ -0,0 +1,257 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/nats-io/nats-server/v2/server"
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// runNATS starts an embedded JetStream server on port, or any free port if
+// it is -1, with a stream capturing events.>.
+func runNATS(t *testing.T, port int) (*server.Server, jetstream.JetStream) {
+	t.Helper()
+	srv, err := server.NewServer(&server.Options{
+		Host:      "127.0.0.1",
+		Port:      port,
+		JetStream: true,
+		StoreDir:  t.TempDir(),
+		NoLog:     true,
+		NoSigs:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	go srv.Start()
+	if !srv.ReadyForConnections(5 * time.Second) {
+		t.Fatal("NATS server not ready")
+	}
+	t.Cleanup(srv.Shutdown)
+
+	conn, err := nats.Connect(srv.ClientURL())
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(conn.Close)
+	js, err := jetstream.New(conn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if _, err := js.CreateStream(ctx, jetstream.StreamConfig{Name: "EVENTS", Subjects: []string{"events.>"}}); err != nil {
+		t.Fatal(err)
+	}
+	return srv, js
+}
+
+func newNATS(t *testing.T, url string) *NATS {
+	t.Helper()
+	n, err := NewNATS(url)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { n.Close() })
+	return n
+}
+
+func TestNATSPublish(t *testing.T) {
+	srv, js := runNATS(t, -1)
+	n := newNATS(t, srv.ClientURL())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	ev := testEvent("e1", OrderPlaced, "o1")
+	if err := n.Publish(ctx, "events.OrderPlaced", ev); err != nil {
+		t.Fatal(err)
+	}
+	// The relay publishes again after a lost acknowledgement; JetStream
+	// keeps one copy
+	if err := n.Publish(ctx, "events.OrderPlaced", ev); err != nil {
+		t.Fatal(err)
+	}
+	if err := n.Publish(ctx, "events.OrderPlaced", testEvent("e2", OrderPlaced, "o2")); err != nil {
+		t.Fatal(err)
+	}
+
+	stream, err := js.Stream(ctx, "EVENTS")
+	if err != nil {
+		t.Fatal(err)
+	}
+	info, err := stream.Info(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.State.Msgs != 2 {
+		t.Errorf("stream holds %d messages, want 2", info.State.Msgs)
+	}
+	msg, err := stream.GetMsg(ctx, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.Subject != "events.OrderPlaced" {
+		t.Errorf("subject = %s", msg.Subject)
+	}
+	if id := msg.Header.Get(nats.MsgIdHdr); id != "e1" {
+		t.Errorf("%s = %q, want the event ID", nats.MsgIdHdr, id)
+	}
+	var got Event
+	if err := json.Unmarshal(msg.Data, &got); err != nil {
+		t.Fatal(err)
+	}
+	sameEvent(t, got, ev)
+}
+
+func TestNATSPublishWithoutStream(t *testing.T) {
+	srv, _ := runNATS(t, -1)
+	n := newNATS(t, srv.ClientURL())
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := n.Publish(ctx, "other.OrderPlaced", testEvent("e1", OrderPlaced, "o1")); err == nil {
+		t.Error("publish to a subject no stream captures succeeded")
+	}
+}
+
+// TestNATSServerLater starts the relay's connection before the server, as
+// happens when both come up together: publishes fail until it is reached.
+func TestNATSServerLater(t *testing.T) {
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	n := newNATS(t, "nats://127.0.0.1:"+strconv.Itoa(port))
+	ev := testEvent("e1", OrderPlaced, "o1")
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	err = n.Publish(ctx, "events.OrderPlaced", ev)
+	cancel()
+	if err == nil {
+		t.Fatal("published with no server")
+	}
+
+	runNATS(t, port)
+	deadline := time.Now().Add(10 * time.Second)
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+		err := n.Publish(ctx, "events.OrderPlaced", ev)
+		cancel()
+		if err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("still failing once the server is up: %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+}
+
+func TestNATSSubscribe(t *testing.T) {
+	srv, js := runNATS(t, -1)
+	n := newNATS(t, srv.ClientURL())
+
+	var mu sync.Mutex
+	var calls []string
+	failed := false
+	handled := make(chan struct{}, 10)
+	h := func(ctx context.Context, ev Event) error {
+		mu.Lock()
+		defer mu.Unlock()
+		calls = append(calls, ev.ID)
+		handled <- struct{}{}
+		if ev.ID == "e1" && !failed {
+			failed = true
+			return errors.New("not now")
+		}
+		return nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	done := make(chan error, 1)
+	go func() { done <- n.Subscribe(ctx, "events.StockAdjusted", "test-consumer", h) }()
+
+	// The consumer starts at new events, so wait for it before publishing
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := js.Consumer(context.Background(), "EVENTS", "test-consumer"); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("consumer never created")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	pctx, pcancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer pcancel()
+	for _, ev := range []Event{testEvent("e1", StockAdjusted, "p1"), testEvent("e2", StockAdjusted, "p2")} {
+		if err := n.Publish(pctx, "events.StockAdjusted", ev); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Not for this subscription
+	if err := n.Publish(pctx, "events.OrderPlaced", testEvent("e3", OrderPlaced, "o1")); err != nil {
+		t.Fatal(err)
+	}
+
+	// e1 fails once and is redelivered
+	for i := 0; i < 3; i++ {
+		select {
+		case <-handled:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("handler called %d times, want 3", i)
+		}
+	}
+
+	// Both were acknowledged in the end
+	consumer, err := js.Consumer(pctx, "EVENTS", "test-consumer")
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline = time.Now().Add(5 * time.Second)
+	for {
+		info, err := consumer.Info(pctx)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if info.NumAckPending == 0 && info.NumPending == 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("%d unacknowledged and %d pending", info.NumAckPending, info.NumPending)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	cancel()
+	if err := <-done; err != nil {
+		t.Errorf("Subscribe = %v", err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	count := map[string]int{}
+	for _, id := range calls {
+		count[id]++
+	}
+	if count["e1"] != 2 || count["e2"] != 1 || count["e3"] != 0 {
+		t.Errorf("handled %v, want e1 twice and e2 once", calls)
+	}
+}
+
+func TestNewNATS(t *testing.T) {
+	for _, u := range []string{"", "localhost:4222", "http://localhost:4222", "nats://"} {
+		if _, err := NewNATS(u); err == nil {
+			t.Errorf("NewNATS(%q) accepted it", u)
+		}
+	}
+}
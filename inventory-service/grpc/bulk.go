@@ -0,0 +1,183 @@
+package grpc
+
+import (
+	"errors"
+	"io"
+	"math"
+
+	"inventory-service/events"
+	inventory_pb "inventory-service/proto/inventory"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// maxHeldAdjustments caps the adjustments an all_or_nothing BulkAdjustStock
+// stream may carry, since they are held until it ends.
+const maxHeldAdjustments = 100000
+
+// errRolledBack is the outcome of valid adjustments of an all_or_nothing
+// stream that were not applied because another one failed.
+var errRolledBack = status.Error(codes.Aborted, "not applied: another adjustment in the stream failed")
+
+// BulkAdjustStock applies each adjustment as it arrives, unless the first
+// message asks for all_or_nothing: then the stream is held, played against a
+// scratch copy of the stock it touches and applied under one lock only if
+// every adjustment succeeds there.
+func (s *Server) BulkAdjustStock(stream inventory_pb.InventoryService_BulkAdjustStockServer) error {
+	var (
+		resp    inventory_pb.BulkAdjustStockResponse
+		held    []*inventory_pb.BulkAdjustStockRequest
+		atomic  bool
+		started bool
+	)
+	for {
+		req, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if !started {
+			atomic, started = req.AllOrNothing, true
+		}
+		if !atomic {
+			resp.Results = append(resp.Results, s.adjustOne(req))
+			continue
+		}
+		if len(held) == maxHeldAdjustments {
+			return status.Errorf(codes.ResourceExhausted, "an all_or_nothing stream carries at most %d adjustments", maxHeldAdjustments)
+		}
+		held = append(held, req)
+	}
+	if atomic {
+		var err error
+		if resp.Results, resp.RolledBack, err = s.adjustAll(held); err != nil {
+			return err
+		}
+	}
+	for _, result := range resp.Results {
+		if result.Success {
+			resp.Applied++
+		} else {
+			resp.Failed++
+		}
+	}
+	return stream.SendAndClose(&resp)
+}
+
+func (s *Server) adjustOne(req *inventory_pb.BulkAdjustStockRequest) *inventory_pb.AdjustmentResult {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	quantity, exists := s.ProductInventory.Inventory[req.ProductId]
+	next, err := planAdjustment(req, quantity, s.ProductInventory.Versions[req.ProductId], exists)
+	var version int64
+	if err == nil {
+		version, err = s.adjust(req.ProductId, next, "bulk", false)
+	}
+	return adjustmentResult(req.ProductId, next, version, err)
+}
+
+// adjustAll applies every adjustment or, reporting rolledBack, none. It only
+// fails if the StockAdjusted events cannot be recorded, which are recorded
+// together before any stock changes, so that then nothing is applied either.
+func (s *Server) adjustAll(reqs []*inventory_pb.BulkAdjustStockRequest) (results []*inventory_pb.AdjustmentResult, rolledBack bool, err error) {
+	type stock struct {
+		quantity int32
+		version  int64
+		exists   bool
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	scratch := make(map[string]stock)
+	planned := make([]stock, len(reqs))
+	recorded := make([]events.Entry, len(reqs))
+	results = make([]*inventory_pb.AdjustmentResult, len(reqs))
+	for i, req := range reqs {
+		current, ok := scratch[req.ProductId]
+		if !ok {
+			current.quantity, current.exists = s.ProductInventory.Inventory[req.ProductId]
+			current.version = s.ProductInventory.Versions[req.ProductId]
+		}
+		next, err := planAdjustment(req, current.quantity, current.version, current.exists)
+		if err != nil {
+			results[i] = adjustmentResult(req.ProductId, 0, 0, err)
+			rolledBack = true
+			continue
+		}
+		recorded[i] = stockAdjusted(req.ProductId, current.quantity, next, current.version+1, "bulk")
+		current.quantity, current.version = next, current.version+1
+		scratch[req.ProductId] = current
+		planned[i] = current
+	}
+	if rolledBack {
+		for i, req := range reqs {
+			if results[i] == nil {
+				results[i] = adjustmentResult(req.ProductId, 0, 0, errRolledBack)
+			}
+		}
+		return results, true, nil
+	}
+
+	if err := recordError(s.outbox.RecordAll(recorded...)); err != nil {
+		return nil, false, err
+	}
+	for i, req := range reqs {
+		s.apply(req.ProductId, planned[i].quantity, planned[i].version, false)
+		results[i] = adjustmentResult(req.ProductId, planned[i].quantity, planned[i].version, nil)
+	}
+	return results, false, nil
+}
+
+// planAdjustment returns the quantity req leaves the stock at, given the
+// stock's current quantity and version, or why req cannot be applied.
+func planAdjustment(req *inventory_pb.BulkAdjustStockRequest, quantity int32, version int64, exists bool) (int32, error) {
+	if req.ProductId == "" {
+		return 0, status.Error(codes.InvalidArgument, "product_id is required")
+	}
+	var next int64
+	switch change := req.Change.(type) {
+	case *inventory_pb.BulkAdjustStockRequest_Set:
+		if change.Set < 0 {
+			return 0, status.Errorf(codes.InvalidArgument, "cannot set stock to %d", change.Set)
+		}
+		next = int64(change.Set)
+	case *inventory_pb.BulkAdjustStockRequest_Delta:
+		next = int64(quantity) + int64(change.Delta)
+	default:
+		return 0, status.Error(codes.InvalidArgument, "either set or delta is required")
+	}
+	if !exists {
+		return 0, status.Error(codes.NotFound, "product not found")
+	}
+	if req.ExpectedVersion != 0 && req.ExpectedVersion != version {
+		return 0, status.Errorf(codes.Aborted, "stock of %s is at version %d, not %d", req.ProductId, version, req.ExpectedVersion)
+	}
+	if next < 0 {
+		return 0, status.Errorf(codes.FailedPrecondition, "stock of %s is %d, cannot take %d away", req.ProductId, quantity, -(next - int64(quantity)))
+	}
+	if next > math.MaxInt32 {
+		return 0, status.Errorf(codes.OutOfRange, "stock of %s would exceed %d", req.ProductId, math.MaxInt32)
+	}
+	return int32(next), nil
+}
+
+func adjustmentResult(productID string, quantity int32, version int64, err error) *inventory_pb.AdjustmentResult {
+	if err != nil {
+		st := status.Convert(err)
+		return &inventory_pb.AdjustmentResult{
+			ProductId: productID,
+			Code:      code.Code(st.Code()).String(),
+			Error:     st.Message(),
+		}
+	}
+	return &inventory_pb.AdjustmentResult{
+		ProductId: productID,
+		Success:   true,
+		Quantity:  quantity,
+		Version:   version,
+	}
+}
@@ -1,55 +1,158 @@
 package grpc
 
 import (
+	"inventory-service/metrics"
 	inventory_pb "inventory-service/proto/inventory"
 	"inventory-service/model"
 	"context"
 	"errors"
+	"inventory-service/events"
+	"sync"
+
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type Server struct {
 	inventory_pb.UnimplementedInventoryServiceServer
     ProductInventory model.ProductInventory
+
+	// mu guards ProductInventory; StockAdjusted events are recorded under it
+	// together with the change.
+	mu     sync.RWMutex
+	outbox *events.Outbox
 }
 
-func NewServer(productInventory model.ProductInventory) *Server {
+func NewServer(productInventory model.ProductInventory, outbox *events.Outbox) *Server {
+	if productInventory.Versions == nil {
+		productInventory.Versions = make(map[string]int64, len(productInventory.Inventory))
+	}
+	for productID := range productInventory.Inventory {
+		if productInventory.Versions[productID] == 0 {
+			productInventory.Versions[productID] = 1
+		}
+	}
 	return &Server{
 		ProductInventory: productInventory,
+		outbox:           outbox,
+	}
+}
+
+// checkVersion fails with Aborted unless expected is zero or the current
+// version of productID. The caller holds s.mu.
+func (s *Server) checkVersion(productID string, expected int64) error {
+	if current := s.ProductInventory.Versions[productID]; expected != 0 && expected != current {
+		return status.Errorf(codes.Aborted, "stock of %s is at version %d, not %d", productID, current, expected)
+	}
+	return nil
+}
+
+// adjust sets the stock of productID, or removes it if remove is set, bumps
+// its version and records StockAdjusted. The caller holds s.mu.
+func (s *Server) adjust(productID string, quantity int32, reason string, remove bool) (int64, error) {
+	previous := s.ProductInventory.Inventory[productID]
+	version := s.ProductInventory.Versions[productID] + 1
+	if err := recordError(s.outbox.RecordAll(stockAdjusted(productID, previous, quantity, version, reason))); err != nil {
+		return 0, err
+	}
+	s.apply(productID, quantity, version, remove)
+	return version, nil
+}
+
+// apply stores a recorded adjustment. The caller holds s.mu.
+func (s *Server) apply(productID string, quantity int32, version int64, remove bool) {
+	s.ProductInventory.Versions[productID] = version
+	if remove {
+		delete(s.ProductInventory.Inventory, productID)
+		metrics.DeleteStock(productID)
+	} else {
+		s.ProductInventory.Inventory[productID] = quantity
+		metrics.SetStock(productID, quantity)
+	}
+}
+
+func stockAdjusted(productID string, previous, quantity int32, version int64, reason string) events.Entry {
+	return events.Entry{Type: events.StockAdjusted, AggregateID: productID, Data: model.StockAdjustment{
+		ProductID: productID,
+		Previous:  previous,
+		Quantity:  quantity,
+		Delta:     quantity - previous,
+		Version:   version,
+		Reason:    reason,
+	}}
+}
+
+// recordError turns a failure to record stock events into a gRPC status.
+func recordError(err error) error {
+	if errors.Is(err, events.ErrOutboxFull) {
+		// Retryable, once the relay has caught up with the broker
+		return status.Errorf(codes.Unavailable, "cannot record stock event: %v", err)
 	}
+	if err != nil {
+		return status.Errorf(codes.Internal, "cannot record stock event: %v", err)
+	}
+	return nil
 }
 
 func (s *Server) CheckStock(ctx context.Context, req *inventory_pb.StockRequest) (*inventory_pb.StockResponse, error) {
-    quantity := s.ProductInventory.Inventory[req.ProductId]
+    s.mu.RLock()
+    defer s.mu.RUnlock()
+    quantity, exists := s.ProductInventory.Inventory[req.ProductId]
+    var version int64
+    if exists {
+        version = s.ProductInventory.Versions[req.ProductId]
+    }
     return &inventory_pb.StockResponse{
         ProductId: req.ProductId,
         Quantity:  quantity,
         InStock:   quantity > 0,
+        Version:   version,
     }, nil
 }
 
 func (s *Server) UpdateStock(ctx context.Context, req *inventory_pb.UpdateStockRequest) (*inventory_pb.StockResponse, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
     if _, exists := s.ProductInventory.Inventory[req.ProductId]; !exists {
-        return nil, errors.New("product not found")
+        return nil, status.Error(codes.NotFound, "product not found")
+    }
+    if err := s.checkVersion(req.ProductId, req.ExpectedVersion); err != nil {
+        return nil, err
     }
     
-    s.ProductInventory.Inventory[req.ProductId] = req.Quantity
+    version, err := s.adjust(req.ProductId, req.Quantity, "update", false)
+    if err != nil {
+        return nil, err
+    }
     return &inventory_pb.StockResponse{
         ProductId: req.ProductId,
         Quantity:  req.Quantity,
         InStock:   req.Quantity > 0,
+        Version:   version,
     }, nil
 }
 
 func (s *Server) AddStock(ctx context.Context, req *inventory_pb.AddStockRequest) (*inventory_pb.StockResponse, error) {
-    s.ProductInventory.Inventory[req.ProductId] = req.Quantity
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    if err := s.checkVersion(req.ProductId, req.ExpectedVersion); err != nil {
+        return nil, err
+    }
+    version, err := s.adjust(req.ProductId, req.Quantity, "add", false)
+    if err != nil {
+        return nil, err
+    }
     return &inventory_pb.StockResponse{
         ProductId: req.ProductId,
         Quantity:  req.Quantity,
         InStock:   req.Quantity > 0,
+        Version:   version,
     }, nil
 }
 
 func (s *Server) DeleteStock(ctx context.Context, req *inventory_pb.StockRequest) (*inventory_pb.DeleteResponse, error) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
     if _, exists := s.ProductInventory.Inventory[req.ProductId]; !exists {
         return &inventory_pb.DeleteResponse{
             Success: false,
@@ -57,9 +160,66 @@ func (s *Server) DeleteStock(ctx context.Context, req *inventory_pb.StockRequest
         }, nil
     }
     
-    delete(s.ProductInventory.Inventory, req.ProductId)
+    if _, err := s.adjust(req.ProductId, 0, "delete", true); err != nil {
+        return nil, err
+    }
     return &inventory_pb.DeleteResponse{
         Success: true,
         Message: "stock deleted successfully",
     }, nil
-}
\ No newline at end of file
+}
+
+func (s *Server) AddStockBatch(ctx context.Context, req *inventory_pb.AddStockBatchRequest) (*inventory_pb.StockBatchResponse, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, item := range req.Items {
+		if err := s.checkVersion(item.ProductId, item.ExpectedVersion); err != nil {
+			return nil, err
+		}
+	}
+	// Every event is recorded before any stock changes, so a batch whose
+	// events cannot all be recorded leaves the stock as it was
+	type stock struct {
+		quantity int32
+		version  int64
+	}
+	latest := make(map[string]stock)
+	recorded := make([]events.Entry, len(req.Items))
+	versions := make([]int64, len(req.Items))
+	for i, item := range req.Items {
+		current, ok := latest[item.ProductId]
+		if !ok {
+			current = stock{s.ProductInventory.Inventory[item.ProductId], s.ProductInventory.Versions[item.ProductId]}
+		}
+		versions[i] = current.version + 1
+		recorded[i] = stockAdjusted(item.ProductId, current.quantity, item.Quantity, versions[i], "add")
+		latest[item.ProductId] = stock{item.Quantity, versions[i]}
+	}
+	if err := recordError(s.outbox.RecordAll(recorded...)); err != nil {
+		return nil, err
+	}
+	resp := &inventory_pb.StockBatchResponse{Items: make([]*inventory_pb.StockResponse, 0, len(req.Items))}
+	for i, item := range req.Items {
+		version := versions[i]
+		s.apply(item.ProductId, item.Quantity, version, false)
+		resp.Items = append(resp.Items, &inventory_pb.StockResponse{
+			ProductId: item.ProductId,
+			Quantity:  item.Quantity,
+			InStock:   item.Quantity > 0,
+			Version:   version,
+		})
+	}
+	return resp, nil
+}
+
+func (s *Server) CheckStockBatch(ctx context.Context, req *inventory_pb.StockBatchRequest) (*inventory_pb.StockBatchResponse, error) {
+	resp := &inventory_pb.StockBatchResponse{Items: make([]*inventory_pb.StockResponse, 0, len(req.ProductIds))}
+	for _, productID := range req.ProductIds {
+		stock, err := s.CheckStock(ctx, &inventory_pb.StockRequest{ProductId: productID})
+		if err != nil {
+			return nil, err
+		}
+		resp.Items = append(resp.Items, stock)
+	}
+	return resp, nil
+}
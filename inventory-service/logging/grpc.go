@@ -0,0 +1,107 @@
+package logging
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"google.golang.org/genproto/googleapis/rpc/errdetails"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+// requestIDMetadataKey is the gRPC metadata key carrying the request ID.
+const requestIDMetadataKey = "x-request-id"
+
+// UnaryServerInterceptor takes the request ID from the incoming metadata (or
+// generates one), returns it in the response header, attaches it to error
+// statuses as a google.rpc.RequestInfo detail and writes one access log line
+// per unary call.
+func UnaryServerInterceptor() grpc.UnaryServerInterceptor {
+	return func(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+		id := incomingRequestID(ctx)
+		if !validRequestID(id) {
+			id = NewRequestID()
+		}
+		ctx = WithRequestID(ctx, id)
+		grpc.SetHeader(ctx, metadata.Pairs(requestIDMetadataKey, id))
+
+		start := time.Now()
+		resp, err := handler(ctx, req)
+		return resp, logCall(ctx, info.FullMethod, start, err, id)
+	}
+}
+
+// StreamServerInterceptor does for streaming calls what
+// UnaryServerInterceptor does for unary ones, logging when the stream ends.
+func StreamServerInterceptor() grpc.StreamServerInterceptor {
+	return func(srv interface{}, ss grpc.ServerStream, info *grpc.StreamServerInfo, handler grpc.StreamHandler) error {
+		ctx := ss.Context()
+		id := incomingRequestID(ctx)
+		if !validRequestID(id) {
+			id = NewRequestID()
+		}
+		ctx = WithRequestID(ctx, id)
+		ss.SetHeader(metadata.Pairs(requestIDMetadataKey, id))
+
+		start := time.Now()
+		err := handler(srv, &contextStream{ServerStream: ss, ctx: ctx})
+		return logCall(ctx, info.FullMethod, start, err, id)
+	}
+}
+
+// contextStream is a server stream with the request ID in its context.
+type contextStream struct {
+	grpc.ServerStream
+	ctx context.Context
+}
+
+func (s *contextStream) Context() context.Context {
+	return s.ctx
+}
+
+// logCall writes the access log line of a call and returns its error with
+// the request ID attached.
+func logCall(ctx context.Context, method string, start time.Time, err error, id string) error {
+	code := status.Code(err)
+	level := slog.LevelInfo
+	switch code {
+	case codes.OK:
+	case codes.Internal, codes.Unknown, codes.DataLoss, codes.Unavailable:
+		level = slog.LevelError
+	default:
+		level = slog.LevelWarn
+	}
+	attrs := []slog.Attr{
+		slog.String("method", method),
+		slog.String("code", code.String()),
+		slog.Duration("duration", time.Since(start)),
+	}
+	if err != nil {
+		attrs = append(attrs, slog.String("error", err.Error()))
+		err = withRequestInfo(err, id)
+	}
+	slog.LogAttrs(ctx, level, "grpc request", attrs...)
+	return err
+}
+
+func incomingRequestID(ctx context.Context) string {
+	md, ok := metadata.FromIncomingContext(ctx)
+	if !ok {
+		return ""
+	}
+	if ids := md.Get(requestIDMetadataKey); len(ids) > 0 {
+		return ids[0]
+	}
+	return ""
+}
+
+func withRequestInfo(err error, id string) error {
+	st, err2 := status.Convert(err).WithDetails(&errdetails.RequestInfo{RequestId: id})
+	if err2 != nil {
+		return err
+	}
+	return st.Err()
+}
@@ -5,15 +5,25 @@ import (
 	"errors"
 	"fmt"
 	"inventory-service/config"
+	"inventory-service/events"
+	"inventory-service/logging"
+	"inventory-service/metrics"
 	"inventory-service/model"
+	"inventory-service/tlsconfig"
+	"inventory-service/tracing"
+	"inventory-service/transcoding"
 
 	// "inventory-service/proto"
 	inventory_pb "inventory-service/proto/inventory"
 	"log"
+	"log/slog"
 	"net"
+	"net/http"
     inventory_grpc "inventory-service/grpc"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
+	"google.golang.org/grpc/keepalive"
 	// "google.golang.org/grpc/health"
 	// "google.golang.org/grpc/health/grpc_health_v1"
 )
@@ -133,29 +143,114 @@ func main() {
 	if err != nil {
 		log.Fatal("Cannot load config:", err)
 	}
+	logging.New("inventory-service", cfg.LogLevel)
+	slog.Info("configuration loaded", "config", cfg)
+
+	// Set up tracing
+	shutdownTracing, err := tracing.Init(context.Background(), "inventory-service", cfg)
+	if err != nil {
+		logging.Fatal("cannot set up tracing", "error", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// Load TLS material
+	certs, err := tlsconfig.New(tlsconfig.Files{
+		CertFile: cfg.TLSCertFile,
+		KeyFile:  cfg.TLSKeyFile,
+		CAFile:   cfg.TLSCAFile,
+	})
+	if err != nil {
+		logging.Fatal("cannot load TLS files", "error", err)
+	}
+	go certs.Watch(context.Background(), cfg.TLSReloadInterval)
 
 	productInfo = model.ProductInventory{
 		Inventory: map[string]int32{"1": 100, "2": 50},
 	}
+	for productID, quantity := range productInfo.Inventory {
+		metrics.SetStock(productID, quantity)
+	}
+
+	// Expose Prometheus metrics
+	metricsAddr := fmt.Sprintf("%s:%s", cfg.MetricsHost, cfg.MetricsPort)
+	go func() {
+		slog.Info("Serving metrics", "addr", metricsAddr)
+		if err := metrics.ListenAndServe(metricsAddr, certs); err != nil {
+			logging.Fatal("failed to serve metrics", "error", err)
+		}
+	}()
 
 	//Set up gRPC
 	grpcAddr := fmt.Sprintf("%s:%s", cfg.GrpcHost, cfg.GrpcPort)
 
 	lis, err := net.Listen("tcp", grpcAddr)
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		logging.Fatal("failed to listen", "addr", grpcAddr, "error", err)
 	}
 
-    server := inventory_grpc.NewServer(productInfo)
-	grpcServer := grpc.NewServer()
+	// Relay domain events
+	outbox := events.NewOutbox("inventory-service")
+	broker, err := events.NewBroker(cfg.EventBroker, cfg.EventBrokerURL)
+	if err != nil {
+		logging.Fatal("cannot set up event broker", "error", err)
+	}
+	defer broker.Close()
+	outbox.SetLimit(cfg.EventOutboxLimit)
+	relay := &events.Relay{
+		Outbox:         outbox,
+		Broker:         broker,
+		TopicPrefix:    cfg.EventTopicPrefix,
+		Interval:       cfg.EventRelayInterval,
+		Batch:          cfg.EventRelayBatch,
+		PublishTimeout: cfg.EventPublishTimeout,
+	}
+	go relay.Run(context.Background())
+
+    server := inventory_grpc.NewServer(productInfo, outbox)
+	grpcOpts := []grpc.ServerOption{
+		tracing.ServerOption(),
+		// Recycling connections lets clients rebalance onto new instances.
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionAge: cfg.GrpcMaxConnectionAge,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             cfg.GrpcKeepaliveMinTime,
+			PermitWithoutStream: true,
+		}),
+		grpc.ChainUnaryInterceptor(
+			metrics.UnaryServerInterceptor(),
+			logging.UnaryServerInterceptor(),
+		),
+		grpc.ChainStreamInterceptor(
+			metrics.StreamServerInterceptor(),
+			logging.StreamServerInterceptor(),
+		),
+	}
+	if certs.ServerEnabled() {
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(certs.ServerConfig(true))))
+	}
+	grpcServer := grpc.NewServer(grpcOpts...)
 	inventory_pb.RegisterInventoryServiceServer(grpcServer, server)
 
+	// Serve the HTTP/JSON bindings next to gRPC
+	transcoder, err := transcoding.Handler(context.Background(), server)
+	if err != nil {
+		logging.Fatal("cannot set up HTTP transcoding", "error", err)
+	}
+	httpAddr := fmt.Sprintf("%s:%s", cfg.HttpHost, cfg.HttpPort)
+	go func() {
+		slog.Info("Serving HTTP transcoding", "addr", httpAddr)
+		if err := certs.ListenAndServe(&http.Server{Addr: httpAddr, Handler: transcoder}); err != nil {
+			logging.Fatal("failed to serve HTTP", "error", err)
+		}
+	}()
+
 	// Register health service
 	// healthServer := health.NewServer()
 	// grpc_health_v1.RegisterHealthServer(s, healthServer)
 
-	log.Printf("Inventory service is running on port %s", cfg.GrpcPort)
+	slog.Info("Inventory service is running", "addr", grpcAddr, "tls", certs.ServerEnabled())
 	if err := grpcServer.Serve(lis); err != nil {
-		log.Fatalf("failed to serve: %v", err)
+		logging.Fatal("failed to serve", "error", err)
 	}
 }
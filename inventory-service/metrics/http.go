@@ -0,0 +1,17 @@
+package metrics
+
+import (
+	"inventory-service/tlsconfig"
+	"net/http"
+
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// ListenAndServe exposes the default registry on /metrics at addr, over TLS
+// when certs has a certificate. The inventory service has no HTTP API of its
+// own, so this runs as a separate listener next to the gRPC server.
+func ListenAndServe(addr string, certs *tlsconfig.Reloader) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	return certs.ListenAndServe(&http.Server{Addr: addr, Handler: mux})
+}
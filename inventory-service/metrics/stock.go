@@ -0,0 +1,21 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var stockLevel = promauto.NewGaugeVec(prometheus.GaugeOpts{
+	Name: "inventory_stock_quantity",
+	Help: "Units currently in stock, by product.",
+}, []string{"product_id"})
+
+// SetStock records the current quantity held for a product.
+func SetStock(productID string, quantity int32) {
+	stockLevel.WithLabelValues(productID).Set(float64(quantity))
+}
+
+// DeleteStock drops the series of a product that is no longer stocked.
+func DeleteStock(productID string) {
+	stockLevel.DeleteLabelValues(productID)
+}
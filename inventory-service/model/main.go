@@ -2,4 +2,7 @@ package model
 
 type ProductInventory struct{
 	Inventory map[string]int32
+	// Versions counts the changes to each product's stock. Entries outlive
+	// deleted stock so that versions never repeat.
+	Versions map[string]int64
 }
@@ -0,0 +1,13 @@
+package model
+
+// StockAdjustment is the payload of a StockAdjusted event.
+type StockAdjustment struct {
+	ProductID string `json:"product_id"`
+	Previous  int32  `json:"previous"`
+	Quantity  int32  `json:"quantity"`
+	Delta     int32  `json:"delta"`
+	Version   int64  `json:"version"`
+	// Reason is the operation that changed the stock: "add", "update",
+	// "delete" or "bulk" (BulkAdjustStock).
+	Reason string `json:"reason"`
+}
@@ -0,0 +1,73 @@
+// Package transcoding serves InventoryService as HTTP/JSON, following the
+// google.api.http bindings in proto/inventory.proto:
+//
+//	GET    /inventory/{product_id}   CheckStock
+//	PUT    /inventory/{product_id}   UpdateStock  {"quantity": 10}
+//	POST   /inventory/{product_id}   AddStock     {"quantity": 10}
+//	DELETE /inventory/{product_id}   DeleteStock
+//
+// Writes given an "expected_version" that is no longer current fail with
+// ABORTED, which is answered 409 Conflict.
+//
+// Requests are dispatched to the server in process rather than over a
+// loopback gRPC connection, so both transports share one inventory and one
+// outbox.
+package transcoding
+
+import (
+	"context"
+	"inventory-service/logging"
+	inventory_pb "inventory-service/proto/inventory"
+	"inventory-service/tracing"
+	"net/http"
+
+	"github.com/grpc-ecosystem/grpc-gateway/v2/runtime"
+	"go.opentelemetry.io/otel/trace"
+	"google.golang.org/protobuf/encoding/protojson"
+	"google.golang.org/protobuf/proto"
+)
+
+// Handler returns the HTTP handler for srv, with the same access logging,
+// request IDs and tracing as the other services' HTTP APIs.
+func Handler(ctx context.Context, srv inventory_pb.InventoryServiceServer) (http.Handler, error) {
+	mux := runtime.NewServeMux(
+		// Field names match the JSON of the rest of the API (product_id,
+		// in_stock) and zero values are kept, so out-of-stock products
+		// still report "quantity": 0.
+		runtime.WithMarshalerOption(runtime.MIMEWildcard, &runtime.JSONPb{
+			MarshalOptions: protojson.MarshalOptions{
+				UseProtoNames:   true,
+				EmitUnpopulated: true,
+			},
+			UnmarshalOptions: protojson.UnmarshalOptions{DiscardUnknown: true},
+		}),
+		runtime.WithForwardResponseOption(deleteStatus),
+		runtime.WithMiddlewares(spanName),
+	)
+	if err := inventory_pb.RegisterInventoryServiceHandlerServer(ctx, mux, srv); err != nil {
+		return nil, err
+	}
+	return tracing.Middleware("inventory-service")(logging.Middleware(mux)), nil
+}
+
+// deleteStatus answers 404 to an unsuccessful DeleteStock, keeping the
+// response body. Over gRPC the outcome is only reported in the body, which
+// callers such as product-service rely on, but HTTP clients expect the status
+// to say so.
+func deleteStatus(_ context.Context, w http.ResponseWriter, resp proto.Message) error {
+	if del, ok := resp.(*inventory_pb.DeleteResponse); ok && !del.Success {
+		w.WriteHeader(http.StatusNotFound)
+	}
+	return nil
+}
+
+// spanName renames the request span after the matched binding, so that
+// /inventory/1 and /inventory/2 share a span name.
+func spanName(next runtime.HandlerFunc) runtime.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request, pathParams map[string]string) {
+		if pattern, ok := runtime.HTTPPattern(r.Context()); ok {
+			trace.SpanFromContext(r.Context()).SetName(r.Method + " " + pattern.String())
+		}
+		next(w, r, pathParams)
+	}
+}
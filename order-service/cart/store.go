@@ -0,0 +1,215 @@
+// Package cart keeps shopping carts in memory until they expire.
+package cart
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"log/slog"
+	"order-service/model"
+	"strconv"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound     = errors.New("cart not found")
+	ErrItemNotFound = errors.New("cart item not found")
+)
+
+// Store holds carts. Every change pushes a cart's expiry TTL into the future.
+// Carts are only found for the customer who created them.
+type Store struct {
+	mu    sync.Mutex
+	carts map[string]*model.Cart
+	ttl   time.Duration
+	now   func() time.Time
+}
+
+func NewStore(ttl time.Duration) *Store {
+	return &Store{
+		carts: make(map[string]*model.Cart),
+		ttl:   ttl,
+		now:   time.Now,
+	}
+}
+
+// Create stores a new empty cart with the settings of c.
+func (s *Store) Create(c model.Cart) model.Cart {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	c.ID = newID()
+	c.Items = []model.CartItem{}
+	c.CreatedAt = now
+	c.UpdatedAt = now
+	c.ExpiresAt = now.Add(s.ttl)
+	s.carts[c.ID] = &c
+	return copyCart(&c)
+}
+
+// Get returns a cart of a customer that has not expired.
+func (s *Store) Get(id, customerID string) (model.Cart, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.get(id, customerID)
+	if err != nil {
+		return model.Cart{}, err
+	}
+	return copyCart(c), nil
+}
+
+// Update applies fn to a cart and refreshes its expiry. The cart is left
+// unchanged if fn fails.
+func (s *Store) Update(id, customerID string, fn func(*model.Cart) error) (model.Cart, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.get(id, customerID)
+	if err != nil {
+		return model.Cart{}, err
+	}
+	updated := copyCart(c)
+	if err := fn(&updated); err != nil {
+		return model.Cart{}, err
+	}
+	now := s.now()
+	updated.UpdatedAt = now
+	updated.ExpiresAt = now.Add(s.ttl)
+	s.carts[id] = &updated
+	return copyCart(&updated), nil
+}
+
+// Delete removes a cart.
+func (s *Store) Delete(id, customerID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if _, err := s.get(id, customerID); err != nil {
+		return err
+	}
+	delete(s.carts, id)
+	return nil
+}
+
+// Take removes a cart and returns it, so that only one caller can check it
+// out. Restore puts it back if the checkout fails.
+func (s *Store) Take(id, customerID string) (model.Cart, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	c, err := s.get(id, customerID)
+	if err != nil {
+		return model.Cart{}, err
+	}
+	delete(s.carts, id)
+	return copyCart(c), nil
+}
+
+// Restore puts back a cart removed by Take.
+func (s *Store) Restore(c model.Cart) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	restored := copyCart(&c)
+	s.carts[c.ID] = &restored
+}
+
+// Sweep drops expired carts and returns how many there were.
+func (s *Store) Sweep() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	n := 0
+	for id, c := range s.carts {
+		if !now.Before(c.ExpiresAt) {
+			delete(s.carts, id)
+			n++
+		}
+	}
+	return n
+}
+
+// Run sweeps expired carts every interval until ctx is done.
+func (s *Store) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if n := s.Sweep(); n > 0 {
+				slog.Info("expired carts removed", "count", n)
+			}
+		}
+	}
+}
+
+// get returns a live cart. Another customer's cart is reported as not found,
+// so that its ID does not give it away.
+func (s *Store) get(id, customerID string) (*model.Cart, error) {
+	c, ok := s.carts[id]
+	if !ok || c.CustomerID != customerID {
+		return nil, ErrNotFound
+	}
+	if !s.now().Before(c.ExpiresAt) {
+		delete(s.carts, id)
+		return nil, ErrNotFound
+	}
+	return c, nil
+}
+
+// AddItem adds quantity of a product or variant to c, merging with a line
+// for the same one.
+func AddItem(c *model.Cart, item model.CartItem) model.CartItem {
+	for i := range c.Items {
+		if c.Items[i].ProductID == item.ProductID && c.Items[i].SKU == item.SKU {
+			c.Items[i].Quantity += item.Quantity
+			return c.Items[i]
+		}
+	}
+	item.ID = nextItemID(c)
+	c.Items = append(c.Items, item)
+	return item
+}
+
+// Item returns the line with the given ID.
+func Item(c *model.Cart, id string) (*model.CartItem, error) {
+	for i := range c.Items {
+		if c.Items[i].ID == id {
+			return &c.Items[i], nil
+		}
+	}
+	return nil, ErrItemNotFound
+}
+
+// RemoveItem drops the line with the given ID.
+func RemoveItem(c *model.Cart, id string) error {
+	for i := range c.Items {
+		if c.Items[i].ID == id {
+			c.Items = append(c.Items[:i], c.Items[i+1:]...)
+			return nil
+		}
+	}
+	return ErrItemNotFound
+}
+
+func nextItemID(c *model.Cart) string {
+	max := 0
+	for _, item := range c.Items {
+		if n, err := strconv.Atoi(item.ID); err == nil && n > max {
+			max = n
+		}
+	}
+	return strconv.Itoa(max + 1)
+}
+
+func copyCart(c *model.Cart) model.Cart {
+	copied := *c
+	copied.Items = append([]model.CartItem{}, c.Items...)
+	return copied
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
@@ -0,0 +1,343 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"order-service/cart"
+	"order-service/metrics"
+	"order-service/model"
+	"order-service/pricing"
+	"order-service/render"
+
+	"github.com/gorilla/mux"
+)
+
+var carts *cart.Store
+
+// CartView is a cart checked against current prices and stock.
+type CartView struct {
+	model.Cart
+	Valid    bool               `json:"valid"`
+	Problems []string           `json:"problems,omitempty"`
+	Pricing  *pricing.Breakdown `json:"pricing,omitempty"`
+}
+
+// viewCart validates every item of a cart through product-service and
+// prices it. Problems a shopper can fix, such as a lapsed coupon or too
+// little stock, are reported in the view rather than as an error.
+func viewCart(ctx context.Context, c model.Cart) (CartView, error) {
+	view := CartView{Cart: c, Valid: true}
+	if len(c.Items) == 0 {
+		return view, nil
+	}
+
+	order := cartOrder(c)
+	products, _, status, err := validateOrder(ctx, &order)
+	if err != nil {
+		if status >= http.StatusInternalServerError {
+			return view, err
+		}
+		view.Valid = false
+		view.Problems = append(view.Problems, err.Error())
+		return view, nil
+	}
+
+	for i, product := range products {
+		item := &view.Items[i]
+		item.Name = product.Name
+		if product.VariantName != "" {
+			item.Name += " (" + product.VariantName + ")"
+		}
+		available := product.Quantity
+		item.Available = &available
+		if item.Quantity > available {
+			view.Valid = false
+			view.Problems = append(view.Problems, fmt.Sprintf("only %d of %s in stock", available, item.Name))
+		}
+	}
+	if _, _, err := applyPricing(&order, products, false); err != nil {
+		view.Valid = false
+		view.Problems = append(view.Problems, err.Error())
+		return view, nil
+	}
+	for i := range view.Items {
+		unitPrice := order.Items[i].UnitPrice
+		view.Items[i].UnitPrice = &unitPrice
+	}
+	view.Currency = order.Currency
+	view.Pricing = order.Pricing
+	return view, nil
+}
+
+// cartOrder turns a cart into an order for validation and checkout.
+func cartOrder(c model.Cart) model.Order {
+	order := model.Order{
+		Currency:   c.Currency,
+		Region:     c.Region,
+		CouponCode: c.CouponCode,
+	}
+	for _, item := range c.Items {
+		order.Items = append(order.Items, model.OrderItem{
+			ProductID: item.ProductID,
+			SKU:       item.SKU,
+			Quantity:  item.Quantity,
+		})
+	}
+	return order
+}
+
+func writeCart(w http.ResponseWriter, r *http.Request, status int, c model.Cart) {
+	view, err := viewCart(r.Context(), c)
+	if err != nil {
+		render.Error(w, r, http.StatusBadGateway, err.Error())
+		return
+	}
+	render.Respond(w, r, status, view)
+}
+
+func cartError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, cart.ErrNotFound) || errors.Is(err, cart.ErrItemNotFound) {
+		render.Error(w, r, http.StatusNotFound, err.Error())
+		return
+	}
+	render.Error(w, r, http.StatusBadRequest, err.Error())
+}
+
+// cartSettings are the parts of a cart a shopper sets directly.
+type cartSettings struct {
+	Currency   string `json:"currency"`
+	Region     string `json:"region"`
+	CouponCode string `json:"coupon_code"`
+}
+
+func (s cartSettings) validate() error {
+	if s.Currency != "" && !rates.Supports(s.Currency) {
+		return fmt.Errorf("unsupported currency %s", s.Currency)
+	}
+	return nil
+}
+
+// CreateCart opens a cart for the caller. Carts are kept to the customer who
+// created them: anyone else is told they do not exist.
+func CreateCart(w http.ResponseWriter, r *http.Request) {
+	caller, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+	var settings cartSettings
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+			render.Error(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	if err := settings.validate(); err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	c := carts.Create(model.Cart{
+		CustomerID: caller.CustomerID,
+		Currency:   settings.Currency,
+		Region:     settings.Region,
+		CouponCode: settings.CouponCode,
+	})
+	writeCart(w, r, http.StatusCreated, c)
+}
+
+func GetCart(w http.ResponseWriter, r *http.Request) {
+	caller, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+	c, err := carts.Get(mux.Vars(r)["id"], caller.CustomerID)
+	if err != nil {
+		cartError(w, r, err)
+		return
+	}
+	writeCart(w, r, http.StatusOK, c)
+}
+
+func UpdateCart(w http.ResponseWriter, r *http.Request) {
+	caller, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+	var settings cartSettings
+	if err := json.NewDecoder(r.Body).Decode(&settings); err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := settings.validate(); err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	c, err := carts.Update(mux.Vars(r)["id"], caller.CustomerID, func(c *model.Cart) error {
+		c.Currency = settings.Currency
+		c.Region = settings.Region
+		c.CouponCode = settings.CouponCode
+		return nil
+	})
+	if err != nil {
+		cartError(w, r, err)
+		return
+	}
+	writeCart(w, r, http.StatusOK, c)
+}
+
+func DeleteCart(w http.ResponseWriter, r *http.Request) {
+	caller, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+	if err := carts.Delete(mux.Vars(r)["id"], caller.CustomerID); err != nil {
+		cartError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// AddCartItem adds a product or variant to a cart once product-service
+// confirms it exists.
+func AddCartItem(w http.ResponseWriter, r *http.Request) {
+	caller, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+	var item model.CartItem
+	if err := json.NewDecoder(r.Body).Decode(&item); err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if item.Quantity <= 0 {
+		item.Quantity = 1
+	}
+	id := mux.Vars(r)["id"]
+	if _, err := carts.Get(id, caller.CustomerID); err != nil {
+		cartError(w, r, err)
+		return
+	}
+	check := model.Order{Items: []model.OrderItem{{ProductID: item.ProductID, SKU: item.SKU, Quantity: item.Quantity}}}
+	if _, _, status, err := validateOrder(r.Context(), &check); err != nil {
+		render.Error(w, r, status, err.Error())
+		return
+	}
+
+	c, err := carts.Update(id, caller.CustomerID, func(c *model.Cart) error {
+		cart.AddItem(c, model.CartItem{ProductID: item.ProductID, SKU: item.SKU, Quantity: item.Quantity})
+		return nil
+	})
+	if err != nil {
+		cartError(w, r, err)
+		return
+	}
+	writeCart(w, r, http.StatusOK, c)
+}
+
+// UpdateCartItem sets the quantity of a cart line. A quantity of zero
+// removes it.
+func UpdateCartItem(w http.ResponseWriter, r *http.Request) {
+	caller, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+	params := mux.Vars(r)
+	var body struct {
+		Quantity int32 `json:"quantity"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if body.Quantity < 0 {
+		render.Error(w, r, http.StatusBadRequest, "quantity must not be negative")
+		return
+	}
+	c, err := carts.Update(params["id"], caller.CustomerID, func(c *model.Cart) error {
+		if body.Quantity == 0 {
+			return cart.RemoveItem(c, params["item"])
+		}
+		item, err := cart.Item(c, params["item"])
+		if err != nil {
+			return err
+		}
+		item.Quantity = body.Quantity
+		return nil
+	})
+	if err != nil {
+		cartError(w, r, err)
+		return
+	}
+	writeCart(w, r, http.StatusOK, c)
+}
+
+func DeleteCartItem(w http.ResponseWriter, r *http.Request) {
+	caller, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+	params := mux.Vars(r)
+	c, err := carts.Update(params["id"], caller.CustomerID, func(c *model.Cart) error {
+		return cart.RemoveItem(c, params["item"])
+	})
+	if err != nil {
+		cartError(w, r, err)
+		return
+	}
+	writeCart(w, r, http.StatusOK, c)
+}
+
+// CheckoutCart places an order for the contents of a cart, at current prices,
+// and discards the cart. The cart is out of the store while the order is
+// placed, and put back if that fails.
+func CheckoutCart(w http.ResponseWriter, r *http.Request) {
+	caller, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+	var body struct {
+		OrderID string `json:"order_id"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			render.Error(w, r, http.StatusBadRequest, err.Error())
+			return
+		}
+	}
+	// Claim the cart so that a concurrent checkout of it finds none
+	c, err := carts.Take(mux.Vars(r)["id"], caller.CustomerID)
+	if err != nil {
+		cartError(w, r, err)
+		return
+	}
+	if len(c.Items) == 0 {
+		carts.Restore(c)
+		render.Error(w, r, http.StatusBadRequest, "cart is empty")
+		return
+	}
+
+	order := cartOrder(c)
+	order.ID = body.OrderID
+	order.CustomerID = caller.CustomerID
+	if order.ID == "" {
+		order.ID = newOrderID()
+	}
+	if reason, status, err := placeOrder(r.Context(), &order); err != nil {
+		carts.Restore(c)
+		metrics.OrderRejected(reason)
+		render.Error(w, r, status, err.Error())
+		return
+	}
+
+	render.Respond(w, r, http.StatusCreated, orderBody(r, order))
+}
+
+func newOrderID() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
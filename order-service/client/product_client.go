@@ -2,11 +2,18 @@ package client
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	order_product_pb "order-service/proto/orderproduct"
 
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
+// ErrOutOfStock reports that an item is short of stock, or has none.
+var ErrOutOfStock = errors.New("out of stock")
+
 type ProductClient struct {
 	client order_product_pb.OrderProductServiceClient
 }
@@ -17,15 +24,29 @@ func NewProductClient(conn *grpc.ClientConn) *ProductClient {
 	}
 }
 
-func (c *ProductClient) ValidateProducts(ctx context.Context, productIDs []string) (*order_product_pb.ValidateProductsResponse, error) {
+// ValidateProducts checks that the products exist and returns their prices,
+// taken from the price list for currency where there is one.
+func (c *ProductClient) ValidateProducts(ctx context.Context, currency string, productIDs []string, items ...*order_product_pb.ProductRef) (*order_product_pb.ValidateProductsResponse, error) {
 	return c.client.ValidateProducts(ctx, &order_product_pb.ValidateProductsRequest{
 		ProductIds: productIDs,
+		Items:      items,
+		Currency:   currency,
 	})
 }
 
-func (c *ProductClient) UpdateStock(ctx context.Context, items []*order_product_pb.OrderItem) error {
-	_, err := c.client.UpdateProductStock(ctx, &order_product_pb.UpdateStockRequest{
-		Items: items,
-	})
+// TakeStock takes items out of stock, all or none. It fails with
+// ErrOutOfStock if any item is short of stock.
+func (c *ProductClient) TakeStock(ctx context.Context, items []*order_product_pb.StockChange) error {
+	_, err := c.client.TakeStock(ctx, &order_product_pb.StockChangeRequest{Items: items})
+	switch status.Code(err) {
+	case codes.FailedPrecondition, codes.NotFound:
+		return fmt.Errorf("%w: %s", ErrOutOfStock, status.Convert(err).Message())
+	}
 	return err
-}
\ No newline at end of file
+}
+
+// ReturnStock puts back items taken by TakeStock.
+func (c *ProductClient) ReturnStock(ctx context.Context, items []*order_product_pb.StockChange) error {
+	_, err := c.client.ReturnStock(ctx, &order_product_pb.StockChangeRequest{Items: items})
+	return err
+}
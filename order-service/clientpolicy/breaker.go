@@ -0,0 +1,178 @@
+package clientpolicy
+
+import (
+	"context"
+	"log/slog"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+type breakerState int
+
+const (
+	stateClosed breakerState = iota
+	stateOpen
+	stateHalfOpen
+)
+
+func (s breakerState) String() string {
+	switch s {
+	case stateOpen:
+		return "open"
+	case stateHalfOpen:
+		return "half-open"
+	default:
+		return "closed"
+	}
+}
+
+// Breaker is a consecutive-failure circuit breaker for one downstream
+// service. Once open it rejects calls with UNAVAILABLE until the cooldown has
+// passed, then lets a single probe through: its success closes the breaker,
+// its failure opens it again.
+type Breaker struct {
+	name      string
+	threshold int
+	cooldown  time.Duration
+
+	mu       sync.Mutex
+	state    breakerState
+	failures int
+	openedAt time.Time
+	probing  bool
+}
+
+// NewBreaker returns a closed breaker. A threshold of zero disables it.
+func NewBreaker(name string, threshold int, cooldown time.Duration) *Breaker {
+	return &Breaker{name: name, threshold: threshold, cooldown: cooldown}
+}
+
+// UnaryClientInterceptor fails calls fast while the breaker is open and feeds
+// it the outcome of the others.
+func (b *Breaker) UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if b.threshold <= 0 {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+		if !b.allow() {
+			return status.Errorf(codes.Unavailable, "circuit breaker open for %s", b.name)
+		}
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		b.outcome(ctx, err)
+		return err
+	}
+}
+
+// StreamClientInterceptor does the same for streaming calls, feeding the
+// breaker the outcome of each stream when it ends.
+func (b *Breaker) StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if b.threshold <= 0 {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+		if !b.allow() {
+			return nil, status.Errorf(codes.Unavailable, "circuit breaker open for %s", b.name)
+		}
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			b.outcome(ctx, err)
+			return nil, err
+		}
+		// gRPC cancels the context of a stream once it ends, so a probe
+		// dropped without its outcome being received is freed then
+		go func() {
+			<-stream.Context().Done()
+			b.release()
+		}()
+		done := func(err error) { b.outcome(ctx, err) }
+		return &endedStream{ClientStream: stream, serverStreams: desc.ServerStreams, done: done}, nil
+	}
+}
+
+func (b *Breaker) allow() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	switch b.state {
+	case stateOpen:
+		if time.Since(b.openedAt) < b.cooldown {
+			return false
+		}
+		b.setState(stateHalfOpen)
+		b.probing = true
+		return true
+	case stateHalfOpen:
+		if b.probing {
+			return false
+		}
+		b.probing = true
+		return true
+	default:
+		return true
+	}
+}
+
+// outcome feeds the breaker the outcome of a call made with ctx. A call
+// cut short because its caller gave up, its context cancelled or past its
+// deadline, says nothing about the downstream: it is not counted, and a probe
+// it was is freed.
+func (b *Breaker) outcome(ctx context.Context, err error) {
+	if ctx.Err() != nil {
+		b.release()
+		return
+	}
+	b.record(err)
+}
+
+func (b *Breaker) record(err error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if !isFailure(err) {
+		b.failures = 0
+		b.probing = false
+		if b.state != stateClosed {
+			b.setState(stateClosed)
+		}
+		return
+	}
+
+	b.failures++
+	b.probing = false
+	if b.state == stateHalfOpen || b.failures >= b.threshold {
+		b.openedAt = time.Now()
+		if b.state != stateOpen {
+			b.setState(stateOpen)
+		}
+	}
+}
+
+// release lets another probe through if the one in flight ended without an
+// outcome.
+func (b *Breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.state == stateHalfOpen {
+		b.probing = false
+	}
+}
+
+func (b *Breaker) setState(s breakerState) {
+	slog.Warn("circuit breaker state changed", "target", b.name, "from", b.state.String(), "to", s.String())
+	b.state = s
+}
+
+// isFailure reports whether err says the downstream is unhealthy, as opposed
+// to rejecting this particular request.
+func isFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted:
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,183 @@
+package clientpolicy
+
+import (
+	"context"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/wrapperspb"
+)
+
+const hedgedMethod = "/test.Service/Get"
+
+// attempts answers the nth attempt of a call after its delay with its error,
+// or with a reply naming the attempt, and records when each one started.
+type attempts struct {
+	delays []time.Duration
+	errs   []error
+
+	mu      sync.Mutex
+	started []time.Time
+}
+
+func (a *attempts) invoke(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+	a.mu.Lock()
+	n := len(a.started)
+	a.started = append(a.started, time.Now())
+	a.mu.Unlock()
+
+	if n < len(a.delays) {
+		select {
+		case <-time.After(a.delays[n]):
+		case <-ctx.Done():
+			return status.FromContextError(ctx.Err()).Err()
+		}
+	}
+	if n < len(a.errs) && a.errs[n] != nil {
+		return a.errs[n]
+	}
+	reply.(*wrapperspb.StringValue).Value = "attempt " + strconv.Itoa(n)
+	return nil
+}
+
+func (a *attempts) count() int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return len(a.started)
+}
+
+func hedge(ctx context.Context, a *attempts, delay time.Duration, maxAttempts int) (string, error) {
+	interceptor := hedgeInterceptor(map[string]bool{hedgedMethod: true}, delay, maxAttempts)
+	reply := &wrapperspb.StringValue{}
+	err := interceptor(ctx, hedgedMethod, &wrapperspb.StringValue{}, reply, nil, a.invoke)
+	return reply.Value, err
+}
+
+func TestHedge(t *testing.T) {
+	const delay = 60 * time.Millisecond
+	tests := []struct {
+		name     string
+		delays   []time.Duration
+		errs     []error
+		reply    string
+		code     codes.Code
+		attempts int
+	}{
+		{"first answers in time", nil, nil, "attempt 0", codes.OK, 1},
+		{"hedge wins", []time.Duration{time.Second}, nil, "attempt 1", codes.OK, 2},
+		{"first wins after the hedge started", []time.Duration{delay * 3 / 2, time.Second}, nil, "attempt 0", codes.OK, 2},
+		{"unavailable is replaced", nil, []error{errUnavailable}, "attempt 1", codes.OK, 2},
+		{"other errors are returned at once", []time.Duration{0, time.Second}, []error{errNotFound}, "", codes.NotFound, 1},
+		{"all unavailable", nil, []error{errUnavailable, errUnavailable, errUnavailable}, "", codes.Unavailable, 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			a := &attempts{delays: tt.delays, errs: tt.errs}
+			reply, err := hedge(context.Background(), a, delay, 3)
+			if status.Code(err) != tt.code {
+				t.Fatalf("error = %v, want %s", err, tt.code)
+			}
+			if reply != tt.reply {
+				t.Errorf("reply = %q, want %q", reply, tt.reply)
+			}
+			if n := a.count(); n != tt.attempts {
+				t.Errorf("%d attempts, want %d", n, tt.attempts)
+			}
+		})
+	}
+}
+
+// TestHedgeBackoff checks that attempts replacing ones that failed with
+// UNAVAILABLE wait a backoff that grows with each failure.
+func TestHedgeBackoff(t *testing.T) {
+	const delay = 20 * time.Millisecond
+	a := &attempts{errs: []error{errUnavailable, errUnavailable}}
+	if _, err := hedge(context.Background(), a, delay, 3); err != nil {
+		t.Fatal(err)
+	}
+	if n := a.count(); n != 3 {
+		t.Fatalf("%d attempts, want 3", n)
+	}
+	for i, min := range []time.Duration{delay, 2 * delay} {
+		if wait := a.started[i+1].Sub(a.started[i]); wait < min {
+			t.Errorf("attempt %d started %v after the one before, want at least %v", i+1, wait, min)
+		}
+	}
+}
+
+func TestHedgeBackoffRange(t *testing.T) {
+	tests := []struct {
+		delay    time.Duration
+		failures int
+		min, max time.Duration
+	}{
+		{100 * time.Millisecond, 1, 100 * time.Millisecond, 150 * time.Millisecond},
+		{100 * time.Millisecond, 2, 200 * time.Millisecond, 300 * time.Millisecond},
+		{100 * time.Millisecond, 4, 800 * time.Millisecond, 1200 * time.Millisecond},
+		{100 * time.Millisecond, 5, maxHedgeBackoff, maxHedgeBackoff * 3 / 2},
+		{100 * time.Millisecond, 100, maxHedgeBackoff, maxHedgeBackoff * 3 / 2},
+		{time.Hour, 1, maxHedgeBackoff, maxHedgeBackoff * 3 / 2},
+		{0, 3, 0, 0},
+	}
+	for _, tt := range tests {
+		seen := make(map[time.Duration]bool)
+		for i := 0; i < 100; i++ {
+			d := hedgeBackoff(tt.delay, tt.failures)
+			if d < tt.min || d > tt.max {
+				t.Fatalf("hedgeBackoff(%v, %d) = %v, want between %v and %v", tt.delay, tt.failures, d, tt.min, tt.max)
+			}
+			seen[d] = true
+		}
+		if tt.max > tt.min && len(seen) < 2 {
+			t.Errorf("hedgeBackoff(%v, %d) is always %v, want jitter", tt.delay, tt.failures, hedgeBackoff(tt.delay, tt.failures))
+		}
+	}
+}
+
+func TestHedgeCallerGivesUp(t *testing.T) {
+	// While waiting to replace a failed attempt
+	a := &attempts{errs: []error{errUnavailable}}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err := hedge(ctx, a, time.Second, 3)
+	if status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("error = %v, want DEADLINE_EXCEEDED", err)
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Errorf("returned after %v, past the caller's deadline", elapsed)
+	}
+	if n := a.count(); n != 1 {
+		t.Errorf("%d attempts, want 1", n)
+	}
+
+	// While attempts are pending
+	a = &attempts{delays: []time.Duration{time.Second, time.Second}}
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if _, err := hedge(ctx, a, 10*time.Millisecond, 2); status.Code(err) != codes.DeadlineExceeded {
+		t.Errorf("error = %v, want DEADLINE_EXCEEDED", err)
+	}
+}
+
+func TestHedgeOnlyListedMethods(t *testing.T) {
+	a := &attempts{errs: []error{errUnavailable}}
+	interceptor := hedgeInterceptor(map[string]bool{hedgedMethod: true}, time.Millisecond, 3)
+	err := interceptor(context.Background(), "/test.Service/Update", nil, &wrapperspb.StringValue{}, nil, a.invoke)
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("error = %v, want UNAVAILABLE", err)
+	}
+	if n := a.count(); n != 1 {
+		t.Errorf("%d attempts of a method not hedged, want 1", n)
+	}
+
+	a = &attempts{errs: []error{errUnavailable}}
+	if _, err := hedge(context.Background(), a, time.Millisecond, 1); status.Code(err) != codes.Unavailable {
+		t.Errorf("error = %v, want UNAVAILABLE with a single attempt allowed", err)
+	}
+}
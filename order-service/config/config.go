@@ -1,18 +1,66 @@
 package config
 
 import (
-	"fmt"
+	"log/slog"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
 
 	"github.com/caarlos0/env"
 )
 
 type Config struct {
-	ServerPort        string `env:"SERVER_PORT" envDefault:"8082"`
-	ServerHost        string `env:"SERVER_HOST" envDefault:"0.0.0.0"`
-	ProductServiceHost string `env:"PRODUCT_SERVICE_HOST" envDefault:"product-service"`
-	ProductServicePort string `env:"PRODUCT_SERIVCE_PORT" envDefault:"50052"`
-	AppEnv            string `env:"APP_ENV" envDefault:"development"`
-	LogLevel          string `env:"LOG_LEVEL" envDefault:"debug"`
+	ServerPort              string        `env:"SERVER_PORT" envDefault:"8082"`
+	ServerHost              string        `env:"SERVER_HOST" envDefault:"0.0.0.0"`
+	ProductServiceHost      string        `env:"PRODUCT_SERVICE_HOST" envDefault:"product-service"`
+	ProductServicePort      string        `env:"PRODUCT_SERVICE_PORT" envDefault:"50052"`
+	AppEnv                  string        `env:"APP_ENV" envDefault:"development"`
+	LogLevel                string        `env:"LOG_LEVEL" envDefault:"debug"`
+	OtelExporter            string        `env:"OTEL_EXPORTER" envDefault:"none"`
+	OtelEndpoint            string        `env:"OTEL_EXPORTER_OTLP_ENDPOINT" envDefault:"otel-collector:4317"`
+	OtelFilePath            string        `env:"OTEL_FILE_PATH" envDefault:"traces.json"`
+	OtelSampleRatio         float64       `env:"OTEL_SAMPLE_RATIO" envDefault:"1"`
+	TLSCertFile             string        `env:"TLS_CERT_FILE"`
+	TLSKeyFile              string        `env:"TLS_KEY_FILE"`
+	TLSCAFile               string        `env:"TLS_CA_FILE"`
+	TLSReloadInterval       time.Duration `env:"TLS_RELOAD_INTERVAL" envDefault:"1m"`
+	ProductCallTimeout      time.Duration `env:"PRODUCT_CALL_TIMEOUT" envDefault:"2s"`
+	ProductMaxAttempts      int           `env:"PRODUCT_MAX_ATTEMPTS" envDefault:"3"`
+	ProductHedgeDelay       time.Duration `env:"PRODUCT_HEDGE_DELAY" envDefault:"200ms"`
+	ProductBreakerThreshold int           `env:"PRODUCT_BREAKER_THRESHOLD" envDefault:"5"`
+	ProductBreakerCooldown  time.Duration `env:"PRODUCT_BREAKER_COOLDOWN" envDefault:"10s"`
+	ProductResolver         string        `env:"PRODUCT_RESOLVER" envDefault:"dns"`
+	ProductAddresses        string        `env:"PRODUCT_ADDRESSES"`
+	ProductEndpointsFile    string        `env:"PRODUCT_ENDPOINTS_FILE"`
+	ProductResolveInterval  time.Duration `env:"PRODUCT_RESOLVE_INTERVAL" envDefault:"30s"`
+	ProductLBPolicy         string        `env:"PRODUCT_LB_POLICY" envDefault:"round_robin"`
+	GrpcKeepaliveTime       time.Duration `env:"GRPC_KEEPALIVE_TIME" envDefault:"30s"`
+	GrpcKeepaliveTimeout    time.Duration `env:"GRPC_KEEPALIVE_TIMEOUT" envDefault:"10s"`
+	BaseCurrency            string        `env:"BASE_CURRENCY" envDefault:"USD"`
+	ExchangeRates           string        `env:"EXCHANGE_RATES"`
+	PricingRulesFile        string        `env:"PRICING_RULES_FILE"`
+	CartTTL                 time.Duration `env:"CART_TTL" envDefault:"24h"`
+	CartSweepInterval       time.Duration `env:"CART_SWEEP_INTERVAL" envDefault:"5m"`
+	PaymentProvider         string        `env:"PAYMENT_PROVIDER" envDefault:"fake"`
+	PaymentWebhookSecret    string        `env:"PAYMENT_WEBHOOK_SECRET" secret:"true"`
+	PaymentWebhookTolerance time.Duration `env:"PAYMENT_WEBHOOK_TOLERANCE" envDefault:"5m"`
+	EventBroker             string        `env:"EVENT_BROKER" envDefault:"inprocess"`
+	EventBrokerURL          string        `env:"EVENT_BROKER_URL"`
+	EventTopicPrefix        string        `env:"EVENT_TOPIC_PREFIX" envDefault:"events."`
+	EventRelayInterval      time.Duration `env:"EVENT_RELAY_INTERVAL" envDefault:"1s"`
+	EventRelayBatch         int           `env:"EVENT_RELAY_BATCH" envDefault:"100"`
+	EventOutboxLimit        int           `env:"EVENT_OUTBOX_LIMIT" envDefault:"10000"`
+	EventPublishTimeout     time.Duration `env:"EVENT_PUBLISH_TIMEOUT" envDefault:"5s"`
+	WebhookTimeout          time.Duration `env:"WEBHOOK_TIMEOUT" envDefault:"10s"`
+	WebhookMaxAttempts      int           `env:"WEBHOOK_MAX_ATTEMPTS" envDefault:"8"`
+	WebhookRetryBase        time.Duration `env:"WEBHOOK_RETRY_BASE" envDefault:"10s"`
+	WebhookRetryMax         time.Duration `env:"WEBHOOK_RETRY_MAX" envDefault:"1h"`
+	WebhookLogSize          int           `env:"WEBHOOK_LOG_SIZE" envDefault:"100"`
+	WebhookPollInterval     time.Duration `env:"WEBHOOK_POLL_INTERVAL" envDefault:"1s"`
+	OpenAPIValidation       string        `env:"OPENAPI_VALIDATION" envDefault:"off"`
+	APIV1Deprecated         time.Time     `env:"API_V1_DEPRECATED" envDefault:"2026-10-19T00:00:00Z"`
+	APIV1Sunset             time.Time     `env:"API_V1_SUNSET" envDefault:"2027-04-19T00:00:00Z"`
 }
 
 func LoadConfig() (Config, error) {
@@ -20,6 +68,40 @@ func LoadConfig() (Config, error) {
 	if err := env.Parse(&cfg); err != nil {
 		return cfg, err
 	}
-	fmt.Println(cfg)
 	return cfg, nil
 }
+
+// LogValue renders the configuration for structured logs, keyed by
+// environment variable. Fields tagged secret:"true" and credentials embedded
+// in URLs are masked.
+func (c Config) LogValue() slog.Value {
+	v := reflect.ValueOf(c)
+	t := v.Type()
+	attrs := make([]slog.Attr, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("env"), ",")
+		if key == "" {
+			key = field.Name
+		}
+		value := v.Field(i).Interface()
+		if field.Tag.Get("secret") == "true" {
+			value = "[REDACTED]"
+		} else if s, ok := value.(string); ok {
+			value = redactURL(s)
+		}
+		attrs = append(attrs, slog.Any(key, value))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func redactURL(s string) string {
+	if !strings.Contains(s, "://") {
+		return s
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	return u.Redacted()
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"order-service/pricing"
+	"order-service/render"
+
+	"github.com/gorilla/mux"
+)
+
+// GetCoupons, CreateCoupon and DeleteCoupon manage coupons and are for
+// admins. GetCoupon looks up one code a shopper already has.
+func GetCoupons(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	render.Respond(w, r, http.StatusOK, pricer.Coupons())
+}
+
+func GetCoupon(w http.ResponseWriter, r *http.Request) {
+	coupon, ok := pricer.Coupon(mux.Vars(r)["code"])
+	if !ok {
+		render.Error(w, r, http.StatusNotFound, "Coupon not found")
+		return
+	}
+	render.Respond(w, r, http.StatusOK, coupon)
+}
+
+func CreateCoupon(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	var coupon pricing.Coupon
+	if err := json.NewDecoder(r.Body).Decode(&coupon); err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := pricer.AddCoupon(coupon); err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, pricing.ErrCouponExists) {
+			status = http.StatusConflict
+		}
+		render.Error(w, r, status, err.Error())
+		return
+	}
+	coupon.Used = 0
+	render.Respond(w, r, http.StatusCreated, coupon)
+}
+
+func DeleteCoupon(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if err := pricer.DeleteCoupon(mux.Vars(r)["code"]); err != nil {
+		render.Error(w, r, http.StatusNotFound, "Coupon not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
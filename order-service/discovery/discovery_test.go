@@ -0,0 +1,101 @@
+package discovery
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTarget(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoints Endpoints
+		want      string
+	}{
+		{"default", Endpoints{Address: "inventory:50051"}, "dns:///inventory:50051"},
+		{"dns", Endpoints{Resolver: "dns", Address: "inventory:50051"}, "dns:///inventory:50051"},
+		{"static", Endpoints{Resolver: "static", Static: "10.0.0.1:50051,10.0.0.2:50051"}, "static:///10.0.0.1:50051,10.0.0.2:50051"},
+		{"file", Endpoints{Resolver: "file", File: "/etc/inventory/endpoints"}, "file:///etc/inventory/endpoints"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := tt.endpoints.Target()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("Target() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+
+	t.Run("relative file", func(t *testing.T) {
+		got, err := Endpoints{Resolver: "file", File: "endpoints"}.Target()
+		if err != nil {
+			t.Fatal(err)
+		}
+		wd, _ := os.Getwd()
+		if want := "file://" + filepath.Join(wd, "endpoints"); got != want {
+			t.Errorf("Target() = %q, want %q", got, want)
+		}
+	})
+
+	for _, e := range []Endpoints{
+		{Resolver: "static", Static: " "},
+		{Resolver: "file"},
+		{Resolver: "consul", Address: "inventory:50051"},
+	} {
+		if got, err := e.Target(); err == nil {
+			t.Errorf("Target() of %+v = %q, want an error", e, got)
+		}
+	}
+}
+
+func TestParseAddresses(t *testing.T) {
+	tests := []struct {
+		list string
+		want []string
+	}{
+		{"", nil},
+		{"a:1", []string{"a:1"}},
+		{"a:1,b:2", []string{"a:1", "b:2"}},
+		{" a:1 , ,b:2 ", []string{"a:1", "b:2"}},
+		{"a:1\nb:2\n\n", []string{"a:1", "b:2"}},
+		{"# instances\na:1 # primary\n#b:2\nc:3,d:4", []string{"a:1", "c:3", "d:4"}},
+		{"\r\n", nil},
+	}
+	for _, tt := range tests {
+		var got []string
+		for _, a := range parseAddresses(tt.list) {
+			got = append(got, a.Addr)
+		}
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("parseAddresses(%q) = %q, want %q", tt.list, got, tt.want)
+		}
+	}
+}
+
+func TestDialOptions(t *testing.T) {
+	for _, resolver := range []string{"dns", "static", "file"} {
+		if opts := (Endpoints{Resolver: resolver, Address: "inventory:50051"}).DialOptions(); len(opts) == 0 {
+			t.Errorf("no dial options for the %s resolver", resolver)
+		}
+	}
+	if !strings.HasPrefix(mustTarget(t, Endpoints{Resolver: "static", Static: "a:1"}), staticBuilder{}.Scheme()+":") {
+		t.Error("static target does not use the static resolver")
+	}
+	if !strings.HasPrefix(mustTarget(t, Endpoints{Resolver: "file", File: "f"}), (&fileBuilder{}).Scheme()+":") {
+		t.Error("file target does not use the file resolver")
+	}
+}
+
+func mustTarget(t *testing.T, e Endpoints) string {
+	t.Helper()
+	target, err := e.Target()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return target
+}
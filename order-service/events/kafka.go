@@ -0,0 +1,86 @@
+package events
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Kafka publishes through a Kafka REST Proxy (v2 API), as served by Confluent
+// REST Proxy or Redpanda's HTTP proxy. Records are keyed by aggregate ID so
+// events for one product or order stay ordered within a partition; consumers
+// drop duplicates by the event ID in the record value.
+type Kafka struct {
+	base   string
+	client *http.Client
+}
+
+// NewKafka takes the proxy's base URL, e.g. http://localhost:8082.
+func NewKafka(rawURL string) (*Kafka, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("invalid Kafka REST proxy URL %q", rawURL)
+	}
+	return &Kafka{base: strings.TrimRight(rawURL, "/"), client: &http.Client{}}, nil
+}
+
+type kafkaRecords struct {
+	Records []kafkaRecord `json:"records"`
+}
+
+type kafkaRecord struct {
+	Key   string `json:"key"`
+	Value Event  `json:"value"`
+}
+
+type kafkaOffsets struct {
+	Offsets []struct {
+		Partition int     `json:"partition"`
+		Offset    int64   `json:"offset"`
+		ErrorCode *int    `json:"error_code"`
+		Error     *string `json:"error"`
+	} `json:"offsets"`
+}
+
+func (k *Kafka) Publish(ctx context.Context, topic string, ev Event) error {
+	body, err := json.Marshal(kafkaRecords{Records: []kafkaRecord{{Key: ev.AggregateID, Value: ev}}})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.base+"/topics/"+url.PathEscape(topic), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/vnd.kafka.json.v2+json")
+	req.Header.Set("Accept", "application/vnd.kafka.v2+json")
+
+	resp, err := k.client.Do(req)
+	if err != nil {
+		return fmt.Errorf("kafka publish: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 512))
+		return fmt.Errorf("kafka publish: %s: %s", resp.Status, bytes.TrimSpace(msg))
+	}
+	var out kafkaOffsets
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return fmt.Errorf("kafka publish: bad response: %w", err)
+	}
+	for _, o := range out.Offsets {
+		if o.Error != nil {
+			return fmt.Errorf("kafka publish: partition %d: %s", o.Partition, *o.Error)
+		}
+	}
+	return nil
+}
+
+func (k *Kafka) Close() error {
+	k.client.CloseIdleConnections()
+	return nil
+}
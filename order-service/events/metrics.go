@@ -0,0 +1,16 @@
+package events
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var outboxPending = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "events_outbox_pending",
+	Help: "Number of recorded events not yet published.",
+})
+
+var outboxRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "events_outbox_rejected_total",
+	Help: "Number of events not recorded because the outbox was full, by type. Their state changes were refused.",
+}, []string{"type"})
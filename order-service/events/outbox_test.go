@@ -0,0 +1,63 @@
+package events
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestOutboxLimit(t *testing.T) {
+	o := NewOutbox("test")
+	o.SetLimit(3)
+	for i := 0; i < 2; i++ {
+		if err := o.Record(OrderPlaced, "o1", nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// One change's events are recorded together or not at all
+	err := o.RecordAll(Entry{OrderStatusChanged, "o1", nil}, Entry{OrderCancelled, "o1", nil})
+	if !errors.Is(err, ErrOutboxFull) {
+		t.Fatalf("RecordAll = %v, want ErrOutboxFull", err)
+	}
+	if n := o.Len(); n != 2 {
+		t.Fatalf("%d pending, want 2", n)
+	}
+	if err := o.Record(OrderStatusChanged, "o1", nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Record(OrderStatusChanged, "o1", nil); !errors.Is(err, ErrOutboxFull) {
+		t.Fatalf("Record = %v, want ErrOutboxFull", err)
+	}
+
+	// Publishing makes room again
+	pending := o.Pending(2)
+	o.Ack(pending[0].ID, pending[1].ID)
+	if err := o.RecordAll(Entry{OrderStatusChanged, "o1", nil}, Entry{OrderCancelled, "o1", nil}); err != nil {
+		t.Fatal(err)
+	}
+	var types []string
+	for _, ev := range o.Pending(10) {
+		types = append(types, ev.Type)
+	}
+	if len(types) != 3 || types[0] != OrderStatusChanged || types[1] != OrderStatusChanged || types[2] != OrderCancelled {
+		t.Errorf("pending %v", types)
+	}
+
+	o.SetLimit(0)
+	for i := 0; i < 100; i++ {
+		if err := o.Record(OrderPlaced, "o1", nil); err != nil {
+			t.Fatalf("unlimited outbox: %v", err)
+		}
+	}
+}
+
+func TestOutboxRecordAllEncodingError(t *testing.T) {
+	o := NewOutbox("test")
+	err := o.RecordAll(Entry{OrderPlaced, "o1", nil}, Entry{OrderPlaced, "o2", make(chan int)})
+	if err == nil || o.Len() != 0 {
+		t.Errorf("RecordAll = %v with %d pending, want an error and none", err, o.Len())
+	}
+	var nilOutbox *Outbox
+	if err := nilOutbox.Record(OrderPlaced, "o1", nil); err != nil {
+		t.Errorf("nil outbox: %v", err)
+	}
+}
@@ -0,0 +1,78 @@
+package events
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+const maxRelayBackoff = 30 * time.Second
+
+// Relay publishes outbox events to a broker in the order they were recorded.
+// An event leaves the outbox only after the broker accepted it, so a crash or
+// broker outage leads to redelivery rather than loss.
+type Relay struct {
+	Outbox      *Outbox
+	Broker      Broker
+	TopicPrefix string
+	Interval    time.Duration
+	Batch       int
+	// PublishTimeout bounds a single Publish call.
+	PublishTimeout time.Duration
+}
+
+// Run publishes until ctx is cancelled. Failures back off exponentially up to
+// maxRelayBackoff, starting from Interval.
+func (r *Relay) Run(ctx context.Context) {
+	backoff := r.Interval
+	for {
+		wait := r.Interval
+		err := r.flush(ctx)
+		if err != nil {
+			slog.WarnContext(ctx, "cannot publish events", "pending", r.Outbox.Len(), "retry_in", backoff.String(), "error", err)
+			wait = backoff
+			backoff = min(backoff*2, maxRelayBackoff)
+		} else {
+			backoff = r.Interval
+		}
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-r.Outbox.Ready():
+			// New events only cut the wait short while the broker is
+			// healthy; a failing one keeps its backoff.
+			if err == nil {
+				timer.Stop()
+				continue
+			}
+			<-timer.C
+		case <-timer.C:
+		}
+	}
+}
+
+// flush publishes pending events until the outbox is empty or a publish fails.
+func (r *Relay) flush(ctx context.Context) error {
+	for {
+		batch := r.Outbox.Pending(r.Batch)
+		if len(batch) == 0 {
+			return nil
+		}
+		published := make([]string, 0, len(batch))
+		for _, ev := range batch {
+			pctx, cancel := context.WithTimeout(ctx, r.PublishTimeout)
+			err := r.Broker.Publish(pctx, r.TopicPrefix+ev.Type, ev)
+			cancel()
+			if err != nil {
+				r.Outbox.Ack(published...)
+				return err
+			}
+			slog.DebugContext(ctx, "event published", "event_id", ev.ID, "type", ev.Type, "aggregate_id", ev.AggregateID)
+			published = append(published, ev.ID)
+		}
+		r.Outbox.Ack(published...)
+	}
+}
@@ -0,0 +1,63 @@
+// Package identity reads the caller identity the API gateway forwards after
+// authenticating a request.
+package identity
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Headers set by the gateway. Clients cannot set them through it.
+const (
+	CustomerHeader = "X-Customer-ID"
+	RolesHeader    = "X-Customer-Roles"
+)
+
+// Roles with access beyond a customer's own orders.
+const (
+	RoleAdmin   = "admin"
+	RoleSupport = "support"
+)
+
+type Identity struct {
+	CustomerID string
+	Roles      []string
+}
+
+// FromRequest returns the caller of r, if the gateway authenticated one.
+func FromRequest(r *http.Request) (Identity, bool) {
+	id := Identity{CustomerID: r.Header.Get(CustomerHeader)}
+	if id.CustomerID == "" {
+		return id, false
+	}
+	for _, role := range strings.Split(r.Header.Get(RolesHeader), ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			id.Roles = append(id.Roles, role)
+		}
+	}
+	return id, true
+}
+
+func (i Identity) HasRole(role string) bool {
+	for _, r := range i.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+// IsAdmin reports whether the caller may see and change every order.
+func (i Identity) IsAdmin() bool {
+	return i.HasRole(RoleAdmin)
+}
+
+// CanSupport reports whether the caller may look up other customers' orders.
+func (i Identity) CanSupport() bool {
+	return i.IsAdmin() || i.HasRole(RoleSupport)
+}
+
+// CanAccess reports whether the caller may see an order of a customer.
+func (i Identity) CanAccess(customerID string) bool {
+	return i.CustomerID == customerID || i.CanSupport()
+}
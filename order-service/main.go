@@ -1,24 +1,60 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	"slices"
+	"order-service/apiversion"
+	"order-service/cart"
 	"order-service/client"
+	"order-service/clientpolicy"
 	"order-service/config"
+	"order-service/events"
+	"order-service/discovery"
+	"order-service/identity"
+	"order-service/logging"
+	"order-service/metrics"
 	"order-service/model"
+	"order-service/openapi"
+	"order-service/payment"
+	"order-service/money"
+	"order-service/pricing"
+	"order-service/render"
+	"order-service/store"
 	order_product_pb "order-service/proto/orderproduct"
-	"time"
+	"order-service/tlsconfig"
+	"order-service/tracing"
+	"order-service/webhook"
+	"shared/patch"
 
 	"github.com/gorilla/mux"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
+	"google.golang.org/grpc/status"
 )
 
-var orders []model.Order
+// openapiJSON describes the HTTP API. Keep it in step with the routes below;
+// the service warns at startup about routes it does not cover.
+//
+//go:embed openapi.json
+var openapiJSON []byte
+
+var outbox = events.NewOutbox("order-service")
+var orders = store.NewOrders(outbox)
 var productClient *client.ProductClient
+var rates *money.Rates
+var pricer *pricing.Engine
 
 func main() {
 	// Load configuration
@@ -26,54 +62,277 @@ func main() {
 	if err != nil {
 		log.Fatal("Cannot load config:", err)
 	}
+	logging.New("order-service", cfg.LogLevel)
+	slog.Info("configuration loaded", "config", cfg)
+
+	// Set up tracing
+	shutdownTracing, err := tracing.Init(context.Background(), "order-service", cfg)
+	if err != nil {
+		logging.Fatal("cannot set up tracing", "error", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// Load TLS material
+	certs, err := tlsconfig.New(tlsconfig.Files{
+		CertFile: cfg.TLSCertFile,
+		KeyFile:  cfg.TLSKeyFile,
+		CAFile:   cfg.TLSCAFile,
+	})
+	if err != nil {
+		logging.Fatal("cannot load TLS files", "error", err)
+	}
+	go certs.Watch(context.Background(), cfg.TLSReloadInterval)
+
 	// Setup gRPC connection to product service
-	productAddr := fmt.Sprintf("%s:%s",
-		cfg.ProductServiceHost,
-		cfg.ProductServicePort,
-	)
-	productConn, err := grpc.NewClient(productAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	productEndpoints := discovery.Endpoints{
+		Resolver:        cfg.ProductResolver,
+		Address:         fmt.Sprintf("%s:%s", cfg.ProductServiceHost, cfg.ProductServicePort),
+		Static:          cfg.ProductAddresses,
+		File:            cfg.ProductEndpointsFile,
+		RefreshInterval: cfg.ProductResolveInterval,
+	}
+	productTarget, err := productEndpoints.Target()
+	if err != nil {
+		logging.Fatal("invalid product endpoints", "error", err)
+	}
+	productCreds := insecure.NewCredentials()
+	if certs.ClientEnabled() {
+		productCreds = credentials.NewTLS(certs.ClientConfig())
+	}
+	productPolicy, err := clientpolicy.Policy{
+		Service:          order_product_pb.OrderProductService_ServiceDesc.ServiceName,
+		Timeout:          cfg.ProductCallTimeout,
+		MaxAttempts:      cfg.ProductMaxAttempts,
+		HedgeMethods:     []string{"ValidateProducts"},
+		HedgeDelay:       cfg.ProductHedgeDelay,
+		BreakerThreshold: cfg.ProductBreakerThreshold,
+		BreakerCooldown:  cfg.ProductBreakerCooldown,
+		LoadBalancing:    cfg.ProductLBPolicy,
+	}.DialOptions()
+	if err != nil {
+		logging.Fatal("invalid product client policy", "error", err)
+	}
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(productCreds),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                cfg.GrpcKeepaliveTime,
+			Timeout:             cfg.GrpcKeepaliveTimeout,
+			PermitWithoutStream: true,
+		}),
+		tracing.DialOption(),
+		grpc.WithChainUnaryInterceptor(
+			metrics.UnaryClientInterceptor(),
+			logging.UnaryClientInterceptor(),
+		),
+		grpc.WithChainStreamInterceptor(
+			metrics.StreamClientInterceptor(),
+			logging.StreamClientInterceptor(),
+		),
+	}
+	dialOpts = append(dialOpts, productEndpoints.DialOptions()...)
+	dialOpts = append(dialOpts, productPolicy...)
+	productConn, err := grpc.NewClient(productTarget, dialOpts...)
 	if err != nil {
-		log.Fatalf("Failed to connect to product service: %v", err)
+		logging.Fatal("failed to connect to product service", "error", err)
 	}
 	defer productConn.Close()
 
 	productClient = client.NewProductClient(productConn)
 
+	rates, err = money.ParseRates(cfg.BaseCurrency, cfg.ExchangeRates)
+	if err != nil {
+		logging.Fatal("invalid exchange rates", "error", err)
+	}
+	pricingRules, err := pricing.LoadRules(cfg.PricingRulesFile)
+	if err != nil {
+		logging.Fatal("invalid pricing rules", "error", err)
+	}
+	pricer = pricing.NewEngine(pricingRules, rates)
+
+	paymentProvider, err = newPaymentProvider(cfg.PaymentProvider)
+	if err != nil {
+		logging.Fatal("cannot set up payments", "error", err)
+	}
+	webhookSecret = cfg.PaymentWebhookSecret
+	webhookTolerance = cfg.PaymentWebhookTolerance
+	if webhookSecret == "" {
+		slog.Warn("PAYMENT_WEBHOOK_SECRET is not set, payment webhooks will be rejected")
+	}
+
+	carts = cart.NewStore(cfg.CartTTL)
+	go carts.Run(context.Background(), cfg.CartSweepInterval)
+
+	// Relay domain events. Outbound webhooks consume them from the local
+	// bus, which also gets every event when an external broker is used.
+	// Stock events come from inventory-service, so webhooks only get them
+	// from a broker that can deliver them here.
+	broker, err := events.NewBroker(cfg.EventBroker, cfg.EventBrokerURL)
+	if err != nil {
+		logging.Fatal("cannot set up event broker", "error", err)
+	}
+	defer broker.Close()
+	webhooks = webhook.NewStore(cfg.WebhookLogSize)
+	dispatcher = webhook.NewDispatcher(webhooks, cfg.WebhookTimeout, cfg.WebhookMaxAttempts, cfg.WebhookRetryBase, cfg.WebhookRetryMax)
+	deliver := events.Dedup(10000, dispatcher.Handle)
+	if subscriber, ok := broker.(events.Subscriber); ok {
+		go subscriber.Subscribe(context.Background(), cfg.EventTopicPrefix+events.StockAdjusted, "order-service-webhooks", deliver)
+	} else {
+		slog.Info("event broker cannot deliver stock events, webhooks will not get them", "broker", cfg.EventBroker)
+	}
+	bus, ok := broker.(*events.Bus)
+	if !ok {
+		bus = events.NewBus()
+		broker = events.Fanout{bus, broker}
+	}
+	bus.Subscribe("", deliver)
+	go dispatcher.Run(context.Background(), cfg.WebhookPollInterval)
+	outbox.SetLimit(cfg.EventOutboxLimit)
+	relay := &events.Relay{
+		Outbox:         outbox,
+		Broker:         broker,
+		TopicPrefix:    cfg.EventTopicPrefix,
+		Interval:       cfg.EventRelayInterval,
+		Batch:          cfg.EventRelayBatch,
+		PublishTimeout: cfg.EventPublishTimeout,
+	}
+	go relay.Run(context.Background())
+
 	// Initialize router
 	router := mux.NewRouter()
+	router.Use(tracing.Middleware("order-service"))
+	router.Use(logging.Middleware)
+	router.Use(metrics.Middleware)
+	router.NotFoundHandler = http.HandlerFunc(render.NotFound)
+	router.MethodNotAllowedHandler = http.HandlerFunc(render.MethodNotAllowed)
+
+	// Describe the API and, in development, check traffic against it
+	apiDoc, err := openapi.Load(openapiJSON)
+	if err != nil {
+		logging.Fatal("cannot load API description", "error", err)
+	}
+	validation, err := openapi.ParseMode(cfg.OpenAPIValidation)
+	if err != nil {
+		logging.Fatal("cannot set up API validation", "error", err)
+	}
+	router.Use(apiDoc.Middleware(validation))
+	router.Handle("/openapi.json", apiDoc.Handler()).Methods("GET")
 
 	// Sample data
-	orders = append(orders, model.Order{ID: "1", ProductIDs: []string{"1", "2"}, Total: 1029.98})
+	orders.Add(model.Order{ID: "1", CustomerID: "1", ProductIDs: []string{"1", "2"}, Currency: "USD", Total: money.New(102998, "USD"), Status: payment.StatusPending})
 
 	// Add health check endpoint
 	router.HandleFunc("/health", healthCheck).Methods("GET")
-	// Routes
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
+	// Routes, for every API version. v2 changed the shape of orders; v1 is
+	// still served, at /v1 and without a prefix, until its sunset.
+	apiversion.Mount(router, []apiversion.Version{
+		{Number: 1, Deprecated: cfg.APIV1Deprecated, Sunset: cfg.APIV1Sunset},
+		{Number: 2},
+	}, registerRoutes)
+
+	problems := apiDoc.CheckRoutes(router)
+	for _, problem := range problems {
+		slog.Warn("API description is out of date", "problem", problem)
+	}
+	if len(problems) > 0 && validation == openapi.ModeEnforce {
+		logging.Fatal("API description does not match the routes")
+	}
+
+	serverAddr := fmt.Sprintf("%s:%s", cfg.ServerHost, cfg.ServerPort)
+	slog.Info("Order service is running", "addr", serverAddr, "tls", certs.ServerEnabled())
+	server := &http.Server{Addr: serverAddr, Handler: router}
+	if err := certs.ListenAndServe(server); err != nil {
+		logging.Fatal("server stopped", "error", err)
+	}
+}
+
+// registerRoutes registers the API on a router, once per version.
+func registerRoutes(router *mux.Router) {
 	router.HandleFunc("/orders", GetOrders).Methods("GET")
     router.HandleFunc("/orders/{id}", GetOrder).Methods("GET")
     router.HandleFunc("/orders", CreateOrder).Methods("POST")
+	router.HandleFunc("/orders/quote", QuoteOrder).Methods("POST")
     router.HandleFunc("/orders/{id}", UpdateOrder).Methods("PUT")
+	router.HandleFunc("/orders/{id}", PatchOrder).Methods("PATCH")
     router.HandleFunc("/orders/{id}", DeleteOrder).Methods("DELETE")
-
-	serverAddr := fmt.Sprintf("%s:%s", cfg.ServerHost, cfg.ServerPort)
-	log.Printf("Order service is running on %s", serverAddr)
-	log.Fatal(http.ListenAndServe(serverAddr, router))
+	router.HandleFunc("/orders/{id}/payment", GetPayment).Methods("GET")
+	router.HandleFunc("/orders/{id}/payment/authorize", AuthorizePayment).Methods("POST")
+	router.HandleFunc("/orders/{id}/payment/capture", CapturePayment).Methods("POST")
+	router.HandleFunc("/orders/{id}/payment/void", VoidPayment).Methods("POST")
+	router.HandleFunc("/orders/{id}/payment/refund", RefundPayment).Methods("POST")
+	router.HandleFunc("/payments/webhook", PaymentWebhook).Methods("POST")
+	router.HandleFunc("/webhooks", GetWebhooks).Methods("GET")
+	router.HandleFunc("/webhooks", CreateWebhook).Methods("POST")
+	router.HandleFunc("/webhooks/dead-letters", GetDeadLetters).Methods("GET")
+	router.HandleFunc("/webhooks/deliveries/{id}/redeliver", RedeliverWebhook).Methods("POST")
+	router.HandleFunc("/webhooks/{id}", GetWebhook).Methods("GET")
+	router.HandleFunc("/webhooks/{id}", UpdateWebhook).Methods("PUT")
+	router.HandleFunc("/webhooks/{id}", DeleteWebhook).Methods("DELETE")
+	router.HandleFunc("/webhooks/{id}/deliveries", GetWebhookDeliveries).Methods("GET")
+	router.HandleFunc("/carts", CreateCart).Methods("POST")
+	router.HandleFunc("/carts/{id}", GetCart).Methods("GET")
+	router.HandleFunc("/carts/{id}", UpdateCart).Methods("PUT")
+	router.HandleFunc("/carts/{id}", DeleteCart).Methods("DELETE")
+	router.HandleFunc("/carts/{id}/items", AddCartItem).Methods("POST")
+	router.HandleFunc("/carts/{id}/items/{item}", UpdateCartItem).Methods("PUT")
+	router.HandleFunc("/carts/{id}/items/{item}", DeleteCartItem).Methods("DELETE")
+	router.HandleFunc("/carts/{id}/checkout", CheckoutCart).Methods("POST")
+	router.HandleFunc("/customers/{id}/orders", GetCustomerOrders).Methods("GET")
+	router.HandleFunc("/coupons", GetCoupons).Methods("GET")
+	router.HandleFunc("/coupons", CreateCoupon).Methods("POST")
+	router.HandleFunc("/coupons/{code}", GetCoupon).Methods("GET")
+	router.HandleFunc("/coupons/{code}", DeleteCoupon).Methods("DELETE")
 }
 
+// GetOrders lists the caller's orders, or every order for admins.
 func GetOrders(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(orders)
+	caller, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+	if caller.IsAdmin() {
+		render.Respond(w, r, http.StatusOK, ordersBody(r, orders.List()))
+		return
+	}
+	render.Respond(w, r, http.StatusOK, ordersBody(r, orders.ByCustomer(caller.CustomerID)))
+}
+
+// GetCustomerOrders lists the orders of any customer for support staff.
+func GetCustomerOrders(w http.ResponseWriter, r *http.Request) {
+	caller, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+	if !caller.CanSupport() {
+		render.Error(w, r, http.StatusForbidden, "Forbidden")
+		return
+	}
+	render.Respond(w, r, http.StatusOK, ordersBody(r, orders.ByCustomer(mux.Vars(r)["id"])))
+}
+
+// requireCaller returns the authenticated caller, answering 401 if there is
+// none.
+func requireCaller(w http.ResponseWriter, r *http.Request) (identity.Identity, bool) {
+	caller, ok := identity.FromRequest(r)
+	if !ok {
+		render.Error(w, r, http.StatusUnauthorized, "Unauthorized")
+	}
+	return caller, ok
 }
 
 func GetOrder(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+	caller, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
 	params := mux.Vars(r)
-	for _, item := range orders {
-		if item.ID == params["id"] {
-			json.NewEncoder(w).Encode(item)
-			return
-		}
+	// Other customers' orders look like missing ones
+	item, ok := orders.Get(params["id"])
+	if !ok || !caller.CanAccess(item.CustomerID) {
+		render.Error(w, r, http.StatusNotFound, "Order not found")
+		return
 	}
-	json.NewEncoder(w).Encode(&model.Order{})
+	render.Respond(w, r, http.StatusOK, orderBody(r, item))
 }
 
 
@@ -86,80 +345,496 @@ func healthCheck(w http.ResponseWriter, r *http.Request) {
 }
 
 func CreateOrder(w http.ResponseWriter, r *http.Request) {
-	var order model.Order
-	if err := json.NewDecoder(r.Body).Decode(&order); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	caller, ok := requireCaller(w, r)
+	if !ok {
 		return
 	}
-
-	//Validate products through gRPC
-	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-	defer cancel()
-
-	resp, err := productClient.ValidateProducts(ctx, order.ProductIDs)
-	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+	var order model.Order
+	if err := decodeOrder(r, &order); err != nil {
+		metrics.OrderRejected("bad_request")
+		render.Error(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
+	order.CustomerID = caller.CustomerID
+	if order.ID == "" {
+		order.ID = newOrderID()
+	}
 
-	if !resp.Valid {
-		http.Error(w, resp.Error, http.StatusBadRequest)
+	if reason, status, err := placeOrder(r.Context(), &order); err != nil {
+		metrics.OrderRejected(reason)
+		render.Error(w, r, status, err.Error())
 		return
 	}
 
-	// Calculate total from validated products
-	var total float64
-	for _, product := range resp.Products {
-		total += product.Price
+	render.Respond(w, r, http.StatusOK, orderBody(r, order))
+}
+
+// placeOrder prices an order, redeeming its coupon, takes its items out of
+// stock and stores it. Orders for more than is in stock are refused. On
+// failure it returns a rejection reason for metrics and an HTTP status.
+func placeOrder(ctx context.Context, order *model.Order) (string, int, error) {
+	if _, exists := orders.Get(order.ID); exists && order.ID != "" {
+		return "bad_request", http.StatusConflict, store.ErrExists
 	}
-	order.Total = total
-	order.Status = "pending"
+	products, reason, code, err := validateOrder(ctx, order)
+	if err != nil {
+		return reason, code, err
+	}
+	for i, item := range order.Items {
+		if item.Quantity > products[i].Quantity {
+			return "out_of_stock", http.StatusConflict, fmt.Errorf("only %d of %s in stock", products[i].Quantity, products[i].Name)
+		}
+	}
+	if reason, status, err := applyPricing(order, products, true); err != nil {
+		return reason, status, err
+	}
+	order.Status = payment.StatusPending
 
-	// Update product stock
-	var orderItems []*order_product_pb.OrderItem
+	// Take the items out of stock. Inventory checks the stock again as it
+	// takes it, so concurrent orders cannot oversell.
+	var taken []*order_product_pb.StockChange
+	for _, item := range order.Items {
+		taken = append(taken, &order_product_pb.StockChange{
+			ProductId: item.ProductID,
+			Sku:       item.SKU,
+			Quantity:  item.Quantity,
+		})
+	}
 	for _, productID := range order.ProductIDs {
-		orderItems = append(orderItems, &order_product_pb.OrderItem{
+		taken = append(taken, &order_product_pb.StockChange{
 			ProductId: productID,
-			Quantity: 1,
+			Quantity:  1,
 		})
 	}
+	if err := productClient.TakeStock(ctx, taken); err != nil {
+		pricer.Release(order.CouponCode)
+		if errors.Is(err, client.ErrOutOfStock) {
+			return "out_of_stock", http.StatusConflict, err
+		}
+		slog.ErrorContext(ctx, "stock update failed", "error", err)
+		if status.Code(err) == codes.Unavailable {
+			return "stock_update_failed", http.StatusServiceUnavailable, err
+		}
+		return "stock_update_failed", http.StatusInternalServerError, err
+	}
+
+	stored, err := orders.Add(*order)
+	if err != nil {
+		pricer.Release(order.CouponCode)
+		if err := productClient.ReturnStock(context.WithoutCancel(ctx), taken); err != nil {
+			slog.ErrorContext(ctx, "cannot return stock of unstored order", "order_id", order.ID, "error", err)
+		}
+		if errors.Is(err, events.ErrOutboxFull) {
+			return "events_backlogged", http.StatusServiceUnavailable, err
+		}
+		return "bad_request", http.StatusConflict, err
+	}
+	*order = stored
+	metrics.OrderCreated(order.Status)
+	return "", 0, nil
+}
 
-	if err := productClient.UpdateStock(ctx, orderItems); err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+// QuoteOrder prices an order exactly as CreateOrder would, without storing
+// it, touching stock or using up its coupon.
+func QuoteOrder(w http.ResponseWriter, r *http.Request) {
+	var order model.Order
+	if err := decodeOrder(r, &order); err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
 		return
 	}
+	if _, status, err := priceOrder(r.Context(), &order, false); err != nil {
+		render.Error(w, r, status, err.Error())
+		return
+	}
+	render.Respond(w, r, http.StatusOK, orderBody(r, order))
+}
 
-	w.Header().Set("Content-Type", "application/json")
-	orders = append(orders, order)
-	json.NewEncoder(w).Encode(order)
+// keepManagedFields copies onto an order sent by a client the fields that
+// only the service changes. Orders never change hands or ID, are priced in
+// their currency, and their status and payment only move with payment
+// events. Items keep the unit price of the stored line for the same product
+// or variant until replaceOrder prices them again.
+func keepManagedFields(order *model.Order, stored model.Order) {
+	order.ID = stored.ID
+	order.CustomerID = stored.CustomerID
+	order.Status = stored.Status
+	order.Payment = stored.Payment
+	order.Currency = stored.Currency
+	order.Pricing = stored.Pricing
+	order.Total = stored.Total
+	for i := range order.Items {
+		item := &order.Items[i]
+		item.UnitPrice = money.New(0, stored.Currency)
+		for _, line := range stored.Items {
+			if line.ProductID == item.ProductID && line.SKU == item.SKU {
+				item.UnitPrice = line.UnitPrice
+				break
+			}
+		}
+	}
 }
 
+// UpdateOrder replaces what a client may change of an order. With If-Match,
+// or a version in the body, it only does so if the order is still as the
+// client last saw it.
 func UpdateOrder(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+	caller, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
 	params := mux.Vars(r)
 	var updatedOrder model.Order
-	json.NewDecoder(r.Body).Decode(&updatedOrder)
+	if err := decodeOrder(r, &updatedOrder); err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	item, ok := orders.Get(params["id"])
+	if !ok || (item.CustomerID != caller.CustomerID && !caller.IsAdmin()) {
+		render.Error(w, r, http.StatusNotFound, "Order not found")
+		return
+	}
+	if !render.IfMatch(r, orderBody(r, item)) {
+		render.PreconditionFailed(w, r)
+		return
+	}
+	if updatedOrder.Version != 0 && updatedOrder.Version != item.Version {
+		render.Error(w, r, http.StatusConflict, store.ErrVersionConflict.Error())
+		return
+	}
+	updatedOrder, status, err := replaceOrder(r.Context(), updatedOrder, item)
+	if err != nil {
+		render.Error(w, r, status, err.Error())
+		return
+	}
+	render.Respond(w, r, http.StatusOK, orderBody(r, updatedOrder))
+}
+
+// PatchOrder changes part of an order, given as a merge patch or JSON Patch
+// against the order as GetOrder returns it in the request's API version. The
+// patched order replaces the one it was applied to, as with UpdateOrder, and
+// a concurrent change makes it fail rather than being undone.
+func PatchOrder(w http.ResponseWriter, r *http.Request) {
+	caller, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
+	params := mux.Vars(r)
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPatchSize))
+	if err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	p, err := patch.Parse(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		patchError(w, r, err)
+		return
+	}
 
-	for i, item := range orders {
-		if item.ID == params["id"] {
-			orders[i] = updatedOrder
-			json.NewEncoder(w).Encode(updatedOrder)
-			return
+	item, ok := orders.Get(params["id"])
+	if !ok || (item.CustomerID != caller.CustomerID && !caller.IsAdmin()) {
+		render.Error(w, r, http.StatusNotFound, "Order not found")
+		return
+	}
+	current := orderBody(r, item)
+	if !render.IfMatch(r, current) {
+		render.PreconditionFailed(w, r)
+		return
+	}
+	doc, err := json.Marshal(current)
+	if err == nil {
+		doc, err = p.Apply(doc)
+	}
+	if err != nil {
+		patchError(w, r, err)
+		return
+	}
+	var patched model.Order
+	if err := decodeOrderFrom(r, bytes.NewReader(doc), &patched); err != nil {
+		patchError(w, r, fmt.Errorf("%w: %v", patch.ErrUnprocessable, err))
+		return
+	}
+	if patched.Version != item.Version {
+		render.Error(w, r, http.StatusConflict, store.ErrVersionConflict.Error())
+		return
+	}
+	patched, status, err := replaceOrder(r.Context(), patched, item)
+	if err != nil {
+		render.Error(w, r, status, err.Error())
+		return
+	}
+	render.Respond(w, r, http.StatusOK, orderBody(r, patched))
+}
+
+// errOrderLocked refuses to change what an order is for once its payment
+// has started.
+var errOrderLocked = errors.New("items, region and coupon of an order cannot change once its payment has started")
+
+// replaceOrder stores updated in place of stored, the order as the caller
+// read it, keeping the fields only the service changes. An update that
+// changes what the order is priced on is priced again, redeeming its coupon
+// if that changed, and only the difference in stock is taken or returned.
+// If the order changed since it was read the update fails and what was taken
+// for it is given back. On failure it returns an HTTP status.
+func replaceOrder(ctx context.Context, updated, stored model.Order) (model.Order, int, error) {
+	keepManagedFields(&updated, stored)
+	var take, give []*order_product_pb.StockChange
+	redeemed := false
+	changed := linesChanged(updated, stored)
+	if changed {
+		if stored.Status != payment.StatusPending || stored.Payment != nil || isAuthorizing(stored.ID) {
+			return model.Order{}, http.StatusConflict, errOrderLocked
+		}
+		redeemed = updated.CouponCode != stored.CouponCode
+		if _, status, err := priceOrder(ctx, &updated, redeemed); err != nil {
+			return model.Order{}, status, err
+		}
+		take, give = stockDifference(stored, updated)
+		if len(take) > 0 {
+			if err := productClient.TakeStock(ctx, take); err != nil {
+				if redeemed {
+					pricer.Release(updated.CouponCode)
+				}
+				if errors.Is(err, client.ErrOutOfStock) {
+					return model.Order{}, http.StatusConflict, err
+				}
+				slog.ErrorContext(ctx, "stock update failed", "order_id", stored.ID, "error", err)
+				return model.Order{}, http.StatusInternalServerError, err
+			}
 		}
 	}
-	http.Error(w, "Order not found", http.StatusNotFound)
+
+	saved, err := orders.Update(stored.ID, func(item *model.Order) error {
+		if item.Version != stored.Version {
+			return store.ErrVersionConflict
+		}
+		// An authorization may have started since the order was read
+		if changed && isAuthorizing(item.ID) {
+			return errOrderLocked
+		}
+		*item = updated
+		return nil
+	})
+	if err != nil {
+		if redeemed {
+			pricer.Release(updated.CouponCode)
+		}
+		if len(take) > 0 {
+			if err := productClient.ReturnStock(context.WithoutCancel(ctx), take); err != nil {
+				slog.ErrorContext(ctx, "cannot return stock of unstored order change", "order_id", stored.ID, "error", err)
+			}
+		}
+		switch {
+		case errors.Is(err, store.ErrVersionConflict), errors.Is(err, errOrderLocked):
+			return model.Order{}, http.StatusConflict, err
+		case errors.Is(err, store.ErrNotFound):
+			return model.Order{}, http.StatusNotFound, errors.New("Order not found")
+		case errors.Is(err, events.ErrOutboxFull):
+			return model.Order{}, http.StatusServiceUnavailable, err
+		}
+		return model.Order{}, http.StatusInternalServerError, err
+	}
+	if redeemed {
+		pricer.Release(stored.CouponCode)
+	}
+	if len(give) > 0 {
+		if err := productClient.ReturnStock(context.WithoutCancel(ctx), give); err != nil {
+			slog.ErrorContext(ctx, "cannot return stock no longer ordered", "order_id", stored.ID, "error", err)
+		}
+	}
+	return saved, 0, nil
 }
 
+// linesChanged reports whether an update changes what an order is priced
+// on: its items, products, region or coupon.
+func linesChanged(order, stored model.Order) bool {
+	if order.Region != stored.Region || order.CouponCode != stored.CouponCode ||
+		!slices.Equal(order.ProductIDs, stored.ProductIDs) || len(order.Items) != len(stored.Items) {
+		return true
+	}
+	for i, item := range order.Items {
+		line := stored.Items[i]
+		if item.ProductID != line.ProductID || item.SKU != line.SKU || item.Quantity != line.Quantity {
+			return true
+		}
+	}
+	return false
+}
+
+// stockDifference returns the stock an updated order needs on top of what
+// its stored version took, and the stock it no longer needs.
+func stockDifference(stored, updated model.Order) (take, give []*order_product_pb.StockChange) {
+	type key struct{ productID, sku string }
+	delta := make(map[key]int32)
+	var keys []key
+	count := func(k key, n int32) {
+		if _, ok := delta[k]; !ok {
+			keys = append(keys, k)
+		}
+		delta[k] += n
+	}
+	for _, item := range updated.Items {
+		count(key{item.ProductID, item.SKU}, item.Quantity)
+	}
+	for _, productID := range updated.ProductIDs {
+		count(key{productID, ""}, 1)
+	}
+	for _, item := range stored.Items {
+		count(key{item.ProductID, item.SKU}, -item.Quantity)
+	}
+	for _, productID := range stored.ProductIDs {
+		count(key{productID, ""}, -1)
+	}
+	for _, k := range keys {
+		change := &order_product_pb.StockChange{ProductId: k.productID, Sku: k.sku, Quantity: delta[k]}
+		switch {
+		case change.Quantity > 0:
+			take = append(take, change)
+		case change.Quantity < 0:
+			change.Quantity = -change.Quantity
+			give = append(give, change)
+		}
+	}
+	return take, give
+}
+
+// maxPatchSize limits the size of PATCH bodies.
+const maxPatchSize = 1 << 20
+
+// patchError answers a patch that cannot be read or applied, listing the
+// formats accepted when it is in neither.
+func patchError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, patch.ErrUnsupportedType) {
+		w.Header().Set("Accept-Patch", patch.Accepted)
+	}
+	render.Error(w, r, patch.Status(err), err.Error())
+}
+
+// DeleteOrder removes an order that has no payment, returning its stock and
+// the use of its coupon.
 func DeleteOrder(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+	caller, ok := requireCaller(w, r)
+	if !ok {
+		return
+	}
 	params := mux.Vars(r)
 
-	for i, item := range orders {
-		if item.ID == params["id"] {
-			orders = append(orders[:i], orders[i+1:]...)
-			w.WriteHeader(http.StatusNoContent)
-			return
+	item, ok := orders.Get(params["id"])
+	if !ok || (item.CustomerID != caller.CustomerID && !caller.IsAdmin()) {
+		render.Error(w, r, http.StatusNotFound, "Order not found")
+		return
+	}
+	deleted, err := orders.Delete(item.ID, func(o model.Order) error {
+		if o.Payment != nil || isAuthorizing(o.ID) {
+			return errOrderPaid
+		}
+		return nil
+	})
+	if err != nil {
+		switch {
+		case errors.Is(err, errOrderPaid):
+			render.Error(w, r, http.StatusConflict, err.Error())
+		case errors.Is(err, store.ErrNotFound):
+			render.Error(w, r, http.StatusNotFound, "Order not found")
+		case errors.Is(err, events.ErrOutboxFull):
+			render.Error(w, r, http.StatusServiceUnavailable, err.Error())
+		default:
+			render.Error(w, r, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+
+	// Give back what placing the order took
+	if deleted.CouponCode != "" {
+		pricer.Release(deleted.CouponCode)
+	}
+	if _, give := stockDifference(deleted, model.Order{}); len(give) > 0 {
+		if err := productClient.ReturnStock(context.WithoutCancel(r.Context()), give); err != nil {
+			slog.ErrorContext(r.Context(), "cannot return stock of deleted order", "order_id", deleted.ID, "error", err)
+		}
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// errOrderPaid refuses to delete an order whose payment has started; it is
+// refunded or cancelled through its payment instead.
+var errOrderPaid = errors.New("an order cannot be deleted once its payment has started")
+
+// priceOrder validates the products of an order through product-service and
+// fills in its unit prices, pricing breakdown and total in the order's
+// currency. With redeem set the order's coupon is used up. On failure it
+// returns a rejection reason for metrics and an HTTP status.
+func priceOrder(ctx context.Context, order *model.Order, redeem bool) (string, int, error) {
+	products, reason, status, err := validateOrder(ctx, order)
+	if err != nil {
+		return reason, status, err
+	}
+	return applyPricing(order, products, redeem)
+}
+
+// validateOrder checks the products of an order through product-service and
+// returns their details, items first and then the bare product IDs.
+func validateOrder(ctx context.Context, order *model.Order) ([]*order_product_pb.ProductInfo, string, int, error) {
+	var refs []*order_product_pb.ProductRef
+	for _, item := range order.Items {
+		if item.Quantity <= 0 {
+			return nil, "bad_request", http.StatusBadRequest, errors.New("item quantity must be positive")
 		}
+		refs = append(refs, &order_product_pb.ProductRef{ProductId: item.ProductID, Sku: item.SKU})
+	}
+
+	if order.Currency == "" {
+		order.Currency = rates.Base()
+	}
+	if !rates.Supports(order.Currency) {
+		return nil, "bad_request", http.StatusBadRequest, fmt.Errorf("unsupported currency %s", order.Currency)
+	}
+
+	//Validate products through gRPC
+	resp, err := productClient.ValidateProducts(ctx, order.Currency, order.ProductIDs, refs...)
+	if err != nil {
+		slog.ErrorContext(ctx, "product validation failed", "error", err)
+		if status.Code(err) == codes.Unavailable {
+			return nil, "validation_failed", http.StatusServiceUnavailable, err
+		}
+		return nil, "validation_failed", http.StatusInternalServerError, err
+	}
+	if !resp.Valid {
+		return nil, "invalid_products", http.StatusBadRequest, errors.New(resp.Error)
+	}
+	return resp.Products, "", 0, nil
+}
+
+// applyPricing prices validated products for an order. Prices the product
+// service could only give in another currency are converted.
+func applyPricing(order *model.Order, products []*order_product_pb.ProductInfo, redeem bool) (string, int, error) {
+	req := pricing.Request{Currency: order.Currency, Region: order.Region, Coupon: order.CouponCode}
+	for i, product := range products {
+		p := product.GetUnitPrice()
+		unitPrice, err := rates.Convert(money.New(p.GetMinorUnits(), p.GetCurrencyCode()), order.Currency)
+		if err != nil {
+			return "bad_request", http.StatusBadRequest, fmt.Errorf("cannot price product %s: %w", product.Id, err)
+		}
+		line := pricing.Line{ProductID: product.Id, Quantity: 1, ListPrice: unitPrice}
+		if i < len(order.Items) {
+			line.SKU = order.Items[i].SKU
+			line.Quantity = order.Items[i].Quantity
+		}
+		req.Lines = append(req.Lines, line)
+	}
+
+	quote := pricer.Quote
+	if redeem {
+		quote = pricer.Redeem
+	}
+	breakdown, err := quote(req)
+	if err != nil {
+		return "bad_request", http.StatusBadRequest, err
+	}
+	for i := range order.Items {
+		order.Items[i].UnitPrice = breakdown.Lines[i].UnitPrice
 	}
-	http.Error(w, "Order not found", http.StatusNotFound)
+	order.Pricing = &breakdown
+	order.Total = breakdown.Total
+	return "", 0, nil
 }
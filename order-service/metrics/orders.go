@@ -0,0 +1,27 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var ordersCreated = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "orders_created_total",
+	Help: "Number of orders created, by initial status.",
+}, []string{"status"})
+
+var ordersRejected = promauto.NewCounterVec(prometheus.CounterOpts{
+	Name: "orders_rejected_total",
+	Help: "Number of order submissions rejected, by reason.",
+}, []string{"reason"})
+
+// OrderCreated counts a newly stored order.
+func OrderCreated(status string) {
+	ordersCreated.WithLabelValues(status).Inc()
+}
+
+// OrderRejected counts an order that was not stored. Reason must come from a
+// small fixed set to keep label cardinality bounded.
+func OrderRejected(reason string) {
+	ordersRejected.WithLabelValues(reason).Inc()
+}
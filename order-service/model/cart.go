@@ -0,0 +1,33 @@
+package model
+
+import (
+	"order-service/money"
+	"time"
+)
+
+// Cart collects items before checkout for the customer who created it. It
+// expires when left untouched.
+type Cart struct {
+	ID         string     `json:"id"`
+	CustomerID string     `json:"customer_id"`
+	Items      []CartItem `json:"items"`
+	Currency   string     `json:"currency,omitempty"`
+	Region     string     `json:"region,omitempty"`
+	CouponCode string     `json:"coupon_code,omitempty"`
+	CreatedAt  time.Time  `json:"created_at"`
+	UpdatedAt  time.Time  `json:"updated_at"`
+	ExpiresAt  time.Time  `json:"expires_at"`
+}
+
+// CartItem is a quantity of a product, or of one of its variants when SKU is
+// set. Name, UnitPrice and Available are filled in from product-service when
+// the cart is read.
+type CartItem struct {
+	ID        string       `json:"id"`
+	ProductID string       `json:"product_id"`
+	SKU       string       `json:"sku,omitempty"`
+	Quantity  int32        `json:"quantity"`
+	Name      string       `json:"name,omitempty"`
+	UnitPrice *money.Money `json:"unit_price,omitempty"`
+	Available *int32       `json:"available,omitempty"`
+}
@@ -1,8 +1,42 @@
 package model
 
+import (
+	"order-service/money"
+	"order-service/pricing"
+)
+
 type Order struct {
-	ID         string   `json:"id"`
-	ProductIDs []string `json:"product_ids"`
-	Total      float64  `json:"total"`
-	Status     string   `json:"status"`
-}
\ No newline at end of file
+	ID         string             `json:"id"`
+	CustomerID string             `json:"customer_id"`
+	ProductIDs []string           `json:"product_ids"`
+	Items      []OrderItem        `json:"items,omitempty"`
+	Currency   string             `json:"currency"`
+	Region     string             `json:"region,omitempty"`
+	CouponCode string             `json:"coupon_code,omitempty"`
+	Pricing    *pricing.Breakdown `json:"pricing,omitempty"`
+	Total      money.Money        `json:"total"`
+	Status     string             `json:"status"`
+	Payment    *Payment           `json:"payment,omitempty"`
+	// Version counts the changes to the order, starting at 1. Sent back on
+	// an update, it must still be current.
+	Version int64 `json:"version"`
+}
+
+// OrderItem orders a quantity of a product, or of one of its variants when
+// SKU is set.
+type OrderItem struct {
+	ProductID string      `json:"product_id"`
+	SKU       string      `json:"sku,omitempty"`
+	Quantity  int32       `json:"quantity"`
+	UnitPrice money.Money `json:"unit_price"`
+}
+
+// Payment is the state of the payment for an order.
+type Payment struct {
+	ID            string      `json:"id"`
+	Provider      string      `json:"provider"`
+	Authorized    money.Money `json:"authorized"`
+	Captured      money.Money `json:"captured"`
+	Refunded      money.Money `json:"refunded"`
+	FailureReason string      `json:"failure_reason,omitempty"`
+}
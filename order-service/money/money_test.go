@@ -0,0 +1,264 @@
+package money
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		amount, currency string
+		want             int64
+		ok               bool
+	}{
+		{"999.99", "USD", 99999, true},
+		{"999.9", "USD", 99990, true},
+		{"999", "USD", 99900, true},
+		{"999.", "USD", 99900, true},
+		{".5", "USD", 50, true},
+		{"0.01", "USD", 1, true},
+		{"-0.01", "USD", -1, true},
+		{"-12.5", "USD", -1250, true},
+		{"+3", "USD", 300, true},
+		{"1.001", "USD", 0, false},
+		{"500", "JPY", 500, true},
+		{"-500", "JPY", -500, true},
+		{"500.0", "JPY", 0, false},
+		{"1.234", "BHD", 1234, true},
+		{"1.2", "BHD", 1200, true},
+		{"-0.005", "BHD", -5, true},
+		{"1.2345", "BHD", 0, false},
+		{"92233720368547758.07", "USD", math.MaxInt64, true},
+		{"92233720368547758.08", "USD", 0, false},
+		{"-92233720368547758.08", "USD", math.MinInt64, true},
+		{"", "USD", 0, false},
+		{".", "USD", 0, false},
+		{"-", "USD", 0, false},
+		{"1.2.3", "BHD", 0, false},
+		{"1e3", "USD", 0, false},
+		{" 1", "USD", 0, false},
+		{"1", "XXX", 0, false},
+		{"1", "usd", 0, false},
+	}
+	for _, tt := range tests {
+		got, err := Parse(tt.amount, tt.currency)
+		if !tt.ok {
+			if err == nil {
+				t.Errorf("Parse(%q, %s) = %v, want an error", tt.amount, tt.currency, got)
+			}
+			continue
+		}
+		if err != nil || got != New(tt.want, tt.currency) {
+			t.Errorf("Parse(%q, %s) = %v, %v, want %d", tt.amount, tt.currency, got, err, tt.want)
+		}
+	}
+}
+
+func TestDecimal(t *testing.T) {
+	tests := []struct {
+		m    Money
+		want string
+	}{
+		{New(99999, "USD"), "999.99"},
+		{New(5, "USD"), "0.05"},
+		{New(0, "USD"), "0.00"},
+		{New(-5, "USD"), "-0.05"},
+		{New(-12345, "USD"), "-123.45"},
+		{New(500, "JPY"), "500"},
+		{New(-500, "JPY"), "-500"},
+		{New(1234, "BHD"), "1.234"},
+		{New(5, "BHD"), "0.005"},
+		{New(-5, "BHD"), "-0.005"},
+		{New(math.MaxInt64, "USD"), "92233720368547758.07"},
+		{New(math.MinInt64, "USD"), "-92233720368547758.08"},
+		{New(math.MinInt64, "JPY"), "-9223372036854775808"},
+		{New(12, "XXX"), "12"},
+	}
+	for _, tt := range tests {
+		if got := tt.m.Decimal(); got != tt.want {
+			t.Errorf("Decimal of %d %s = %s, want %s", tt.m.Amount, tt.m.Currency, got, tt.want)
+		}
+		if tt.m.Currency == "XXX" {
+			continue
+		}
+		// What Decimal writes, Parse reads back
+		if back, err := Parse(tt.want, tt.m.Currency); err != nil || back != tt.m {
+			t.Errorf("Parse(Decimal(%v)) = %v, %v", tt.m, back, err)
+		}
+	}
+	if got := New(-12345, "USD").String(); got != "-123.45 USD" {
+		t.Errorf("String = %s", got)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	for _, m := range []Money{New(0, "USD"), New(1, "JPY"), New(1, "BHD")} {
+		if err := m.Validate(); err != nil {
+			t.Errorf("Validate(%v) = %v", m, err)
+		}
+	}
+	for _, m := range []Money{New(-1, "USD"), New(1, "XXX"), New(1, "")} {
+		if err := m.Validate(); err == nil {
+			t.Errorf("Validate(%v) accepted it", m)
+		}
+	}
+}
+
+func TestAdd(t *testing.T) {
+	tests := []struct {
+		a, b Money
+		want Money
+		err  bool
+	}{
+		{New(150, "USD"), New(250, "USD"), New(400, "USD"), false},
+		{New(150, "USD"), New(-250, "USD"), New(-100, "USD"), false},
+		{New(-150, "BHD"), New(-250, "BHD"), New(-400, "BHD"), false},
+		{Money{}, New(500, "JPY"), New(500, "JPY"), false},
+		{New(0, "USD"), New(0, "USD"), New(0, "USD"), false},
+		{New(math.MaxInt64, "USD"), New(0, "USD"), New(math.MaxInt64, "USD"), false},
+		{New(math.MaxInt64, "USD"), New(1, "USD"), Money{}, true},
+		{New(math.MinInt64, "USD"), New(-1, "USD"), Money{}, true},
+		{New(math.MinInt64, "USD"), New(math.MaxInt64, "USD"), New(-1, "USD"), false},
+		{New(100, "USD"), New(100, "JPY"), Money{}, true},
+	}
+	for _, tt := range tests {
+		got, err := tt.a.Add(tt.b)
+		if tt.err != (err != nil) || got != tt.want {
+			t.Errorf("%v + %v = %v, %v", tt.a, tt.b, got, err)
+		}
+	}
+	if _, err := New(100, "USD").Add(New(100, "JPY")); !errors.Is(err, ErrCurrencyMismatch) {
+		t.Errorf("adding JPY to USD: %v, want ErrCurrencyMismatch", err)
+	}
+}
+
+func TestMul(t *testing.T) {
+	tests := []struct {
+		m    Money
+		n    int64
+		want Money
+		err  bool
+	}{
+		{New(1999, "USD"), 3, New(5997, "USD"), false},
+		{New(1999, "USD"), 0, New(0, "USD"), false},
+		{New(1999, "USD"), -2, New(-3998, "USD"), false},
+		{New(-500, "JPY"), -2, New(1000, "JPY"), false},
+		{New(math.MaxInt64, "USD"), 1, New(math.MaxInt64, "USD"), false},
+		{New(math.MaxInt64, "USD"), 2, Money{}, true},
+		{New(math.MaxInt64/2+1, "USD"), 2, Money{}, true},
+		{New(math.MinInt64/2, "USD"), 2, New(math.MinInt64, "USD"), false},
+		{New(math.MinInt64, "USD"), -1, Money{}, true},
+		{New(-1, "USD"), math.MinInt64, Money{}, true},
+		{New(0, "USD"), math.MinInt64, New(0, "USD"), false},
+		{New(1, "USD"), math.MinInt64, New(math.MinInt64, "USD"), false},
+	}
+	for _, tt := range tests {
+		got, err := tt.m.Mul(tt.n)
+		if tt.err != (err != nil) || got != tt.want {
+			t.Errorf("%v * %d = %v, %v", tt.m, tt.n, got, err)
+		}
+	}
+}
+
+func TestJSON(t *testing.T) {
+	data, err := json.Marshal(New(1234, "BHD"))
+	if err != nil || string(data) != `{"amount":1234,"currency":"BHD"}` {
+		t.Fatalf("Marshal = %s, %v", data, err)
+	}
+	var m Money
+	if err := json.Unmarshal(data, &m); err != nil || m != New(1234, "BHD") {
+		t.Errorf("Unmarshal = %v, %v", m, err)
+	}
+}
+
+func TestConvert(t *testing.T) {
+	rates, err := ParseRates("USD", "JPY=150, eur = 0.5, BHD=0.376, KWD=0.3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		m    Money
+		to   string
+		want int64
+	}{
+		{New(100, "USD"), "USD", 100},
+		{New(1000, "USD"), "JPY", 1500},
+		{New(1000, "USD"), "EUR", 500},
+		{New(1000, "USD"), "BHD", 3760},
+		// Half-way cases round to even
+		{New(1, "USD"), "JPY", 2},   // 1.5
+		{New(3, "USD"), "JPY", 4},   // 4.5
+		{New(5, "USD"), "JPY", 8},   // 7.5
+		{New(1, "USD"), "EUR", 0},   // 0.5
+		{New(3, "USD"), "EUR", 2},   // 1.5
+		{New(-1, "USD"), "JPY", -2}, // -1.5
+		{New(-3, "USD"), "JPY", -4}, // -4.5
+		{New(-3, "USD"), "EUR", -2}, // -1.5
+		// Off half-way, to the nearest
+		{New(7, "USD"), "EUR", 4}, // 3.5 -> 4
+		{New(1, "JPY"), "USD", 1}, // 0.666...
+		{New(-1, "JPY"), "USD", -1},
+		{New(2, "EUR"), "USD", 4},
+		// Between two non-base currencies, through the base
+		{New(500, "JPY"), "EUR", 167},   // 3.333... EUR
+		{New(500, "JPY"), "BHD", 1253},  // 1.25333... BHD
+		{New(1253, "BHD"), "JPY", 500},  // 499.867...
+		{New(1000, "KWD"), "BHD", 1253}, // 1.25333... BHD
+	}
+	for _, tt := range tests {
+		got, err := rates.Convert(tt.m, tt.to)
+		if err != nil || got != New(tt.want, tt.to) {
+			t.Errorf("Convert(%v, %s) = %v, %v, want %d", tt.m, tt.to, got, err, tt.want)
+		}
+	}
+
+	if _, err := rates.Convert(New(math.MaxInt64, "USD"), "JPY"); err == nil {
+		t.Error("converting MaxInt64 cents to JPY did not overflow")
+	}
+	if _, err := rates.Convert(New(100, "GBP"), "USD"); err == nil {
+		t.Error("converted from a currency without a rate")
+	}
+	if _, err := rates.Convert(New(100, "USD"), "GBP"); err == nil {
+		t.Error("converted to a currency without a rate")
+	}
+	if !rates.Supports("EUR") || !rates.Supports("USD") || rates.Supports("GBP") || rates.Base() != "USD" {
+		t.Error("Supports or Base disagree with the table")
+	}
+}
+
+func TestParseRates(t *testing.T) {
+	for _, table := range []string{"", " ", "EUR=0.92", "EUR=0.92,GBP=0.79,", "EUR=23/25"} {
+		if _, err := ParseRates("USD", table); err != nil {
+			t.Errorf("ParseRates(%q) = %v", table, err)
+		}
+	}
+	for _, table := range []string{"EUR", "EUR=", "EUR=0", "EUR=-1", "EUR=abc", "XXX=1"} {
+		if _, err := ParseRates("USD", table); err == nil {
+			t.Errorf("ParseRates(%q) accepted it", table)
+		}
+	}
+	if _, err := ParseRates("XXX", ""); err == nil {
+		t.Error("ParseRates accepted an unsupported base")
+	}
+}
+
+func TestPriceList(t *testing.T) {
+	list := PriceList{New(999, "USD"), New(1500, "JPY")}
+	if m, ok := list.In("JPY"); !ok || m != New(1500, "JPY") {
+		t.Errorf("In(JPY) = %v, %v", m, ok)
+	}
+	if _, ok := list.In("EUR"); ok {
+		t.Error("In(EUR) found a price")
+	}
+	if err := list.Validate(); err != nil {
+		t.Error(err)
+	}
+	if err := append(list, New(1, "USD")).Validate(); err == nil {
+		t.Error("Validate accepted two USD prices")
+	}
+	if err := (PriceList{New(-1, "USD")}).Validate(); err == nil {
+		t.Error("Validate accepted a negative price")
+	}
+}
@@ -0,0 +1,31 @@
+package money
+
+import "fmt"
+
+// PriceList holds at most one price per currency.
+type PriceList []Money
+
+// In returns the price in the given currency.
+func (l PriceList) In(currency string) (Money, bool) {
+	for _, m := range l {
+		if m.Currency == currency {
+			return m, true
+		}
+	}
+	return Money{}, false
+}
+
+// Validate checks every price and that no currency appears twice.
+func (l PriceList) Validate() error {
+	seen := make(map[string]bool, len(l))
+	for _, m := range l {
+		if err := m.Validate(); err != nil {
+			return err
+		}
+		if seen[m.Currency] {
+			return fmt.Errorf("duplicate price in %s", m.Currency)
+		}
+		seen[m.Currency] = true
+	}
+	return nil
+}
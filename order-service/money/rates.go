@@ -0,0 +1,106 @@
+package money
+
+import (
+	"fmt"
+	"math/big"
+	"strings"
+)
+
+// Rates converts between currencies through a base currency. Rates are kept
+// as exact fractions so conversions round only once.
+type Rates struct {
+	base  string
+	rates map[string]*big.Rat
+}
+
+// ParseRates reads a table such as "EUR=0.92,GBP=0.79", giving how many units
+// of each currency one unit of base buys.
+func ParseRates(base, table string) (*Rates, error) {
+	if _, err := Exponent(base); err != nil {
+		return nil, err
+	}
+	r := &Rates{base: base, rates: map[string]*big.Rat{base: big.NewRat(1, 1)}}
+	for _, entry := range strings.Split(table, ",") {
+		entry = strings.TrimSpace(entry)
+		if entry == "" {
+			continue
+		}
+		currency, value, ok := strings.Cut(entry, "=")
+		if !ok {
+			return nil, fmt.Errorf("invalid exchange rate %q", entry)
+		}
+		currency = strings.ToUpper(strings.TrimSpace(currency))
+		if _, err := Exponent(currency); err != nil {
+			return nil, err
+		}
+		rate, ok := new(big.Rat).SetString(strings.TrimSpace(value))
+		if !ok || rate.Sign() <= 0 {
+			return nil, fmt.Errorf("invalid exchange rate for %s: %q", currency, value)
+		}
+		r.rates[currency] = rate
+	}
+	return r, nil
+}
+
+// Base returns the base currency.
+func (r *Rates) Base() string {
+	return r.base
+}
+
+// Supports reports whether amounts can be converted to and from currency.
+func (r *Rates) Supports(currency string) bool {
+	_, ok := r.rates[currency]
+	return ok
+}
+
+// Convert expresses m in another currency, rounding half to even to the
+// target's minor unit.
+func (r *Rates) Convert(m Money, to string) (Money, error) {
+	if m.Currency == to {
+		return m, nil
+	}
+	from, ok := r.rates[m.Currency]
+	if !ok {
+		return Money{}, fmt.Errorf("no exchange rate for %s", m.Currency)
+	}
+	rate, ok := r.rates[to]
+	if !ok {
+		return Money{}, fmt.Errorf("no exchange rate for %s", to)
+	}
+	fromExp, _ := Exponent(m.Currency)
+	toExp, _ := Exponent(to)
+
+	// amount * rate(to) / rate(from), rescaled between minor units
+	x := new(big.Rat).SetInt64(m.Amount)
+	x.Mul(x, rate)
+	x.Quo(x, from)
+	x.Mul(x, new(big.Rat).SetFrac(pow10(toExp), pow10(fromExp)))
+
+	n, err := roundHalfEven(x)
+	if err != nil {
+		return Money{}, err
+	}
+	return Money{Amount: n, Currency: to}, nil
+}
+
+func roundHalfEven(x *big.Rat) (int64, error) {
+	q, rem := new(big.Int).QuoRem(x.Num(), x.Denom(), new(big.Int))
+	// Compare twice the remainder with the denominator
+	twice := new(big.Int).Abs(rem)
+	twice.Lsh(twice, 1)
+	if c := twice.Cmp(x.Denom()); c > 0 || (c == 0 && q.Bit(0) == 1) {
+		if x.Sign() < 0 {
+			q.Sub(q, big.NewInt(1))
+		} else {
+			q.Add(q, big.NewInt(1))
+		}
+	}
+	if !q.IsInt64() {
+		return 0, fmt.Errorf("amount overflows")
+	}
+	return q.Int64(), nil
+}
+
+func pow10(n int) *big.Int {
+	return new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(n)), nil)
+}
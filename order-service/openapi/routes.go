@@ -0,0 +1,45 @@
+package openapi
+
+import (
+	"slices"
+
+	"github.com/gorilla/mux"
+)
+
+// CheckRoutes compares the routes registered on router with the document and
+// returns one message for every route that is not described and every
+// described operation that no route serves. Routes without a method, such as
+// proxied prefixes, are not compared, and versioned routes may be described
+// by their unversioned path.
+func (d *Document) CheckRoutes(router *mux.Router) []string {
+	var problems []string
+	served := make(map[string]bool)
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			described, op := d.find(path, method)
+			if op == nil {
+				problems = append(problems, method+" "+path+" is served but not described")
+				continue
+			}
+			served[method+" "+described] = true
+		}
+		return nil
+	})
+	for path, item := range d.Paths {
+		for method := range item.Operations() {
+			if !served[method+" "+path] {
+				problems = append(problems, method+" "+path+" is described but not served")
+			}
+		}
+	}
+	slices.Sort(problems)
+	return slices.Compact(problems)
+}
@@ -0,0 +1,279 @@
+// Package openapi loads a service's OpenAPI 3 description, serves it, checks
+// it against the routes the service registers and, in development, checks
+// live requests and responses against it.
+//
+// Only the parts of OpenAPI the services use are understood: paths with
+// path, query and header parameters, JSON request and response bodies, and
+// schemas built from type, format, enum, nullable, properties, required,
+// additionalProperties, items and the numeric, length and size limits.
+// References may point at components.schemas, components.parameters and
+// components.responses.
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"regexp"
+	"strings"
+)
+
+// Document is a parsed OpenAPI description.
+type Document struct {
+	OpenAPI    string               `json:"openapi"`
+	Paths      map[string]*PathItem `json:"paths"`
+	Components Components           `json:"components"`
+
+	raw []byte
+}
+
+type Components struct {
+	Schemas    map[string]*Schema    `json:"schemas"`
+	Parameters map[string]*Parameter `json:"parameters"`
+	Responses  map[string]*Response  `json:"responses"`
+}
+
+type PathItem struct {
+	Parameters []*Parameter `json:"parameters"`
+	Get        *Operation   `json:"get"`
+	Put        *Operation   `json:"put"`
+	Post       *Operation   `json:"post"`
+	Delete     *Operation   `json:"delete"`
+	Patch      *Operation   `json:"patch"`
+	Head       *Operation   `json:"head"`
+}
+
+// Operations returns the operations of the item keyed by HTTP method.
+func (p *PathItem) Operations() map[string]*Operation {
+	ops := make(map[string]*Operation)
+	for method, op := range map[string]*Operation{
+		http.MethodGet:    p.Get,
+		http.MethodPut:    p.Put,
+		http.MethodPost:   p.Post,
+		http.MethodDelete: p.Delete,
+		http.MethodPatch:  p.Patch,
+		http.MethodHead:   p.Head,
+	} {
+		if op != nil {
+			ops[method] = op
+		}
+	}
+	return ops
+}
+
+type Operation struct {
+	OperationID string               `json:"operationId"`
+	Parameters  []*Parameter         `json:"parameters"`
+	RequestBody *RequestBody         `json:"requestBody"`
+	Responses   map[string]*Response `json:"responses"`
+}
+
+type Parameter struct {
+	Ref      string  `json:"$ref"`
+	Name     string  `json:"name"`
+	In       string  `json:"in"`
+	Required bool    `json:"required"`
+	Schema   *Schema `json:"schema"`
+}
+
+type RequestBody struct {
+	Required bool                  `json:"required"`
+	Content  map[string]*MediaType `json:"content"`
+}
+
+type Response struct {
+	Ref         string                `json:"$ref"`
+	Description string                `json:"description"`
+	Content     map[string]*MediaType `json:"content"`
+}
+
+type MediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+type Schema struct {
+	Ref                  string             `json:"$ref"`
+	Type                 string             `json:"type"`
+	Format               string             `json:"format"`
+	Nullable             bool               `json:"nullable"`
+	Enum                 []any              `json:"enum"`
+	Properties           map[string]*Schema `json:"properties"`
+	Required             []string           `json:"required"`
+	AdditionalProperties *Additional        `json:"additionalProperties"`
+	Items                *Schema            `json:"items"`
+	Minimum              *float64           `json:"minimum"`
+	Maximum              *float64           `json:"maximum"`
+	MinLength            *int               `json:"minLength"`
+	MaxLength            *int               `json:"maxLength"`
+	MinItems             *int               `json:"minItems"`
+	MaxItems             *int               `json:"maxItems"`
+}
+
+// Additional is the value of additionalProperties: either a boolean or a
+// schema for the values of properties not listed.
+type Additional struct {
+	Allowed bool
+	Schema  *Schema
+}
+
+func (a *Additional) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, &a.Allowed); err == nil {
+		return nil
+	}
+	a.Allowed = true
+	return json.Unmarshal(data, &a.Schema)
+}
+
+// Load parses an OpenAPI 3 document and checks that its references resolve.
+func Load(data []byte) (*Document, error) {
+	var d Document
+	if err := json.Unmarshal(data, &d); err != nil {
+		return nil, fmt.Errorf("parse OpenAPI document: %w", err)
+	}
+	if !strings.HasPrefix(d.OpenAPI, "3.") {
+		return nil, fmt.Errorf("unsupported OpenAPI version %q", d.OpenAPI)
+	}
+	d.raw = data
+	if err := d.check(); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// Handler serves the document as it was loaded.
+func (d *Document) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(d.raw)
+	})
+}
+
+// Operation returns the operation for a path template, written as in the
+// document (/products/{id}), and an HTTP method.
+func (d *Document) Operation(path, method string) (*Operation, bool) {
+	_, op := d.find(path, method)
+	return op, op != nil
+}
+
+// versionPrefix matches the version prefix of a path, such as /v2/.
+var versionPrefix = regexp.MustCompile(`^/v[0-9]+/`)
+
+// find returns the operation for a route's path template and method, and the
+// path that describes it. A route under a version prefix is described by its
+// own path if the document has one and otherwise by the unversioned path, so
+// that only operations whose shape changed in a version are described again.
+func (d *Document) find(template, method string) (string, *Operation) {
+	paths := []string{template}
+	if loc := versionPrefix.FindStringIndex(template); loc != nil {
+		paths = append(paths, template[loc[1]-1:])
+	}
+	for _, path := range paths {
+		if item, ok := d.Paths[path]; ok {
+			if op, ok := item.Operations()[method]; ok {
+				return path, op
+			}
+		}
+	}
+	return template, nil
+}
+
+// parameters returns the parameters of an operation, including those shared
+// by its path, with references resolved.
+func (d *Document) parameters(path string, op *Operation) []*Parameter {
+	var params []*Parameter
+	for _, p := range append(d.Paths[path].Parameters, op.Parameters...) {
+		params = append(params, d.parameter(p))
+	}
+	return params
+}
+
+func (d *Document) parameter(p *Parameter) *Parameter {
+	if p.Ref != "" {
+		return d.Components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+	}
+	return p
+}
+
+func (d *Document) response(r *Response) *Response {
+	if r.Ref != "" {
+		return d.Components.Responses[strings.TrimPrefix(r.Ref, "#/components/responses/")]
+	}
+	return r
+}
+
+func (d *Document) schema(s *Schema) *Schema {
+	for s != nil && s.Ref != "" {
+		s = d.Components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+	}
+	return s
+}
+
+// check reports the first reference that does not resolve.
+func (d *Document) check() error {
+	var walk func(s *Schema, at string) error
+	seen := make(map[*Schema]bool)
+	walk = func(s *Schema, at string) error {
+		if s == nil || seen[s] {
+			return nil
+		}
+		seen[s] = true
+		if s.Ref != "" {
+			if d.schema(s) == nil {
+				return fmt.Errorf("%s: unresolved reference %s", at, s.Ref)
+			}
+			return nil
+		}
+		for name, prop := range s.Properties {
+			if err := walk(prop, at+"."+name); err != nil {
+				return err
+			}
+		}
+		if s.AdditionalProperties != nil {
+			if err := walk(s.AdditionalProperties.Schema, at+".additionalProperties"); err != nil {
+				return err
+			}
+		}
+		return walk(s.Items, at+".items")
+	}
+	for name, s := range d.Components.Schemas {
+		if err := walk(s, "components.schemas."+name); err != nil {
+			return err
+		}
+	}
+	for path, item := range d.Paths {
+		for method, op := range item.Operations() {
+			at := method + " " + path
+			for _, p := range append(item.Parameters, op.Parameters...) {
+				resolved := d.parameter(p)
+				if resolved == nil {
+					return fmt.Errorf("%s: unresolved reference %s", at, p.Ref)
+				}
+				if err := walk(resolved.Schema, at+" parameter "+resolved.Name); err != nil {
+					return err
+				}
+			}
+			if op.RequestBody != nil {
+				for typ, media := range op.RequestBody.Content {
+					if err := walk(media.Schema, at+" request "+typ); err != nil {
+						return err
+					}
+				}
+			}
+			if len(op.Responses) == 0 {
+				return fmt.Errorf("%s: no responses", at)
+			}
+			for code, r := range op.Responses {
+				resolved := d.response(r)
+				if resolved == nil {
+					return fmt.Errorf("%s: unresolved reference %s", at, r.Ref)
+				}
+				for typ, media := range resolved.Content {
+					if err := walk(media.Schema, at+" response "+code+" "+typ); err != nil {
+						return err
+					}
+				}
+			}
+		}
+	}
+	return nil
+}
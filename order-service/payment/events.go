@@ -0,0 +1,166 @@
+package payment
+
+import (
+	"errors"
+	"fmt"
+	"order-service/model"
+	"order-service/money"
+)
+
+// Order statuses driven by payment.
+const (
+	StatusPending           = "pending"
+	StatusAuthorized        = "authorized"
+	StatusPaid              = "paid"
+	StatusPartiallyRefunded = "partially_refunded"
+	StatusRefunded          = "refunded"
+	StatusPaymentFailed     = "payment_failed"
+	StatusCancelled         = "cancelled"
+)
+
+// Event types, raised by our own calls to the provider and received from it
+// by webhook.
+const (
+	EventAuthorized = "payment.authorized"
+	EventFailed     = "payment.failed"
+	EventCaptured   = "payment.captured"
+	EventVoided     = "payment.voided"
+	EventRefunded   = "payment.refunded"
+)
+
+// KnownEvent reports whether Apply handles events of a type.
+func KnownEvent(eventType string) bool {
+	switch eventType {
+	case EventAuthorized, EventFailed, EventCaptured, EventVoided, EventRefunded:
+		return true
+	}
+	return false
+}
+
+// ErrInvalidTransition is returned for an event that does not fit the
+// order's current status.
+var ErrInvalidTransition = errors.New("invalid payment transition")
+
+// ErrInvalidAmount is returned for an amount that a payment cannot take.
+var ErrInvalidAmount = errors.New("invalid payment amount")
+
+// Event is something that happened to a payment.
+type Event struct {
+	ID        string      `json:"id"`
+	Type      string      `json:"type"`
+	PaymentID string      `json:"payment_id"`
+	OrderID   string      `json:"order_id,omitempty"`
+	Amount    money.Money `json:"amount"`
+	Reason    string      `json:"reason,omitempty"`
+}
+
+// Apply moves an order to the status implied by a payment event. Amounts
+// default to everything that is left: the order total to authorize, the
+// authorization to capture, the captured amount to refund. An amount given
+// must pass CheckAmount against that.
+func Apply(o *model.Order, ev Event, provider string) error {
+	p := o.Payment
+	if ev.Type != EventAuthorized && ev.Type != EventFailed && (p == nil || p.ID != ev.PaymentID) {
+		return fmt.Errorf("%w: payment %s does not belong to order %s", ErrInvalidTransition, ev.PaymentID, o.ID)
+	}
+
+	switch ev.Type {
+	case EventAuthorized:
+		if p != nil && p.ID == ev.PaymentID && o.Status == StatusAuthorized {
+			return nil
+		}
+		if err := expect(o, StatusPending, StatusPaymentFailed); err != nil {
+			return err
+		}
+		amount, err := eventAmount(ev.Amount, o.Total)
+		if err != nil {
+			return err
+		}
+		o.Payment = &model.Payment{
+			ID:         ev.PaymentID,
+			Provider:   provider,
+			Authorized: amount,
+			Captured:   money.New(0, amount.Currency),
+			Refunded:   money.New(0, amount.Currency),
+		}
+		o.Status = StatusAuthorized
+	case EventFailed:
+		if err := expect(o, StatusPending, StatusPaymentFailed); err != nil {
+			return err
+		}
+		none := money.New(0, o.Total.Currency)
+		o.Payment = &model.Payment{
+			ID:            ev.PaymentID,
+			Provider:      provider,
+			Authorized:    none,
+			Captured:      none,
+			Refunded:      none,
+			FailureReason: ev.Reason,
+		}
+		o.Status = StatusPaymentFailed
+	case EventCaptured:
+		if err := expect(o, StatusAuthorized); err != nil {
+			return err
+		}
+		amount, err := eventAmount(ev.Amount, p.Authorized)
+		if err != nil {
+			return err
+		}
+		p.Captured = amount
+		o.Status = StatusPaid
+	case EventVoided:
+		if err := expect(o, StatusAuthorized); err != nil {
+			return err
+		}
+		o.Status = StatusCancelled
+	case EventRefunded:
+		if err := expect(o, StatusPaid, StatusPartiallyRefunded); err != nil {
+			return err
+		}
+		left := money.New(p.Captured.Amount-p.Refunded.Amount, p.Captured.Currency)
+		amount, err := eventAmount(ev.Amount, left)
+		if err != nil {
+			return err
+		}
+		p.Refunded.Amount += amount.Amount
+		o.Status = StatusPartiallyRefunded
+		if p.Refunded.Amount == p.Captured.Amount {
+			o.Status = StatusRefunded
+		}
+	default:
+		return fmt.Errorf("unknown payment event %q", ev.Type)
+	}
+	return nil
+}
+
+func expect(o *model.Order, statuses ...string) error {
+	for _, s := range statuses {
+		if o.Status == s {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: order %s is %s", ErrInvalidTransition, o.ID, o.Status)
+}
+
+// CheckAmount returns ErrInvalidAmount unless amount is positive, in the
+// currency of left and no more than left.
+func CheckAmount(amount, left money.Money) error {
+	switch {
+	case amount.Currency != left.Currency:
+		return fmt.Errorf("%w: %s is not in %s", ErrInvalidAmount, amount, left.Currency)
+	case amount.Amount <= 0:
+		return fmt.Errorf("%w: %s is not positive", ErrInvalidAmount, amount)
+	case amount.Amount > left.Amount:
+		return fmt.Errorf("%w: %s exceeds the %s left", ErrInvalidAmount, amount, left)
+	}
+	return nil
+}
+
+// eventAmount is the amount of an event, or all that is left if the event
+// has none.
+func eventAmount(amount, left money.Money) (money.Money, error) {
+	if amount.IsZero() {
+		return left, nil
+	}
+	return amount, CheckAmount(amount, left)
+}
@@ -0,0 +1,121 @@
+package payment
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"order-service/money"
+	"sync"
+)
+
+// Payment methods the fake provider declines, for exercising failure paths.
+const (
+	FakeDeclinedMethod = "tok_decline"
+	FakeNoFundsMethod  = "tok_insufficient_funds"
+)
+
+type fakePayment struct {
+	authorized money.Money
+	captured   money.Money
+	refunded   money.Money
+	voided     bool
+}
+
+// FakeProvider is an in-memory provider for development and tests. It
+// accepts any payment method except FakeDeclinedMethod and FakeNoFundsMethod.
+type FakeProvider struct {
+	mu       sync.Mutex
+	payments map[string]*fakePayment
+	byKey    map[string]string
+}
+
+func NewFakeProvider() *FakeProvider {
+	return &FakeProvider{
+		payments: make(map[string]*fakePayment),
+		byKey:    make(map[string]string),
+	}
+}
+
+func (p *FakeProvider) Name() string {
+	return "fake"
+}
+
+func (p *FakeProvider) Authorize(ctx context.Context, req AuthorizeRequest) (string, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if id, ok := p.byKey[req.IdempotencyKey]; ok && req.IdempotencyKey != "" {
+		return id, nil
+	}
+	switch req.PaymentMethod {
+	case FakeDeclinedMethod:
+		return "", fmt.Errorf("%w: card declined", ErrDeclined)
+	case FakeNoFundsMethod:
+		return "", fmt.Errorf("%w: insufficient funds", ErrDeclined)
+	}
+	b := make([]byte, 8)
+	rand.Read(b)
+	id := "fake_pay_" + hex.EncodeToString(b)
+	p.payments[id] = &fakePayment{
+		authorized: req.Amount,
+		captured:   money.New(0, req.Amount.Currency),
+		refunded:   money.New(0, req.Amount.Currency),
+	}
+	if req.IdempotencyKey != "" {
+		p.byKey[req.IdempotencyKey] = id
+	}
+	return id, nil
+}
+
+func (p *FakeProvider) Capture(ctx context.Context, paymentID string, amount money.Money) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pay, err := p.payment(paymentID)
+	if err != nil {
+		return err
+	}
+	if pay.voided {
+		return fmt.Errorf("payment %s was voided", paymentID)
+	}
+	if err := CheckAmount(amount, money.New(pay.authorized.Amount-pay.captured.Amount, pay.authorized.Currency)); err != nil {
+		return err
+	}
+	pay.captured.Amount += amount.Amount
+	return nil
+}
+
+func (p *FakeProvider) Void(ctx context.Context, paymentID string) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pay, err := p.payment(paymentID)
+	if err != nil {
+		return err
+	}
+	if pay.captured.Amount > 0 {
+		return fmt.Errorf("payment %s is already captured", paymentID)
+	}
+	pay.voided = true
+	return nil
+}
+
+func (p *FakeProvider) Refund(ctx context.Context, paymentID string, amount money.Money) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	pay, err := p.payment(paymentID)
+	if err != nil {
+		return err
+	}
+	if err := CheckAmount(amount, money.New(pay.captured.Amount-pay.refunded.Amount, pay.captured.Currency)); err != nil {
+		return err
+	}
+	pay.refunded.Amount += amount.Amount
+	return nil
+}
+
+func (p *FakeProvider) payment(id string) (*fakePayment, error) {
+	pay, ok := p.payments[id]
+	if !ok {
+		return nil, fmt.Errorf("unknown payment %s", id)
+	}
+	return pay, nil
+}
@@ -0,0 +1,36 @@
+// Package payment takes payment for orders through a pluggable provider and
+// keeps order status in step with the payment.
+package payment
+
+import (
+	"context"
+	"errors"
+	"order-service/money"
+)
+
+// ErrDeclined is returned when a provider refuses a payment. It is the
+// customer's problem rather than a fault.
+var ErrDeclined = errors.New("payment declined")
+
+// AuthorizeRequest asks a provider to hold an amount on a payment method.
+type AuthorizeRequest struct {
+	OrderID       string
+	Amount        money.Money
+	PaymentMethod string
+	// IdempotencyKey lets providers recognise a retried request.
+	IdempotencyKey string
+}
+
+// PaymentProvider is a payment service provider. Payments are identified by
+// the provider's own IDs.
+type PaymentProvider interface {
+	Name() string
+	// Authorize holds the amount and returns the provider's payment ID.
+	Authorize(ctx context.Context, req AuthorizeRequest) (string, error)
+	// Capture collects a previously authorized amount.
+	Capture(ctx context.Context, paymentID string, amount money.Money) error
+	// Void releases an authorization that will not be captured.
+	Void(ctx context.Context, paymentID string) error
+	// Refund returns some or all of a captured amount.
+	Refund(ctx context.Context, paymentID string, amount money.Money) error
+}
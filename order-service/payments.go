@@ -0,0 +1,315 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"order-service/events"
+	"order-service/identity"
+	"order-service/model"
+	"order-service/money"
+	"order-service/payment"
+	"order-service/render"
+	"order-service/store"
+	"sync"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+var paymentProvider payment.PaymentProvider
+var webhookEvents = payment.NewEventLog(7 * 24 * time.Hour)
+var webhookSecret string
+var webhookTolerance time.Duration
+
+// authorizing holds the IDs of orders whose payment is being authorized, so
+// that the order is authorized once and does not change while it is.
+var authorizing sync.Map
+
+// isAuthorizing reports whether the payment of an order is being authorized.
+func isAuthorizing(orderID string) bool {
+	_, ok := authorizing.Load(orderID)
+	return ok
+}
+
+// newPaymentProvider returns the provider configured by name.
+func newPaymentProvider(name string) (payment.PaymentProvider, error) {
+	switch name {
+	case "fake":
+		return payment.NewFakeProvider(), nil
+	default:
+		return nil, fmt.Errorf("unsupported payment provider %q", name)
+	}
+}
+
+type paymentRequest struct {
+	PaymentMethod string       `json:"payment_method"`
+	Amount        *money.Money `json:"amount"`
+}
+
+// paymentOrder loads an order for a payment action by the caller, who must
+// hold one of the roles given or admin, or own the order if owners may act.
+func paymentOrder(w http.ResponseWriter, r *http.Request, owner bool, roles ...string) (model.Order, bool) {
+	caller, ok := requireCaller(w, r)
+	if !ok {
+		return model.Order{}, false
+	}
+	order, ok := orders.Get(mux.Vars(r)["id"])
+	if !ok || !caller.CanAccess(order.CustomerID) {
+		render.Error(w, r, http.StatusNotFound, "Order not found")
+		return model.Order{}, false
+	}
+	if owner && order.CustomerID == caller.CustomerID {
+		return order, true
+	}
+	for _, role := range append(roles, identity.RoleAdmin) {
+		if caller.HasRole(role) {
+			return order, true
+		}
+	}
+	render.Error(w, r, http.StatusForbidden, "Forbidden")
+	return model.Order{}, false
+}
+
+func decodePaymentRequest(w http.ResponseWriter, r *http.Request) (paymentRequest, bool) {
+	var req paymentRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			render.Error(w, r, http.StatusBadRequest, err.Error())
+			return req, false
+		}
+	}
+	return req, true
+}
+
+// applyPayment records a payment event on an order and writes the result.
+func applyPayment(w http.ResponseWriter, r *http.Request, orderID string, ev payment.Event, status int) {
+	order, err := orders.Update(orderID, func(o *model.Order) error {
+		return payment.Apply(o, ev, paymentProvider.Name())
+	})
+	if err != nil {
+		paymentError(w, r, err)
+		return
+	}
+	render.Respond(w, r, status, orderBody(r, order))
+}
+
+func paymentError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		render.Error(w, r, http.StatusNotFound, err.Error())
+	case errors.Is(err, payment.ErrInvalidTransition):
+		render.Error(w, r, http.StatusConflict, err.Error())
+	case errors.Is(err, payment.ErrInvalidAmount):
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+	case errors.Is(err, events.ErrOutboxFull):
+		render.Error(w, r, http.StatusServiceUnavailable, err.Error())
+	default:
+		render.Error(w, r, http.StatusBadGateway, err.Error())
+	}
+}
+
+func GetPayment(w http.ResponseWriter, r *http.Request) {
+	order, ok := paymentOrder(w, r, true, identity.RoleSupport)
+	if !ok {
+		return
+	}
+	if order.Payment == nil {
+		render.Error(w, r, http.StatusNotFound, "Payment not found")
+		return
+	}
+	render.Respond(w, r, http.StatusOK, order.Payment)
+}
+
+// AuthorizePayment holds the order total on the customer's payment method.
+// A declined payment leaves the order in payment_failed, from where it can
+// be authorized again. Only one authorization of an order runs at a time.
+func AuthorizePayment(w http.ResponseWriter, r *http.Request) {
+	order, ok := paymentOrder(w, r, true)
+	if !ok {
+		return
+	}
+	req, ok := decodePaymentRequest(w, r)
+	if !ok {
+		return
+	}
+	if req.PaymentMethod == "" {
+		render.Error(w, r, http.StatusBadRequest, "payment_method is required")
+		return
+	}
+	if _, busy := authorizing.LoadOrStore(order.ID, struct{}{}); busy {
+		render.Error(w, r, http.StatusConflict, "payment of order "+order.ID+" is already being authorized")
+		return
+	}
+	defer authorizing.Delete(order.ID)
+	// Read the order again now that it is held, as it may have moved on
+	order, ok = orders.Get(order.ID)
+	if !ok {
+		render.Error(w, r, http.StatusNotFound, "Order not found")
+		return
+	}
+	if order.Status != payment.StatusPending && order.Status != payment.StatusPaymentFailed {
+		render.Error(w, r, http.StatusConflict, "order "+order.ID+" is "+order.Status)
+		return
+	}
+
+	paymentID, err := paymentProvider.Authorize(r.Context(), payment.AuthorizeRequest{
+		OrderID:        order.ID,
+		Amount:         order.Total,
+		PaymentMethod:  req.PaymentMethod,
+		IdempotencyKey: order.ID + ":" + req.PaymentMethod,
+	})
+	if errors.Is(err, payment.ErrDeclined) {
+		applyPayment(w, r, order.ID, payment.Event{Type: payment.EventFailed, Reason: err.Error()}, http.StatusPaymentRequired)
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(r.Context(), "payment authorization failed", "order_id", order.ID, "error", err)
+		paymentError(w, r, err)
+		return
+	}
+	applyPayment(w, r, order.ID, payment.Event{Type: payment.EventAuthorized, PaymentID: paymentID, Amount: order.Total}, http.StatusOK)
+}
+
+// CapturePayment collects an authorized payment, by default in full.
+func CapturePayment(w http.ResponseWriter, r *http.Request) {
+	order, ok := paymentOrder(w, r, false)
+	if !ok {
+		return
+	}
+	req, ok := decodePaymentRequest(w, r)
+	if !ok {
+		return
+	}
+	if order.Status != payment.StatusAuthorized {
+		render.Error(w, r, http.StatusConflict, "order "+order.ID+" is "+order.Status)
+		return
+	}
+	amount := order.Payment.Authorized
+	if req.Amount != nil {
+		amount = *req.Amount
+		if err := payment.CheckAmount(amount, order.Payment.Authorized); err != nil {
+			paymentError(w, r, err)
+			return
+		}
+	}
+	if err := paymentProvider.Capture(r.Context(), order.Payment.ID, amount); err != nil {
+		slog.ErrorContext(r.Context(), "payment capture failed", "order_id", order.ID, "error", err)
+		paymentError(w, r, err)
+		return
+	}
+	applyPayment(w, r, order.ID, payment.Event{Type: payment.EventCaptured, PaymentID: order.Payment.ID, Amount: amount}, http.StatusOK)
+}
+
+// VoidPayment releases an authorization and cancels the order.
+func VoidPayment(w http.ResponseWriter, r *http.Request) {
+	order, ok := paymentOrder(w, r, true)
+	if !ok {
+		return
+	}
+	if order.Status != payment.StatusAuthorized {
+		render.Error(w, r, http.StatusConflict, "order "+order.ID+" is "+order.Status)
+		return
+	}
+	if err := paymentProvider.Void(r.Context(), order.Payment.ID); err != nil {
+		slog.ErrorContext(r.Context(), "payment void failed", "order_id", order.ID, "error", err)
+		paymentError(w, r, err)
+		return
+	}
+	applyPayment(w, r, order.ID, payment.Event{Type: payment.EventVoided, PaymentID: order.Payment.ID}, http.StatusOK)
+}
+
+// RefundPayment returns some or, by default, all of what is left of a
+// captured payment.
+func RefundPayment(w http.ResponseWriter, r *http.Request) {
+	order, ok := paymentOrder(w, r, false, identity.RoleSupport)
+	if !ok {
+		return
+	}
+	req, ok := decodePaymentRequest(w, r)
+	if !ok {
+		return
+	}
+	if order.Status != payment.StatusPaid && order.Status != payment.StatusPartiallyRefunded {
+		render.Error(w, r, http.StatusConflict, "order "+order.ID+" is "+order.Status)
+		return
+	}
+	p := order.Payment
+	left := money.New(p.Captured.Amount-p.Refunded.Amount, p.Captured.Currency)
+	amount := left
+	if req.Amount != nil {
+		amount = *req.Amount
+		if err := payment.CheckAmount(amount, left); err != nil {
+			paymentError(w, r, err)
+			return
+		}
+	}
+	if err := paymentProvider.Refund(r.Context(), p.ID, amount); err != nil {
+		slog.ErrorContext(r.Context(), "payment refund failed", "order_id", order.ID, "error", err)
+		paymentError(w, r, err)
+		return
+	}
+	applyPayment(w, r, order.ID, payment.Event{Type: payment.EventRefunded, PaymentID: p.ID, Amount: amount}, http.StatusOK)
+}
+
+// PaymentWebhook receives provider callbacks. Deliveries must be signed with
+// the shared secret; each event ID is applied at most once and repeats are
+// acknowledged so the provider stops retrying.
+func PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	if webhookSecret == "" {
+		render.Error(w, r, http.StatusServiceUnavailable, "payment webhooks are not configured")
+		return
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, 1<<20))
+	if err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := payment.VerifySignature(webhookSecret, r.Header.Get(payment.SignatureHeader), body, time.Now(), webhookTolerance); err != nil {
+		slog.WarnContext(r.Context(), "rejected payment webhook", "error", err)
+		render.Error(w, r, http.StatusUnauthorized, err.Error())
+		return
+	}
+	var ev payment.Event
+	if err := json.Unmarshal(body, &ev); err != nil || ev.ID == "" || ev.OrderID == "" {
+		render.Error(w, r, http.StatusBadRequest, "event needs id and order_id")
+		return
+	}
+	// Providers add event types over time; those we do not handle are
+	// acknowledged so that they are not retried
+	if !payment.KnownEvent(ev.Type) {
+		slog.InfoContext(r.Context(), "ignored payment webhook of unknown type", "event_id", ev.ID, "type", ev.Type)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	if !webhookEvents.Begin(ev.ID) {
+		slog.InfoContext(r.Context(), "duplicate payment webhook", "event_id", ev.ID)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	_, err = orders.Update(ev.OrderID, func(o *model.Order) error {
+		return payment.Apply(o, ev, paymentProvider.Name())
+	})
+	// Events that can never apply are acknowledged too, or they would be
+	// retried forever
+	never := errors.Is(err, payment.ErrInvalidTransition) || errors.Is(err, payment.ErrInvalidAmount) || errors.Is(err, store.ErrNotFound)
+	webhookEvents.Done(ev.ID, err == nil || never)
+	if err != nil {
+		slog.WarnContext(r.Context(), "payment webhook not applied", "event_id", ev.ID, "order_id", ev.OrderID, "error", err)
+		if never {
+			w.WriteHeader(http.StatusOK)
+			return
+		}
+		status := http.StatusInternalServerError
+		if errors.Is(err, events.ErrOutboxFull) {
+			status = http.StatusServiceUnavailable
+		}
+		render.Error(w, r, status, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+}
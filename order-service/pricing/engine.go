@@ -0,0 +1,292 @@
+// Package pricing turns priced order lines into a breakdown of subtotal,
+// discounts, tax and total.
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"order-service/money"
+	"sort"
+	"sync"
+	"time"
+)
+
+var (
+	ErrUnknownCoupon = errors.New("unknown coupon")
+	ErrCouponExpired = errors.New("coupon has expired")
+	ErrCouponUsedUp  = errors.New("coupon usage limit reached")
+	ErrCouponExists  = errors.New("coupon already exists")
+	ErrUnknownRegion = errors.New("no tax rate for region")
+)
+
+// Line is an order line priced at the catalog unit price.
+type Line struct {
+	ProductID string      `json:"product_id"`
+	SKU       string      `json:"sku,omitempty"`
+	Quantity  int32       `json:"quantity"`
+	ListPrice money.Money `json:"list_price"`
+	UnitPrice money.Money `json:"unit_price"`
+	Total     money.Money `json:"total"`
+}
+
+// AppliedDiscount is one reduction in a breakdown.
+type AppliedDiscount struct {
+	Name      string      `json:"name"`
+	Coupon    string      `json:"coupon,omitempty"`
+	ProductID string      `json:"product_id,omitempty"`
+	Amount    money.Money `json:"amount"`
+}
+
+// Breakdown explains how an order total was reached.
+type Breakdown struct {
+	Lines     []Line            `json:"lines"`
+	Subtotal  money.Money       `json:"subtotal"`
+	Discounts []AppliedDiscount `json:"discounts,omitempty"`
+	Discount  money.Money       `json:"discount"`
+	Region    string            `json:"region,omitempty"`
+	TaxRate   Percent           `json:"tax_rate"`
+	Tax       money.Money       `json:"tax"`
+	Total     money.Money       `json:"total"`
+}
+
+// Request asks for the price of some lines in a currency. Lines need
+// ProductID, SKU, Quantity and ListPrice in that currency.
+type Request struct {
+	Currency string
+	Region   string
+	Coupon   string
+	Lines    []Line
+}
+
+// Engine applies pricing rules. Coupon usage is tracked in memory.
+type Engine struct {
+	mu      sync.Mutex
+	rules   Rules
+	coupons map[string]*Coupon
+	rates   *money.Rates
+	now     func() time.Time
+}
+
+// NewEngine returns an engine for rules, converting fixed discounts into the
+// order currency with rates.
+func NewEngine(rules Rules, rates *money.Rates) *Engine {
+	e := &Engine{
+		rules:   rules,
+		coupons: make(map[string]*Coupon),
+		rates:   rates,
+		now:     time.Now,
+	}
+	for i := range rules.Coupons {
+		c := rules.Coupons[i]
+		e.coupons[c.Code] = &c
+	}
+	return e
+}
+
+// Quote prices a request without redeeming its coupon.
+func (e *Engine) Quote(req Request) (Breakdown, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.quote(req)
+}
+
+// Redeem prices a request like Quote and counts one use of its coupon.
+func (e *Engine) Redeem(req Request) (Breakdown, error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	b, err := e.quote(req)
+	if err != nil {
+		return b, err
+	}
+	if req.Coupon != "" {
+		e.coupons[req.Coupon].Used++
+	}
+	return b, nil
+}
+
+// Release gives back a use of a coupon redeemed for an order that was not
+// placed after all.
+func (e *Engine) Release(code string) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if c, ok := e.coupons[code]; ok && c.Used > 0 {
+		c.Used--
+	}
+}
+
+func (e *Engine) quote(req Request) (Breakdown, error) {
+	b := Breakdown{
+		Subtotal: money.New(0, req.Currency),
+		Discount: money.New(0, req.Currency),
+		Tax:      money.New(0, req.Currency),
+		Region:   req.Region,
+	}
+
+	// Lines at tier prices
+	for _, line := range req.Lines {
+		line.UnitPrice = line.ListPrice
+		if tier, ok := e.tier(line.ProductID, line.Quantity); ok {
+			cut := tier.Percent.Of(line.ListPrice)
+			line.UnitPrice.Amount -= cut.Amount
+		}
+		total, err := line.UnitPrice.Mul(int64(line.Quantity))
+		if err != nil {
+			return b, err
+		}
+		line.Total = total
+		if b.Subtotal, err = b.Subtotal.Add(total); err != nil {
+			return b, err
+		}
+		b.Lines = append(b.Lines, line)
+	}
+
+	// Automatic discounts, then the coupon
+	var coupon *Coupon
+	if req.Coupon != "" {
+		c, err := e.coupon(req.Coupon)
+		if err != nil {
+			return b, err
+		}
+		coupon = c
+	}
+	remaining := b.Subtotal.Amount
+	apply := func(d Discount, code string) error {
+		amount, err := e.discount(d, b)
+		if err != nil {
+			return err
+		}
+		amount.Amount = min(amount.Amount, remaining)
+		if amount.Amount <= 0 {
+			return nil
+		}
+		remaining -= amount.Amount
+		name := d.Name
+		if name == "" {
+			name = code
+		}
+		b.Discounts = append(b.Discounts, AppliedDiscount{Name: name, Coupon: code, ProductID: d.ProductID, Amount: amount})
+		b.Discount.Amount += amount.Amount
+		return nil
+	}
+	for _, d := range e.rules.Discounts {
+		if err := apply(d, ""); err != nil {
+			return b, err
+		}
+	}
+	if coupon != nil {
+		if err := apply(coupon.Discount, coupon.Code); err != nil {
+			return b, err
+		}
+	}
+
+	// Tax on the discounted amount
+	if req.Region != "" {
+		rate, ok := e.rules.TaxRates[req.Region]
+		if !ok {
+			return b, fmt.Errorf("%w %s", ErrUnknownRegion, req.Region)
+		}
+		b.TaxRate = rate
+		b.Tax = rate.Of(money.New(remaining, req.Currency))
+	}
+	b.Total = money.New(remaining+b.Tax.Amount, req.Currency)
+	return b, nil
+}
+
+// tier returns the best tier a line qualifies for.
+func (e *Engine) tier(productID string, quantity int32) (Tier, bool) {
+	var best Tier
+	found := false
+	for _, t := range e.rules.Tiers {
+		if t.ProductID == productID && quantity >= t.MinQuantity && (!found || t.MinQuantity > best.MinQuantity) {
+			best, found = t, true
+		}
+	}
+	return best, found
+}
+
+// discount works out the amount d takes off, before capping.
+func (e *Engine) discount(d Discount, b Breakdown) (money.Money, error) {
+	base := b.Subtotal
+	if d.ProductID != "" {
+		base = money.New(0, b.Subtotal.Currency)
+		for _, line := range b.Lines {
+			if line.ProductID == d.ProductID {
+				base.Amount += line.Total.Amount
+			}
+		}
+		if base.Amount == 0 {
+			return base, nil
+		}
+	}
+	if d.Type == Percentage {
+		return d.Percent.Of(base), nil
+	}
+	amount, err := e.rates.Convert(*d.Amount, base.Currency)
+	if err != nil {
+		return money.Money{}, fmt.Errorf("discount %s: %w", d.Name, err)
+	}
+	amount.Amount = min(amount.Amount, base.Amount)
+	return amount, nil
+}
+
+func (e *Engine) coupon(code string) (*Coupon, error) {
+	c, ok := e.coupons[code]
+	if !ok {
+		return nil, ErrUnknownCoupon
+	}
+	if c.ExpiresAt != nil && !e.now().Before(*c.ExpiresAt) {
+		return nil, ErrCouponExpired
+	}
+	if c.MaxUses > 0 && c.Used >= c.MaxUses {
+		return nil, ErrCouponUsedUp
+	}
+	return c, nil
+}
+
+// Coupons returns all coupons ordered by code.
+func (e *Engine) Coupons() []Coupon {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	coupons := make([]Coupon, 0, len(e.coupons))
+	for _, c := range e.coupons {
+		coupons = append(coupons, *c)
+	}
+	sort.Slice(coupons, func(i, j int) bool { return coupons[i].Code < coupons[j].Code })
+	return coupons
+}
+
+func (e *Engine) Coupon(code string) (Coupon, bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	c, ok := e.coupons[code]
+	if !ok {
+		return Coupon{}, false
+	}
+	return *c, true
+}
+
+// AddCoupon registers a new coupon with no uses.
+func (e *Engine) AddCoupon(c Coupon) error {
+	if err := c.validate(); err != nil {
+		return err
+	}
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.coupons[c.Code]; ok {
+		return ErrCouponExists
+	}
+	c.Used = 0
+	e.coupons[c.Code] = &c
+	return nil
+}
+
+// DeleteCoupon withdraws a coupon.
+func (e *Engine) DeleteCoupon(code string) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if _, ok := e.coupons[code]; !ok {
+		return ErrUnknownCoupon
+	}
+	delete(e.coupons, code)
+	return nil
+}
@@ -0,0 +1,353 @@
+package pricing
+
+import (
+	"encoding/json"
+	"errors"
+	"order-service/money"
+	"testing"
+	"time"
+)
+
+func usd(amount int64) *money.Money {
+	m := money.New(amount, "USD")
+	return &m
+}
+
+func lines(currency string, prices ...int64) []Line {
+	var out []Line
+	for i, price := range prices {
+		out = append(out, Line{
+			ProductID: string(rune('a' + i)),
+			Quantity:  1,
+			ListPrice: money.New(price, currency),
+		})
+	}
+	return out
+}
+
+func TestQuote(t *testing.T) {
+	tests := []struct {
+		name     string
+		rules    Rules
+		req      Request
+		subtotal int64
+		discount int64
+		tax      int64
+		total    int64
+	}{
+		{
+			name:     "no rules",
+			req:      Request{Currency: "USD", Lines: lines("USD", 1999, 500)},
+			subtotal: 2499, total: 2499,
+		},
+		{
+			name: "quantity",
+			req: Request{Currency: "USD", Lines: []Line{
+				{ProductID: "a", Quantity: 3, ListPrice: money.New(1999, "USD")},
+			}},
+			subtotal: 5997, total: 5997,
+		},
+		{
+			name:     "percentage coupon rounds half to even",
+			rules:    Rules{Coupons: []Coupon{{Code: "TEN", Discount: Discount{Type: Percentage, Percent: 1000}}}},
+			req:      Request{Currency: "USD", Coupon: "TEN", Lines: lines("USD", 4445)},
+			subtotal: 4445, discount: 444, total: 4001, // 444.5
+		},
+		{
+			name:     "percentage coupon on one product",
+			rules:    Rules{Coupons: []Coupon{{Code: "B20", Discount: Discount{Type: Percentage, Percent: 2000, ProductID: "b"}}}},
+			req:      Request{Currency: "USD", Coupon: "B20", Lines: lines("USD", 1000, 500)},
+			subtotal: 1500, discount: 100, total: 1400,
+		},
+		{
+			name:     "percentage coupon on a product not ordered",
+			rules:    Rules{Coupons: []Coupon{{Code: "Z20", Discount: Discount{Type: Percentage, Percent: 2000, ProductID: "z"}}}},
+			req:      Request{Currency: "USD", Coupon: "Z20", Lines: lines("USD", 1000)},
+			subtotal: 1000, total: 1000,
+		},
+		{
+			name:     "hundred percent",
+			rules:    Rules{Coupons: []Coupon{{Code: "FREE", Discount: Discount{Type: Percentage, Percent: hundredPercent}}}},
+			req:      Request{Currency: "USD", Coupon: "FREE", Region: "CA", Lines: lines("USD", 1000)},
+			subtotal: 1000, discount: 1000, total: 0,
+		},
+		{
+			name:     "fixed coupon",
+			rules:    Rules{Coupons: []Coupon{{Code: "FIVE", Discount: Discount{Type: Fixed, Amount: usd(500)}}}},
+			req:      Request{Currency: "USD", Coupon: "FIVE", Lines: lines("USD", 1999)},
+			subtotal: 1999, discount: 500, total: 1499,
+		},
+		{
+			name:     "fixed coupon converted to the order currency",
+			rules:    Rules{Coupons: []Coupon{{Code: "FIVE", Discount: Discount{Type: Fixed, Amount: usd(500)}}}},
+			req:      Request{Currency: "JPY", Coupon: "FIVE", Lines: lines("JPY", 3000)},
+			subtotal: 3000, discount: 750, total: 2250,
+		},
+		{
+			name:     "fixed coupon larger than the subtotal",
+			rules:    Rules{Coupons: []Coupon{{Code: "FIFTY", Discount: Discount{Type: Fixed, Amount: usd(5000)}}}},
+			req:      Request{Currency: "USD", Coupon: "FIFTY", Region: "CA", Lines: lines("USD", 1999)},
+			subtotal: 1999, discount: 1999, total: 0,
+		},
+		{
+			name:     "fixed coupon larger than its product's lines",
+			rules:    Rules{Coupons: []Coupon{{Code: "B10", Discount: Discount{Type: Fixed, Amount: usd(1000), ProductID: "b"}}}},
+			req:      Request{Currency: "USD", Coupon: "B10", Lines: lines("USD", 1000, 500)},
+			subtotal: 1500, discount: 500, total: 1000,
+		},
+		{
+			name: "coupon capped by what automatic discounts left",
+			rules: Rules{
+				Discounts: []Discount{{Name: "sale", Type: Percentage, Percent: 6000}},
+				Coupons:   []Coupon{{Code: "HALF", Discount: Discount{Type: Percentage, Percent: 5000}}},
+			},
+			req:      Request{Currency: "USD", Coupon: "HALF", Lines: lines("USD", 1000)},
+			subtotal: 1000, discount: 1000, total: 0,
+		},
+		{
+			name: "automatic discounts together larger than the subtotal",
+			rules: Rules{Discounts: []Discount{
+				{Name: "a", Type: Fixed, Amount: usd(800)},
+				{Name: "b", Type: Fixed, Amount: usd(800)},
+			}},
+			req:      Request{Currency: "USD", Lines: lines("USD", 1000)},
+			subtotal: 1000, discount: 1000, total: 0,
+		},
+		{
+			name:     "tax on the discounted amount",
+			rules:    Rules{Coupons: []Coupon{{Code: "FIVE", Discount: Discount{Type: Fixed, Amount: usd(500)}}}},
+			req:      Request{Currency: "USD", Coupon: "FIVE", Region: "CA", Lines: lines("USD", 4500)},
+			subtotal: 4500, discount: 500, tax: 290, total: 4290, // 7.25% of 40.00
+		},
+		{
+			name:     "tax rounds half to even",
+			req:      Request{Currency: "USD", Region: "CA", Lines: lines("USD", 1000)},
+			subtotal: 1000, tax: 72, total: 1072, // 72.5
+		},
+		{
+			name:  "tier",
+			rules: Rules{Tiers: []Tier{{ProductID: "a", MinQuantity: 5, Percent: 1000}, {ProductID: "a", MinQuantity: 10, Percent: 1500}}},
+			req: Request{Currency: "USD", Lines: []Line{
+				{ProductID: "a", Quantity: 4, ListPrice: money.New(1000, "USD")},
+				{ProductID: "a", Quantity: 9, ListPrice: money.New(1000, "USD")},
+				{ProductID: "a", Quantity: 10, ListPrice: money.New(1000, "USD")},
+			}},
+			subtotal: 4000 + 8100 + 8500, total: 20600,
+		},
+	}
+	rates, err := money.ParseRates("USD", "JPY=150")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.rules.TaxRates = map[string]Percent{"CA": 725}
+			b, err := NewEngine(tt.rules, rates).Quote(tt.req)
+			if err != nil {
+				t.Fatal(err)
+			}
+			c := tt.req.Currency
+			if b.Subtotal != money.New(tt.subtotal, c) || b.Discount != money.New(tt.discount, c) ||
+				b.Tax != money.New(tt.tax, c) || b.Total != money.New(tt.total, c) {
+				t.Errorf("got subtotal %v, discount %v, tax %v, total %v, want %d, %d, %d, %d",
+					b.Subtotal, b.Discount, b.Tax, b.Total, tt.subtotal, tt.discount, tt.tax, tt.total)
+			}
+			var sum int64
+			for _, d := range b.Discounts {
+				if d.Amount.Amount <= 0 || d.Amount.Currency != c {
+					t.Errorf("applied discount %s of %v", d.Name, d.Amount)
+				}
+				sum += d.Amount.Amount
+			}
+			if sum != b.Discount.Amount {
+				t.Errorf("discounts add up to %d, not %v", sum, b.Discount)
+			}
+		})
+	}
+}
+
+func TestCouponUses(t *testing.T) {
+	e := NewEngine(Rules{Coupons: []Coupon{
+		{Code: "TWICE", MaxUses: 2, Discount: Discount{Type: Percentage, Percent: 1000}},
+	}}, nil)
+	req := Request{Currency: "USD", Coupon: "TWICE", Lines: lines("USD", 1000)}
+
+	for i := 0; i < 3; i++ {
+		if _, err := e.Quote(req); err != nil {
+			t.Fatalf("quote %d: %v", i, err)
+		}
+	}
+	if c, _ := e.Coupon("TWICE"); c.Used != 0 {
+		t.Fatalf("quotes used the coupon %d times", c.Used)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := e.Redeem(req); err != nil {
+			t.Fatalf("redeem %d: %v", i, err)
+		}
+	}
+	if _, err := e.Redeem(req); !errors.Is(err, ErrCouponUsedUp) {
+		t.Fatalf("third redeem: %v, want ErrCouponUsedUp", err)
+	}
+	if _, err := e.Quote(req); !errors.Is(err, ErrCouponUsedUp) {
+		t.Fatalf("quote after the last use: %v, want ErrCouponUsedUp", err)
+	}
+	if c, _ := e.Coupon("TWICE"); c.Used != 2 {
+		t.Fatalf("used %d times, want 2", c.Used)
+	}
+
+	e.Release("TWICE")
+	if _, err := e.Redeem(req); err != nil {
+		t.Fatalf("redeem after a release: %v", err)
+	}
+	e.Release("TWICE")
+	e.Release("TWICE")
+	e.Release("TWICE")
+	e.Release("NONE")
+	if c, _ := e.Coupon("TWICE"); c.Used != 0 {
+		t.Errorf("used %d times after releasing more than was redeemed", c.Used)
+	}
+}
+
+func TestCouponUnlimited(t *testing.T) {
+	e := NewEngine(Rules{Coupons: []Coupon{
+		{Code: "ALWAYS", Discount: Discount{Type: Percentage, Percent: 1000}},
+	}}, nil)
+	req := Request{Currency: "USD", Coupon: "ALWAYS", Lines: lines("USD", 1000)}
+	for i := 0; i < 100; i++ {
+		if _, err := e.Redeem(req); err != nil {
+			t.Fatalf("redeem %d: %v", i, err)
+		}
+	}
+}
+
+func TestCouponExpiry(t *testing.T) {
+	expires := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	e := NewEngine(Rules{Coupons: []Coupon{
+		{Code: "JUNE", ExpiresAt: &expires, Discount: Discount{Type: Percentage, Percent: 1000}},
+	}}, nil)
+	req := Request{Currency: "USD", Coupon: "JUNE", Lines: lines("USD", 1000)}
+
+	tests := []struct {
+		now  time.Time
+		want error
+	}{
+		{expires.Add(-time.Nanosecond), nil},
+		{expires, ErrCouponExpired},
+		{expires.Add(time.Hour), ErrCouponExpired},
+	}
+	for _, tt := range tests {
+		e.now = func() time.Time { return tt.now }
+		if _, err := e.Redeem(req); !errors.Is(err, tt.want) {
+			t.Errorf("redeem at %v: %v, want %v", tt.now, err, tt.want)
+		}
+	}
+	if c, _ := e.Coupon("JUNE"); c.Used != 1 {
+		t.Errorf("used %d times, want 1", c.Used)
+	}
+}
+
+func TestQuoteErrors(t *testing.T) {
+	e := NewEngine(Rules{TaxRates: map[string]Percent{"CA": 725}}, nil)
+	if _, err := e.Quote(Request{Currency: "USD", Coupon: "NONE", Lines: lines("USD", 1000)}); !errors.Is(err, ErrUnknownCoupon) {
+		t.Errorf("unknown coupon: %v", err)
+	}
+	if _, err := e.Quote(Request{Currency: "USD", Region: "XX", Lines: lines("USD", 1000)}); !errors.Is(err, ErrUnknownRegion) {
+		t.Errorf("unknown region: %v", err)
+	}
+
+	rates, _ := money.ParseRates("USD", "")
+	e = NewEngine(Rules{Discounts: []Discount{{Name: "five", Type: Fixed, Amount: usd(500)}}}, rates)
+	if _, err := e.Quote(Request{Currency: "JPY", Lines: lines("JPY", 1000)}); err == nil {
+		t.Error("applied a USD discount to a JPY order without a rate")
+	}
+}
+
+func TestCoupons(t *testing.T) {
+	e := NewEngine(Rules{}, nil)
+	if err := e.AddCoupon(Coupon{Code: "B", Used: 5, Discount: Discount{Type: Percentage, Percent: 1000}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.AddCoupon(Coupon{Code: "A", Discount: Discount{Type: Fixed, Amount: usd(100)}}); err != nil {
+		t.Fatal(err)
+	}
+	if err := e.AddCoupon(Coupon{Code: "A", Discount: Discount{Type: Fixed, Amount: usd(100)}}); !errors.Is(err, ErrCouponExists) {
+		t.Errorf("adding A again: %v", err)
+	}
+	for _, c := range []Coupon{
+		{Discount: Discount{Type: Percentage, Percent: 1000}},
+		{Code: "C", Discount: Discount{Type: Percentage, Percent: hundredPercent + 1}},
+		{Code: "C", Discount: Discount{Type: Percentage, Percent: -1}},
+		{Code: "C", Discount: Discount{Type: Fixed}},
+		{Code: "C", Discount: Discount{Type: Fixed, Amount: usd(-1)}},
+		{Code: "C", Discount: Discount{Type: "bogo"}},
+		{Code: "C", MaxUses: -1, Discount: Discount{Type: Percentage, Percent: 1000}},
+	} {
+		if err := e.AddCoupon(c); err == nil {
+			t.Errorf("added invalid coupon %+v", c)
+		}
+	}
+	coupons := e.Coupons()
+	if len(coupons) != 2 || coupons[0].Code != "A" || coupons[1].Code != "B" || coupons[1].Used != 0 {
+		t.Errorf("coupons = %+v", coupons)
+	}
+	if err := e.DeleteCoupon("A"); err != nil {
+		t.Error(err)
+	}
+	if err := e.DeleteCoupon("A"); !errors.Is(err, ErrUnknownCoupon) {
+		t.Errorf("deleting A again: %v", err)
+	}
+}
+
+func TestPercent(t *testing.T) {
+	tests := []struct {
+		json string
+		want Percent
+		text string
+	}{
+		{"7.25", 725, "7.25"},
+		{"7.5", 750, "7.5"},
+		{"7.50", 750, "7.5"},
+		{"20", 2000, "20"},
+		{"0.05", 5, "0.05"},
+		{"0", 0, "0"},
+		{"100", hundredPercent, "100"},
+		{"-0.5", -50, "-0.5"},
+		{"-7.25", -725, "-7.25"},
+	}
+	for _, tt := range tests {
+		var p Percent
+		if err := json.Unmarshal([]byte(tt.json), &p); err != nil || p != tt.want {
+			t.Errorf("Unmarshal(%s) = %d, %v, want %d", tt.json, p, err, tt.want)
+		}
+		if got := tt.want.String(); got != tt.text {
+			t.Errorf("String of %d = %s, want %s", tt.want, got, tt.text)
+		}
+	}
+	for _, bad := range []string{"7.125", "abc", `"7"`} {
+		var p Percent
+		if err := json.Unmarshal([]byte(bad), &p); err == nil {
+			t.Errorf("Unmarshal(%s) accepted it", bad)
+		}
+	}
+
+	of := []struct {
+		p      Percent
+		amount int64
+		want   int64
+	}{
+		{1000, 1999, 200},  // 199.9
+		{1000, 1995, 200},  // 199.5
+		{1000, 1985, 198},  // 198.5
+		{725, 1000, 72},    // 72.5
+		{725, 1400, 102},   // 101.5
+		{725, -1000, -72},  // -72.5
+		{725, -1400, -102}, // -101.5
+		{hundredPercent, 1999, 1999},
+		{0, 1999, 0},
+	}
+	for _, tt := range of {
+		if got := tt.p.Of(money.New(tt.amount, "USD")); got != money.New(tt.want, "USD") {
+			t.Errorf("%s%% of %d = %v, want %d", tt.p, tt.amount, got, tt.want)
+		}
+	}
+}
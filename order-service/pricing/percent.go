@@ -0,0 +1,69 @@
+package pricing
+
+import (
+	"fmt"
+	"order-service/money"
+	"strconv"
+	"strings"
+)
+
+// Percent is a rate in hundredths of a percent, so 7.25% is 725. In JSON it
+// is written as a plain percentage such as 7.25, parsed without floating
+// point.
+type Percent int64
+
+const hundredPercent Percent = 10000
+
+func (p *Percent) UnmarshalJSON(data []byte) error {
+	s := string(data)
+	whole, frac, _ := strings.Cut(s, ".")
+	if len(frac) > 2 {
+		return fmt.Errorf("percentage %s has more than two decimal places", s)
+	}
+	n, err := strconv.ParseInt(whole+frac+strings.Repeat("0", 2-len(frac)), 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid percentage %s", s)
+	}
+	*p = Percent(n)
+	return nil
+}
+
+func (p Percent) MarshalJSON() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p Percent) String() string {
+	sign := ""
+	if p < 0 {
+		sign, p = "-", -p
+	}
+	s := sign + strconv.FormatInt(int64(p/100), 10)
+	if frac := p % 100; frac != 0 {
+		s += strings.TrimRight(fmt.Sprintf(".%02d", frac), "0")
+	}
+	return s
+}
+
+func (p Percent) validate() error {
+	if p < 0 || p > hundredPercent {
+		return fmt.Errorf("percentage %s is out of range", p)
+	}
+	return nil
+}
+
+// Of returns p percent of m, rounded half to even to the minor unit.
+func (p Percent) Of(m money.Money) money.Money {
+	n := m.Amount * int64(p)
+	q, r := n/int64(hundredPercent), n%int64(hundredPercent)
+	if r < 0 {
+		r = -r
+	}
+	if twice := 2 * r; twice > int64(hundredPercent) || (twice == int64(hundredPercent) && q%2 != 0) {
+		if n < 0 {
+			q--
+		} else {
+			q++
+		}
+	}
+	return money.New(q, m.Currency)
+}
@@ -0,0 +1,119 @@
+package pricing
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"order-service/money"
+	"os"
+	"time"
+)
+
+// Discount kinds.
+const (
+	Percentage = "percentage"
+	Fixed      = "fixed"
+)
+
+// Discount takes a percentage or a fixed amount off the order, or off the
+// lines of a single product when ProductID is set.
+type Discount struct {
+	Name      string       `json:"name"`
+	Type      string       `json:"type"`
+	Percent   Percent      `json:"percent,omitempty"`
+	Amount    *money.Money `json:"amount,omitempty"`
+	ProductID string       `json:"product_id,omitempty"`
+}
+
+func (d Discount) validate() error {
+	switch d.Type {
+	case Percentage:
+		return d.Percent.validate()
+	case Fixed:
+		if d.Amount == nil {
+			return errors.New("fixed discount needs an amount")
+		}
+		return d.Amount.Validate()
+	default:
+		return fmt.Errorf("unknown discount type %q", d.Type)
+	}
+}
+
+// Coupon is a discount applied on request by code, at most MaxUses times
+// (zero for unlimited) and until ExpiresAt (zero for never).
+type Coupon struct {
+	Code string `json:"code"`
+	Discount
+	MaxUses   int        `json:"max_uses,omitempty"`
+	Used      int        `json:"used"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+func (c Coupon) validate() error {
+	if c.Code == "" {
+		return errors.New("coupon code is required")
+	}
+	if c.MaxUses < 0 {
+		return errors.New("max_uses must not be negative")
+	}
+	return c.Discount.validate()
+}
+
+// Tier lowers the unit price of a product by Percent once a line orders at
+// least MinQuantity of it.
+type Tier struct {
+	ProductID   string  `json:"product_id"`
+	MinQuantity int32   `json:"min_quantity"`
+	Percent     Percent `json:"percent"`
+}
+
+// Rules is the pricing configuration, normally loaded from a JSON file.
+type Rules struct {
+	Discounts []Discount         `json:"discounts"`
+	Coupons   []Coupon           `json:"coupons"`
+	Tiers     []Tier             `json:"tiers"`
+	TaxRates  map[string]Percent `json:"tax_rates"`
+}
+
+// LoadRules reads rules from a JSON file. An empty path gives no rules.
+func LoadRules(path string) (Rules, error) {
+	var rules Rules
+	if path == "" {
+		return rules, nil
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return rules, err
+	}
+	if err := json.Unmarshal(data, &rules); err != nil {
+		return rules, fmt.Errorf("parsing %s: %w", path, err)
+	}
+	return rules, rules.validate()
+}
+
+func (r Rules) validate() error {
+	for _, d := range r.Discounts {
+		if err := d.validate(); err != nil {
+			return fmt.Errorf("discount %q: %w", d.Name, err)
+		}
+	}
+	for _, c := range r.Coupons {
+		if err := c.validate(); err != nil {
+			return fmt.Errorf("coupon %q: %w", c.Code, err)
+		}
+	}
+	for _, t := range r.Tiers {
+		if t.MinQuantity <= 0 {
+			return fmt.Errorf("tier for product %s: min_quantity must be positive", t.ProductID)
+		}
+		if err := t.Percent.validate(); err != nil {
+			return fmt.Errorf("tier for product %s: %w", t.ProductID, err)
+		}
+	}
+	for region, rate := range r.TaxRates {
+		if err := rate.validate(); err != nil {
+			return fmt.Errorf("tax rate for %s: %w", region, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package render
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"order-service/logging"
+)
+
+// ErrorBody is the envelope every error response is written in.
+type ErrorBody struct {
+	Error ErrorDetail `json:"error"`
+}
+
+type ErrorDetail struct {
+	// Code is the status text in snake case, such as not_found.
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+	Status    int    `json:"status"`
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// Error writes an error in the envelope.
+func Error(w http.ResponseWriter, r *http.Request, status int, message string) {
+	// Requests no route matched skip the logging middleware, so the ID
+	// is only in the header
+	requestID := logging.RequestID(r.Context())
+	if requestID == "" {
+		requestID = r.Header.Get(logging.RequestIDHeader)
+	}
+	h := w.Header()
+	h.Del("ETag")
+	h.Set("Content-Type", JSON)
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(ErrorBody{Error: ErrorDetail{
+		Code:      Code(status),
+		Message:   message,
+		Status:    status,
+		RequestID: requestID,
+	}})
+}
+
+// Code returns the error code for a status.
+func Code(status int) string {
+	text := http.StatusText(status)
+	if text == "" {
+		return "error"
+	}
+	return strings.ReplaceAll(strings.ToLower(strings.ReplaceAll(text, "-", " ")), " ", "_")
+}
+
+// NotFound answers requests no route matches.
+func NotFound(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusNotFound, "no such resource")
+}
+
+// MethodNotAllowed answers requests for a route with another method.
+func MethodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusMethodNotAllowed, "method "+r.Method+" is not allowed")
+}
@@ -0,0 +1,76 @@
+package render
+
+import (
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// ETag returns the entity tag of a resource as sent in a media type: a hash
+// of its JSON body and the media type, so it changes whenever what a GET
+// returns changes, and each encoding of a resource has a tag of its own.
+func ETag(v any, mediaType string) string {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return ""
+	}
+	return etag(body, mediaType)
+}
+
+func etag(body []byte, mediaType string) string {
+	h := sha256.New()
+	h.Write([]byte(mediaType))
+	h.Write([]byte{0})
+	h.Write(body)
+	return fmt.Sprintf("%q", fmt.Sprintf("%x", h.Sum(nil)[:12]))
+}
+
+// IfMatch checks the If-Match precondition of a request against the current
+// body of the resource it changes, as a GET in the request's API version
+// would return it. The tag of any encoding of that body matches, as the
+// client may have read it in any. Without If-Match it holds.
+func IfMatch(r *http.Request, current any) bool {
+	header := r.Header.Get("If-Match")
+	if header == "" {
+		return true
+	}
+	body, err := json.Marshal(current)
+	if err != nil {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if candidate == "*" {
+			return true
+		}
+		// Weak tags never match strongly
+		for _, mediaType := range []string{JSON, MsgPack, Protobuf} {
+			if candidate == etag(body, mediaType) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// PreconditionFailed answers a request whose If-Match no longer holds.
+func PreconditionFailed(w http.ResponseWriter, r *http.Request) {
+	Error(w, r, http.StatusPreconditionFailed, "resource has changed; fetch it again and retry with its new ETag")
+}
+
+// noneMatch reports whether an If-None-Match header names tag, comparing
+// weakly.
+func noneMatch(header, tag string) bool {
+	if header == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(header, ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+		if candidate == "*" || candidate == tag {
+			return true
+		}
+	}
+	return false
+}
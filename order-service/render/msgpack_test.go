@@ -0,0 +1,203 @@
+package render
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/vmihailenco/msgpack/v5"
+)
+
+func TestMsgPackRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		doc    any
+		marker byte
+	}{
+		{"null", nil, 0xc0},
+		{"true", true, 0xc3},
+		{"false", false, 0xc2},
+
+		{"zero", number(0), 0x00},
+		{"largest positive fixint", number(127), 0x7f},
+		{"smallest int16 above fixint", number(128), 0xd1},
+		{"smallest negative fixint", number(-32), 0xe0},
+		{"largest int8 below fixint", number(-33), 0xd0},
+		{"smallest int8", number(math.MinInt8), 0xd0},
+		{"largest int16 below int8", number(math.MinInt8 - 1), 0xd1},
+		{"largest int16", number(math.MaxInt16), 0xd1},
+		{"smallest int32 above int16", number(math.MaxInt16 + 1), 0xd2},
+		{"smallest int16", number(math.MinInt16), 0xd1},
+		{"largest int32 below int16", number(math.MinInt16 - 1), 0xd2},
+		{"largest int32", number(math.MaxInt32), 0xd2},
+		{"smallest int64 above int32", number(math.MaxInt32 + 1), 0xd3},
+		{"smallest int32", number(math.MinInt32), 0xd2},
+		{"largest int64 below int32", number(math.MinInt32 - 1), 0xd3},
+		{"largest int64", number(math.MaxInt64), 0xd3},
+		{"smallest int64", number(math.MinInt64), 0xd3},
+		{"beyond int64", json.Number("9223372036854775808"), 0xcb},
+		{"fraction", json.Number("9.99"), 0xcb},
+		{"negative fraction", json.Number("-0.5"), 0xcb},
+		{"exponent", json.Number("1e300"), 0xcb},
+
+		{"empty string", "", 0xa0},
+		{"longest fixstr", strings.Repeat("a", 31), 0xbf},
+		{"shortest str8", strings.Repeat("a", 32), 0xd9},
+		{"multibyte str8", strings.Repeat("é", 16), 0xd9},
+		{"longest str8", strings.Repeat("a", math.MaxUint8), 0xd9},
+		{"shortest str16", strings.Repeat("a", math.MaxUint8+1), 0xda},
+		{"longest str16", strings.Repeat("a", math.MaxUint16), 0xda},
+		{"shortest str32", strings.Repeat("a", math.MaxUint16+1), 0xdb},
+
+		{"empty array", []any{}, 0x90},
+		{"longest fixarray", list(15), 0x9f},
+		{"shortest array16", list(16), 0xdc},
+		{"shortest array32", list(math.MaxUint16 + 1), 0xdd},
+
+		{"empty map", map[string]any{}, 0x80},
+		{"longest fixmap", object(15), 0x8f},
+		{"shortest map16", object(16), 0xde},
+		{"shortest map32", object(math.MaxUint16 + 1), 0xdf},
+		{"nested maps", map[string]any{
+			"id":    "1",
+			"price": map[string]any{"amount": number(99999), "currency": "USD"},
+			"variants": []any{
+				map[string]any{"sku": "1-red", "attributes": map[string]any{"color": map[string]any{"value": "red"}}},
+				map[string]any{"sku": "1-blue", "price": nil, "in_stock": false},
+			},
+			"ratio": json.Number("0.25"),
+		}, 0x84},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := appendMsgPack(nil, tt.doc)
+			if b[0] != tt.marker {
+				t.Errorf("marker = %#x, want %#x", b[0], tt.marker)
+			}
+			got := referenceDecode(t, b)
+			if want := plainNumbers(tt.doc); !reflect.DeepEqual(got, want) {
+				t.Errorf("decoded %v, want %v", abbreviate(got), abbreviate(want))
+			}
+		})
+	}
+}
+
+func TestMsgPackSortsKeys(t *testing.T) {
+	b := appendMsgPack(nil, map[string]any{"b": number(2), "a": number(1)})
+	want := []byte{0x82, 0xa1, 'a', 0x01, 0xa1, 'b', 0x02}
+	if !bytes.Equal(b, want) {
+		t.Errorf("encoded % x, want % x", b, want)
+	}
+}
+
+// TestMsgPackFromJSON checks what Respond sends: a JSON body decoded with
+// exact numbers and encoded again.
+func TestMsgPackFromJSON(t *testing.T) {
+	body := `{"id":"1","quantity":2147483648,"price":{"amount":-129,"currency":"JPY"},"rate":0.1,"tags":["a",null,true]}`
+	doc, err := decode([]byte(body))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := referenceDecode(t, appendMsgPack(nil, doc))
+	want := map[string]any{
+		"id":       "1",
+		"quantity": int64(2147483648),
+		"price":    map[string]any{"amount": int64(-129), "currency": "JPY"},
+		"rate":     0.1,
+		"tags":     []any{"a", nil, true},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("decoded %v, want %v", got, want)
+	}
+}
+
+func number(i int64) json.Number {
+	return json.Number(strconv.FormatInt(i, 10))
+}
+
+func list(n int) []any {
+	items := make([]any, n)
+	for i := range items {
+		items[i] = number(int64(i))
+	}
+	return items
+}
+
+func object(n int) map[string]any {
+	m := make(map[string]any, n)
+	for i := 0; i < n; i++ {
+		m["k"+strconv.Itoa(i)] = number(int64(i))
+	}
+	return m
+}
+
+// referenceDecode decodes one MessagePack value with an independent
+// implementation, reading integers as int64 and floats as float64.
+func referenceDecode(t *testing.T, b []byte) any {
+	t.Helper()
+	dec := msgpack.NewDecoder(bytes.NewReader(b))
+	dec.UseLooseInterfaceDecoding(true)
+	v, err := dec.DecodeInterfaceLoose()
+	if err != nil {
+		t.Fatalf("reference decoder: %v", err)
+	}
+	if _, err := dec.DecodeInterfaceLoose(); !errors.Is(err, io.EOF) {
+		t.Fatalf("trailing bytes after the value: %v", err)
+	}
+	return plainNumbers(v)
+}
+
+// plainNumbers turns json.Number into int64 or float64, as the reference
+// decoder returns numbers.
+func plainNumbers(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		if i, err := strconv.ParseInt(v.String(), 10, 64); err == nil {
+			return i
+		}
+		f, _ := v.Float64()
+		return f
+	case uint64:
+		if v <= math.MaxInt64 {
+			return int64(v)
+		}
+	case []any:
+		out := make([]any, len(v))
+		for i, item := range v {
+			out[i] = plainNumbers(item)
+		}
+		return out
+	case map[string]any:
+		out := make(map[string]any, len(v))
+		for k, item := range v {
+			out[k] = plainNumbers(item)
+		}
+		return out
+	}
+	return v
+}
+
+// abbreviate keeps failure messages about long strings and lists readable.
+func abbreviate(v any) any {
+	switch v := v.(type) {
+	case string:
+		if len(v) > 40 {
+			return v[:40] + "... (" + strconv.Itoa(len(v)) + " bytes)"
+		}
+	case []any:
+		if len(v) > 20 {
+			return strconv.Itoa(len(v)) + " items"
+		}
+	case map[string]any:
+		if len(v) > 20 {
+			return strconv.Itoa(len(v)) + " entries"
+		}
+	}
+	return v
+}
@@ -0,0 +1,159 @@
+// Package render writes REST responses: bodies in the encoding the client
+// accepts, entity tags for conditional requests, and errors in one envelope.
+//
+// Bodies are JSON unless Accept prefers MessagePack (application/msgpack) or
+// protobuf (application/x-protobuf), which is sent as a google.protobuf.Value
+// holding the same document. Errors are always JSON.
+package render
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+
+	"google.golang.org/protobuf/proto"
+	"google.golang.org/protobuf/types/known/structpb"
+)
+
+// Media types a body can be written in.
+const (
+	JSON     = "application/json"
+	MsgPack  = "application/msgpack"
+	Protobuf = "application/x-protobuf"
+)
+
+// protobufType is the Content-Type of protobuf bodies, naming the message.
+const protobufType = Protobuf + "; proto=google.protobuf.Value"
+
+// Respond writes v with status in the encoding the request accepts. A
+// successful GET carries the ETag of that encoding, and one whose
+// If-None-Match names it is answered 304 Not Modified without a body.
+func Respond(w http.ResponseWriter, r *http.Request, status int, v any) {
+	body, err := json.Marshal(v)
+	if err != nil {
+		Error(w, r, http.StatusInternalServerError, "cannot encode response: "+err.Error())
+		return
+	}
+	h := w.Header()
+	h.Add("Vary", "Accept")
+	mediaType := Negotiate(r.Header.Get("Accept"))
+	if status == http.StatusOK && (r.Method == http.MethodGet || r.Method == http.MethodHead) {
+		tag := etag(body, mediaType)
+		h.Set("ETag", tag)
+		if noneMatch(r.Header.Get("If-None-Match"), tag) {
+			w.WriteHeader(http.StatusNotModified)
+			return
+		}
+	}
+
+	switch mediaType {
+	case MsgPack, Protobuf:
+		doc, err := decode(body)
+		if err == nil {
+			if mediaType == MsgPack {
+				body = appendMsgPack(nil, doc)
+			} else {
+				body, err = protobufValue(doc)
+			}
+		}
+		if err != nil {
+			Error(w, r, http.StatusInternalServerError, "cannot encode response: "+err.Error())
+			return
+		}
+		if mediaType == Protobuf {
+			mediaType = protobufType
+		}
+	default:
+		body = append(body, '\n')
+	}
+	h.Set("Content-Type", mediaType)
+	w.WriteHeader(status)
+	w.Write(body)
+}
+
+// Negotiate returns the media type to answer with for an Accept header:
+// the supported type with the highest quality, JSON on a tie and when
+// nothing supported is asked for.
+func Negotiate(accept string) string {
+	type choice struct {
+		mediaType string
+		quality   float64
+	}
+	var choices []choice
+	for _, part := range strings.Split(accept, ",") {
+		typ, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		quality := 1.0
+		if q, ok := params["q"]; ok {
+			if quality, err = strconv.ParseFloat(q, 64); err != nil {
+				continue
+			}
+		}
+		if supported := supportedType(typ); supported != "" && quality > 0 {
+			choices = append(choices, choice{supported, quality})
+		}
+	}
+	sort.SliceStable(choices, func(i, j int) bool {
+		if choices[i].quality != choices[j].quality {
+			return choices[i].quality > choices[j].quality
+		}
+		return choices[i].mediaType == JSON && choices[j].mediaType != JSON
+	})
+	if len(choices) == 0 {
+		return JSON
+	}
+	return choices[0].mediaType
+}
+
+func supportedType(typ string) string {
+	switch {
+	case typ == JSON, typ == "*/*", typ == "application/*", strings.HasSuffix(typ, "+json"):
+		return JSON
+	case typ == MsgPack, typ == "application/x-msgpack", typ == "application/vnd.msgpack":
+		return MsgPack
+	case typ == Protobuf, typ == "application/protobuf", typ == "application/vnd.google.protobuf":
+		return Protobuf
+	}
+	return ""
+}
+
+// decode parses a JSON document keeping numbers exact.
+func decode(body []byte) (any, error) {
+	dec := json.NewDecoder(strings.NewReader(string(body)))
+	dec.UseNumber()
+	var doc any
+	err := dec.Decode(&doc)
+	return doc, err
+}
+
+func protobufValue(doc any) ([]byte, error) {
+	v, err := structpb.NewValue(plain(doc))
+	if err != nil {
+		return nil, err
+	}
+	return proto.Marshal(v)
+}
+
+// plain turns the numbers of a decoded document into float64, the only
+// number google.protobuf.Value holds.
+func plain(v any) any {
+	switch v := v.(type) {
+	case json.Number:
+		f, _ := v.Float64()
+		return f
+	case []any:
+		for i := range v {
+			v[i] = plain(v[i])
+		}
+	case map[string]any:
+		for k := range v {
+			v[k] = plain(v[k])
+		}
+	}
+	return v
+}
@@ -0,0 +1,151 @@
+// Package store keeps orders in memory, safe for concurrent use by the HTTP
+// handlers and background workers.
+package store
+
+import (
+	"errors"
+	"order-service/events"
+	"order-service/model"
+	"order-service/payment"
+	"sync"
+)
+
+var (
+	ErrNotFound = errors.New("order not found")
+	ErrExists   = errors.New("order already exists")
+	// ErrVersionConflict rejects a change made against an old version.
+	ErrVersionConflict = errors.New("order has changed since the given version")
+)
+
+// Orders records OrderPlaced when an order is added, OrderStatusChanged on
+// every status transition and OrderCancelled when an order becomes cancelled
+// or is deleted before that, in the outbox and under the same lock as the
+// change.
+type Orders struct {
+	mu     sync.RWMutex
+	orders []model.Order
+	outbox *events.Outbox
+}
+
+// StatusChange is the payload of OrderStatusChanged: the updated order and
+// the status it left.
+type StatusChange struct {
+	model.Order
+	PreviousStatus string `json:"previous_status"`
+}
+
+// NewOrders returns an empty store recording its events in outbox, which may
+// be nil.
+func NewOrders(outbox *events.Outbox) *Orders {
+	return &Orders{outbox: outbox}
+}
+
+// List returns a snapshot of all orders.
+func (s *Orders) List() []model.Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	return append([]model.Order{}, s.orders...)
+}
+
+// ByCustomer returns the orders of one customer.
+func (s *Orders) ByCustomer(customerID string) []model.Order {
+	return s.Filter(func(o model.Order) bool { return o.CustomerID == customerID })
+}
+
+// Filter returns the orders for which keep is true.
+func (s *Orders) Filter(keep func(model.Order) bool) []model.Order {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	matched := []model.Order{}
+	for _, o := range s.orders {
+		if keep(o) {
+			matched = append(matched, o)
+		}
+	}
+	return matched
+}
+
+func (s *Orders) Get(id string) (model.Order, bool) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	i := s.index(id)
+	if i < 0 {
+		return model.Order{}, false
+	}
+	return s.orders[i], true
+}
+
+// Add stores o at version 1 and returns it as stored.
+func (s *Orders) Add(o model.Order) (model.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if o.ID != "" && s.index(o.ID) >= 0 {
+		return model.Order{}, ErrExists
+	}
+	o.Version = 1
+	if err := s.outbox.Record(events.OrderPlaced, o.ID, o); err != nil {
+		return model.Order{}, err
+	}
+	s.orders = append(s.orders, o)
+	return o, nil
+}
+
+// Update applies fn to an order under the store lock and bumps its version.
+// The order is left unchanged if fn fails.
+func (s *Orders) Update(id string, fn func(*model.Order) error) (model.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 {
+		return model.Order{}, ErrNotFound
+	}
+	o := s.orders[i]
+	if err := fn(&o); err != nil {
+		return model.Order{}, err
+	}
+	o.Version = s.orders[i].Version + 1
+	if previous := s.orders[i].Status; o.Status != previous {
+		recorded := []events.Entry{{Type: events.OrderStatusChanged, AggregateID: o.ID, Data: StatusChange{o, previous}}}
+		if o.Status == payment.StatusCancelled {
+			recorded = append(recorded, events.Entry{Type: events.OrderCancelled, AggregateID: o.ID, Data: o})
+		}
+		if err := s.outbox.RecordAll(recorded...); err != nil {
+			return model.Order{}, err
+		}
+	}
+	s.orders[i] = o
+	return o, nil
+}
+
+// Delete removes an order once check, called under the store lock, allows
+// it, and returns the order removed.
+func (s *Orders) Delete(id string, check func(model.Order) error) (model.Order, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 {
+		return model.Order{}, ErrNotFound
+	}
+	o := s.orders[i]
+	if err := check(o); err != nil {
+		return model.Order{}, err
+	}
+	if o.Status != payment.StatusCancelled {
+		cancelled := o
+		cancelled.Status = payment.StatusCancelled
+		if err := s.outbox.Record(events.OrderCancelled, o.ID, cancelled); err != nil {
+			return model.Order{}, err
+		}
+	}
+	s.orders = append(s.orders[:i], s.orders[i+1:]...)
+	return o, nil
+}
+
+func (s *Orders) index(id string) int {
+	for i, o := range s.orders {
+		if o.ID == id {
+			return i
+		}
+	}
+	return -1
+}
@@ -0,0 +1,212 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"order-service/apiversion"
+	"order-service/model"
+	"order-service/money"
+	"order-service/pricing"
+	"strings"
+)
+
+// orderV1 is an order as API v1 shows it: total and the unit prices of its
+// items are decimal numbers in the order's currency, such as 999.99, as they
+// were before Money. Pricing and payment came with Money and keep it.
+type orderV1 struct {
+	ID         string             `json:"id"`
+	CustomerID string             `json:"customer_id"`
+	ProductIDs []string           `json:"product_ids"`
+	Items      []orderItemV1      `json:"items,omitempty"`
+	Currency   string             `json:"currency"`
+	Region     string             `json:"region,omitempty"`
+	CouponCode string             `json:"coupon_code,omitempty"`
+	Pricing    *pricing.Breakdown `json:"pricing,omitempty"`
+	Total      json.Number        `json:"total"`
+	Status     string             `json:"status"`
+	Payment    *model.Payment     `json:"payment,omitempty"`
+	Version    int64              `json:"version"`
+}
+
+// orderItemV1 is an order item as API v1 shows it, its unit price as on
+// orderV1.
+type orderItemV1 struct {
+	ProductID string      `json:"product_id"`
+	SKU       string      `json:"sku,omitempty"`
+	Quantity  int32       `json:"quantity"`
+	UnitPrice json.Number `json:"unit_price"`
+}
+
+func toV1(o model.Order) orderV1 {
+	v1 := orderV1{
+		ID:         o.ID,
+		CustomerID: o.CustomerID,
+		ProductIDs: o.ProductIDs,
+		Currency:   o.Currency,
+		Region:     o.Region,
+		CouponCode: o.CouponCode,
+		Pricing:    o.Pricing,
+		Total:      legacyAmount(o.Total),
+		Status:     o.Status,
+		Payment:    o.Payment,
+		Version:    o.Version,
+	}
+	for _, item := range o.Items {
+		v1.Items = append(v1.Items, orderItemV1{
+			ProductID: item.ProductID,
+			SKU:       item.SKU,
+			Quantity:  item.Quantity,
+			UnitPrice: legacyAmount(item.UnitPrice),
+		})
+	}
+	return v1
+}
+
+// legacyAmount is an amount as v1 shows it: a decimal number without
+// trailing zeros, like the floats v1 had.
+func legacyAmount(m money.Money) json.Number {
+	d := m.Decimal()
+	if strings.Contains(d, ".") {
+		d = strings.TrimSuffix(strings.TrimRight(d, "0"), ".")
+	}
+	return json.Number(d)
+}
+
+// fromV1 leaves out total and unit prices: the service prices every order
+// it stores, so those sent by clients are never used.
+func fromV1(o orderV1) model.Order {
+	order := model.Order{
+		ID:         o.ID,
+		CustomerID: o.CustomerID,
+		ProductIDs: o.ProductIDs,
+		Currency:   o.Currency,
+		Region:     o.Region,
+		CouponCode: o.CouponCode,
+		Pricing:    o.Pricing,
+		Status:     o.Status,
+		Payment:    o.Payment,
+		Version:    o.Version,
+	}
+	for _, item := range o.Items {
+		order.Items = append(order.Items, model.OrderItem{
+			ProductID: item.ProductID,
+			SKU:       item.SKU,
+			Quantity:  item.Quantity,
+		})
+	}
+	return order
+}
+
+// orderV2 is an order as API v2 shows it. v1 listed products ordered before
+// line items existed in product_ids; v2 lists them as items of one, so that
+// items is the only list of what was ordered and is always present.
+type orderV2 struct {
+	ID         string             `json:"id"`
+	CustomerID string             `json:"customer_id"`
+	Items      []model.OrderItem  `json:"items"`
+	Currency   string             `json:"currency"`
+	Region     string             `json:"region,omitempty"`
+	CouponCode string             `json:"coupon_code,omitempty"`
+	Pricing    *pricing.Breakdown `json:"pricing,omitempty"`
+	Total      money.Money        `json:"total"`
+	Status     string             `json:"status"`
+	Payment    *model.Payment     `json:"payment,omitempty"`
+	Version    int64              `json:"version"`
+}
+
+func toV2(o model.Order) orderV2 {
+	items := append([]model.OrderItem{}, o.Items...)
+	for i, productID := range o.ProductIDs {
+		// Lines are priced in the order items then product IDs
+		unitPrice := money.New(0, o.Currency)
+		if line := len(o.Items) + i; o.Pricing != nil && line < len(o.Pricing.Lines) {
+			unitPrice = o.Pricing.Lines[line].UnitPrice
+		}
+		items = append(items, model.OrderItem{ProductID: productID, Quantity: 1, UnitPrice: unitPrice})
+	}
+	return orderV2{
+		ID:         o.ID,
+		CustomerID: o.CustomerID,
+		Items:      items,
+		Currency:   o.Currency,
+		Region:     o.Region,
+		CouponCode: o.CouponCode,
+		Pricing:    o.Pricing,
+		Total:      o.Total,
+		Status:     o.Status,
+		Payment:    o.Payment,
+		Version:    o.Version,
+	}
+}
+
+func fromV2(o orderV2) model.Order {
+	return model.Order{
+		ID:         o.ID,
+		CustomerID: o.CustomerID,
+		Items:      o.Items,
+		Currency:   o.Currency,
+		Region:     o.Region,
+		CouponCode: o.CouponCode,
+		Pricing:    o.Pricing,
+		Total:      o.Total,
+		Status:     o.Status,
+		Payment:    o.Payment,
+		Version:    o.Version,
+	}
+}
+
+// decodeOrder reads an order in the shape of the request's API version. v2
+// rejects fields it does not know, product_ids among them.
+func decodeOrder(r *http.Request, order *model.Order) error {
+	return decodeOrderFrom(r, r.Body, order)
+}
+
+// decodeOrderFrom is decodeOrder reading body instead of the request's.
+func decodeOrderFrom(r *http.Request, body io.Reader, order *model.Order) error {
+	if apiversion.FromRequest(r) < 2 {
+		var v1 orderV1
+		if err := json.NewDecoder(body).Decode(&v1); err != nil {
+			return err
+		}
+		*order = fromV1(v1)
+		return nil
+	}
+	dec := json.NewDecoder(body)
+	dec.DisallowUnknownFields()
+	var v2 orderV2
+	if err := dec.Decode(&v2); err != nil {
+		return err
+	}
+	if len(v2.Items) == 0 {
+		return errors.New("order has no items")
+	}
+	*order = fromV2(v2)
+	return nil
+}
+
+// orderBody returns an order in the shape of the request's API version.
+func orderBody(r *http.Request, order model.Order) any {
+	if apiversion.FromRequest(r) < 2 {
+		return toV1(order)
+	}
+	return toV2(order)
+}
+
+// ordersBody returns a list of orders in the shape of the request's API
+// version.
+func ordersBody(r *http.Request, list []model.Order) any {
+	if apiversion.FromRequest(r) < 2 {
+		v1 := make([]orderV1, 0, len(list))
+		for _, o := range list {
+			v1 = append(v1, toV1(o))
+		}
+		return v1
+	}
+	v2 := make([]orderV2, 0, len(list))
+	for _, o := range list {
+		v2 = append(v2, toV2(o))
+	}
+	return v2
+}
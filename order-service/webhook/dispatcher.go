@@ -0,0 +1,154 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math/rand/v2"
+	"net/http"
+	"order-service/events"
+	"order-service/payment"
+	"sync"
+	"time"
+)
+
+// Headers sent with every delivery. The signature uses the same scheme as
+// incoming payment webhooks: "t=<unix time>,v1=<hex HMAC-SHA256>" over
+// "<unix time>.<body>", keyed by the subscription secret. Receivers drop
+// duplicates by event ID.
+const (
+	SignatureHeader = "X-Webhook-Signature"
+	EventHeader     = "X-Webhook-Event"
+	EventIDHeader   = "X-Webhook-Event-ID"
+	DeliveryHeader  = "X-Webhook-Delivery"
+)
+
+// concurrency bounds the deliveries in flight at once.
+const concurrency = 8
+
+type Dispatcher struct {
+	store       *Store
+	client      *http.Client
+	maxAttempts int
+	retryBase   time.Duration
+	retryMax    time.Duration
+	wake        chan struct{}
+}
+
+// NewDispatcher sends deliveries from store, giving each up to maxAttempts
+// tries. Retries wait retryBase, doubling up to retryMax, plus some jitter.
+func NewDispatcher(store *Store, timeout time.Duration, maxAttempts int, retryBase, retryMax time.Duration) *Dispatcher {
+	return &Dispatcher{
+		store:       store,
+		client:      &http.Client{Timeout: timeout},
+		maxAttempts: maxAttempts,
+		retryBase:   retryBase,
+		retryMax:    retryMax,
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Handle queues deliveries of ev. It is subscribed to the event bus.
+func (d *Dispatcher) Handle(ctx context.Context, ev events.Event) error {
+	if d.store.Enqueue(ev) > 0 {
+		d.Wake()
+	}
+	return nil
+}
+
+// Wake makes Run look for due deliveries straight away.
+func (d *Dispatcher) Wake() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Run sends due deliveries until ctx is cancelled, checking every interval.
+func (d *Dispatcher) Run(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		d.dispatch(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-d.wake:
+		case <-ticker.C:
+		}
+	}
+}
+
+func (d *Dispatcher) dispatch(ctx context.Context) {
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for _, j := range d.store.due(time.Now()) {
+		sem <- struct{}{}
+		wg.Add(1)
+		go func() {
+			defer func() { <-sem; wg.Done() }()
+			d.deliver(ctx, j)
+		}()
+	}
+	wg.Wait()
+}
+
+func (d *Dispatcher) deliver(ctx context.Context, j job) {
+	attempt := Attempt{At: time.Now().UTC()}
+	status, err := d.post(ctx, j)
+	attempt.StatusCode = status
+	if err != nil {
+		attempt.Error = err.Error()
+	}
+
+	tries := j.delivery.tries + 1
+	switch {
+	case err == nil:
+		d.store.record(j.delivery.ID, attempt, StatusDelivered, time.Time{})
+	case tries >= d.maxAttempts:
+		slog.WarnContext(ctx, "webhook delivery dead-lettered", "delivery_id", j.delivery.ID, "subscription_id", j.subscription.ID, "event_id", j.delivery.EventID, "attempts", tries, "error", err)
+		d.store.record(j.delivery.ID, attempt, StatusDead, time.Time{})
+	default:
+		wait := d.backoff(tries)
+		slog.InfoContext(ctx, "webhook delivery failed", "delivery_id", j.delivery.ID, "subscription_id", j.subscription.ID, "attempt", tries, "retry_in", wait.String(), "error", err)
+		d.store.record(j.delivery.ID, attempt, StatusPending, time.Now().UTC().Add(wait))
+	}
+}
+
+// post sends the event envelope and treats any 2xx answer as success.
+func (d *Dispatcher) post(ctx context.Context, j job) (int, error) {
+	body, err := json.Marshal(j.delivery.event)
+	if err != nil {
+		return 0, err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, j.subscription.URL, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(EventHeader, j.delivery.EventType)
+	req.Header.Set(EventIDHeader, j.delivery.EventID)
+	req.Header.Set(DeliveryHeader, j.delivery.ID)
+	req.Header.Set(SignatureHeader, payment.Sign(j.subscription.Secret, time.Now(), body))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("subscriber answered %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// backoff returns the wait after the given number of failed tries.
+func (d *Dispatcher) backoff(tries int) time.Duration {
+	wait := d.retryMax
+	if shift := tries - 1; shift < 32 && d.retryBase<<shift < d.retryMax {
+		wait = d.retryBase << shift
+	}
+	return wait + rand.N(wait/5+1)
+}
@@ -0,0 +1,343 @@
+// Package webhook delivers order and stock events to partner endpoints.
+// Subscriptions pick the event types they want; each matching event becomes a
+// delivery that is retried with exponential backoff and ends up either
+// delivered or in the dead-letter list, from where it can be redelivered by
+// hand.
+package webhook
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"order-service/events"
+	"slices"
+	"sync"
+	"time"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrPending  = errors.New("delivery is still being retried")
+)
+
+// EventTypes are the events a subscription can filter on. StockAdjusted is
+// published by inventory-service and only arrives through the nats broker.
+var EventTypes = []string{events.OrderPlaced, events.OrderStatusChanged, events.OrderCancelled, events.StockAdjusted}
+
+// Delivery statuses.
+const (
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusDead      = "dead"
+)
+
+type Subscription struct {
+	ID  string `json:"id"`
+	URL string `json:"url"`
+	// Events filters by event type; empty means every type.
+	Events []string `json:"events,omitempty"`
+	// Secret keys the delivery signatures. It is generated when left empty
+	// and only returned when the subscription is created.
+	Secret    string    `json:"secret,omitempty"`
+	Active    bool      `json:"active"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (s Subscription) Validate() error {
+	u, err := url.Parse(s.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("url must be an absolute http or https URL")
+	}
+	for _, typ := range s.Events {
+		if !slices.Contains(EventTypes, typ) {
+			return fmt.Errorf("unknown event type %q", typ)
+		}
+	}
+	return nil
+}
+
+// Wants reports whether the subscription takes events of the given type.
+func (s Subscription) Wants(eventType string) bool {
+	return s.Active && (len(s.Events) == 0 || slices.Contains(s.Events, eventType))
+}
+
+// Redacted returns s without its secret.
+func (s Subscription) Redacted() Subscription {
+	s.Secret = ""
+	return s
+}
+
+// Attempt records one POST to the subscriber.
+type Attempt struct {
+	At         time.Time `json:"at"`
+	StatusCode int       `json:"status_code,omitempty"`
+	Error      string    `json:"error,omitempty"`
+}
+
+type Delivery struct {
+	ID             string     `json:"id"`
+	SubscriptionID string     `json:"subscription_id"`
+	EventID        string     `json:"event_id"`
+	EventType      string     `json:"event_type"`
+	Status         string     `json:"status"`
+	Attempts       []Attempt  `json:"attempts"`
+	NextAttemptAt  *time.Time `json:"next_attempt_at,omitempty"`
+	CreatedAt      time.Time  `json:"created_at"`
+
+	event events.Event
+	// tries counts the attempts since the delivery was last queued.
+	tries int
+}
+
+func (d Delivery) clone() Delivery {
+	d.Attempts = append([]Attempt{}, d.Attempts...)
+	return d
+}
+
+// Store keeps subscriptions and their deliveries in memory. Each
+// subscription's log holds its pending and dead deliveries plus the last
+// logSize delivered ones.
+type Store struct {
+	mu         sync.Mutex
+	subs       []Subscription
+	deliveries map[string]*Delivery
+	log        map[string][]string
+	logSize    int
+}
+
+func NewStore(logSize int) *Store {
+	return &Store{
+		deliveries: map[string]*Delivery{},
+		log:        map[string][]string{},
+		logSize:    logSize,
+	}
+}
+
+// Subscriptions returns all subscriptions without their secrets.
+func (s *Store) Subscriptions() []Subscription {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := make([]Subscription, 0, len(s.subs))
+	for _, sub := range s.subs {
+		list = append(list, sub.Redacted())
+	}
+	return list
+}
+
+// Subscription returns one subscription without its secret.
+func (s *Store) Subscription(id string) (Subscription, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 {
+		return Subscription{}, false
+	}
+	return s.subs[i].Redacted(), true
+}
+
+// Add stores a new subscription under a fresh ID and returns it, including
+// its secret.
+func (s *Store) Add(sub Subscription) Subscription {
+	sub.ID = newID(8)
+	if sub.Secret == "" {
+		sub.Secret = "whsec_" + newID(24)
+	}
+	sub.CreatedAt = time.Now().UTC()
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.subs = append(s.subs, sub)
+	return sub
+}
+
+// Update replaces the URL, filters and active flag of a subscription, and its
+// secret if a new one is given.
+func (s *Store) Update(id string, sub Subscription) (Subscription, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 {
+		return Subscription{}, ErrNotFound
+	}
+	current := s.subs[i]
+	current.URL, current.Events, current.Active = sub.URL, sub.Events, sub.Active
+	if sub.Secret != "" {
+		current.Secret = sub.Secret
+	}
+	s.subs[i] = current
+	return current.Redacted(), nil
+}
+
+// Delete removes a subscription together with its deliveries.
+func (s *Store) Delete(id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	i := s.index(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	s.subs = append(s.subs[:i], s.subs[i+1:]...)
+	for _, did := range s.log[id] {
+		delete(s.deliveries, did)
+	}
+	delete(s.log, id)
+	return nil
+}
+
+// Enqueue creates a pending delivery of ev for every subscription that wants
+// it and returns how many were created.
+func (s *Store) Enqueue(ev events.Event) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := time.Now().UTC()
+	n := 0
+	for _, sub := range s.subs {
+		if !sub.Wants(ev.Type) {
+			continue
+		}
+		d := &Delivery{
+			ID:             newID(8),
+			SubscriptionID: sub.ID,
+			EventID:        ev.ID,
+			EventType:      ev.Type,
+			Status:         StatusPending,
+			Attempts:       []Attempt{},
+			NextAttemptAt:  &now,
+			CreatedAt:      now,
+			event:          ev,
+		}
+		s.deliveries[d.ID] = d
+		s.log[sub.ID] = append(s.log[sub.ID], d.ID)
+		n++
+	}
+	return n
+}
+
+// job is a delivery that is due, with the subscription it goes to.
+type job struct {
+	delivery     Delivery
+	subscription Subscription
+}
+
+// due returns the pending deliveries whose next attempt is at or before now.
+func (s *Store) due(now time.Time) []job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var jobs []job
+	for _, sub := range s.subs {
+		for _, id := range s.log[sub.ID] {
+			d := s.deliveries[id]
+			if d.Status == StatusPending && !d.NextAttemptAt.After(now) {
+				jobs = append(jobs, job{d.clone(), sub})
+			}
+		}
+	}
+	return jobs
+}
+
+// record adds an attempt to a delivery and moves it to status. next is the
+// time of the following attempt while it stays pending.
+func (s *Store) record(id string, attempt Attempt, status string, next time.Time) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.deliveries[id]
+	if !ok {
+		// The subscription was deleted meanwhile
+		return
+	}
+	d.Attempts = append(d.Attempts, attempt)
+	d.tries++
+	d.Status = status
+	d.NextAttemptAt = nil
+	if status == StatusPending {
+		d.NextAttemptAt = &next
+	}
+	if status == StatusDelivered {
+		s.trim(d.SubscriptionID)
+	}
+}
+
+// trim drops the oldest delivered entries beyond logSize from a log.
+func (s *Store) trim(subID string) {
+	delivered := 0
+	for _, id := range s.log[subID] {
+		if s.deliveries[id].Status == StatusDelivered {
+			delivered++
+		}
+	}
+	kept := s.log[subID][:0]
+	for _, id := range s.log[subID] {
+		if delivered > s.logSize && s.deliveries[id].Status == StatusDelivered {
+			delete(s.deliveries, id)
+			delivered--
+			continue
+		}
+		kept = append(kept, id)
+	}
+	s.log[subID] = kept
+}
+
+// Deliveries returns the log of a subscription, newest first.
+func (s *Store) Deliveries(subID string) ([]Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.index(subID) < 0 {
+		return nil, ErrNotFound
+	}
+	ids := s.log[subID]
+	list := make([]Delivery, 0, len(ids))
+	for i := len(ids) - 1; i >= 0; i-- {
+		list = append(list, s.deliveries[ids[i]].clone())
+	}
+	return list, nil
+}
+
+// DeadLetters returns the deliveries that ran out of attempts, newest first.
+func (s *Store) DeadLetters() []Delivery {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	list := []Delivery{}
+	for _, d := range s.deliveries {
+		if d.Status == StatusDead {
+			list = append(list, d.clone())
+		}
+	}
+	slices.SortFunc(list, func(a, b Delivery) int { return b.CreatedAt.Compare(a.CreatedAt) })
+	return list
+}
+
+// Redeliver puts a dead or delivered delivery back in the queue for
+// immediate sending, with a fresh allowance of attempts. Earlier attempts
+// stay in its log.
+func (s *Store) Redeliver(id string) (Delivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	d, ok := s.deliveries[id]
+	if !ok {
+		return Delivery{}, ErrNotFound
+	}
+	if d.Status == StatusPending {
+		return Delivery{}, ErrPending
+	}
+	now := time.Now().UTC()
+	d.Status = StatusPending
+	d.NextAttemptAt = &now
+	d.tries = 0
+	return d.clone(), nil
+}
+
+func (s *Store) index(id string) int {
+	for i, sub := range s.subs {
+		if sub.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func newID(n int) string {
+	b := make([]byte, n)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
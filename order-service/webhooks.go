@@ -0,0 +1,134 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"order-service/render"
+	"order-service/webhook"
+
+	"github.com/gorilla/mux"
+)
+
+var webhooks *webhook.Store
+var dispatcher *webhook.Dispatcher
+
+// Webhook subscriptions carry secrets and see every customer's orders, so
+// only admins manage them.
+func requireAdmin(w http.ResponseWriter, r *http.Request) bool {
+	caller, ok := requireCaller(w, r)
+	if ok && !caller.IsAdmin() {
+		render.Error(w, r, http.StatusForbidden, "Forbidden")
+		return false
+	}
+	return ok
+}
+
+func GetWebhooks(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	render.Respond(w, r, http.StatusOK, webhooks.Subscriptions())
+}
+
+func GetWebhook(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	sub, ok := webhooks.Subscription(mux.Vars(r)["id"])
+	if !ok {
+		render.Error(w, r, http.StatusNotFound, "Webhook not found")
+		return
+	}
+	render.Respond(w, r, http.StatusOK, sub)
+}
+
+func CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	sub := webhook.Subscription{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := sub.Validate(); err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	// The secret is only ever shown here
+	render.Respond(w, r, http.StatusCreated, webhooks.Add(sub))
+}
+
+func UpdateWebhook(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	var sub webhook.Subscription
+	if err := json.NewDecoder(r.Body).Decode(&sub); err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := sub.Validate(); err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	id := mux.Vars(r)["id"]
+	if current, ok := webhooks.Subscription(id); ok && !render.IfMatch(r, current) {
+		render.PreconditionFailed(w, r)
+		return
+	}
+	sub, err := webhooks.Update(id, sub)
+	if err != nil {
+		render.Error(w, r, http.StatusNotFound, "Webhook not found")
+		return
+	}
+	render.Respond(w, r, http.StatusOK, sub)
+}
+
+func DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	if err := webhooks.Delete(mux.Vars(r)["id"]); err != nil {
+		render.Error(w, r, http.StatusNotFound, "Webhook not found")
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func GetWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	deliveries, err := webhooks.Deliveries(mux.Vars(r)["id"])
+	if err != nil {
+		render.Error(w, r, http.StatusNotFound, "Webhook not found")
+		return
+	}
+	render.Respond(w, r, http.StatusOK, deliveries)
+}
+
+func GetDeadLetters(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	render.Respond(w, r, http.StatusOK, webhooks.DeadLetters())
+}
+
+func RedeliverWebhook(w http.ResponseWriter, r *http.Request) {
+	if !requireAdmin(w, r) {
+		return
+	}
+	delivery, err := webhooks.Redeliver(mux.Vars(r)["id"])
+	switch {
+	case errors.Is(err, webhook.ErrNotFound):
+		render.Error(w, r, http.StatusNotFound, "Delivery not found")
+		return
+	case err != nil:
+		render.Error(w, r, http.StatusConflict, err.Error())
+		return
+	}
+	dispatcher.Wake()
+	render.Respond(w, r, http.StatusAccepted, delivery)
+}
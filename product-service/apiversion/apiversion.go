@@ -0,0 +1,92 @@
+// Package apiversion serves a service's HTTP API under version prefixes,
+// such as /v1/orders and /v2/orders, next to the unversioned paths, which
+// keep serving the first version for clients that predate versioning. Every
+// version is served by the same routes; handlers ask for the version of a
+// request to pick the shape they read and write.
+package apiversion
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Version is one version of an API.
+type Version struct {
+	Number int
+	// Deprecated is when the version was deprecated; zero if it is not.
+	Deprecated time.Time
+	// Sunset is when the version will stop being served; zero if that has
+	// not been decided.
+	Sunset time.Time
+}
+
+// Prefix returns the path prefix of the version, such as /v2.
+func (v Version) Prefix() string {
+	return fmt.Sprintf("/v%d", v.Number)
+}
+
+type versionKey struct{}
+
+// prefix matches the version prefix of a path.
+var prefix = regexp.MustCompile(`^/v[0-9]+(/|$)`)
+
+// FromRequest returns the API version a request was routed to, or 1 for
+// requests outside Mount.
+func FromRequest(r *http.Request) int {
+	if v, ok := r.Context().Value(versionKey{}).(int); ok {
+		return v
+	}
+	return 1
+}
+
+// Mount registers the routes for every version under its prefix and once
+// more without a prefix for the first version. Versions are listed oldest
+// first. Responses of every version but the last point at the same path in
+// the last version and announce the version's deprecation (RFC 9745) and
+// sunset (RFC 8594) when they are set.
+func Mount(router *mux.Router, versions []Version, routes func(*mux.Router)) {
+	latest := versions[len(versions)-1]
+	for _, v := range versions {
+		sub := router.PathPrefix(v.Prefix()).Subrouter()
+		sub.Use(v.middleware(latest))
+		routes(sub)
+	}
+	legacy := router.NewRoute().Subrouter()
+	legacy.Use(versions[0].middleware(latest))
+	routes(legacy)
+}
+
+func (v Version) middleware(latest Version) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if v.Number != latest.Number {
+				v.announce(w.Header(), latest, r.URL.Path)
+			}
+			ctx := context.WithValue(r.Context(), versionKey{}, v.Number)
+			next.ServeHTTP(w, r.WithContext(ctx))
+		})
+	}
+}
+
+func (v Version) announce(h http.Header, latest Version, path string) {
+	if !v.Deprecated.IsZero() {
+		h.Set("Deprecation", fmt.Sprintf("@%d", v.Deprecated.Unix()))
+	}
+	if !v.Sunset.IsZero() {
+		h.Set("Sunset", v.Sunset.UTC().Format(http.TimeFormat))
+	}
+	h.Add("Link", fmt.Sprintf("<%s%s>; rel=\"successor-version\"", latest.Prefix(), unversioned(path)))
+}
+
+// unversioned returns a path without its version prefix, if it has one.
+func unversioned(path string) string {
+	if loc := prefix.FindStringIndex(path); loc != nil {
+		return "/" + path[loc[1]:]
+	}
+	return path
+}
@@ -0,0 +1,565 @@
+package main
+
+// Bulk import and export of the catalog with its stock.
+//
+// Both take CSV and NDJSON. CSV has a header row naming its columns, in any
+// order: id, name, price, currency, quantity, category_id, version and
+// stock_version, with prices in major units such as 9.99. Export adds
+// in_stock, which import ignores, so an export can be imported again.
+// CSV leaves variants out; NDJSON has one product per line as POST /products
+// takes it, variants included.
+//
+// Imported products that exist are replaced, except that their stock is only
+// set when the row has a quantity, and only if it is still at the row's
+// stock_version when it has one, and CSV rows keep the prices in other
+// currencies and attributes CSV cannot hold.
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"product-service/metrics"
+	"product-service/model"
+	"product-service/money"
+	inventory_pb "product-service/proto/inventory"
+	"product-service/render"
+	"product-service/store"
+	"strconv"
+	"strings"
+)
+
+// Media types of the bulk formats.
+const (
+	csvType    = "text/csv"
+	ndjsonType = "application/x-ndjson"
+)
+
+// importBatchSize is the number of products whose stock is written or read
+// in one call to inventory-service.
+var importBatchSize = 100
+
+// maxImportSize limits the size of an import, and maxImportLine that of
+// one NDJSON line.
+const (
+	maxImportSize = 32 << 20
+	maxImportLine = 1 << 20
+)
+
+var csvColumns = []string{"id", "name", "price", "currency", "quantity", "category_id", "in_stock", "version", "stock_version"}
+
+// ImportResult reports what an import did, or with dry_run would do.
+type ImportResult struct {
+	DryRun  bool          `json:"dry_run"`
+	Rows    int           `json:"rows"`
+	Created int           `json:"created"`
+	Updated int           `json:"updated"`
+	Failed  int           `json:"failed"`
+	Errors  []ImportError `json:"errors"`
+}
+
+// ImportError is a row that was not imported. Line counts from 1 and
+// includes the CSV header.
+type ImportError struct {
+	Line  int    `json:"line"`
+	ID    string `json:"id,omitempty"`
+	Error string `json:"error"`
+}
+
+type importRow struct {
+	line    int
+	product model.Product
+	// stock is set when the row has a quantity; csv when it came from CSV.
+	stock, csv bool
+	exists     bool
+	err        error
+}
+
+// ImportProducts creates the products of a CSV or NDJSON file and replaces
+// those that exist, as POST and PUT /products/{id} would. Rows that fail are
+// reported and the rest imported; with dry_run=true nothing is written.
+// Products are imported in batches, each with one call to write its stock.
+func ImportProducts(w http.ResponseWriter, r *http.Request) {
+	dryRun := false
+	if v := r.URL.Query().Get("dry_run"); v != "" {
+		var err error
+		if dryRun, err = strconv.ParseBool(v); err != nil {
+			render.Error(w, r, http.StatusBadRequest, "dry_run must be true or false")
+			return
+		}
+	}
+
+	body := http.MaxBytesReader(w, r.Body, maxImportSize)
+	var rows []importRow
+	var err error
+	switch mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType {
+	case csvType:
+		rows, err = readCSV(body)
+	case ndjsonType:
+		rows, err = readNDJSON(r, body)
+	default:
+		render.Error(w, r, http.StatusUnsupportedMediaType, "import takes "+csvType+" or "+ndjsonType)
+		return
+	}
+	if err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	checkImport(rows)
+	if !dryRun {
+		importRows(r.Context(), rows)
+		metrics.SetCatalogSize(catalog.Len())
+	}
+
+	result := ImportResult{DryRun: dryRun, Rows: len(rows), Errors: []ImportError{}}
+	for _, row := range rows {
+		switch {
+		case row.err != nil:
+			result.Failed++
+			result.Errors = append(result.Errors, ImportError{Line: row.line, ID: row.product.ID, Error: row.err.Error()})
+		case row.exists:
+			result.Updated++
+		default:
+			result.Created++
+		}
+	}
+	slog.InfoContext(r.Context(), "catalog imported", "dry_run", dryRun, "rows", result.Rows, "failed", result.Failed)
+	render.Respond(w, r, http.StatusOK, result)
+}
+
+func readCSV(body io.Reader) ([]importRow, error) {
+	reader := csv.NewReader(body)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err == io.EOF {
+		return nil, errors.New("CSV has no header row")
+	}
+	if err != nil {
+		return nil, err
+	}
+	columns := make(map[string]int, len(header))
+	for i, name := range header {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if !isCSVColumn(name) {
+			return nil, fmt.Errorf("unknown CSV column %q", name)
+		}
+		columns[name] = i
+	}
+	if _, ok := columns["id"]; !ok {
+		return nil, errors.New("CSV has no id column")
+	}
+
+	var rows []importRow
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return rows, nil
+		}
+		var parseErr *csv.ParseError
+		if errors.As(err, &parseErr) {
+			rows = append(rows, importRow{line: parseErr.StartLine, err: parseErr.Err})
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		line, _ := reader.FieldPos(0)
+		row := importRow{line: line, csv: true}
+		if i, ok := columns["quantity"]; ok && i < len(record) {
+			row.stock = strings.TrimSpace(record[i]) != ""
+		}
+		row.product, row.err = csvProduct(record, columns)
+		rows = append(rows, row)
+	}
+}
+
+func isCSVColumn(name string) bool {
+	for _, column := range csvColumns {
+		if name == column {
+			return true
+		}
+	}
+	return false
+}
+
+func csvProduct(record []string, columns map[string]int) (model.Product, error) {
+	field := func(name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+	product := model.Product{ID: field("id"), Name: field("name"), CategoryID: field("category_id")}
+	price, err := money.Parse(field("price"), field("currency"))
+	if err != nil {
+		return product, fmt.Errorf("price: %w", err)
+	}
+	product.Price = price
+	if v := field("quantity"); v != "" {
+		quantity, err := strconv.ParseInt(v, 10, 32)
+		if err != nil {
+			return product, fmt.Errorf("quantity %q is not a whole number", v)
+		}
+		product.Quantity = int32(quantity)
+	}
+	if v := field("version"); v != "" {
+		if product.Version, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return product, fmt.Errorf("version %q is not a whole number", v)
+		}
+	}
+	if v := field("stock_version"); v != "" {
+		if product.StockVersion, err = strconv.ParseInt(v, 10, 64); err != nil {
+			return product, fmt.Errorf("stock_version %q is not a whole number", v)
+		}
+	}
+	return product, nil
+}
+
+func readNDJSON(r *http.Request, body io.Reader) ([]importRow, error) {
+	scanner := bufio.NewScanner(body)
+	scanner.Buffer(nil, maxImportLine)
+	var rows []importRow
+	for line := 1; scanner.Scan(); line++ {
+		data := bytes.TrimSpace(scanner.Bytes())
+		if len(data) == 0 {
+			continue
+		}
+		row := importRow{line: line}
+		var members map[string]json.RawMessage
+		if row.err = json.Unmarshal(data, &members); row.err == nil {
+			_, row.stock = members["quantity"]
+			row.err = decodeProductFrom(r, bytes.NewReader(data), &row.product)
+		}
+		rows = append(rows, row)
+	}
+	return rows, scanner.Err()
+}
+
+// checkImport validates rows against the catalog and each other, recording
+// why rows cannot be imported.
+func checkImport(rows []importRow) {
+	ids := make(map[string]int)
+	skus := make(map[string]int)
+	for i := range rows {
+		row := &rows[i]
+		if row.err != nil {
+			continue
+		}
+		row.err = checkImportRow(row, ids, skus)
+	}
+}
+
+func checkImportRow(row *importRow, ids, skus map[string]int) error {
+	product := &row.product
+	if err := validateProduct(*product); err != nil {
+		return err
+	}
+	if line, ok := ids[product.ID]; ok {
+		return fmt.Errorf("product %s is also on line %d", product.ID, line)
+	}
+	ids[product.ID] = row.line
+
+	existing, exists := catalog.Product(product.ID)
+	row.exists = exists
+	if !exists {
+		product.Version = 0
+		product.StockVersion = 0
+		for _, variant := range product.Variants {
+			if line, ok := skus[variant.SKU]; ok {
+				return fmt.Errorf("SKU %s is also on line %d", variant.SKU, line)
+			}
+			skus[variant.SKU] = row.line
+		}
+		return catalog.CanAdd(*product)
+	}
+	// Variants are managed through /products/{id}/variants
+	if len(product.Variants) > 0 {
+		return errors.New("variants of existing products cannot be imported")
+	}
+	product.Variants = existing.Variants
+	if row.csv {
+		product.Prices = existing.Prices
+		product.Attributes = existing.Attributes
+	}
+	return catalog.CanUpdate(*product)
+}
+
+// importRows imports valid rows in batches, as UpdateProduct and
+// CreateProduct would: products that exist are replaced before their stock
+// is written, so it is only written for replacements that stood, and new
+// products are reserved and only stored once their stock exists. If the
+// stock of a batch cannot be written, its products are left as they were.
+func importRows(ctx context.Context, rows []importRow) {
+	var valid []int
+	for i, row := range rows {
+		if row.err == nil {
+			valid = append(valid, i)
+		}
+	}
+	for start := 0; start < len(valid); start += importBatchSize {
+		batch := valid[start:min(start+importBatchSize, len(valid))]
+		checkStockVersions(ctx, rows, batch)
+		var replaced, added []int
+		previous := make(map[int]model.Product)
+		reservations := make(map[int]*store.Reservation)
+		var items []*inventory_pb.AddStockRequest
+		for _, i := range batch {
+			row := &rows[i]
+			if row.err != nil {
+				continue
+			}
+			product := row.product
+			if row.exists {
+				old, ok := catalog.Product(product.ID)
+				if !ok {
+					row.err = store.ErrNotFound
+					continue
+				}
+				// Without a version the row replaces the product as
+				// read here, which is what is put back on failure
+				if product.Version == 0 {
+					product.Version = old.Version
+				}
+				stored, err := catalog.UpdateProduct(product.ID, product)
+				if err != nil {
+					row.err = err
+					continue
+				}
+				row.product = stored
+				replaced = append(replaced, i)
+				previous[i] = old
+				if row.stock {
+					items = append(items, &inventory_pb.AddStockRequest{
+						ProductId:       product.ID,
+						Quantity:        product.Quantity,
+						ExpectedVersion: product.StockVersion,
+					})
+				}
+				continue
+			}
+			reservation, err := catalog.Reserve(product)
+			if err != nil {
+				row.err = err
+				continue
+			}
+			added = append(added, i)
+			reservations[i] = reservation
+			items = append(items, &inventory_pb.AddStockRequest{ProductId: product.ID, Quantity: product.Quantity})
+			for _, variant := range product.Variants {
+				items = append(items, &inventory_pb.AddStockRequest{ProductId: variant.SKU, Quantity: variant.Quantity})
+			}
+		}
+		var err error
+		if len(items) > 0 {
+			_, err = inventoryClient.AddStockBatch(ctx, &inventory_pb.AddStockBatchRequest{Items: items})
+		}
+		if err != nil {
+			slog.ErrorContext(ctx, "cannot import stock", "products", len(batch), "error", err)
+			for _, i := range replaced {
+				restoreProduct(ctx, previous[i], rows[i].product.Version)
+				rows[i].err = fmt.Errorf("stock: %w", err)
+			}
+			for _, i := range added {
+				reservations[i].Release()
+				rows[i].err = fmt.Errorf("stock: %w", err)
+			}
+			continue
+		}
+
+		for _, i := range added {
+			row := &rows[i]
+			stored, err := reservations[i].Add()
+			if err != nil {
+				row.err = err
+				ids := []string{row.product.ID}
+				for _, variant := range row.product.Variants {
+					ids = append(ids, variant.SKU)
+				}
+				deleteStock(ctx, ids)
+				continue
+			}
+			row.product = stored
+		}
+		for _, i := range batch {
+			if rows[i].err == nil {
+				reindex(rows[i].product.ID)
+			}
+		}
+	}
+}
+
+// checkStockVersions fails the rows of a batch that set stock which is no
+// longer at their stock_version, so that they do not fail the whole batch
+// when it is written. Writing the batch checks the versions again.
+func checkStockVersions(ctx context.Context, rows []importRow, batch []int) {
+	checked := func(row importRow) bool {
+		return row.err == nil && row.exists && row.stock && row.product.StockVersion != 0
+	}
+	var ids []string
+	for _, i := range batch {
+		if checked(rows[i]) {
+			ids = append(ids, rows[i].product.ID)
+		}
+	}
+	if len(ids) == 0 {
+		return
+	}
+	resp, err := inventoryClient.CheckStockBatch(ctx, &inventory_pb.StockBatchRequest{ProductIds: ids})
+	if err != nil {
+		return
+	}
+	current := make(map[string]int64, len(resp.Items))
+	for _, item := range resp.Items {
+		current[item.ProductId] = item.Version
+	}
+	for _, i := range batch {
+		row := &rows[i]
+		if checked(*row) && current[row.product.ID] != row.product.StockVersion {
+			row.err = fmt.Errorf("stock of %s is at version %d, not %d", row.product.ID, current[row.product.ID], row.product.StockVersion)
+		}
+	}
+}
+
+// ExportProducts streams the catalog with current stock as NDJSON, or as
+// CSV with format=csv or when Accept prefers text/csv. Stock is read in
+// batches as the products are written.
+func ExportProducts(w http.ResponseWriter, r *http.Request) {
+	format, err := exportFormat(r)
+	if err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	ctx := r.Context()
+	products := catalog.Products()
+
+	var csvWriter *csv.Writer
+	enc := json.NewEncoder(w)
+	started := false
+	begin := func() {
+		started = true
+		w.Header().Set("Content-Type", format)
+		extension := map[string]string{csvType: "csv", ndjsonType: "ndjson"}[format]
+		w.Header().Set("Content-Disposition", `attachment; filename="products.`+extension+`"`)
+		w.WriteHeader(http.StatusOK)
+		if format == csvType {
+			csvWriter = csv.NewWriter(w)
+			csvWriter.Write(csvColumns)
+		}
+	}
+
+	for start := 0; start < len(products); start += importBatchSize {
+		batch := products[start:min(start+importBatchSize, len(products))]
+		stock, err := batchStock(ctx, batch)
+		if err != nil && !started {
+			render.Error(w, r, http.StatusBadGateway, "cannot read stock: "+err.Error())
+			return
+		}
+		if err != nil {
+			// The status is sent, so abort the response rather than let
+			// a partial export pass for a whole one
+			slog.ErrorContext(ctx, "export aborted", "written", start, "error", err)
+			panic(http.ErrAbortHandler)
+		}
+		if !started {
+			begin()
+		}
+		for _, product := range batch {
+			view := withStock(product, stock)
+			if csvWriter != nil {
+				csvWriter.Write(csvRecord(view))
+			} else {
+				enc.Encode(productBody(r, view))
+			}
+		}
+		if csvWriter != nil {
+			csvWriter.Flush()
+		}
+		http.NewResponseController(w).Flush()
+	}
+	if !started {
+		begin()
+		if csvWriter != nil {
+			csvWriter.Flush()
+		}
+	}
+}
+
+func exportFormat(r *http.Request) (string, error) {
+	switch r.URL.Query().Get("format") {
+	case "csv":
+		return csvType, nil
+	case "ndjson":
+		return ndjsonType, nil
+	case "":
+	default:
+		return "", errors.New("format must be csv or ndjson")
+	}
+	for _, part := range strings.Split(r.Header.Get("Accept"), ",") {
+		if mediaType, _, err := mime.ParseMediaType(strings.TrimSpace(part)); err == nil && mediaType == csvType {
+			return csvType, nil
+		}
+	}
+	return ndjsonType, nil
+}
+
+// batchStock reads the stock of products and their variants in one call,
+// keyed by product ID and SKU.
+func batchStock(ctx context.Context, products []model.Product) (map[string]*inventory_pb.StockResponse, error) {
+	var keys []string
+	for _, product := range products {
+		keys = append(keys, product.ID)
+		for _, variant := range product.Variants {
+			keys = append(keys, variant.SKU)
+		}
+	}
+	resp, err := inventoryClient.CheckStockBatch(ctx, &inventory_pb.StockBatchRequest{ProductIds: keys})
+	if err != nil {
+		return nil, err
+	}
+	stock := make(map[string]*inventory_pb.StockResponse, len(resp.Items))
+	for _, item := range resp.Items {
+		stock[item.ProductId] = item
+	}
+	return stock, nil
+}
+
+// withStock is enrichProduct with stock already read.
+func withStock(product model.Product, stock map[string]*inventory_pb.StockResponse) Product {
+	view := productView(product)
+	if s, ok := stock[product.ID]; ok {
+		view.InStock = s.InStock
+		view.Quantity = s.Quantity
+		view.StockVersion = s.Version
+	}
+	for _, variant := range product.Variants {
+		if s, ok := stock[variant.SKU]; ok {
+			variant.InStock = s.InStock
+			variant.Quantity = s.Quantity
+			variant.StockVersion = s.Version
+		}
+		view.Variants = append(view.Variants, variant)
+	}
+	return view
+}
+
+func csvRecord(p Product) []string {
+	return []string{
+		p.ID,
+		p.Name,
+		p.Price.Decimal(),
+		p.Price.Currency,
+		strconv.Itoa(int(p.Quantity)),
+		p.CategoryID,
+		strconv.FormatBool(p.InStock),
+		strconv.FormatInt(p.Version, 10),
+		strconv.FormatInt(p.StockVersion, 10),
+	}
+}
@@ -0,0 +1,260 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"product-service/events"
+	"product-service/model"
+	inventory_pb "product-service/proto/inventory"
+	"product-service/render"
+	"product-service/store"
+
+	"github.com/gorilla/mux"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// validateProduct checks the parts of a product the catalog cannot: attribute
+// types and that its category exists.
+func validateProduct(product model.Product) error {
+	if product.ID == "" {
+		return errors.New("product id is required")
+	}
+	if err := product.Price.Validate(); err != nil {
+		return fmt.Errorf("price: %w", err)
+	}
+	if err := product.Prices.Validate(); err != nil {
+		return fmt.Errorf("prices: %w", err)
+	}
+	if err := model.ValidateAttributes(product.Attributes); err != nil {
+		return err
+	}
+	if product.CategoryID != "" {
+		if _, ok := catalog.Category(product.CategoryID); !ok {
+			return fmt.Errorf("category %s not found", product.CategoryID)
+		}
+	}
+	for _, variant := range product.Variants {
+		if err := validateVariant(variant); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func validateVariant(variant model.Variant) error {
+	if variant.SKU == "" {
+		return errors.New("variant sku is required")
+	}
+	if variant.Price != nil {
+		if err := variant.Price.Validate(); err != nil {
+			return fmt.Errorf("variant %s price: %w", variant.SKU, err)
+		}
+	}
+	if err := variant.Prices.Validate(); err != nil {
+		return fmt.Errorf("variant %s prices: %w", variant.SKU, err)
+	}
+	if err := model.ValidateAttributes(variant.Attributes); err != nil {
+		return fmt.Errorf("variant %s: %w", variant.SKU, err)
+	}
+	return nil
+}
+
+// catalogError maps store and inventory-service errors to HTTP statuses.
+func catalogError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, store.ErrNotFound):
+		render.Error(w, r, http.StatusNotFound, err.Error())
+	case errors.Is(err, store.ErrExists), errors.Is(err, store.ErrInUse), errors.Is(err, store.ErrVersionConflict):
+		render.Error(w, r, http.StatusConflict, err.Error())
+	case status.Code(err) == codes.Aborted:
+		// Stock changed since the version the client sent
+		render.Error(w, r, http.StatusConflict, status.Convert(err).Message())
+	case errors.Is(err, store.ErrCycle), errors.Is(err, store.ErrIDChange):
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+	case errors.Is(err, events.ErrOutboxFull), status.Code(err) == codes.Unavailable:
+		// Events are not being published; the change can be retried later
+		render.Error(w, r, http.StatusServiceUnavailable, err.Error())
+	default:
+		render.Error(w, r, http.StatusInternalServerError, err.Error())
+	}
+}
+
+func GetCategories(w http.ResponseWriter, r *http.Request) {
+	render.Respond(w, r, http.StatusOK, catalog.Categories())
+}
+
+func GetCategory(w http.ResponseWriter, r *http.Request) {
+	category, ok := catalog.Category(mux.Vars(r)["id"])
+	if !ok {
+		render.Error(w, r, http.StatusNotFound, "Category not found")
+		return
+	}
+	render.Respond(w, r, http.StatusOK, categoryDetail(category))
+}
+
+// categoryDetail is a category as GET /categories/{id} returns it, with the
+// IDs of its ancestors.
+func categoryDetail(category model.Category) any {
+	return struct {
+		model.Category
+		Path []string `json:"path"`
+	}{category, catalog.Path(category.ID)}
+}
+
+func CreateCategory(w http.ResponseWriter, r *http.Request) {
+	var category model.Category
+	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if category.ID == "" {
+		render.Error(w, r, http.StatusBadRequest, "category id is required")
+		return
+	}
+	if err := catalog.AddCategory(category); err != nil {
+		catalogError(w, r, err)
+		return
+	}
+	render.Respond(w, r, http.StatusCreated, category)
+}
+
+func UpdateCategory(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	var category model.Category
+	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if current, ok := catalog.Category(id); ok && !render.IfMatch(r, categoryDetail(current)) {
+		render.PreconditionFailed(w, r)
+		return
+	}
+	if err := catalog.UpdateCategory(id, category); err != nil {
+		catalogError(w, r, err)
+		return
+	}
+	category.ID = id
+	render.Respond(w, r, http.StatusOK, category)
+}
+
+func DeleteCategory(w http.ResponseWriter, r *http.Request) {
+	if err := catalog.DeleteCategory(mux.Vars(r)["id"]); err != nil {
+		catalogError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetCategoryProducts lists the products of a category and its subcategories.
+func GetCategoryProducts(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+	if _, ok := catalog.Category(id); !ok {
+		render.Error(w, r, http.StatusNotFound, "Category not found")
+		return
+	}
+	render.Respond(w, r, http.StatusOK, productsBody(r, enrichProducts(r.Context(), catalog.ProductsInCategory(id))))
+}
+
+func GetVariants(w http.ResponseWriter, r *http.Request) {
+	product, ok := catalog.Product(mux.Vars(r)["id"])
+	if !ok {
+		render.Error(w, r, http.StatusNotFound, "Product not found")
+		return
+	}
+	variants := make([]model.Variant, 0, len(product.Variants))
+	for _, variant := range product.Variants {
+		variants = append(variants, enrichVariant(r.Context(), variant))
+	}
+	render.Respond(w, r, http.StatusOK, variantsBody(r, variants))
+}
+
+func CreateVariant(w http.ResponseWriter, r *http.Request) {
+	productID := mux.Vars(r)["id"]
+	var variant model.Variant
+	if err := decodeVariant(r, &variant); err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := validateVariant(variant); err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err := catalog.AddVariant(productID, variant); err != nil {
+		catalogError(w, r, err)
+		return
+	}
+
+	_, err := inventoryClient.AddStock(r.Context(), &inventory_pb.AddStockRequest{
+		ProductId: variant.SKU,
+		Quantity:  variant.Quantity,
+	})
+	if err != nil {
+		catalog.DeleteVariant(productID, variant.SKU)
+		render.Error(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	reindex(productID)
+	render.Respond(w, r, http.StatusCreated, variantBody(r, variant))
+}
+
+func UpdateVariant(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	var variant model.Variant
+	if err := decodeVariant(r, &variant); err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	// The SKU keys the stock, so it cannot change
+	variant.SKU = params["sku"]
+	if err := validateVariant(variant); err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	product, ok := catalog.Product(params["id"])
+	if !ok {
+		render.Error(w, r, http.StatusNotFound, "Product not found")
+		return
+	}
+	stored, ok := product.Variant(variant.SKU)
+	if !ok {
+		render.Error(w, r, http.StatusNotFound, "Variant not found")
+		return
+	}
+	keepVariantPrice(r, &variant, stored)
+
+	stock, err := inventoryClient.UpdateStock(r.Context(), &inventory_pb.UpdateStockRequest{
+		ProductId:       variant.SKU,
+		Quantity:        variant.Quantity,
+		ExpectedVersion: variant.StockVersion,
+	})
+	if err != nil {
+		catalogError(w, r, err)
+		return
+	}
+
+	if err := catalog.UpdateVariant(params["id"], variant.SKU, variant); err != nil {
+		catalogError(w, r, err)
+		return
+	}
+	variant.StockVersion = stock.Version
+	reindex(params["id"])
+	render.Respond(w, r, http.StatusOK, variantBody(r, variant))
+}
+
+func DeleteVariant(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	if err := catalog.DeleteVariant(params["id"], params["sku"]); err != nil {
+		catalogError(w, r, err)
+		return
+	}
+	if _, err := inventoryClient.DeleteStock(r.Context(), &inventory_pb.StockRequest{ProductId: params["sku"]}); err != nil {
+		slog.WarnContext(r.Context(), "cannot delete variant stock", "sku", params["sku"], "error", err)
+	}
+	reindex(params["id"])
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,218 @@
+package clientpolicy
+
+import (
+	"context"
+	"errors"
+	"io"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+var (
+	errUnavailable = status.Error(codes.Unavailable, "down")
+	errNotFound    = status.Error(codes.NotFound, "no such product")
+)
+
+// call makes a unary call through the breaker to an invoker returning err,
+// and reports whether the invoker was reached.
+func call(b *Breaker, ctx context.Context, err error) (bool, error) {
+	reached := false
+	invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+		reached = true
+		return err
+	}
+	got := b.UnaryClientInterceptor()(ctx, "/test.Service/Get", nil, nil, nil, invoker)
+	return reached, got
+}
+
+func (b *Breaker) currentState() breakerState {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.state
+}
+
+func TestBreakerOpensAfterThreshold(t *testing.T) {
+	b := NewBreaker("test", 3, time.Hour)
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		call(b, ctx, errUnavailable)
+	}
+	// A success in between starts the count again
+	call(b, ctx, nil)
+	for i := 0; i < 2; i++ {
+		call(b, ctx, errUnavailable)
+	}
+	if s := b.currentState(); s != stateClosed {
+		t.Fatalf("state = %s after 2 consecutive failures, want closed", s)
+	}
+	call(b, ctx, status.Error(codes.DeadlineExceeded, "slow"))
+	if s := b.currentState(); s != stateOpen {
+		t.Fatalf("state = %s after 3 consecutive failures, want open", s)
+	}
+
+	reached, err := call(b, ctx, nil)
+	if reached {
+		t.Error("open breaker let a call through")
+	}
+	if status.Code(err) != codes.Unavailable {
+		t.Errorf("error = %v, want UNAVAILABLE", err)
+	}
+}
+
+func TestBreakerIgnoresRequestErrors(t *testing.T) {
+	b := NewBreaker("test", 2, time.Hour)
+	for _, err := range []error{errNotFound, status.Error(codes.InvalidArgument, "bad"), status.Error(codes.Aborted, "version"), errNotFound} {
+		call(b, context.Background(), err)
+	}
+	if s := b.currentState(); s != stateClosed {
+		t.Errorf("state = %s after errors about the requests, want closed", s)
+	}
+}
+
+func TestBreakerHalfOpen(t *testing.T) {
+	tests := []struct {
+		name  string
+		probe error
+		want  breakerState
+	}{
+		{"probe succeeds", nil, stateClosed},
+		{"probe fails", errUnavailable, stateOpen},
+		{"probe rejected as a request", errNotFound, stateClosed},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBreaker("test", 1, 20*time.Millisecond)
+			call(b, context.Background(), errUnavailable)
+			time.Sleep(30 * time.Millisecond)
+
+			// Only one probe is let through at a time
+			var probed, second bool
+			invoker := func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, opts ...grpc.CallOption) error {
+				probed = true
+				second, _ = call(b, context.Background(), nil)
+				return tt.probe
+			}
+			b.UnaryClientInterceptor()(context.Background(), "/test.Service/Get", nil, nil, nil, invoker)
+			if !probed {
+				t.Fatal("no probe after the cooldown")
+			}
+			if second {
+				t.Error("a second call went through while probing")
+			}
+			if s := b.currentState(); s != tt.want {
+				t.Errorf("state = %s, want %s", s, tt.want)
+			}
+		})
+	}
+}
+
+func TestBreakerIgnoresCallerGivingUp(t *testing.T) {
+	b := NewBreaker("test", 1, 20*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	call(b, ctx, status.FromContextError(ctx.Err()).Err())
+	deadline, stop := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer stop()
+	call(b, deadline, status.Error(codes.DeadlineExceeded, "context deadline exceeded"))
+	if s := b.currentState(); s != stateClosed {
+		t.Fatalf("state = %s after calls whose callers gave up, want closed", s)
+	}
+
+	// A probe cut short by its caller frees the way for the next one
+	call(b, context.Background(), errUnavailable)
+	time.Sleep(30 * time.Millisecond)
+	if reached, _ := call(b, ctx, errUnavailable); !reached {
+		t.Fatal("no probe after the cooldown")
+	}
+	if s := b.currentState(); s != stateHalfOpen {
+		t.Errorf("state = %s after an abandoned probe, want half-open", s)
+	}
+	if reached, _ := call(b, context.Background(), nil); !reached {
+		t.Error("abandoned probe kept the next one out")
+	}
+	if s := b.currentState(); s != stateClosed {
+		t.Errorf("state = %s, want closed", s)
+	}
+}
+
+func TestBreakerDisabled(t *testing.T) {
+	b := NewBreaker("test", 0, time.Hour)
+	for i := 0; i < 10; i++ {
+		if reached, _ := call(b, context.Background(), errUnavailable); !reached {
+			t.Fatalf("call %d did not go through", i)
+		}
+	}
+}
+
+// fakeStream ends with err after sending the given number of messages.
+type fakeStream struct {
+	grpc.ClientStream
+	ctx      context.Context
+	messages int
+	err      error
+}
+
+func (s *fakeStream) Context() context.Context { return s.ctx }
+
+func (s *fakeStream) RecvMsg(m interface{}) error {
+	if s.messages > 0 {
+		s.messages--
+		return nil
+	}
+	return s.err
+}
+
+func TestBreakerStream(t *testing.T) {
+	tests := []struct {
+		name          string
+		serverStreams bool
+		messages      int
+		end           error
+		want          breakerState
+	}{
+		{"server stream ends cleanly", true, 2, io.EOF, stateClosed},
+		{"server stream fails", true, 2, errUnavailable, stateOpen},
+		{"server stream rejected", true, 0, errNotFound, stateClosed},
+		{"client stream answered", false, 1, nil, stateClosed},
+		{"client stream fails", false, 0, errUnavailable, stateOpen},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := NewBreaker("test", 1, time.Hour)
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			desc := &grpc.StreamDesc{ServerStreams: tt.serverStreams}
+			streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+				return &fakeStream{ctx: ctx, messages: tt.messages, err: tt.end}, nil
+			}
+			stream, err := b.StreamClientInterceptor()(ctx, desc, nil, "/test.Service/Watch", streamer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i <= tt.messages; i++ {
+				stream.RecvMsg(nil)
+			}
+			if s := b.currentState(); s != tt.want {
+				t.Errorf("state = %s, want %s", s, tt.want)
+			}
+		})
+	}
+
+	t.Run("not started", func(t *testing.T) {
+		b := NewBreaker("test", 1, time.Hour)
+		streamer := func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+			return nil, errUnavailable
+		}
+		if _, err := b.StreamClientInterceptor()(context.Background(), &grpc.StreamDesc{}, nil, "/test.Service/Watch", streamer); !errors.Is(err, errUnavailable) {
+			t.Errorf("error = %v", err)
+		}
+		if s := b.currentState(); s != stateOpen {
+			t.Errorf("state = %s, want open", s)
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package clientpolicy
+
+import (
+	"context"
+	"math/rand/v2"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxHedgeBackoff caps the wait before an attempt replacing one that failed
+// with UNAVAILABLE, as maxBackoff does for retries.
+const maxHedgeBackoff = time.Second
+
+// hedgeInterceptor sends up to maxAttempts copies of a call to the methods
+// listed, starting a new one whenever the previous has not answered within
+// delay. One that failed with UNAVAILABLE is replaced after a backoff that
+// doubles from delay with every such failure, with jitter so that clients
+// failing together do not come back together. The first success wins and the
+// other attempts are cancelled; any other failure is returned at once.
+//
+// grpc-go does not implement the hedgingPolicy of the service config, hence
+// the interceptor.
+func hedgeInterceptor(methods map[string]bool, delay time.Duration, maxAttempts int) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		out, ok := reply.(proto.Message)
+		if !methods[method] || maxAttempts < 2 || !ok {
+			return invoker(ctx, method, req, reply, cc, opts...)
+		}
+
+		ctx, cancel := context.WithCancel(ctx)
+		defer cancel()
+
+		type result struct {
+			reply proto.Message
+			err   error
+		}
+		results := make(chan result, maxAttempts)
+		launched, pending, unavailable := 0, 0, 0
+		launch := func() {
+			attempt := out.ProtoReflect().New().Interface()
+			launched++
+			pending++
+			go func() {
+				err := invoker(ctx, method, req, attempt, cc, opts...)
+				results <- result{attempt, err}
+			}()
+		}
+
+		launch()
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+
+		var lastErr error
+		for {
+			// Pending attempts fail with the context, so it is only watched
+			// while waiting to replace a failed one
+			var done <-chan struct{}
+			if pending == 0 {
+				done = ctx.Done()
+			}
+			select {
+			case <-done:
+				return status.FromContextError(ctx.Err()).Err()
+			case <-timer.C:
+				if launched < maxAttempts {
+					launch()
+					timer.Reset(delay)
+				}
+			case res := <-results:
+				pending--
+				if res.err == nil {
+					proto.Reset(out)
+					proto.Merge(out, res.reply)
+					return nil
+				}
+				lastErr = res.err
+				if status.Code(res.err) != codes.Unavailable {
+					return res.err
+				}
+				unavailable++
+				if launched < maxAttempts {
+					timer.Reset(hedgeBackoff(delay, unavailable))
+				} else if pending == 0 {
+					return lastErr
+				}
+			}
+		}
+	}
+}
+
+// hedgeBackoff returns the wait before replacing the failures-th attempt to
+// fail with UNAVAILABLE: delay doubled for each earlier one, up to
+// maxHedgeBackoff, plus up to half as much again.
+func hedgeBackoff(delay time.Duration, failures int) time.Duration {
+	if delay <= 0 {
+		return 0
+	}
+	wait := maxHedgeBackoff
+	if shift := failures - 1; delay < maxHedgeBackoff && shift < 32 && delay<<shift < maxHedgeBackoff {
+		wait = delay << shift
+	}
+	return wait + rand.N(wait/2+1)
+}
@@ -0,0 +1,154 @@
+package clientpolicy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"google.golang.org/grpc"
+	_ "google.golang.org/grpc/balancer/leastrequest"
+)
+
+// Policy describes how calls to one downstream gRPC service are made.
+type Policy struct {
+	// Service is the fully-qualified service name, e.g. "inventory.InventoryService".
+	Service string
+	// Timeout bounds every call, and every stream from start to end. An
+	// earlier deadline inherited from the inbound request still wins.
+	Timeout time.Duration
+	// MaxAttempts caps both retries and hedged attempts, including the first.
+	MaxAttempts int
+	// RetryMethods are idempotent methods retried by gRPC on UNAVAILABLE.
+	RetryMethods []string
+	// HedgeMethods are reads for which a parallel attempt is started when
+	// the previous one has not answered within HedgeDelay.
+	HedgeMethods []string
+	HedgeDelay   time.Duration
+	// After BreakerThreshold consecutive failures the breaker opens and
+	// calls fail fast for BreakerCooldown.
+	BreakerThreshold int
+	BreakerCooldown  time.Duration
+	// LoadBalancing picks among the resolved addresses: "round_robin",
+	// "least_request" or "pick_first".
+	LoadBalancing string
+}
+
+// DialOptions returns the options applying p to a client connection. The
+// interceptors run after any installed earlier on the same connection.
+func (p Policy) DialOptions() ([]grpc.DialOption, error) {
+	serviceConfig, err := p.serviceConfig()
+	if err != nil {
+		return nil, err
+	}
+	breaker := NewBreaker(p.Service, p.BreakerThreshold, p.BreakerCooldown)
+	return []grpc.DialOption{
+		grpc.WithDefaultServiceConfig(serviceConfig),
+		grpc.WithChainUnaryInterceptor(
+			breaker.UnaryClientInterceptor(),
+			deadlineInterceptor(p.Timeout),
+			hedgeInterceptor(p.fullMethods(p.HedgeMethods), p.HedgeDelay, p.MaxAttempts),
+		),
+		grpc.WithChainStreamInterceptor(
+			breaker.StreamClientInterceptor(),
+			deadlineStreamInterceptor(p.Timeout),
+		),
+	}, nil
+}
+
+func (p Policy) fullMethods(methods []string) map[string]bool {
+	full := make(map[string]bool, len(methods))
+	for _, m := range methods {
+		full[fmt.Sprintf("/%s/%s", p.Service, m)] = true
+	}
+	return full
+}
+
+type methodName struct {
+	Service string `json:"service"`
+	Method  string `json:"method"`
+}
+
+type retryPolicy struct {
+	MaxAttempts          int      `json:"maxAttempts"`
+	InitialBackoff       string   `json:"initialBackoff"`
+	MaxBackoff           string   `json:"maxBackoff"`
+	BackoffMultiplier    float64  `json:"backoffMultiplier"`
+	RetryableStatusCodes []string `json:"retryableStatusCodes"`
+}
+
+type methodConfig struct {
+	Name        []methodName `json:"name"`
+	RetryPolicy *retryPolicy `json:"retryPolicy,omitempty"`
+}
+
+type serviceConfig struct {
+	LoadBalancingConfig []map[string]interface{} `json:"loadBalancingConfig,omitempty"`
+	MethodConfig        []methodConfig           `json:"methodConfig,omitempty"`
+}
+
+// serviceConfig renders the balancer and retry policy in the gRPC service
+// config format. gRPC retries transparently below the interceptors, so the
+// breaker only sees the outcome of the last attempt.
+func (p Policy) serviceConfig() (string, error) {
+	var sc serviceConfig
+	switch p.LoadBalancing {
+	case "":
+	case "round_robin", "pick_first":
+		sc.LoadBalancingConfig = []map[string]interface{}{{p.LoadBalancing: struct{}{}}}
+	case "least_request":
+		sc.LoadBalancingConfig = []map[string]interface{}{{
+			"least_request_experimental": map[string]int{"choiceCount": 2},
+		}}
+	default:
+		return "", fmt.Errorf("unknown load balancing policy %q", p.LoadBalancing)
+	}
+	if p.MaxAttempts > 1 && len(p.RetryMethods) > 0 {
+		mc := methodConfig{RetryPolicy: &retryPolicy{
+			MaxAttempts:          p.MaxAttempts,
+			InitialBackoff:       "0.1s",
+			MaxBackoff:           "1s",
+			BackoffMultiplier:    2,
+			RetryableStatusCodes: []string{"UNAVAILABLE"},
+		}}
+		for _, m := range p.RetryMethods {
+			mc.Name = append(mc.Name, methodName{Service: p.Service, Method: m})
+		}
+		sc.MethodConfig = append(sc.MethodConfig, mc)
+	}
+	b, err := json.Marshal(sc)
+	return string(b), err
+}
+
+// deadlineInterceptor derives each call's deadline from the caller's context,
+// so a call never outlives the inbound request that triggered it.
+func deadlineInterceptor(timeout time.Duration) grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		if timeout > 0 {
+			var cancel context.CancelFunc
+			ctx, cancel = context.WithTimeout(ctx, timeout)
+			defer cancel()
+		}
+		return invoker(ctx, method, req, reply, cc, opts...)
+	}
+}
+
+// deadlineStreamInterceptor is deadlineInterceptor for streaming calls.
+func deadlineStreamInterceptor(timeout time.Duration) grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		if timeout <= 0 {
+			return streamer(ctx, desc, cc, method, opts...)
+		}
+		ctx, cancel := context.WithTimeout(ctx, timeout)
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			cancel()
+			return nil, err
+		}
+		go func() {
+			<-stream.Context().Done()
+			cancel()
+		}()
+		return stream, nil
+	}
+}
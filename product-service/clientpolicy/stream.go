@@ -0,0 +1,31 @@
+package clientpolicy
+
+import (
+	"errors"
+	"io"
+	"sync"
+
+	"google.golang.org/grpc"
+)
+
+// endedStream calls done once with the outcome of a client stream: nil when
+// the server ends it cleanly or the one response of a call without server
+// streaming arrives, otherwise the error RecvMsg returns. A stream is only
+// seen to end when its caller receives from it, as gRPC requires.
+type endedStream struct {
+	grpc.ClientStream
+	serverStreams bool
+	once          sync.Once
+	done          func(error)
+}
+
+func (s *endedStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case errors.Is(err, io.EOF):
+		s.once.Do(func() { s.done(nil) })
+	case err != nil || !s.serverStreams:
+		s.once.Do(func() { s.done(err) })
+	}
+	return err
+}
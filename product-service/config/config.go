@@ -1,16 +1,57 @@
 package config
 
-import "github.com/caarlos0/env/v11"
+import (
+	"log/slog"
+	"net/url"
+	"reflect"
+	"strings"
+	"time"
+
+	"github.com/caarlos0/env/v11"
+)
 
 type Config struct {
-	ServerPort           string `env:"SERVER_PORT" envDefault:"8081"`
-	ServerHost           string `env:"SERVER_HOST" envDefault:"0.0.0.0"`
-	InventoryServiceHost string `env:"INVENTORY_SERVICE_HOST" envDefault:"inventory-service"`
-	InventoryServicePort string `env:"INVENTORY_SERVICE_PORT" envDefault:"50051"`
-	GrpcHost             string `env:"GRPC_HOST" envDefault:"0.0.0.0"`
-	GrpcPort             string `env:"GRPC_PORT" envDefault:"50052"`
-	AppEnv               string `env:"APP_ENV" envDefault:"development"`
-	LogLevel             string `env:"LOG_LEVEL" envDefault:"info"`
+	ServerPort                string        `env:"SERVER_PORT" envDefault:"8081"`
+	ServerHost                string        `env:"SERVER_HOST" envDefault:"0.0.0.0"`
+	InventoryServiceHost      string        `env:"INVENTORY_SERVICE_HOST" envDefault:"inventory-service"`
+	InventoryServicePort      string        `env:"INVENTORY_SERVICE_PORT" envDefault:"50051"`
+	GrpcHost                  string        `env:"GRPC_HOST" envDefault:"0.0.0.0"`
+	GrpcPort                  string        `env:"GRPC_PORT" envDefault:"50052"`
+	AppEnv                    string        `env:"APP_ENV" envDefault:"development"`
+	LogLevel                  string        `env:"LOG_LEVEL" envDefault:"info"`
+	OtelExporter              string        `env:"OTEL_EXPORTER" envDefault:"none"`
+	OtelEndpoint              string        `env:"OTEL_EXPORTER_OTLP_ENDPOINT" envDefault:"otel-collector:4317"`
+	OtelFilePath              string        `env:"OTEL_FILE_PATH" envDefault:"traces.json"`
+	OtelSampleRatio           float64       `env:"OTEL_SAMPLE_RATIO" envDefault:"1"`
+	TLSCertFile               string        `env:"TLS_CERT_FILE"`
+	TLSKeyFile                string        `env:"TLS_KEY_FILE"`
+	TLSCAFile                 string        `env:"TLS_CA_FILE"`
+	TLSReloadInterval         time.Duration `env:"TLS_RELOAD_INTERVAL" envDefault:"1m"`
+	InventoryCallTimeout      time.Duration `env:"INVENTORY_CALL_TIMEOUT" envDefault:"1s"`
+	InventoryMaxAttempts      int           `env:"INVENTORY_MAX_ATTEMPTS" envDefault:"3"`
+	InventoryHedgeDelay       time.Duration `env:"INVENTORY_HEDGE_DELAY" envDefault:"100ms"`
+	InventoryBreakerThreshold int           `env:"INVENTORY_BREAKER_THRESHOLD" envDefault:"5"`
+	InventoryBreakerCooldown  time.Duration `env:"INVENTORY_BREAKER_COOLDOWN" envDefault:"10s"`
+	InventoryResolver         string        `env:"INVENTORY_RESOLVER" envDefault:"dns"`
+	InventoryAddresses        string        `env:"INVENTORY_ADDRESSES"`
+	InventoryEndpointsFile    string        `env:"INVENTORY_ENDPOINTS_FILE"`
+	InventoryResolveInterval  time.Duration `env:"INVENTORY_RESOLVE_INTERVAL" envDefault:"30s"`
+	InventoryLBPolicy         string        `env:"INVENTORY_LB_POLICY" envDefault:"round_robin"`
+	GrpcKeepaliveTime         time.Duration `env:"GRPC_KEEPALIVE_TIME" envDefault:"30s"`
+	GrpcKeepaliveTimeout      time.Duration `env:"GRPC_KEEPALIVE_TIMEOUT" envDefault:"10s"`
+	GrpcKeepaliveMinTime      time.Duration `env:"GRPC_KEEPALIVE_MIN_TIME" envDefault:"10s"`
+	GrpcMaxConnectionAge      time.Duration `env:"GRPC_MAX_CONNECTION_AGE" envDefault:"5m"`
+	EventBroker               string        `env:"EVENT_BROKER" envDefault:"inprocess"`
+	EventBrokerURL            string        `env:"EVENT_BROKER_URL"`
+	EventTopicPrefix          string        `env:"EVENT_TOPIC_PREFIX" envDefault:"events."`
+	EventRelayInterval        time.Duration `env:"EVENT_RELAY_INTERVAL" envDefault:"1s"`
+	EventRelayBatch           int           `env:"EVENT_RELAY_BATCH" envDefault:"100"`
+	EventOutboxLimit          int           `env:"EVENT_OUTBOX_LIMIT" envDefault:"10000"`
+	EventPublishTimeout       time.Duration `env:"EVENT_PUBLISH_TIMEOUT" envDefault:"5s"`
+	OpenAPIValidation         string        `env:"OPENAPI_VALIDATION" envDefault:"off"`
+	ImportBatchSize           int           `env:"IMPORT_BATCH_SIZE" envDefault:"100"`
+	BaseCurrency              string        `env:"BASE_CURRENCY" envDefault:"USD"`
+	ExchangeRates             string        `env:"EXCHANGE_RATES"`
 }
 
 func LoadConfig() (Config, error) {
@@ -20,3 +61,38 @@ func LoadConfig() (Config, error) {
 	}
 	return cfg, nil
 }
+
+// LogValue renders the configuration for structured logs, keyed by
+// environment variable. Fields tagged secret:"true" and credentials embedded
+// in URLs are masked.
+func (c Config) LogValue() slog.Value {
+	v := reflect.ValueOf(c)
+	t := v.Type()
+	attrs := make([]slog.Attr, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		key, _, _ := strings.Cut(field.Tag.Get("env"), ",")
+		if key == "" {
+			key = field.Name
+		}
+		value := v.Field(i).Interface()
+		if field.Tag.Get("secret") == "true" {
+			value = "[REDACTED]"
+		} else if s, ok := value.(string); ok {
+			value = redactURL(s)
+		}
+		attrs = append(attrs, slog.Any(key, value))
+	}
+	return slog.GroupValue(attrs...)
+}
+
+func redactURL(s string) string {
+	if !strings.Contains(s, "://") {
+		return s
+	}
+	u, err := url.Parse(s)
+	if err != nil || u.User == nil {
+		return s
+	}
+	return u.Redacted()
+}
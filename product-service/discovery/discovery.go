@@ -0,0 +1,85 @@
+package discovery
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/resolver/dns"
+)
+
+// Endpoints describes where the instances of a downstream service are found.
+type Endpoints struct {
+	// Resolver is one of "dns" (Address is resolved and re-resolved every
+	// RefreshInterval), "static" (Static is a comma-separated host:port
+	// list) or "file" (File lists one host:port per line and is re-read
+	// when it changes).
+	Resolver        string
+	Address         string
+	Static          string
+	File            string
+	RefreshInterval time.Duration
+}
+
+// Target returns the gRPC dial target for the configured resolver.
+func (e Endpoints) Target() (string, error) {
+	switch e.Resolver {
+	case "", "dns":
+		return "dns:///" + e.Address, nil
+	case "static":
+		if strings.TrimSpace(e.Static) == "" {
+			return "", fmt.Errorf("static resolver needs a list of addresses")
+		}
+		return "static:///" + e.Static, nil
+	case "file":
+		if e.File == "" {
+			return "", fmt.Errorf("file resolver needs an endpoints file")
+		}
+		path, err := filepath.Abs(e.File)
+		if err != nil {
+			return "", err
+		}
+		return "file://" + path, nil
+	default:
+		return "", fmt.Errorf("unknown resolver %q", e.Resolver)
+	}
+}
+
+// DialOptions install the resolvers backing Target on a single connection,
+// leaving the global gRPC registry untouched. For address lists the channel
+// authority, and so the TLS server name, stays the logical Address rather
+// than the list itself.
+func (e Endpoints) DialOptions() []grpc.DialOption {
+	if e.RefreshInterval > 0 {
+		dns.SetMinResolutionInterval(e.RefreshInterval)
+	}
+	opts := []grpc.DialOption{grpc.WithResolvers(
+		&periodicDNSBuilder{Builder: dns.NewBuilder(), interval: e.RefreshInterval},
+		staticBuilder{},
+		&fileBuilder{interval: e.RefreshInterval},
+	)}
+	if e.Resolver == "static" || e.Resolver == "file" {
+		opts = append(opts, grpc.WithAuthority(e.Address))
+	}
+	return opts
+}
+
+// parseAddresses splits a list of host:port entries separated by commas or
+// newlines, skipping blanks and # comments.
+func parseAddresses(list string) []resolver.Address {
+	var addrs []resolver.Address
+	for _, line := range strings.Split(list, "\n") {
+		if i := strings.IndexByte(line, '#'); i >= 0 {
+			line = line[:i]
+		}
+		for _, addr := range strings.Split(line, ",") {
+			if addr = strings.TrimSpace(addr); addr != "" {
+				addrs = append(addrs, resolver.Address{Addr: addr})
+			}
+		}
+	}
+	return addrs
+}
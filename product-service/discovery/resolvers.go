@@ -0,0 +1,153 @@
+package discovery
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	"google.golang.org/grpc/resolver"
+)
+
+// periodicDNSBuilder wraps the gRPC DNS resolver, which only re-resolves
+// when a connection fails, so that new instances behind the name are picked
+// up every interval as well.
+type periodicDNSBuilder struct {
+	resolver.Builder
+	interval time.Duration
+}
+
+func (b *periodicDNSBuilder) Build(target resolver.Target, cc resolver.ClientConn, opts resolver.BuildOptions) (resolver.Resolver, error) {
+	r, err := b.Builder.Build(target, cc, opts)
+	if err != nil || b.interval <= 0 {
+		return r, err
+	}
+	p := &periodicResolver{Resolver: r, done: make(chan struct{})}
+	go p.refresh(b.interval)
+	return p, nil
+}
+
+type periodicResolver struct {
+	resolver.Resolver
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (r *periodicResolver) refresh(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			r.ResolveNow(resolver.ResolveNowOptions{})
+		}
+	}
+}
+
+func (r *periodicResolver) Close() {
+	r.closeOnce.Do(func() { close(r.done) })
+	r.Resolver.Close()
+}
+
+// staticBuilder resolves static:///host1:port,host2:port to a fixed list.
+type staticBuilder struct{}
+
+func (staticBuilder) Scheme() string { return "static" }
+
+func (staticBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	addrs := parseAddresses(target.Endpoint())
+	if len(addrs) == 0 {
+		return nil, fmt.Errorf("static resolver: no addresses in %q", target.Endpoint())
+	}
+	if err := cc.UpdateState(resolver.State{Addresses: addrs}); err != nil {
+		return nil, err
+	}
+	return nopResolver{}, nil
+}
+
+type nopResolver struct{}
+
+func (nopResolver) ResolveNow(resolver.ResolveNowOptions) {}
+func (nopResolver) Close()                                {}
+
+// fileBuilder resolves file:///path/to/endpoints to the addresses listed in
+// the file, re-reading it when its modification time changes.
+type fileBuilder struct {
+	interval time.Duration
+}
+
+func (*fileBuilder) Scheme() string { return "file" }
+
+func (b *fileBuilder) Build(target resolver.Target, cc resolver.ClientConn, _ resolver.BuildOptions) (resolver.Resolver, error) {
+	r := &fileResolver{path: target.URL.Path, cc: cc, done: make(chan struct{})}
+	if err := r.load(); err != nil {
+		return nil, err
+	}
+	if b.interval > 0 {
+		go r.watch(b.interval)
+	}
+	return r, nil
+}
+
+type fileResolver struct {
+	path string
+	cc   resolver.ClientConn
+
+	mu        sync.Mutex
+	modTime   time.Time
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func (r *fileResolver) load() error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	info, err := os.Stat(r.path)
+	if err != nil {
+		return err
+	}
+	if info.ModTime().Equal(r.modTime) {
+		return nil
+	}
+	data, err := os.ReadFile(r.path)
+	if err != nil {
+		return err
+	}
+	addrs := parseAddresses(string(data))
+	if len(addrs) == 0 {
+		return fmt.Errorf("file resolver: no addresses in %s", r.path)
+	}
+	r.modTime = info.ModTime()
+	return r.cc.UpdateState(resolver.State{Addresses: addrs})
+}
+
+func (r *fileResolver) watch(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.done:
+			return
+		case <-ticker.C:
+			if err := r.load(); err != nil {
+				slog.Warn("failed to reload endpoints file, keeping previous addresses", "path", r.path, "error", err)
+			}
+		}
+	}
+}
+
+func (r *fileResolver) ResolveNow(resolver.ResolveNowOptions) {
+	go func() {
+		if err := r.load(); err != nil {
+			r.cc.ReportError(err)
+		}
+	}()
+}
+
+func (r *fileResolver) Close() {
+	r.closeOnce.Do(func() { close(r.done) })
+}
@@ -0,0 +1,315 @@
+package discovery
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/health"
+	healthpb "google.golang.org/grpc/health/grpc_health_v1"
+	"google.golang.org/grpc/resolver"
+	"google.golang.org/grpc/serviceconfig"
+)
+
+// fakeConn records the addresses resolvers hand to gRPC.
+type fakeConn struct {
+	updates chan []string
+	mu      sync.Mutex
+	errs    []error
+}
+
+func newFakeConn() *fakeConn {
+	return &fakeConn{updates: make(chan []string, 10)}
+}
+
+func (c *fakeConn) UpdateState(s resolver.State) error {
+	var addrs []string
+	for _, a := range s.Addresses {
+		addrs = append(addrs, a.Addr)
+	}
+	c.updates <- addrs
+	return nil
+}
+
+func (c *fakeConn) ReportError(err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.errs = append(c.errs, err)
+}
+
+func (c *fakeConn) NewAddress([]resolver.Address) {}
+
+func (c *fakeConn) ParseServiceConfig(string) *serviceconfig.ParseResult { return nil }
+
+// next returns the addresses of the next update, failing after a while.
+func (c *fakeConn) next(t *testing.T) []string {
+	t.Helper()
+	select {
+	case addrs := <-c.updates:
+		return addrs
+	case <-time.After(5 * time.Second):
+		t.Fatal("no address update")
+		return nil
+	}
+}
+
+func (c *fakeConn) none(t *testing.T, wait time.Duration) {
+	t.Helper()
+	select {
+	case addrs := <-c.updates:
+		t.Errorf("unexpected update to %q", addrs)
+	case <-time.After(wait):
+	}
+}
+
+func target(t *testing.T, s string) resolver.Target {
+	t.Helper()
+	u, err := url.Parse(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return resolver.Target{URL: *u}
+}
+
+func TestStaticResolver(t *testing.T) {
+	cc := newFakeConn()
+	r, err := staticBuilder{}.Build(target(t, "static:///a:1, b:2"), cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if got, want := cc.next(t), []string{"a:1", "b:2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("addresses = %q, want %q", got, want)
+	}
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	cc.none(t, 10*time.Millisecond)
+
+	if _, err := (staticBuilder{}).Build(target(t, "static:///,"), newFakeConn(), resolver.BuildOptions{}); err == nil {
+		t.Error("built a static resolver without addresses")
+	}
+}
+
+func writeEndpoints(t *testing.T, path, content string, modTime time.Time) {
+	t.Helper()
+	if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	// Set explicitly, as writes within the file system's time resolution
+	// could otherwise leave it unchanged
+	if err := os.Chtimes(path, modTime, modTime); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestFileResolver(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "endpoints")
+	start := time.Now().Add(-time.Hour)
+	writeEndpoints(t, path, "# inventory\na:1\nb:2\n", start)
+
+	cc := newFakeConn()
+	r, err := (&fileBuilder{interval: 10 * time.Millisecond}).Build(target(t, "file://"+path), cc, resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if got, want := cc.next(t), []string{"a:1", "b:2"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("addresses = %q, want %q", got, want)
+	}
+
+	// Left alone while the file is unchanged
+	cc.none(t, 50*time.Millisecond)
+
+	writeEndpoints(t, path, "c:3\n", start.Add(time.Minute))
+	if got, want := cc.next(t), []string{"c:3"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("addresses = %q, want %q", got, want)
+	}
+
+	// A file left without addresses or removed keeps the previous ones
+	writeEndpoints(t, path, "# drained\n", start.Add(2*time.Minute))
+	cc.none(t, 50*time.Millisecond)
+	if err := os.Remove(path); err != nil {
+		t.Fatal(err)
+	}
+	cc.none(t, 50*time.Millisecond)
+
+	// Asked to resolve again, it reports the file missing
+	r.ResolveNow(resolver.ResolveNowOptions{})
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		cc.mu.Lock()
+		n := len(cc.errs)
+		cc.mu.Unlock()
+		if n > 0 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("missing endpoints file not reported")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	writeEndpoints(t, path, "d:4", start.Add(3*time.Minute))
+	if got, want := cc.next(t), []string{"d:4"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("addresses = %q, want %q", got, want)
+	}
+
+	// Closed, it stops watching
+	r.Close()
+	r.Close()
+	writeEndpoints(t, path, "e:5", start.Add(4*time.Minute))
+	cc.none(t, 50*time.Millisecond)
+}
+
+func TestFileResolverBuildErrors(t *testing.T) {
+	dir := t.TempDir()
+	empty := filepath.Join(dir, "empty")
+	writeEndpoints(t, empty, "\n# nothing yet\n", time.Now())
+	for _, path := range []string{filepath.Join(dir, "missing"), empty} {
+		if _, err := (&fileBuilder{}).Build(target(t, "file://"+path), newFakeConn(), resolver.BuildOptions{}); err == nil {
+			t.Errorf("built a file resolver from %s", filepath.Base(path))
+		}
+	}
+}
+
+// countingBuilder builds resolvers that count how often they are asked to
+// resolve again.
+type countingBuilder struct {
+	resolver *countingResolver
+}
+
+func (b *countingBuilder) Build(resolver.Target, resolver.ClientConn, resolver.BuildOptions) (resolver.Resolver, error) {
+	return b.resolver, nil
+}
+
+func (*countingBuilder) Scheme() string { return "dns" }
+
+type countingResolver struct {
+	mu     sync.Mutex
+	count  int
+	closed bool
+}
+
+func (r *countingResolver) ResolveNow(resolver.ResolveNowOptions) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.count++
+}
+
+func (r *countingResolver) Close() {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.closed = true
+}
+
+func (r *countingResolver) resolved() int {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.count
+}
+
+func TestPeriodicDNSResolver(t *testing.T) {
+	inner := &countingResolver{}
+	b := &periodicDNSBuilder{Builder: &countingBuilder{inner}, interval: 10 * time.Millisecond}
+	r, err := b.Build(target(t, "dns:///inventory:50051"), newFakeConn(), resolver.BuildOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deadline := time.Now().Add(5 * time.Second)
+	for inner.resolved() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("resolved again %d times, want every interval", inner.resolved())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	r.Close()
+	r.Close()
+	if !inner.closed {
+		t.Error("DNS resolver not closed")
+	}
+	n := inner.resolved()
+	time.Sleep(50 * time.Millisecond)
+	if got := inner.resolved(); got != n {
+		t.Errorf("resolved %d more times after closing", got-n)
+	}
+
+	// Without an interval the DNS resolver is used as it is
+	plain := &periodicDNSBuilder{Builder: &countingBuilder{inner}}
+	if r, _ := plain.Build(target(t, "dns:///inventory:50051"), newFakeConn(), resolver.BuildOptions{}); r != resolver.Resolver(inner) {
+		t.Errorf("resolver = %T, want the DNS resolver itself", r)
+	}
+}
+
+// serve starts a gRPC server whose health service knows only the given
+// service name, so that a client can tell which server it reached.
+func serve(t *testing.T, name string) string {
+	t.Helper()
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	srv := grpc.NewServer()
+	h := health.NewServer()
+	h.SetServingStatus(name, healthpb.HealthCheckResponse_SERVING)
+	healthpb.RegisterHealthServer(srv, h)
+	go srv.Serve(lis)
+	t.Cleanup(srv.Stop)
+	return lis.Addr().String()
+}
+
+// TestEndpointsDial dials through the static and file resolvers as the
+// services do, and follows the endpoints file to another server.
+func TestEndpointsDial(t *testing.T) {
+	a, b := serve(t, "a"), serve(t, "b")
+	path := filepath.Join(t.TempDir(), "endpoints")
+	writeEndpoints(t, path, a+"\n", time.Now().Add(-time.Hour))
+
+	for _, e := range []Endpoints{
+		{Resolver: "static", Address: "inventory:50051", Static: a},
+		{Resolver: "file", Address: "inventory:50051", File: path, RefreshInterval: 10 * time.Millisecond},
+	} {
+		t.Run(e.Resolver, func(t *testing.T) {
+			target, err := e.Target()
+			if err != nil {
+				t.Fatal(err)
+			}
+			opts := append(e.DialOptions(), grpc.WithTransportCredentials(insecure.NewCredentials()))
+			conn, err := grpc.NewClient(target, opts...)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer conn.Close()
+			if conn.CanonicalTarget() != target {
+				t.Errorf("target = %q, want %q", conn.CanonicalTarget(), target)
+			}
+			client := healthpb.NewHealthClient(conn)
+			ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "a"}); err != nil {
+				t.Fatalf("call to %s failed: %v", a, err)
+			}
+			if e.Resolver != "file" {
+				return
+			}
+
+			writeEndpoints(t, path, b+"\n", time.Now())
+			for {
+				if _, err := client.Check(ctx, &healthpb.HealthCheckRequest{Service: "b"}); err == nil {
+					break
+				}
+				if ctx.Err() != nil {
+					t.Fatal("calls never moved to the server added to the endpoints file")
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Broker delivers events to a topic. Publish must only return nil once the
+// broker has taken responsibility for the event.
+type Broker interface {
+	Publish(ctx context.Context, topic string, ev Event) error
+	Close() error
+}
+
+// Subscriber is a broker that also delivers events other services publish.
+type Subscriber interface {
+	// Subscribe calls h for each event published to topic from now on
+	// until ctx is done. The broker keeps the position under durable, so
+	// a restart resumes after the last event h accepted.
+	Subscribe(ctx context.Context, topic, durable string, h Handler) error
+}
+
+// NewBroker returns the broker named by kind: "inprocess", "nats" or "kafka".
+func NewBroker(kind, url string) (Broker, error) {
+	switch kind {
+	case "", "inprocess":
+		return NewBus(), nil
+	case "nats":
+		return NewNATS(url)
+	case "kafka":
+		return NewKafka(url)
+	default:
+		return nil, fmt.Errorf("unknown event broker %q", kind)
+	}
+}
+
+// Fanout publishes to each broker in turn. A failure makes the relay retry the
+// event on all of them, so the brokers see at-least-once delivery as usual.
+type Fanout []Broker
+
+func (f Fanout) Publish(ctx context.Context, topic string, ev Event) error {
+	for _, b := range f {
+		if err := b.Publish(ctx, topic, ev); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (f Fanout) Close() error {
+	var errs []error
+	for _, b := range f {
+		errs = append(errs, b.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// Handler consumes an event. Returning an error makes the publisher retry.
+type Handler func(ctx context.Context, ev Event) error
+
+// Bus is an in-process broker that calls subscribers synchronously.
+type Bus struct {
+	mu   sync.RWMutex
+	subs map[string][]Handler
+}
+
+func NewBus() *Bus {
+	return &Bus{subs: map[string][]Handler{}}
+}
+
+// Subscribe registers h for one event type, or for every type if eventType is
+// empty.
+func (b *Bus) Subscribe(eventType string, h Handler) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.subs[eventType] = append(b.subs[eventType], h)
+}
+
+// Publish hands ev to its subscribers. If one fails the whole event is retried,
+// so subscribers should be wrapped with Dedup.
+func (b *Bus) Publish(ctx context.Context, topic string, ev Event) error {
+	b.mu.RLock()
+	handlers := append(append([]Handler(nil), b.subs[ev.Type]...), b.subs[""]...)
+	b.mu.RUnlock()
+	for _, h := range handlers {
+		if err := h(ctx, ev); err != nil {
+			return fmt.Errorf("%s subscriber: %w", ev.Type, err)
+		}
+	}
+	return nil
+}
+
+func (b *Bus) Close() error {
+	return nil
+}
+
+// Dedup wraps h so that an event ID it has already handled successfully is
+// skipped. It remembers the last size IDs.
+func Dedup(size int, h Handler) Handler {
+	var mu sync.Mutex
+	seen := make(map[string]bool, size)
+	order := make([]string, 0, size)
+	return func(ctx context.Context, ev Event) error {
+		mu.Lock()
+		dup := seen[ev.ID]
+		mu.Unlock()
+		if dup {
+			return nil
+		}
+		if err := h(ctx, ev); err != nil {
+			return err
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		if !seen[ev.ID] {
+			if len(order) == size {
+				delete(seen, order[0])
+				order = order[1:]
+			}
+			seen[ev.ID] = true
+			order = append(order, ev.ID)
+		}
+		return nil
+	}
+}
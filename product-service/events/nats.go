@@ -0,0 +1,119 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/url"
+	"time"
+
+	"github.com/nats-io/nats.go"
+	"github.com/nats-io/nats.go/jetstream"
+)
+
+// NATS publishes to a JetStream stream. Each message carries the event ID in
+// the Nats-Msg-Id header, which JetStream uses to drop duplicates within the
+// stream's duplicate window, and Publish waits for the stream's
+// acknowledgement. A stream must capture the topics, e.g. "events.>".
+type NATS struct {
+	conn *nats.Conn
+	js   jetstream.JetStream
+}
+
+// NewNATS connects to a nats://[user:pass@]host:port URL. A server that is
+// not up yet is retried in the background, as is one that goes away; until
+// it is reached, publishes time out and the relay tries them again.
+func NewNATS(rawURL string) (*NATS, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || u.Scheme != "nats" || u.Host == "" {
+		return nil, fmt.Errorf("invalid NATS URL %q", rawURL)
+	}
+	conn, err := nats.Connect(rawURL,
+		nats.Name("outbox-relay"),
+		nats.RetryOnFailedConnect(true),
+		nats.MaxReconnects(-1),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("nats connect: %w", err)
+	}
+	js, err := jetstream.New(conn)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+	return &NATS{conn: conn, js: js}, nil
+}
+
+func (n *NATS) Publish(ctx context.Context, topic string, ev Event) error {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+	msg := nats.NewMsg(topic)
+	msg.Data = body
+	if _, err := n.js.PublishMsg(ctx, msg, jetstream.WithMsgID(ev.ID)); err != nil {
+		return fmt.Errorf("nats publish: %w", err)
+	}
+	return nil
+}
+
+// Subscribe consumes topic through a durable JetStream consumer on the
+// stream that captures it, created to start at new events. Events h accepts
+// are acknowledged, and those it fails are redelivered. Until the server and
+// stream can be reached, it retries every few seconds.
+func (n *NATS) Subscribe(ctx context.Context, topic, durable string, h Handler) error {
+	for {
+		consumer, err := n.consume(ctx, topic, durable, h)
+		if err == nil {
+			<-ctx.Done()
+			consumer.Stop()
+			return nil
+		}
+		slog.WarnContext(ctx, "cannot subscribe to events", "topic", topic, "error", err)
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(5 * time.Second):
+		}
+	}
+}
+
+func (n *NATS) consume(ctx context.Context, topic, durable string, h Handler) (jetstream.ConsumeContext, error) {
+	setupCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+	defer cancel()
+	stream, err := n.js.StreamNameBySubject(setupCtx, topic)
+	if err != nil {
+		return nil, fmt.Errorf("finding stream: %w", err)
+	}
+	consumer, err := n.js.CreateOrUpdateConsumer(setupCtx, stream, jetstream.ConsumerConfig{
+		Durable:       durable,
+		FilterSubject: topic,
+		DeliverPolicy: jetstream.DeliverNewPolicy,
+		AckPolicy:     jetstream.AckExplicitPolicy,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("creating consumer: %w", err)
+	}
+	return consumer.Consume(func(msg jetstream.Msg) {
+		var ev Event
+		if err := json.Unmarshal(msg.Data(), &ev); err != nil {
+			slog.WarnContext(ctx, "dropping malformed event", "subject", msg.Subject(), "error", err)
+			msg.Term()
+			return
+		}
+		if err := h(ctx, ev); err != nil {
+			slog.WarnContext(ctx, "event handler failed", "event_id", ev.ID, "type", ev.Type, "error", err)
+			msg.Nak()
+			return
+		}
+		msg.Ack()
+	})
+}
+
+// Close closes the connection. Publish has nothing in flight once it
+// returns, so nothing is lost.
+func (n *NATS) Close() error {
+	n.conn.Close()
+	return nil
+}
@@ -0,0 +1,132 @@
+package events
+
+import (
+	"encoding/json"
+	"errors"
+	"sync"
+	"time"
+)
+
+// ErrOutboxFull is returned by Record while the outbox holds as many events
+// as its limit allows, typically because the broker has been down for a
+// while. Stores then refuse the state change, pushing back on callers instead
+// of growing without bound or losing events.
+var ErrOutboxFull = errors.New("event outbox is full")
+
+// Outbox holds recorded events until the relay has published them. Stores
+// call Record while holding their own lock, after every check that could
+// fail, so an event exists exactly when its state change was applied.
+type Outbox struct {
+	source string
+
+	mu      sync.Mutex
+	pending []Event
+	limit   int
+	ready   chan struct{}
+}
+
+func NewOutbox(source string) *Outbox {
+	return &Outbox{source: source, ready: make(chan struct{}, 1)}
+}
+
+// SetLimit caps the number of unpublished events. Zero or less means no
+// limit, which is the default.
+func (o *Outbox) SetLimit(n int) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	o.limit = n
+}
+
+// Entry is an event to record.
+type Entry struct {
+	Type        string
+	AggregateID string
+	Data        any
+}
+
+// Record appends an event. A nil outbox records nothing, which keeps stores
+// usable without event publishing.
+func (o *Outbox) Record(typ, aggregateID string, data any) error {
+	return o.RecordAll(Entry{typ, aggregateID, data})
+}
+
+// RecordAll appends the events of one state change, all of them or, if any
+// cannot be encoded or the outbox has no room for them all, none.
+func (o *Outbox) RecordAll(entries ...Entry) error {
+	if o == nil {
+		return nil
+	}
+	now := time.Now().UTC()
+	recorded := make([]Event, 0, len(entries))
+	for _, e := range entries {
+		raw, err := json.Marshal(e.Data)
+		if err != nil {
+			return err
+		}
+		recorded = append(recorded, Event{
+			ID:          newID(),
+			Type:        e.Type,
+			Source:      o.source,
+			AggregateID: e.AggregateID,
+			OccurredAt:  now,
+			Data:        raw,
+		})
+	}
+	o.mu.Lock()
+	if o.limit > 0 && len(o.pending)+len(recorded) > o.limit {
+		o.mu.Unlock()
+		for _, ev := range recorded {
+			outboxRejected.WithLabelValues(ev.Type).Inc()
+		}
+		return ErrOutboxFull
+	}
+	o.pending = append(o.pending, recorded...)
+	outboxPending.Set(float64(len(o.pending)))
+	o.mu.Unlock()
+
+	select {
+	case o.ready <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Pending returns up to limit of the oldest unpublished events, in the order
+// they were recorded.
+func (o *Outbox) Pending(limit int) []Event {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	n := min(limit, len(o.pending))
+	return append([]Event(nil), o.pending[:n]...)
+}
+
+// Ack removes published events.
+func (o *Outbox) Ack(ids ...string) {
+	done := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		done[id] = true
+	}
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	kept := o.pending[:0]
+	for _, ev := range o.pending {
+		if !done[ev.ID] {
+			kept = append(kept, ev)
+		}
+	}
+	clear(o.pending[len(kept):])
+	o.pending = kept
+	outboxPending.Set(float64(len(o.pending)))
+}
+
+// Len returns the number of unpublished events.
+func (o *Outbox) Len() int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return len(o.pending)
+}
+
+// Ready is signalled whenever an event is recorded.
+func (o *Outbox) Ready() <-chan struct{} {
+	return o.ready
+}
@@ -1,17 +1,24 @@
 package grpc
 
 import (
-    // "context"
-    order_product_pb "product-service/proto/orderproduct"
-	"product-service/model"
 	"context"
+	"errors"
+	"fmt"
+	"io"
+	"product-service/money"
 	inventory_product_pb "product-service/proto/inventory"
+	order_product_pb "product-service/proto/orderproduct"
+	"product-service/store"
+
+	"google.golang.org/genproto/googleapis/rpc/code"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
 )
 
 type Server struct {
-    order_product_pb.UnimplementedOrderProductServiceServer
-	inventoryClient  inventory_product_pb.InventoryServiceClient
-    products []model.Product
+	order_product_pb.UnimplementedOrderProductServiceServer
+	inventoryClient inventory_product_pb.InventoryServiceClient
+	catalog         *store.Catalog
 }
 
 type Product struct {
@@ -22,62 +29,187 @@ type Product struct {
 	Quantity int32   `json:"quantity"`
 }
 
-
-func NewServer(inventoryClient inventory_product_pb.InventoryServiceClient ,products []model.Product) *Server {
-    return &Server{
+func NewServer(inventoryClient inventory_product_pb.InventoryServiceClient, catalog *store.Catalog) *Server {
+	return &Server{
 		inventoryClient: inventoryClient,
-        products: products,
-    }
+		catalog:         catalog,
+	}
 }
 
 func (s *Server) ValidateProducts(ctx context.Context, req *order_product_pb.ValidateProductsRequest) (*order_product_pb.ValidateProductsResponse, error) {
-    var validProducts []*order_product_pb.ProductInfo
-    
-    for _, id := range req.ProductIds {
-        for _, product := range s.products {
-            if product.ID == id {
-                validProducts = append(validProducts, &order_product_pb.ProductInfo{
-                    Id:       product.ID,
-                    Name:     product.Name,
-                    Price:    product.Price,
-                    InStock:  product.InStock,
-                    Quantity: product.Quantity,
-                })
-                break
-            }
-        }
-    }
-    
-    if len(validProducts) != len(req.ProductIds) {
-        return &order_product_pb.ValidateProductsResponse{
-            Valid: false,
-            Error: "some products not found",
-        }, nil
-    }
-    
-    return &order_product_pb.ValidateProductsResponse{
-        Valid:    true,
-        Products: validProducts,
-    }, nil
+	refs := req.Items
+	for _, id := range req.ProductIds {
+		refs = append(refs, &order_product_pb.ProductRef{ProductId: id})
+	}
+
+	var validProducts []*order_product_pb.ProductInfo
+	for _, ref := range refs {
+		info, err := s.productInfo(ctx, ref, req.Currency)
+		if errors.Is(err, errUnknownProduct) {
+			return &order_product_pb.ValidateProductsResponse{
+				Valid: false,
+				Error: err.Error(),
+			}, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		validProducts = append(validProducts, info)
+	}
+
+	return &order_product_pb.ValidateProductsResponse{
+		Valid:    true,
+		Products: validProducts,
+	}, nil
+}
+
+// errUnknownProduct makes a reference invalid, as opposed to inventory
+// failures, which fail the whole call.
+var errUnknownProduct = errors.New("not found")
+
+// productInfo resolves a reference to a product or one of its variants,
+// taking the price from the variant when one is named. Prices come from the
+// price list for currency when there is one, else in the base currency.
+func (s *Server) productInfo(ctx context.Context, ref *order_product_pb.ProductRef, currency string) (*order_product_pb.ProductInfo, error) {
+	product, ok := s.catalog.Product(ref.ProductId)
+	if !ok {
+		return nil, fmt.Errorf("product %s %w", ref.ProductId, errUnknownProduct)
+	}
+	price := product.PriceIn(currency)
+	info := &order_product_pb.ProductInfo{
+		Id:        product.ID,
+		Name:      product.Name,
+		Price:     price.Float(),
+		UnitPrice: toProto(price),
+	}
+	stockKey := product.ID
+	if ref.Sku != "" {
+		variant, ok := product.Variant(ref.Sku)
+		if !ok {
+			return nil, fmt.Errorf("variant %s of product %s %w", ref.Sku, ref.ProductId, errUnknownProduct)
+		}
+		info.Sku = variant.SKU
+		info.VariantName = variant.Name
+		price = product.VariantPriceIn(variant, currency)
+		info.Price = price.Float()
+		info.UnitPrice = toProto(price)
+		stockKey = variant.SKU
+	}
+
+	// Report live stock, variants by SKU
+	stock, err := s.inventoryClient.CheckStock(ctx, &inventory_product_pb.StockRequest{ProductId: stockKey})
+	if err != nil {
+		return nil, fmt.Errorf("checking stock of %s: %w", stockKey, err)
+	}
+	info.InStock = stock.InStock
+	info.Quantity = stock.Quantity
+	info.StockVersion = stock.Version
+	return info, nil
+}
+
+func toProto(m money.Money) *order_product_pb.Money {
+	return &order_product_pb.Money{CurrencyCode: m.Currency, MinorUnits: m.Amount}
 }
 
+// UpdateProductStock sets the stock of each item, all or none. It fails with
+// the status of the first item that cannot be set, such as ABORTED when
+// expected_stock_version is no longer current.
 func (s *Server) UpdateProductStock(ctx context.Context, req *order_product_pb.UpdateStockRequest) (*order_product_pb.UpdateStockResponse, error) {
-    // Update inventory through gRPC client
-    for _, item := range req.Items {
-        // Call inventory service to update stock
-        _, err := s.inventoryClient.UpdateStock(ctx, &inventory_product_pb.UpdateStockRequest{
-            ProductId: item.ProductId,
-            Quantity: item.Quantity,
-        })
-        if err != nil {
-            return &order_product_pb.UpdateStockResponse{
-                Success: false,
-                Error:   err.Error(),
-            }, nil
-        }
-    }
-    
-    return &order_product_pb.UpdateStockResponse{
-        Success: true,
-    }, nil
-}
\ No newline at end of file
+	adjustments := make([]*inventory_product_pb.BulkAdjustStockRequest, 0, len(req.Items))
+	for _, item := range req.Items {
+		// Variant stock is keyed by SKU
+		stockKey := item.ProductId
+		if item.Sku != "" {
+			stockKey = item.Sku
+		}
+		adjustments = append(adjustments, &inventory_product_pb.BulkAdjustStockRequest{
+			ProductId:       stockKey,
+			Change:          &inventory_product_pb.BulkAdjustStockRequest_Set{Set: item.Quantity},
+			ExpectedVersion: item.ExpectedStockVersion,
+		})
+	}
+	if err := s.adjustStock(ctx, adjustments); err != nil {
+		return nil, err
+	}
+	return &order_product_pb.UpdateStockResponse{Success: true}, nil
+}
+
+func (s *Server) TakeStock(ctx context.Context, req *order_product_pb.StockChangeRequest) (*order_product_pb.StockChangeResponse, error) {
+	if err := s.changeStock(ctx, req.Items, -1); err != nil {
+		return nil, err
+	}
+	return &order_product_pb.StockChangeResponse{}, nil
+}
+
+func (s *Server) ReturnStock(ctx context.Context, req *order_product_pb.StockChangeRequest) (*order_product_pb.StockChangeResponse, error) {
+	if err := s.changeStock(ctx, req.Items, 1); err != nil {
+		return nil, err
+	}
+	return &order_product_pb.StockChangeResponse{}, nil
+}
+
+// changeStock adds sign times each item's quantity to its stock, all or
+// none. Variant stock is keyed by SKU.
+func (s *Server) changeStock(ctx context.Context, items []*order_product_pb.StockChange, sign int32) error {
+	adjustments := make([]*inventory_product_pb.BulkAdjustStockRequest, 0, len(items))
+	for _, item := range items {
+		if item.Quantity <= 0 {
+			return status.Errorf(codes.InvalidArgument, "quantity of %s must be positive", item.ProductId)
+		}
+		stockKey := item.ProductId
+		if item.Sku != "" {
+			stockKey = item.Sku
+		}
+		adjustments = append(adjustments, &inventory_product_pb.BulkAdjustStockRequest{
+			ProductId: stockKey,
+			Change:    &inventory_product_pb.BulkAdjustStockRequest_Delta{Delta: sign * item.Quantity},
+		})
+	}
+	return s.adjustStock(ctx, adjustments)
+}
+
+// adjustStock streams adjustments to inventory's BulkAdjustStock in
+// all_or_nothing mode. If any cannot be applied it fails with that
+// adjustment's status.
+func (s *Server) adjustStock(ctx context.Context, adjustments []*inventory_product_pb.BulkAdjustStockRequest) error {
+	if len(adjustments) == 0 {
+		return nil
+	}
+	adjustments[0].AllOrNothing = true
+	stream, err := s.inventoryClient.BulkAdjustStock(ctx)
+	if err != nil {
+		return err
+	}
+	for _, adjustment := range adjustments {
+		// On io.EOF the server has ended the stream, and CloseAndRecv
+		// returns why
+		if err := stream.Send(adjustment); err != nil {
+			if err == io.EOF {
+				break
+			}
+			return err
+		}
+	}
+	resp, err := stream.CloseAndRecv()
+	if err != nil {
+		return err
+	}
+	if !resp.RolledBack {
+		return nil
+	}
+	// Adjustments left out by the rollback are ABORTED too, so prefer the
+	// first failure of another kind
+	var failure *inventory_product_pb.AdjustmentResult
+	for _, result := range resp.Results {
+		if result.Success {
+			continue
+		}
+		if failure == nil || (failure.Code == code.Code_ABORTED.String() && result.Code != failure.Code) {
+			failure = result
+		}
+	}
+	if failure == nil {
+		return status.Error(codes.Internal, "stock adjustments rolled back without a failure")
+	}
+	return status.Error(codes.Code(code.Code_value[failure.Code]), failure.Error)
+}
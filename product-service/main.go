@@ -1,37 +1,71 @@
 package main
 
 import (
+	"bytes"
 	"context"
+	_ "embed"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
+	"log/slog"
 	"net/http"
+	"strings"
+	"product-service/apiversion"
 	"product-service/config"
+	"product-service/events"
 	"net"
 
 	// "product-service/proto"
-	"time"
 
 	inventory_pb "product-service/proto/inventory"
 	order_product_pb "product-service/proto/orderproduct"
+	"product-service/clientpolicy"
+	"product-service/discovery"
 	product_grpc "product-service/grpc"
+	"product-service/logging"
+	"product-service/metrics"
 	"product-service/model"
+	"product-service/money"
+	"product-service/openapi"
+	"product-service/render"
+	"product-service/search"
+	"product-service/store"
+	"product-service/tlsconfig"
+	"product-service/tracing"
+	"shared/patch"
 	// "product-service/proto/orderproduct"
 
 	"github.com/gorilla/mux"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
 )
 
 type Product struct {
-	ID       string  `json:"id"`
-	Name     string  `json:"name"`
-	Price    float64 `json:"price"`
-	InStock  bool    `json:"in_stock"`
-	Quantity int32   `json:"quantity"`
+	ID         string                     `json:"id"`
+	Name       string                     `json:"name"`
+	Price      money.Money                `json:"price"`
+	Prices     money.PriceList            `json:"prices,omitempty"`
+	InStock    bool                       `json:"in_stock"`
+	Quantity   int32                      `json:"quantity"`
+	CategoryID string                     `json:"category_id,omitempty"`
+	Attributes map[string]model.Attribute `json:"attributes,omitempty"`
+	Variants   []model.Variant            `json:"variants,omitempty"`
+	Version      int64                    `json:"version"`
+	StockVersion int64                    `json:"stock_version,omitempty"`
 }
 
-var products []model.Product
+// openapiJSON describes the HTTP API. Keep it in step with the routes below;
+// the service warns at startup about routes it does not cover.
+//
+//go:embed openapi.json
+var openapiJSON []byte
+
+var outbox = events.NewOutbox("product-service")
+var catalog = store.NewCatalog(outbox)
 var inventoryClient inventory_pb.InventoryServiceClient
 
 func main() {
@@ -40,57 +74,222 @@ func main() {
 	if err != nil {
 		log.Fatal("Cannot load config:", err)
 	}
-	
+	logging.New("product-service", cfg.LogLevel)
+	slog.Info("configuration loaded", "config", cfg)
+
+	// Set up tracing
+	shutdownTracing, err := tracing.Init(context.Background(), "product-service", cfg)
+	if err != nil {
+		logging.Fatal("cannot set up tracing", "error", err)
+	}
+	defer shutdownTracing(context.Background())
+
+	// Load TLS material
+	certs, err := tlsconfig.New(tlsconfig.Files{
+		CertFile: cfg.TLSCertFile,
+		KeyFile:  cfg.TLSKeyFile,
+		CAFile:   cfg.TLSCAFile,
+	})
+	if err != nil {
+		logging.Fatal("cannot load TLS files", "error", err)
+	}
+	go certs.Watch(context.Background(), cfg.TLSReloadInterval)
 
 	// Set up gRPC connection to inventory service
-	inventoryAddr := fmt.Sprintf("%s:%s",
-		cfg.InventoryServiceHost,
-		cfg.InventoryServicePort,
-	)
-	conn, err := grpc.NewClient(inventoryAddr, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	inventoryEndpoints := discovery.Endpoints{
+		Resolver:        cfg.InventoryResolver,
+		Address:         fmt.Sprintf("%s:%s", cfg.InventoryServiceHost, cfg.InventoryServicePort),
+		Static:          cfg.InventoryAddresses,
+		File:            cfg.InventoryEndpointsFile,
+		RefreshInterval: cfg.InventoryResolveInterval,
+	}
+	inventoryTarget, err := inventoryEndpoints.Target()
 	if err != nil {
-		log.Fatalf("failed to connect: %v", err)
+		logging.Fatal("invalid inventory endpoints", "error", err)
+	}
+	inventoryCreds := insecure.NewCredentials()
+	if certs.ClientEnabled() {
+		inventoryCreds = credentials.NewTLS(certs.ClientConfig())
+	}
+	inventoryPolicy, err := clientpolicy.Policy{
+		Service:          inventory_pb.InventoryService_ServiceDesc.ServiceName,
+		Timeout:          cfg.InventoryCallTimeout,
+		MaxAttempts:      cfg.InventoryMaxAttempts,
+		// Writes carrying an expected version are not retried: if the first
+		// attempt landed, the retry would fail with ABORTED. Reads are
+		// retried by hedging.
+		RetryMethods:     []string{"DeleteStock"},
+		HedgeMethods:     []string{"CheckStock", "CheckStockBatch"},
+		HedgeDelay:       cfg.InventoryHedgeDelay,
+		BreakerThreshold: cfg.InventoryBreakerThreshold,
+		BreakerCooldown:  cfg.InventoryBreakerCooldown,
+		LoadBalancing:    cfg.InventoryLBPolicy,
+	}.DialOptions()
+	if err != nil {
+		logging.Fatal("invalid inventory client policy", "error", err)
+	}
+	dialOpts := []grpc.DialOption{
+		grpc.WithTransportCredentials(inventoryCreds),
+		grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                cfg.GrpcKeepaliveTime,
+			Timeout:             cfg.GrpcKeepaliveTimeout,
+			PermitWithoutStream: true,
+		}),
+		tracing.DialOption(),
+		grpc.WithChainUnaryInterceptor(
+			metrics.UnaryClientInterceptor(),
+			logging.UnaryClientInterceptor(),
+		),
+		grpc.WithChainStreamInterceptor(
+			metrics.StreamClientInterceptor(),
+			logging.StreamClientInterceptor(),
+		),
+	}
+	dialOpts = append(dialOpts, inventoryEndpoints.DialOptions()...)
+	dialOpts = append(dialOpts, inventoryPolicy...)
+	conn, err := grpc.NewClient(inventoryTarget, dialOpts...)
+	if err != nil {
+		logging.Fatal("failed to connect to inventory service", "error", err)
 	}
 	defer conn.Close()
 	inventoryClient = inventory_pb.NewInventoryServiceClient(conn)
 
+	// Relay domain events
+	broker, err := events.NewBroker(cfg.EventBroker, cfg.EventBrokerURL)
+	if err != nil {
+		logging.Fatal("cannot set up event broker", "error", err)
+	}
+	defer broker.Close()
+	outbox.SetLimit(cfg.EventOutboxLimit)
+	relay := &events.Relay{
+		Outbox:         outbox,
+		Broker:         broker,
+		TopicPrefix:    cfg.EventTopicPrefix,
+		Interval:       cfg.EventRelayInterval,
+		Batch:          cfg.EventRelayBatch,
+		PublishTimeout: cfg.EventPublishTimeout,
+	}
+	go relay.Run(context.Background())
+
 	router := mux.NewRouter()
+	router.Use(tracing.Middleware("product-service"))
+	router.Use(logging.Middleware)
+	router.Use(metrics.Middleware)
+	router.NotFoundHandler = http.HandlerFunc(render.NotFound)
+	router.MethodNotAllowedHandler = http.HandlerFunc(render.MethodNotAllowed)
+
+	// Describe the API and, in development, check traffic against it
+	apiDoc, err := openapi.Load(openapiJSON)
+	if err != nil {
+		logging.Fatal("cannot load API description", "error", err)
+	}
+	validation, err := openapi.ParseMode(cfg.OpenAPIValidation)
+	if err != nil {
+		logging.Fatal("cannot set up API validation", "error", err)
+	}
+	router.Use(apiDoc.Middleware(validation))
+	router.Handle("/openapi.json", apiDoc.Handler()).Methods("GET")
 
 	// Add health check endpoint
 	router.HandleFunc("/health", healthCheck).Methods("GET")
+	router.Handle("/metrics", metrics.Handler()).Methods("GET")
+
+	importBatchSize = cfg.ImportBatchSize
+	if _, err := money.Exponent(cfg.BaseCurrency); err != nil {
+		logging.Fatal("invalid BASE_CURRENCY", "error", err)
+	}
+	baseCurrency = cfg.BaseCurrency
+	rates, err := money.ParseRates(cfg.BaseCurrency, cfg.ExchangeRates)
+	if err != nil {
+		logging.Fatal("invalid exchange rates", "error", err)
+	}
+	searchIndex = search.NewIndex(rates)
 
 	// Sample data
-	products = append(products, model.Product{ID: "1", Name: "Laptop", Price: 999.99})
-	products = append(products, model.Product{ID: "2", Name: "Mouse", Price: 29.99})
+	catalog.AddProduct(model.Product{ID: "1", Name: "Laptop", Price: money.New(99999, "USD")})
+	catalog.AddProduct(model.Product{ID: "2", Name: "Mouse", Price: money.New(2999, "USD")})
+	metrics.SetCatalogSize(catalog.Len())
+	for _, product := range catalog.Products() {
+		searchIndex.Add(product)
+	}
 
 	// Start gRPC server
 	grpcAddr := fmt.Sprintf("%s:%s", cfg.GrpcHost, cfg.GrpcPort)
 
 	lis, err := net.Listen("tcp", grpcAddr)
 	if err != nil {
-		log.Fatalf("failed to listen: %v", err)
+		logging.Fatal("failed to listen", "addr", grpcAddr, "error", err)
 	}
 
-	ser := product_grpc.NewServer(inventoryClient ,products)
-	grpcServer := grpc.NewServer()
+	ser := product_grpc.NewServer(inventoryClient, catalog)
+	grpcOpts := []grpc.ServerOption{
+		tracing.ServerOption(),
+		// Recycling connections lets clients rebalance onto new instances.
+		grpc.KeepaliveParams(keepalive.ServerParameters{
+			MaxConnectionAge: cfg.GrpcMaxConnectionAge,
+		}),
+		grpc.KeepaliveEnforcementPolicy(keepalive.EnforcementPolicy{
+			MinTime:             cfg.GrpcKeepaliveMinTime,
+			PermitWithoutStream: true,
+		}),
+		grpc.ChainUnaryInterceptor(
+			metrics.UnaryServerInterceptor(),
+			logging.UnaryServerInterceptor(),
+		),
+	}
+	if certs.ServerEnabled() {
+		grpcOpts = append(grpcOpts, grpc.Creds(credentials.NewTLS(certs.ServerConfig(true))))
+	}
+	grpcServer := grpc.NewServer(grpcOpts...)
 	order_product_pb.RegisterOrderProductServiceServer(grpcServer, ser)
 	go func() {
-		log.Printf("Starting gRPC server on %s", grpcAddr)
+		slog.Info("Starting gRPC server", "addr", grpcAddr)
 		if err := grpcServer.Serve(lis); err != nil {
-			log.Fatalf("failed to serve gRPC: %v", err)
+			logging.Fatal("failed to serve gRPC", "error", err)
 		}
 	}()
 
-	// HTTP Endpoint
+	// HTTP Endpoint, for every API version; v1 is also served without a
+	// prefix. v1 shows prices as decimals in the base currency, v2 as Money
+	apiversion.Mount(router, []apiversion.Version{{Number: 1}, {Number: 2}}, registerRoutes)
+
+	problems := apiDoc.CheckRoutes(router)
+	for _, problem := range problems {
+		slog.Warn("API description is out of date", "problem", problem)
+	}
+	if len(problems) > 0 && validation == openapi.ModeEnforce {
+		logging.Fatal("API description does not match the routes")
+	}
+
+	serverAddr := fmt.Sprintf("%s:%s", cfg.ServerHost, cfg.ServerPort)
+	slog.Info("Product service is running", "addr", serverAddr, "tls", certs.ServerEnabled())
+	server := &http.Server{Addr: serverAddr, Handler: router}
+	if err := certs.ListenAndServe(server); err != nil {
+		logging.Fatal("server stopped", "error", err)
+	}
+}
+
+// registerRoutes registers the API on a router, once per version.
+func registerRoutes(router *mux.Router) {
 	router.HandleFunc("/products", GetProducts).Methods("GET")
+	router.HandleFunc("/products/search", SearchProducts).Methods("GET")
+	router.HandleFunc("/products:import", ImportProducts).Methods("POST")
+	router.HandleFunc("/products:export", ExportProducts).Methods("GET")
     router.HandleFunc("/products/{id}", GetProduct).Methods("GET")
     router.HandleFunc("/products", CreateProduct).Methods("POST")
     router.HandleFunc("/products/{id}", UpdateProduct).Methods("PUT")
+	router.HandleFunc("/products/{id}", PatchProduct).Methods("PATCH")
     router.HandleFunc("/products/{id}", DeleteProduct).Methods("DELETE")
-
-	serverAddr := fmt.Sprintf("%s:%s", cfg.ServerHost, cfg.ServerPort)
-	log.Printf("Product service is running on %s", serverAddr)
-	log.Fatal(http.ListenAndServe(serverAddr, router))
+	router.HandleFunc("/products/{id}/variants", GetVariants).Methods("GET")
+	router.HandleFunc("/products/{id}/variants", CreateVariant).Methods("POST")
+	router.HandleFunc("/products/{id}/variants/{sku}", UpdateVariant).Methods("PUT")
+	router.HandleFunc("/products/{id}/variants/{sku}", DeleteVariant).Methods("DELETE")
+	router.HandleFunc("/categories", GetCategories).Methods("GET")
+	router.HandleFunc("/categories", CreateCategory).Methods("POST")
+	router.HandleFunc("/categories/{id}", GetCategory).Methods("GET")
+	router.HandleFunc("/categories/{id}", UpdateCategory).Methods("PUT")
+	router.HandleFunc("/categories/{id}", DeleteCategory).Methods("DELETE")
+	router.HandleFunc("/categories/{id}/products", GetCategoryProducts).Methods("GET")
 }
 
 func healthCheck(w http.ResponseWriter, r *http.Request) {
@@ -101,136 +300,369 @@ func healthCheck(w http.ResponseWriter, r *http.Request) {
 	})
 }
 
+
 func GetProducts(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+	list := catalog.Products()
+	if category := r.URL.Query().Get("category"); category != "" {
+		list = catalog.ProductsInCategory(category)
+	}
+	// ?ids=1&ids=2 fetches several products in one call; unknown IDs are
+	// skipped. v1 also splits each value on commas, as in ?ids=1,2
+	if ids := r.URL.Query()["ids"]; len(ids) > 0 {
+		if apiversion.FromRequest(r) < 2 {
+			var split []string
+			for _, v := range ids {
+				split = append(split, strings.Split(v, ",")...)
+			}
+			ids = split
+		}
+		list = list[:0]
+		for _, id := range ids {
+			if product, ok := catalog.Product(id); ok {
+				list = append(list, product)
+			}
+		}
+	}
 
-	// Get inventory information for each product
-	enrichedProducts := make([]Product, len(products))
-	for i, product := range products {
-		ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-		defer cancel()
+	// Get inventory information for all the products in one call
+	render.Respond(w, r, http.StatusOK, productsBody(r, enrichProducts(r.Context(), list)))
+}
 
-		resp, err := inventoryClient.CheckStock(ctx, &inventory_pb.StockRequest{ProductId: product.ID})
-		if err != nil {
-			log.Printf("Error checking stock for product %s: %v", product.ID, err)
-			continue
-		}
+func GetProduct(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	item, ok := catalog.Product(params["id"])
+	if !ok {
+		render.Error(w, r, http.StatusNotFound, "Product not found")
+		return
+	}
+	render.Respond(w, r, http.StatusOK, productBody(r, enrichProduct(r.Context(), item)))
+}
+
+// enrichProduct adds stock levels from inventory-service to a product and
+// its variants. Failed lookups are logged and leave the stock empty.
+func enrichProduct(ctx context.Context, product model.Product) Product {
+	enriched := productView(product)
+	resp, err := inventoryClient.CheckStock(ctx, &inventory_pb.StockRequest{ProductId: product.ID})
+	if err != nil {
+		slog.ErrorContext(ctx, "error checking stock", "product_id", product.ID, "error", err)
+		metrics.StockLookupFailed()
+	} else {
+		enriched.InStock = resp.InStock
+		enriched.Quantity = resp.Quantity
+		enriched.StockVersion = resp.Version
+	}
+	for _, variant := range product.Variants {
+		enriched.Variants = append(enriched.Variants, enrichVariant(ctx, variant))
+	}
+	return enriched
+}
+
+// enrichProducts is enrichProduct for many products, reading their stock in
+// one CheckStockBatch call.
+func enrichProducts(ctx context.Context, products []model.Product) []Product {
+	stock, err := batchStock(ctx, products)
+	if err != nil {
+		slog.ErrorContext(ctx, "error checking stock", "products", len(products), "error", err)
+		metrics.StockLookupFailed()
+	}
+	enriched := make([]Product, 0, len(products))
+	for _, product := range products {
+		enriched = append(enriched, withStock(product, stock))
+	}
+	return enriched
+}
+
+// productView is a product as the API shows it, without its stock.
+func productView(product model.Product) Product {
+	return Product{
+		ID:         product.ID,
+		Name:       product.Name,
+		Price:      product.Price,
+		Prices:     product.Prices,
+		CategoryID: product.CategoryID,
+		Attributes: product.Attributes,
+		Version:    product.Version,
+	}
+}
+
+func enrichVariant(ctx context.Context, variant model.Variant) model.Variant {
+	resp, err := inventoryClient.CheckStock(ctx, &inventory_pb.StockRequest{ProductId: variant.SKU})
+	if err != nil {
+		slog.ErrorContext(ctx, "error checking stock", "sku", variant.SKU, "error", err)
+		metrics.StockLookupFailed()
+		return variant
+	}
+	variant.InStock = resp.InStock
+	variant.Quantity = resp.Quantity
+	variant.StockVersion = resp.Version
+	return variant
+}
 
-		enrichedProducts[i] = Product{
-			ID:       product.ID,
-			Name:     product.Name,
-			Price:    product.Price,
-			InStock:  resp.InStock,
-			Quantity: resp.Quantity,
+func CreateProduct(w http.ResponseWriter, r *http.Request) {
+	var product model.Product
+	if err := decodeProduct(r, &product); err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if err := validateProduct(product); err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Hold the product's ID and SKUs while its stock is written, so that
+	// no other product is created with them meanwhile
+	reservation, err := catalog.Reserve(product)
+	if err != nil {
+		catalogError(w, r, err)
+		return
+	}
+
+	// Add to inventory, the product itself and each variant by SKU. The
+	// product is only stored once its stock exists, so ProductCreated is
+	// never recorded for a product that fails here, and stock written for
+	// it is deleted again.
+	ctx := r.Context()
+	written, err := addProductStock(ctx, product)
+	if err != nil {
+		reservation.Release()
+		deleteStock(ctx, written)
+		render.Error(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	product, err = reservation.Add()
+	if err != nil {
+		deleteStock(ctx, written)
+		catalogError(w, r, err)
+		return
+	}
+
+	metrics.SetCatalogSize(catalog.Len())
+	searchIndex.Add(product)
+	render.Respond(w, r, http.StatusOK, productBody(r, Product(product)))
+}
+
+// addProductStock adds the stock of a new product and of each of its
+// variants, stopping at the first that fails. It returns the IDs of the
+// stock it wrote.
+func addProductStock(ctx context.Context, product model.Product) ([]string, error) {
+	items := []*inventory_pb.AddStockRequest{{ProductId: product.ID, Quantity: product.Quantity}}
+	for _, variant := range product.Variants {
+		items = append(items, &inventory_pb.AddStockRequest{ProductId: variant.SKU, Quantity: variant.Quantity})
+	}
+	var written []string
+	for _, item := range items {
+		if _, err := inventoryClient.AddStock(ctx, item); err != nil {
+			return written, err
 		}
+		written = append(written, item.ProductId)
 	}
+	return written, nil
+}
 
-	json.NewEncoder(w).Encode(enrichedProducts)
+// deleteStock deletes the stock written for a product that was not stored.
+// It runs even if the request was cancelled, and only logs failures.
+func deleteStock(ctx context.Context, ids []string) {
+	ctx = context.WithoutCancel(ctx)
+	for _, id := range ids {
+		if _, err := inventoryClient.DeleteStock(ctx, &inventory_pb.StockRequest{ProductId: id}); err != nil {
+			slog.ErrorContext(ctx, "cannot delete stock of unstored product", "product_id", id, "error", err)
+		}
+	}
 }
 
-func GetProduct(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
+func UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
+	var updatedProduct model.Product
+	if err := decodeProduct(r, &updatedProduct); err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	// The path names the product, which the body cannot rename
+	if updatedProduct.ID != params["id"] {
+		render.Error(w, r, http.StatusBadRequest, store.ErrIDChange.Error())
+		return
+	}
+
+	item, ok := catalog.Product(params["id"])
+	if !ok {
+		render.Error(w, r, http.StatusNotFound, "Product not found")
+		return
+	}
+	if !render.IfMatch(r, productBody(r, enrichProduct(r.Context(), item))) {
+		render.PreconditionFailed(w, r)
+		return
+	}
+	if err := validateProduct(updatedProduct); err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	// Variants are managed through /products/{id}/variants. They are kept
+	// from the product as read, so without a version in the body the
+	// change is made against that one.
+	updatedProduct.Variants = item.Variants
+	keepPrice(r, &updatedProduct, item)
+	if updatedProduct.Version == 0 {
+		updatedProduct.Version = item.Version
+	}
 
-	for _, item := range products {
-		if item.ID == params["id"] {
-			ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-			defer cancel()
+	// Store the product before its stock: the catalog checks the version
+	// under its lock, so stock is only written for a change that stands
+	ctx := r.Context()
+	stored, err := catalog.UpdateProduct(params["id"], updatedProduct)
+	if err != nil {
+		catalogError(w, r, err)
+		return
+	}
 
-			resp, err := inventoryClient.CheckStock(ctx, &inventory_pb.StockRequest{ProductId: item.ID})
-			if err != nil {
-				log.Printf("Error checking stock for product %s: %v", params["id"], err)
-			}
+	stock, err := inventoryClient.UpdateStock(ctx, &inventory_pb.UpdateStockRequest{
+		ProductId:       params["id"],
+		Quantity:        updatedProduct.Quantity,
+		ExpectedVersion: updatedProduct.StockVersion,
+	})
+	if err != nil {
+		restoreProduct(ctx, item, stored.Version)
+		catalogError(w, r, err)
+		return
+	}
+	updatedProduct = stored
+	updatedProduct.StockVersion = stock.Version
+	reindex(params["id"])
+	render.Respond(w, r, http.StatusOK, productBody(r, Product(updatedProduct)))
+}
 
-			enrichedProduct := Product{
-				ID:       item.ID,
-				Name:     item.Name,
-				Price:    item.Price,
-				InStock:  resp.InStock,
-				Quantity: resp.Quantity,
-			}
+// PatchProduct changes part of a product, given as a merge patch or JSON
+// Patch against the product as GetProduct returns it. Stock is only written
+// when the patch touches quantity, and only if it has not changed since.
+func PatchProduct(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxPatchSize))
+	if err != nil {
+		render.Error(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	p, err := patch.Parse(r.Header.Get("Content-Type"), body)
+	if err != nil {
+		patchError(w, r, err)
+		return
+	}
+	if p.Touches("variants") {
+		render.Error(w, r, http.StatusUnprocessableEntity, "variants are managed through /products/{id}/variants")
+		return
+	}
+
+	item, ok := catalog.Product(params["id"])
+	if !ok {
+		render.Error(w, r, http.StatusNotFound, "Product not found")
+		return
+	}
+	ctx := r.Context()
+	current := productBody(r, enrichProduct(ctx, item))
+	if !render.IfMatch(r, current) {
+		render.PreconditionFailed(w, r)
+		return
+	}
+	doc, err := json.Marshal(current)
+	if err == nil {
+		doc, err = p.Apply(doc)
+	}
+	if err != nil {
+		patchError(w, r, err)
+		return
+	}
+	var patched model.Product
+	if err := decodeProductFrom(r, bytes.NewReader(doc), &patched); err != nil {
+		patchError(w, r, fmt.Errorf("%w: %v", patch.ErrUnprocessable, err))
+		return
+	}
+	if patched.ID != item.ID {
+		render.Error(w, r, http.StatusUnprocessableEntity, "product id cannot change")
+		return
+	}
+	if err := validateProduct(patched); err != nil {
+		render.Error(w, r, http.StatusUnprocessableEntity, err.Error())
+		return
+	}
+	patched.Variants = item.Variants
+	keepPrice(r, &patched, item)
+	// Unless the patch sets it, the version is the one the patch was
+	// applied to, so a concurrent change fails rather than being undone
+	if patched.Version != item.Version {
+		catalogError(w, r, store.ErrVersionConflict)
+		return
+	}
 
-			json.NewEncoder(w).Encode(enrichedProduct)
+	// Store the product before its stock, as UpdateProduct does
+	stored, err := catalog.UpdateProduct(item.ID, patched)
+	if err != nil {
+		catalogError(w, r, err)
+		return
+	}
+	if p.Touches("quantity") {
+		_, err := inventoryClient.UpdateStock(ctx, &inventory_pb.UpdateStockRequest{
+			ProductId:       item.ID,
+			Quantity:        patched.Quantity,
+			ExpectedVersion: patched.StockVersion,
+		})
+		if err != nil {
+			restoreProduct(ctx, item, stored.Version)
+			catalogError(w, r, err)
 			return
 		}
 	}
-	
-	json.NewEncoder(w).Encode(&Product{})
+	reindex(item.ID)
+	render.Respond(w, r, http.StatusOK, productBody(r, enrichProduct(ctx, stored)))
 }
 
-func CreateProduct(w http.ResponseWriter, r *http.Request) {
-    w.Header().Set("Content-Type", "application/json")
-    var product model.Product
-    json.NewDecoder(r.Body).Decode(&product)
-
-    // Add to inventory
-    ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-    defer cancel()
-    
-    _, err := inventoryClient.AddStock(ctx, &inventory_pb.AddStockRequest{
-        ProductId: product.ID,
-        Quantity: product.Quantity,
-    })
-    if err != nil {
-        http.Error(w, err.Error(), http.StatusInternalServerError)
-        return
-    }
-
-    products = append(products, product)
-    json.NewEncoder(w).Encode(product)
+// restoreProduct puts back a product as it was before an update whose stock
+// could not be written, unless the product has changed again since the
+// update stored version.
+func restoreProduct(ctx context.Context, previous model.Product, version int64) {
+	previous.Version = version
+	if _, err := catalog.UpdateProduct(previous.ID, previous); err != nil {
+		slog.ErrorContext(ctx, "cannot restore product after failed stock update", "product_id", previous.ID, "error", err)
+	}
 }
 
-func UpdateProduct(w http.ResponseWriter, r *http.Request) {
-    w.Header().Set("Content-Type", "application/json")
-    params := mux.Vars(r)
-    var updatedProduct model.Product
-    json.NewDecoder(r.Body).Decode(&updatedProduct)
-
-    for i, item := range products {
-        if item.ID == params["id"] {
-            // Update inventory
-            ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-            defer cancel()
-            
-            _, err := inventoryClient.UpdateStock(ctx, &inventory_pb.UpdateStockRequest{
-                ProductId: params["id"],
-                Quantity: updatedProduct.Quantity,
-            })
-            if err != nil {
-                http.Error(w, err.Error(), http.StatusInternalServerError)
-                return
-            }
-
-            products[i] = updatedProduct
-            json.NewEncoder(w).Encode(updatedProduct)
-            return
-        }
-    }
-    http.Error(w, "Product not found", http.StatusNotFound)
+// maxPatchSize limits the size of PATCH bodies.
+const maxPatchSize = 1 << 20
+
+// patchError answers a patch that cannot be read or applied, listing the
+// formats accepted when it is in neither.
+func patchError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, patch.ErrUnsupportedType) {
+		w.Header().Set("Accept-Patch", patch.Accepted)
+	}
+	render.Error(w, r, patch.Status(err), err.Error())
 }
 
 func DeleteProduct(w http.ResponseWriter, r *http.Request) {
-    w.Header().Set("Content-Type", "application/json")
-    params := mux.Vars(r)
-
-    for i, item := range products {
-        if item.ID == params["id"] {
-            // Delete from inventory
-            ctx, cancel := context.WithTimeout(context.Background(), time.Second)
-            defer cancel()
-            
-            _, err := inventoryClient.DeleteStock(ctx, &inventory_pb.StockRequest{
-                ProductId: params["id"],
-            })
-            if err != nil {
-                http.Error(w, err.Error(), http.StatusInternalServerError)
-                return
-            }
-
-            products = append(products[:i], products[i+1:]...)
-            w.WriteHeader(http.StatusNoContent)
-            return
-        }
-    }
-    http.Error(w, "Product not found", http.StatusNotFound)
-}
\ No newline at end of file
+	params := mux.Vars(r)
+
+	item, ok := catalog.Product(params["id"])
+	if !ok {
+		render.Error(w, r, http.StatusNotFound, "Product not found")
+		return
+	}
+
+	// Delete from inventory
+	ctx := r.Context()
+
+	_, err := inventoryClient.DeleteStock(ctx, &inventory_pb.StockRequest{
+		ProductId: params["id"],
+	})
+	if err != nil {
+		render.Error(w, r, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, variant := range item.Variants {
+		if _, err := inventoryClient.DeleteStock(ctx, &inventory_pb.StockRequest{ProductId: variant.SKU}); err != nil {
+			slog.WarnContext(ctx, "cannot delete variant stock", "sku", variant.SKU, "error", err)
+		}
+	}
+
+	catalog.DeleteProduct(params["id"])
+	metrics.SetCatalogSize(catalog.Len())
+	searchIndex.Remove(params["id"])
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,26 @@
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+var catalogSize = promauto.NewGauge(prometheus.GaugeOpts{
+	Name: "products_catalog_size",
+	Help: "Number of products currently in the catalog.",
+})
+
+var stockLookupFailures = promauto.NewCounter(prometheus.CounterOpts{
+	Name: "products_stock_lookup_failures_total",
+	Help: "Number of product reads served without stock because inventory-service failed.",
+})
+
+// SetCatalogSize records the current number of products.
+func SetCatalogSize(n int) {
+	catalogSize.Set(float64(n))
+}
+
+// StockLookupFailed counts a failed stock enrichment.
+func StockLookupFailed() {
+	stockLookupFailures.Inc()
+}
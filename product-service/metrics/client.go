@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"context"
+	"errors"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/status"
+)
+
+var grpcClientDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+	Name:    "grpc_client_handling_seconds",
+	Help:    "Latency of outbound gRPC calls, by method and status code.",
+	Buckets: prometheus.DefBuckets,
+}, []string{"method", "code"})
+
+// UnaryClientInterceptor records the latency of every outbound unary call.
+func UnaryClientInterceptor() grpc.UnaryClientInterceptor {
+	return func(ctx context.Context, method string, req, reply interface{}, cc *grpc.ClientConn, invoker grpc.UnaryInvoker, opts ...grpc.CallOption) error {
+		start := time.Now()
+		err := invoker(ctx, method, req, reply, cc, opts...)
+		grpcClientDuration.WithLabelValues(method, status.Code(err).String()).Observe(time.Since(start).Seconds())
+		return err
+	}
+}
+
+// StreamClientInterceptor records the latency of every outbound stream, from
+// its start until the caller receives how it ended.
+func StreamClientInterceptor() grpc.StreamClientInterceptor {
+	return func(ctx context.Context, desc *grpc.StreamDesc, cc *grpc.ClientConn, method string, streamer grpc.Streamer, opts ...grpc.CallOption) (grpc.ClientStream, error) {
+		start := time.Now()
+		observe := func(err error) {
+			grpcClientDuration.WithLabelValues(method, status.Code(err).String()).Observe(time.Since(start).Seconds())
+		}
+		stream, err := streamer(ctx, desc, cc, method, opts...)
+		if err != nil {
+			observe(err)
+			return nil, err
+		}
+		return &observedStream{ClientStream: stream, serverStreams: desc.ServerStreams, done: observe}, nil
+	}
+}
+
+// observedStream calls done once with the outcome of a client stream: nil
+// when the server ends it cleanly or the one response of a call without
+// server streaming arrives, otherwise the error RecvMsg returns.
+type observedStream struct {
+	grpc.ClientStream
+	serverStreams bool
+	once          sync.Once
+	done          func(error)
+}
+
+func (s *observedStream) RecvMsg(m interface{}) error {
+	err := s.ClientStream.RecvMsg(m)
+	switch {
+	case errors.Is(err, io.EOF):
+		s.once.Do(func() { s.done(nil) })
+	case err != nil || !s.serverStreams:
+		s.once.Do(func() { s.done(err) })
+	}
+	return err
+}
@@ -0,0 +1,49 @@
+package model
+
+import "fmt"
+
+// Attribute types.
+const (
+	AttributeString  = "string"
+	AttributeNumber  = "number"
+	AttributeBoolean = "boolean"
+)
+
+// Attribute is a typed product property. Once decoded from JSON, Value holds
+// a string, a float64 or a bool according to Type.
+type Attribute struct {
+	Type  string      `json:"type"`
+	Value interface{} `json:"value"`
+}
+
+// Validate checks that Value matches Type.
+func (a Attribute) Validate() error {
+	var ok bool
+	switch a.Type {
+	case AttributeString:
+		_, ok = a.Value.(string)
+	case AttributeNumber:
+		_, ok = a.Value.(float64)
+	case AttributeBoolean:
+		_, ok = a.Value.(bool)
+	default:
+		return fmt.Errorf("unknown attribute type %q", a.Type)
+	}
+	if !ok {
+		return fmt.Errorf("value %v is not a %s", a.Value, a.Type)
+	}
+	return nil
+}
+
+// ValidateAttributes validates every attribute of a set.
+func ValidateAttributes(attrs map[string]Attribute) error {
+	for name, attr := range attrs {
+		if name == "" {
+			return fmt.Errorf("attribute name must not be empty")
+		}
+		if err := attr.Validate(); err != nil {
+			return fmt.Errorf("attribute %q: %w", name, err)
+		}
+	}
+	return nil
+}
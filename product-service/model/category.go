@@ -0,0 +1,9 @@
+package model
+
+// Category groups products. Categories form a tree through ParentID; a
+// category without a parent is a root.
+type Category struct {
+	ID       string `json:"id"`
+	Name     string `json:"name"`
+	ParentID string `json:"parent_id,omitempty"`
+}
@@ -1,9 +1,72 @@
 package model
 
+import "product-service/money"
+
 type Product struct {
-	ID       string  `json:"id"`
-	Name     string  `json:"name"`
-	Price    float64 `json:"price"`
-	InStock  bool    `json:"in_stock"`
-	Quantity int32   `json:"quantity"`
-}
\ No newline at end of file
+	ID         string               `json:"id"`
+	Name       string               `json:"name"`
+	Price      money.Money          `json:"price"`
+	Prices     money.PriceList      `json:"prices,omitempty"`
+	InStock    bool                 `json:"in_stock"`
+	Quantity   int32                `json:"quantity"`
+	CategoryID string               `json:"category_id,omitempty"`
+	Attributes map[string]Attribute `json:"attributes,omitempty"`
+	Variants   []Variant            `json:"variants,omitempty"`
+	// Version counts the changes to the product, starting at 1. Sent back
+	// on an update, it must still be current.
+	Version int64 `json:"version"`
+	// StockVersion is the version of the product's stock in
+	// inventory-service, checked the same way when quantity is updated.
+	StockVersion int64 `json:"stock_version,omitempty"`
+}
+
+// Variant is a sellable version of a product, such as one size and colour.
+// Its SKU is unique across the catalog and keys its stock in
+// inventory-service. A variant without a price sells at the product's.
+type Variant struct {
+	SKU        string               `json:"sku"`
+	Name       string               `json:"name"`
+	Price      *money.Money         `json:"price,omitempty"`
+	Prices     money.PriceList      `json:"prices,omitempty"`
+	InStock    bool                 `json:"in_stock"`
+	Quantity   int32                `json:"quantity"`
+	Attributes map[string]Attribute `json:"attributes,omitempty"`
+	// StockVersion is the version of the variant's stock, as on Product.
+	StockVersion int64 `json:"stock_version,omitempty"`
+}
+
+// Variant returns the variant of p with the given SKU.
+func (p Product) Variant(sku string) (Variant, bool) {
+	for _, v := range p.Variants {
+		if v.SKU == sku {
+			return v, true
+		}
+	}
+	return Variant{}, false
+}
+
+// PriceIn returns the price of p in currency from its price list. Without
+// one it returns the base price, in whatever currency that is.
+func (p Product) PriceIn(currency string) money.Money {
+	if p.Price.Currency == currency {
+		return p.Price
+	}
+	if m, ok := p.Prices.In(currency); ok {
+		return m
+	}
+	return p.Price
+}
+
+// VariantPriceIn is PriceIn for one of the variants of p.
+func (p Product) VariantPriceIn(v Variant, currency string) money.Money {
+	if v.Price == nil {
+		return p.PriceIn(currency)
+	}
+	if v.Price.Currency == currency {
+		return *v.Price
+	}
+	if m, ok := v.Prices.In(currency); ok {
+		return m
+	}
+	return *v.Price
+}
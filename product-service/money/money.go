@@ -0,0 +1,132 @@
+// Package money represents amounts exactly, as an integer number of minor
+// units (cents for USD) in an ISO 4217 currency.
+package money
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+var ErrCurrencyMismatch = errors.New("currency mismatch")
+
+// exponents holds the number of minor unit digits of supported currencies.
+var exponents = map[string]int{
+	"AUD": 2, "BHD": 3, "CAD": 2, "CHF": 2, "CNY": 2, "EUR": 2, "GBP": 2,
+	"HKD": 2, "IDR": 2, "INR": 2, "JPY": 0, "KRW": 0, "KWD": 3, "NZD": 2,
+	"SGD": 2, "THB": 2, "USD": 2, "VND": 0,
+}
+
+// Exponent returns the number of minor unit digits of a currency.
+func Exponent(currency string) (int, error) {
+	exp, ok := exponents[currency]
+	if !ok {
+		return 0, fmt.Errorf("unsupported currency %q", currency)
+	}
+	return exp, nil
+}
+
+// Money is an amount in minor units of a currency. In JSON it reads
+// {"amount": 99999, "currency": "USD"} for 999.99 USD.
+type Money struct {
+	Amount   int64  `json:"amount"`
+	Currency string `json:"currency"`
+}
+
+func New(amount int64, currency string) Money {
+	return Money{Amount: amount, Currency: currency}
+}
+
+// Parse reads a decimal amount such as "999.99" in the given currency. It
+// rejects empty amounts and more fractional digits than the currency has.
+func Parse(amount, currency string) (Money, error) {
+	exp, err := Exponent(currency)
+	if err != nil {
+		return Money{}, err
+	}
+	whole, frac, _ := strings.Cut(amount, ".")
+	if strings.TrimLeft(whole, "+-") == "" && frac == "" {
+		return Money{}, fmt.Errorf("invalid amount %q", amount)
+	}
+	if len(frac) > exp {
+		return Money{}, fmt.Errorf("%s has at most %d decimal places", currency, exp)
+	}
+	digits := whole + frac + strings.Repeat("0", exp-len(frac))
+	n, err := strconv.ParseInt(digits, 10, 64)
+	if err != nil {
+		return Money{}, fmt.Errorf("invalid amount %q", amount)
+	}
+	return Money{Amount: n, Currency: currency}, nil
+}
+
+// Validate checks that the currency is supported and the amount is not
+// negative.
+func (m Money) Validate() error {
+	if _, err := Exponent(m.Currency); err != nil {
+		return err
+	}
+	if m.Amount < 0 {
+		return fmt.Errorf("amount must not be negative")
+	}
+	return nil
+}
+
+func (m Money) IsZero() bool {
+	return m.Amount == 0 && m.Currency == ""
+}
+
+// Add returns m+o. Both must be in the same currency.
+func (m Money) Add(o Money) (Money, error) {
+	if m.IsZero() {
+		return o, nil
+	}
+	if m.Currency != o.Currency {
+		return Money{}, fmt.Errorf("%w: %s and %s", ErrCurrencyMismatch, m.Currency, o.Currency)
+	}
+	sum := m.Amount + o.Amount
+	if (sum > m.Amount) != (o.Amount > 0) {
+		return Money{}, errors.New("amount overflows")
+	}
+	return Money{Amount: sum, Currency: m.Currency}, nil
+}
+
+// Mul returns m multiplied by a quantity.
+func (m Money) Mul(n int64) (Money, error) {
+	product := m.Amount * n
+	// -1 * MinInt64 wraps to MinInt64, which the division cannot catch
+	if m.Amount != 0 && (product/m.Amount != n || (m.Amount == -1 && n == math.MinInt64)) {
+		return Money{}, errors.New("amount overflows")
+	}
+	return Money{Amount: product, Currency: m.Currency}, nil
+}
+
+// Decimal formats the amount in major units, such as "999.99".
+func (m Money) Decimal() string {
+	exp, err := Exponent(m.Currency)
+	if err != nil || exp == 0 {
+		return strconv.FormatInt(m.Amount, 10)
+	}
+	// Formatted before the sign comes off, as -MinInt64 does not fit
+	s := strconv.FormatInt(m.Amount, 10)
+	sign := ""
+	if s[0] == '-' {
+		sign, s = "-", s[1:]
+	}
+	if len(s) <= exp {
+		s = strings.Repeat("0", exp+1-len(s)) + s
+	}
+	return sign + s[:len(s)-exp] + "." + s[len(s)-exp:]
+}
+
+// Float returns the amount in major units. It is for display and coarse
+// comparisons only, never for arithmetic.
+func (m Money) Float() float64 {
+	f, _ := strconv.ParseFloat(m.Decimal(), 64)
+	return f
+}
+
+func (m Money) String() string {
+	return m.Decimal() + " " + m.Currency
+}
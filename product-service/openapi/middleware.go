@@ -0,0 +1,263 @@
+package openapi
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log/slog"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"product-service/render"
+
+	"github.com/gorilla/mux"
+)
+
+// Validation modes for Middleware.
+const (
+	ModeOff     = "off"
+	ModeWarn    = "warn"
+	ModeEnforce = "enforce"
+)
+
+// maxBody bounds the request bodies read for validation; larger ones pass
+// unchecked.
+const maxBody = 10 << 20
+
+// ParseMode checks a validation mode from configuration.
+func ParseMode(mode string) (string, error) {
+	switch mode {
+	case ModeOff, ModeWarn, ModeEnforce:
+		return mode, nil
+	}
+	return "", fmt.Errorf("unknown OpenAPI validation mode %q (want off, warn or enforce)", mode)
+}
+
+// Middleware checks requests and responses of the matched route against the
+// document. In warn mode mismatches are only logged. In enforce mode a
+// request that does not match is answered with 400 before it reaches the
+// handler, and a JSON response that does not match is replaced by a 500, so
+// that drift fails loudly in development and tests. JSON responses are
+// buffered for the check; other responses, such as plain-text errors and
+// streams, are passed through and only their status is checked.
+func (d *Document) Middleware(mode string) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		if mode == ModeOff {
+			return next
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			path, op := d.route(r)
+			if op == nil {
+				slog.WarnContext(r.Context(), "operation not in API description", "method", r.Method, "path", path)
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			if problems := d.checkRequest(r, path, op); len(problems) > 0 {
+				slog.WarnContext(r.Context(), "request does not match API description",
+					"operation", op.OperationID, "problems", problems)
+				if mode == ModeEnforce {
+					render.Error(w, r, http.StatusBadRequest, "request does not match the API description: "+strings.Join(problems, "; "))
+					return
+				}
+			}
+
+			rec := &recorder{ResponseWriter: w, status: http.StatusOK}
+			next.ServeHTTP(rec, r)
+
+			if problems := d.checkResponse(op, rec); len(problems) > 0 {
+				slog.ErrorContext(r.Context(), "response does not match API description",
+					"operation", op.OperationID, "status", rec.status, "problems", problems)
+				if mode == ModeEnforce && rec.buffer {
+					w.Header().Del("Content-Length")
+					render.Error(w, r, http.StatusInternalServerError, "response does not match the API description: "+strings.Join(problems, "; "))
+					return
+				}
+			}
+			if rec.buffer {
+				w.WriteHeader(rec.status)
+				w.Write(rec.body.Bytes())
+			}
+		})
+	}
+}
+
+// route returns the path describing the matched route and its operation, if
+// the document describes it.
+func (d *Document) route(r *http.Request) (string, *Operation) {
+	route := mux.CurrentRoute(r)
+	if route == nil {
+		return r.URL.Path, nil
+	}
+	path, err := route.GetPathTemplate()
+	if err != nil {
+		return r.URL.Path, nil
+	}
+	return d.find(path, r.Method)
+}
+
+func (d *Document) checkRequest(r *http.Request, path string, op *Operation) []string {
+	var problems []string
+	vars := mux.Vars(r)
+	query := r.URL.Query()
+	for _, p := range d.parameters(path, op) {
+		var raw string
+		var present bool
+		switch p.In {
+		case "path":
+			raw, present = vars[p.Name]
+		case "query":
+			raw, present = query.Get(p.Name), query.Has(p.Name)
+			// Arrays are sent in form style, repeating the parameter
+			// for each item
+			if s := d.schema(p.Schema); present && s != nil && s.Type == "array" {
+				items := make([]any, 0, len(query[p.Name]))
+				for _, v := range query[p.Name] {
+					items = append(items, d.parse(s.Items, v))
+				}
+				problems = append(problems, d.validate(p.Schema, items, p.In+"."+p.Name)...)
+				continue
+			}
+		case "header":
+			raw = r.Header.Get(p.Name)
+			present = raw != ""
+		default:
+			continue
+		}
+		if !present {
+			if p.Required {
+				problems = append(problems, fmt.Sprintf("missing %s parameter %q", p.In, p.Name))
+			}
+			continue
+		}
+		problems = append(problems, d.validate(p.Schema, d.parse(p.Schema, raw), p.In+"."+p.Name)...)
+	}
+
+	if op.RequestBody == nil || r.Body == nil {
+		return problems
+	}
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxBody))
+	// The handler reads what was checked followed by the rest
+	r.Body = struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(bytes.NewReader(body), r.Body), r.Body}
+	if err != nil {
+		return append(problems, "cannot read request body: "+err.Error())
+	}
+	if len(body) == maxBody {
+		// Too large to check
+		return problems
+	}
+	if len(bytes.TrimSpace(body)) == 0 {
+		if op.RequestBody.Required {
+			problems = append(problems, "missing request body")
+		}
+		return problems
+	}
+	// Clients such as curl label JSON bodies as form data unless told
+	// otherwise, and the handlers decode the body regardless, so an
+	// unlisted content type is read as JSON when JSON is accepted.
+	media, ok := op.RequestBody.Content[mediaType(r.Header.Get("Content-Type"))]
+	if !ok {
+		media, ok = op.RequestBody.Content["application/json"]
+	}
+	if !ok {
+		return append(problems, fmt.Sprintf("request Content-Type %q is not accepted", r.Header.Get("Content-Type")))
+	}
+	return append(problems, d.checkJSON(media, body, "body")...)
+}
+
+func (d *Document) checkResponse(op *Operation, rec *recorder) []string {
+	resp, ok := op.Responses[strconv.Itoa(rec.status)]
+	if !ok {
+		resp, ok = op.Responses[fmt.Sprintf("%dXX", rec.status/100)]
+	}
+	if !ok {
+		resp, ok = op.Responses["default"]
+	}
+	if !ok {
+		return []string{fmt.Sprintf("status %d is not described", rec.status)}
+	}
+	resp = d.response(resp)
+
+	contentType := rec.Header().Get("Content-Type")
+	if len(resp.Content) == 0 {
+		if contentType != "" || rec.body.Len() > 0 {
+			return []string{fmt.Sprintf("status %d is described without a body but has Content-Type %q", rec.status, contentType)}
+		}
+		return nil
+	}
+	media, ok := resp.Content[mediaType(contentType)]
+	if !ok {
+		return []string{fmt.Sprintf("response Content-Type %q is not described for status %d", contentType, rec.status)}
+	}
+	if !rec.buffer {
+		return nil
+	}
+	return d.checkJSON(media, rec.body.Bytes(), "body")
+}
+
+func (d *Document) checkJSON(media *MediaType, body []byte, at string) []string {
+	if media.Schema == nil {
+		return nil
+	}
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return []string{at + ": invalid JSON: " + err.Error()}
+	}
+	return d.validate(media.Schema, v, at)
+}
+
+func mediaType(contentType string) string {
+	typ, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return contentType
+	}
+	return typ
+}
+
+// recorder holds back JSON responses until they have been checked and passes
+// anything else straight through.
+type recorder struct {
+	http.ResponseWriter
+	status      int
+	buffer      bool
+	body        bytes.Buffer
+	wroteHeader bool
+}
+
+func (r *recorder) WriteHeader(status int) {
+	if r.wroteHeader {
+		return
+	}
+	r.wroteHeader = true
+	r.status = status
+	r.buffer = mediaType(r.Header().Get("Content-Type")) == "application/json"
+	if !r.buffer {
+		r.ResponseWriter.WriteHeader(status)
+	}
+}
+
+func (r *recorder) Write(b []byte) (int, error) {
+	if !r.wroteHeader {
+		r.WriteHeader(http.StatusOK)
+	}
+	if r.buffer {
+		return r.body.Write(b)
+	}
+	return r.ResponseWriter.Write(b)
+}
+
+// Flush passes through for unbuffered responses so that streams keep
+// streaming.
+func (r *recorder) Flush() {
+	if !r.buffer {
+		http.NewResponseController(r.ResponseWriter).Flush()
+	}
+}
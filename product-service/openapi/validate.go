@@ -0,0 +1,182 @@
+package openapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/url"
+	"slices"
+	"sort"
+	"strconv"
+	"time"
+	"unicode/utf8"
+)
+
+// validate checks a decoded JSON value, with numbers as json.Number, against
+// a schema and returns one message per violation, each prefixed with the
+// location of the offending value.
+func (d *Document) validate(s *Schema, v any, at string) []string {
+	s = d.schema(s)
+	if s == nil {
+		return nil
+	}
+	if v == nil {
+		if s.Nullable || s.Type == "" {
+			return nil
+		}
+		return []string{at + ": must not be null"}
+	}
+	if len(s.Enum) > 0 && !slices.ContainsFunc(s.Enum, func(e any) bool { return equal(e, v) }) {
+		return []string{fmt.Sprintf("%s: %v is not one of %v", at, v, s.Enum)}
+	}
+
+	switch s.Type {
+	case "":
+		return nil
+	case "string":
+		str, ok := v.(string)
+		if !ok {
+			return []string{at + ": must be a string"}
+		}
+		return d.validateString(s, str, at)
+	case "integer", "number":
+		n, ok := v.(json.Number)
+		if !ok {
+			return []string{at + ": must be a " + s.Type}
+		}
+		return validateNumber(s, n, at)
+	case "boolean":
+		if _, ok := v.(bool); !ok {
+			return []string{at + ": must be a boolean"}
+		}
+		return nil
+	case "array":
+		items, ok := v.([]any)
+		if !ok {
+			return []string{at + ": must be an array"}
+		}
+		var errs []string
+		if s.MinItems != nil && len(items) < *s.MinItems {
+			errs = append(errs, fmt.Sprintf("%s: must have at least %d items", at, *s.MinItems))
+		}
+		if s.MaxItems != nil && len(items) > *s.MaxItems {
+			errs = append(errs, fmt.Sprintf("%s: must have at most %d items", at, *s.MaxItems))
+		}
+		for i, item := range items {
+			errs = append(errs, d.validate(s.Items, item, fmt.Sprintf("%s[%d]", at, i))...)
+		}
+		return errs
+	case "object":
+		obj, ok := v.(map[string]any)
+		if !ok {
+			return []string{at + ": must be an object"}
+		}
+		return d.validateObject(s, obj, at)
+	default:
+		return []string{fmt.Sprintf("%s: unknown schema type %q", at, s.Type)}
+	}
+}
+
+func (d *Document) validateString(s *Schema, str, at string) []string {
+	var errs []string
+	n := utf8.RuneCountInString(str)
+	if s.MinLength != nil && n < *s.MinLength {
+		errs = append(errs, fmt.Sprintf("%s: must be at least %d characters", at, *s.MinLength))
+	}
+	if s.MaxLength != nil && n > *s.MaxLength {
+		errs = append(errs, fmt.Sprintf("%s: must be at most %d characters", at, *s.MaxLength))
+	}
+	switch s.Format {
+	case "date-time":
+		if _, err := time.Parse(time.RFC3339Nano, str); err != nil {
+			errs = append(errs, at+": must be an RFC 3339 date-time")
+		}
+	case "uri":
+		if u, err := url.Parse(str); err != nil || u.Scheme == "" || u.Host == "" {
+			errs = append(errs, at+": must be an absolute URI")
+		}
+	}
+	return errs
+}
+
+func validateNumber(s *Schema, n json.Number, at string) []string {
+	f, err := n.Float64()
+	if err != nil {
+		return []string{at + ": must be a number"}
+	}
+	var errs []string
+	if s.Type == "integer" {
+		i, err := strconv.ParseInt(n.String(), 10, 64)
+		if err != nil {
+			return []string{at + ": must be an integer"}
+		}
+		if s.Format == "int32" && (i < math.MinInt32 || i > math.MaxInt32) {
+			errs = append(errs, at+": must fit in 32 bits")
+		}
+	}
+	if s.Minimum != nil && f < *s.Minimum {
+		errs = append(errs, fmt.Sprintf("%s: must be at least %v", at, *s.Minimum))
+	}
+	if s.Maximum != nil && f > *s.Maximum {
+		errs = append(errs, fmt.Sprintf("%s: must be at most %v", at, *s.Maximum))
+	}
+	return errs
+}
+
+func (d *Document) validateObject(s *Schema, obj map[string]any, at string) []string {
+	var errs []string
+	for _, name := range s.Required {
+		if _, ok := obj[name]; !ok {
+			errs = append(errs, fmt.Sprintf("%s: missing property %q", at, name))
+		}
+	}
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		if prop, ok := s.Properties[name]; ok {
+			errs = append(errs, d.validate(prop, obj[name], at+"."+name)...)
+			continue
+		}
+		switch extra := s.AdditionalProperties; {
+		case extra == nil:
+		case !extra.Allowed:
+			errs = append(errs, fmt.Sprintf("%s: unknown property %q", at, name))
+		case extra.Schema != nil:
+			errs = append(errs, d.validate(extra.Schema, obj[name], at+"."+name)...)
+		}
+	}
+	return errs
+}
+
+// parse converts a path, query or header parameter to the JSON value its
+// schema describes, so that it can be validated like a body.
+func (d *Document) parse(s *Schema, raw string) any {
+	s = d.schema(s)
+	if s == nil {
+		return raw
+	}
+	switch s.Type {
+	case "integer", "number":
+		if _, err := strconv.ParseFloat(raw, 64); err == nil {
+			return json.Number(raw)
+		}
+	case "boolean":
+		if b, err := strconv.ParseBool(raw); err == nil {
+			return b
+		}
+	}
+	return raw
+}
+
+// equal compares an enum value from the document with a decoded value.
+func equal(e, v any) bool {
+	if n, ok := v.(json.Number); ok {
+		f, err := n.Float64()
+		ef, isNumber := e.(float64)
+		return err == nil && isNumber && f == ef
+	}
+	return e == v
+}
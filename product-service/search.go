@@ -0,0 +1,113 @@
+package main
+
+import (
+	"net/http"
+	"product-service/model"
+	"product-service/render"
+	"product-service/search"
+	"sort"
+	"strconv"
+)
+
+var searchIndex *search.Index
+
+// reindex brings the search index in line with the catalog for one product.
+func reindex(id string) {
+	if product, ok := catalog.Product(id); ok {
+		searchIndex.Add(product)
+		return
+	}
+	searchIndex.Remove(id)
+}
+
+type SearchResult struct {
+	Product
+	Score float64 `json:"score"`
+}
+
+type SearchResponse struct {
+	Query   string         `json:"query"`
+	Total   int            `json:"total"`
+	Results []SearchResult `json:"results"`
+	Facets  search.Facets  `json:"facets"`
+}
+
+// SearchProducts serves GET /products/search?q=. Results are ranked by
+// relevance, then by stock on hand, and can be narrowed with category and
+// price_band, the band of the price in the base currency. Facets are counted
+// before narrowing.
+func SearchProducts(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	q := query.Get("q")
+	if q == "" {
+		render.Error(w, r, http.StatusBadRequest, "missing query parameter q")
+		return
+	}
+	limit := 20
+	if l := query.Get("limit"); l != "" {
+		n, err := strconv.Atoi(l)
+		if err != nil || n <= 0 {
+			render.Error(w, r, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		limit = n
+	}
+
+	hits := searchIndex.Search(q)
+	facets := searchIndex.Facets(hits)
+
+	var inCategory map[string]bool
+	if category := query.Get("category"); category != "" {
+		inCategory = make(map[string]bool)
+		for _, p := range catalog.ProductsInCategory(category) {
+			inCategory[p.ID] = true
+		}
+	}
+	band := query.Get("price_band")
+
+	var matches []model.Product
+	var scores []float64
+	for _, hit := range hits {
+		product, ok := catalog.Product(hit.ID)
+		if !ok {
+			continue
+		}
+		if inCategory != nil && !inCategory[product.ID] {
+			continue
+		}
+		if band != "" {
+			if b, ok := searchIndex.PriceBand(product.ID); !ok || b != band {
+				continue
+			}
+		}
+		matches = append(matches, product)
+		scores = append(scores, hit.Score)
+	}
+	// Stock breaks ties, so it is read for every match, in one call
+	results := make([]SearchResult, 0, len(matches))
+	for i, product := range enrichProducts(r.Context(), matches) {
+		results = append(results, SearchResult{Product: product, Score: scores[i]})
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		if results[i].Score != results[j].Score {
+			return results[i].Score > results[j].Score
+		}
+		return stockOnHand(results[i].Product) > stockOnHand(results[j].Product)
+	})
+
+	resp := SearchResponse{Query: q, Total: len(results), Facets: facets}
+	if len(results) > limit {
+		results = results[:limit]
+	}
+	resp.Results = results
+	render.Respond(w, r, http.StatusOK, searchBody(r, resp))
+}
+
+// stockOnHand is the quantity of a product plus that of its variants.
+func stockOnHand(p Product) int32 {
+	total := p.Quantity
+	for _, v := range p.Variants {
+		total += v.Quantity
+	}
+	return total
+}
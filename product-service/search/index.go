@@ -0,0 +1,281 @@
+// Package search keeps an in-memory inverted index over the product catalog.
+package search
+
+import (
+	"fmt"
+	"product-service/model"
+	"product-service/money"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Field weights: a hit in the product name counts more than one in its
+// attributes or variants.
+const (
+	nameWeight  = 3
+	otherWeight = 1
+)
+
+// Match quality relative to an exact term match.
+const (
+	prefixScore = 0.75
+	typoScore   = 0.5
+)
+
+// Hit is a product matching a query.
+type Hit struct {
+	ID    string
+	Score float64
+}
+
+type document struct {
+	terms    map[string]int
+	category string
+	band     string // empty if the price cannot be put in the base currency
+}
+
+// Index maps terms to the products containing them. It is safe for
+// concurrent use.
+type Index struct {
+	mu       sync.RWMutex
+	postings map[string]map[string]int
+	docs     map[string]document
+	terms    []string // sorted, for prefix lookups
+	rates    *money.Rates
+}
+
+// NewIndex returns an empty index that puts products in price bands by their
+// price in the base currency of rates.
+func NewIndex(rates *money.Rates) *Index {
+	return &Index{
+		postings: make(map[string]map[string]int),
+		docs:     make(map[string]document),
+		rates:    rates,
+	}
+}
+
+// Add indexes a product, replacing any earlier version of it.
+func (idx *Index) Add(p model.Product) {
+	terms := make(map[string]int)
+	addText(terms, p.Name, nameWeight)
+	addText(terms, p.CategoryID, otherWeight)
+	addAttributes(terms, p.Attributes)
+	for _, v := range p.Variants {
+		addText(terms, v.Name, otherWeight)
+		addText(terms, v.SKU, otherWeight)
+		addAttributes(terms, v.Attributes)
+	}
+
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(p.ID)
+	idx.docs[p.ID] = document{terms: terms, category: p.CategoryID, band: idx.band(p)}
+	for term, weight := range terms {
+		posting, ok := idx.postings[term]
+		if !ok {
+			posting = make(map[string]int)
+			idx.postings[term] = posting
+			i := sort.SearchStrings(idx.terms, term)
+			idx.terms = append(idx.terms, "")
+			copy(idx.terms[i+1:], idx.terms[i:])
+			idx.terms[i] = term
+		}
+		posting[p.ID] = weight
+	}
+}
+
+// Remove drops a product from the index.
+func (idx *Index) Remove(id string) {
+	idx.mu.Lock()
+	defer idx.mu.Unlock()
+	idx.remove(id)
+}
+
+func (idx *Index) remove(id string) {
+	doc, ok := idx.docs[id]
+	if !ok {
+		return
+	}
+	delete(idx.docs, id)
+	for term := range doc.terms {
+		posting := idx.postings[term]
+		delete(posting, id)
+		if len(posting) == 0 {
+			delete(idx.postings, term)
+			i := sort.SearchStrings(idx.terms, term)
+			idx.terms = append(idx.terms[:i], idx.terms[i+1:]...)
+		}
+	}
+}
+
+// Search returns the products matching every token of the query, best
+// first. Tokens match indexed terms exactly, as a prefix, or within a few
+// typos depending on their length.
+func (idx *Index) Search(query string) []Hit {
+	tokens := Tokenize(query)
+	if len(tokens) == 0 {
+		return nil
+	}
+
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+
+	var scores map[string]float64
+	for _, token := range tokens {
+		tokenScores := make(map[string]float64)
+		for term, quality := range idx.expand(token) {
+			for id, weight := range idx.postings[term] {
+				// Count the best matching term per token and product
+				tokenScores[id] = max(tokenScores[id], quality*float64(weight))
+			}
+		}
+		if scores == nil {
+			scores = tokenScores
+			continue
+		}
+		for id := range scores {
+			if s, ok := tokenScores[id]; ok {
+				scores[id] += s
+			} else {
+				delete(scores, id)
+			}
+		}
+	}
+
+	hits := make([]Hit, 0, len(scores))
+	for id, score := range scores {
+		hits = append(hits, Hit{ID: id, Score: score})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Score != hits[j].Score {
+			return hits[i].Score > hits[j].Score
+		}
+		return hits[i].ID < hits[j].ID
+	})
+	return hits
+}
+
+// expand returns the indexed terms a query token matches, with the quality
+// of each match.
+func (idx *Index) expand(token string) map[string]float64 {
+	matches := make(map[string]float64)
+	if _, ok := idx.postings[token]; ok {
+		matches[token] = 1
+	}
+	if len(token) >= 2 {
+		for i := sort.SearchStrings(idx.terms, token); i < len(idx.terms) && strings.HasPrefix(idx.terms[i], token); i++ {
+			if idx.terms[i] != token {
+				matches[idx.terms[i]] = prefixScore
+			}
+		}
+	}
+	if typos := maxTypos(token); typos > 0 {
+		for _, term := range idx.terms {
+			if _, ok := matches[term]; ok {
+				continue
+			}
+			if d := distance(token, term, typos); d <= typos {
+				matches[term] = typoScore / float64(d)
+			}
+		}
+	}
+	return matches
+}
+
+// PriceBand is a half-open range [Min, Max) of prices in major units of the
+// base currency. A zero Max means unbounded.
+type PriceBand struct {
+	Name string
+	Min  float64
+	Max  float64
+}
+
+// PriceBands are the bands used for price facets.
+var PriceBands = []PriceBand{
+	{Name: "under-25", Max: 25},
+	{Name: "25-100", Min: 25, Max: 100},
+	{Name: "100-500", Min: 100, Max: 500},
+	{Name: "500-and-over", Min: 500},
+}
+
+// Band returns the price band a price in the base currency falls into.
+func Band(price float64) string {
+	for _, b := range PriceBands {
+		if price >= b.Min && (b.Max == 0 || price < b.Max) {
+			return b.Name
+		}
+	}
+	return PriceBands[0].Name
+}
+
+// band returns the price band of a product: that of its price in the base
+// currency, taken from its price list if it has one there and converted
+// otherwise. It is empty if there is no rate for the product's currency.
+func (idx *Index) band(p model.Product) string {
+	base := idx.rates.Base()
+	price := p.Price
+	if price.Currency != base {
+		if m, ok := p.Prices.In(base); ok {
+			price = m
+		} else if converted, err := idx.rates.Convert(price, base); err == nil {
+			price = converted
+		} else {
+			return ""
+		}
+	}
+	return Band(price.Float())
+}
+
+// PriceBand returns the price band of an indexed product, and false if it
+// is not indexed or has no band.
+func (idx *Index) PriceBand(id string) (string, bool) {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	doc, ok := idx.docs[id]
+	return doc.band, ok && doc.band != ""
+}
+
+// Facets counts search hits by category and price band.
+type Facets struct {
+	Category  map[string]int `json:"category"`
+	PriceBand map[string]int `json:"price_band"`
+}
+
+// Facets counts the given hits. Products without a category are counted
+// under "none"; those without a price band are not counted by band.
+func (idx *Index) Facets(hits []Hit) Facets {
+	idx.mu.RLock()
+	defer idx.mu.RUnlock()
+	f := Facets{Category: make(map[string]int), PriceBand: make(map[string]int)}
+	for _, hit := range hits {
+		doc, ok := idx.docs[hit.ID]
+		if !ok {
+			continue
+		}
+		category := doc.category
+		if category == "" {
+			category = "none"
+		}
+		f.Category[category]++
+		if doc.band != "" {
+			f.PriceBand[doc.band]++
+		}
+	}
+	return f
+}
+
+func addText(terms map[string]int, text string, weight int) {
+	for _, token := range Tokenize(text) {
+		terms[token] = max(terms[token], weight)
+	}
+}
+
+func addAttributes(terms map[string]int, attrs map[string]model.Attribute) {
+	for name, attr := range attrs {
+		addText(terms, name, otherWeight)
+		if attr.Type == model.AttributeString {
+			addText(terms, fmt.Sprint(attr.Value), otherWeight)
+		}
+	}
+}
@@ -0,0 +1,318 @@
+package store
+
+import (
+	"errors"
+	"product-service/events"
+	"product-service/model"
+	"sync"
+)
+
+var (
+	ErrNotFound = errors.New("not found")
+	ErrExists   = errors.New("already exists")
+	ErrInUse    = errors.New("still in use")
+	ErrCycle    = errors.New("category would become its own ancestor")
+	// ErrVersionConflict rejects a change made against an old version.
+	ErrVersionConflict = errors.New("product has changed since the given version")
+	// ErrIDChange rejects a replacement carrying another product's ID.
+	ErrIDChange = errors.New("product id cannot change")
+)
+
+// Catalog holds products and categories in memory. It is shared by the HTTP
+// handlers and the gRPC server, so every access goes through its lock.
+type Catalog struct {
+	mu         sync.RWMutex
+	products   []model.Product
+	categories []model.Category
+	outbox     *events.Outbox
+	// reservedIDs and reservedSKUs are held by Reservations
+	reservedIDs  map[string]bool
+	reservedSKUs map[string]bool
+}
+
+// NewCatalog returns an empty catalog that records its domain events in
+// outbox, which may be nil.
+func NewCatalog(outbox *events.Outbox) *Catalog {
+	return &Catalog{
+		outbox:       outbox,
+		reservedIDs:  make(map[string]bool),
+		reservedSKUs: make(map[string]bool),
+	}
+}
+
+// Products returns a snapshot of all products.
+func (c *Catalog) Products() []model.Product {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]model.Product(nil), c.products...)
+}
+
+// Len returns the number of products.
+func (c *Catalog) Len() int {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return len(c.products)
+}
+
+func (c *Catalog) Product(id string) (model.Product, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	i := c.productIndex(id)
+	if i < 0 {
+		return model.Product{}, false
+	}
+	return c.products[i], true
+}
+
+// ProductBySKU returns the product owning the variant with the given SKU.
+func (c *Catalog) ProductBySKU(sku string) (model.Product, model.Variant, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	for _, p := range c.products {
+		if v, ok := p.Variant(sku); ok {
+			return p, v, true
+		}
+	}
+	return model.Product{}, model.Variant{}, false
+}
+
+// CanAdd reports whether AddProduct would currently accept p.
+func (c *Catalog) CanAdd(p model.Product) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.productIndex(p.ID) >= 0 || c.reservedIDs[p.ID] {
+		return ErrExists
+	}
+	return c.checkProduct(p, "")
+}
+
+// CanUpdate reports whether UpdateProduct would currently accept p as a
+// replacement for the product with its ID.
+func (c *Catalog) CanUpdate(p model.Product) error {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	i := c.productIndex(p.ID)
+	if i < 0 {
+		return ErrNotFound
+	}
+	if p.Version != 0 && p.Version != c.products[i].Version {
+		return ErrVersionConflict
+	}
+	return c.checkProduct(p, p.ID)
+}
+
+// AddProduct stores p at version 1 and records ProductCreated.
+func (c *Catalog) AddProduct(p model.Product) (model.Product, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.addProduct(p)
+}
+
+func (c *Catalog) addProduct(p model.Product) (model.Product, error) {
+	if c.productIndex(p.ID) >= 0 || c.reservedIDs[p.ID] {
+		return model.Product{}, ErrExists
+	}
+	if err := c.checkProduct(p, ""); err != nil {
+		return model.Product{}, err
+	}
+	p.Version = 1
+	if err := c.outbox.Record(events.ProductCreated, p.ID, p); err != nil {
+		return model.Product{}, err
+	}
+	c.products = append(c.products, p)
+	return p, nil
+}
+
+// Reservation holds the ID and SKUs of a product about to be added, so that
+// what is stored with it elsewhere, such as its stock, can be written first
+// without another product taking them meanwhile.
+type Reservation struct {
+	c       *Catalog
+	product model.Product
+	done    bool
+}
+
+// Reserve checks that AddProduct would accept p, as CanAdd does, and holds
+// its ID and SKUs until the reservation is added or released.
+func (c *Catalog) Reserve(p model.Product) (*Reservation, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.productIndex(p.ID) >= 0 || c.reservedIDs[p.ID] {
+		return nil, ErrExists
+	}
+	if err := c.checkProduct(p, ""); err != nil {
+		return nil, err
+	}
+	c.reservedIDs[p.ID] = true
+	for _, v := range p.Variants {
+		c.reservedSKUs[v.SKU] = true
+	}
+	return &Reservation{c: c, product: p}, nil
+}
+
+// Add stores the reserved product as AddProduct does and ends the
+// reservation, whether or not the product could be stored.
+func (r *Reservation) Add() (model.Product, error) {
+	r.c.mu.Lock()
+	defer r.c.mu.Unlock()
+	if r.done {
+		return model.Product{}, ErrNotFound
+	}
+	r.release()
+	return r.c.addProduct(r.product)
+}
+
+// Release ends the reservation without storing the product. It does
+// nothing once the reservation has ended.
+func (r *Reservation) Release() {
+	r.c.mu.Lock()
+	defer r.c.mu.Unlock()
+	r.release()
+}
+
+func (r *Reservation) release() {
+	if r.done {
+		return
+	}
+	r.done = true
+	delete(r.c.reservedIDs, r.product.ID)
+	for _, v := range r.product.Variants {
+		delete(r.c.reservedSKUs, v.SKU)
+	}
+}
+
+// UpdateProduct replaces the product stored under id, which p must keep. A
+// non-zero p.Version is the version the change was made against, and must
+// still be current.
+func (c *Catalog) UpdateProduct(id string, p model.Product) (model.Product, error) {
+	if p.ID != id {
+		return model.Product{}, ErrIDChange
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.productIndex(id)
+	if i < 0 {
+		return model.Product{}, ErrNotFound
+	}
+	if p.Version != 0 && p.Version != c.products[i].Version {
+		return model.Product{}, ErrVersionConflict
+	}
+	if err := c.checkProduct(p, id); err != nil {
+		return model.Product{}, err
+	}
+	p.Version = c.products[i].Version + 1
+	c.products[i] = p
+	return p, nil
+}
+
+func (c *Catalog) DeleteProduct(id string) (model.Product, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.productIndex(id)
+	if i < 0 {
+		return model.Product{}, ErrNotFound
+	}
+	p := c.products[i]
+	c.products = append(c.products[:i], c.products[i+1:]...)
+	return p, nil
+}
+
+// AddVariant appends a variant to a product.
+func (c *Catalog) AddVariant(productID string, v model.Variant) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.productIndex(productID)
+	if i < 0 {
+		return ErrNotFound
+	}
+	if c.skuTaken(v.SKU, "") {
+		return ErrExists
+	}
+	p := c.products[i]
+	p.Variants = append(append([]model.Variant(nil), p.Variants...), v)
+	p.Version++
+	c.products[i] = p
+	return nil
+}
+
+// UpdateVariant replaces the variant of a product with the given SKU.
+func (c *Catalog) UpdateVariant(productID, sku string, v model.Variant) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.productIndex(productID)
+	if i < 0 {
+		return ErrNotFound
+	}
+	p := c.products[i]
+	for j := range p.Variants {
+		if p.Variants[j].SKU == sku {
+			p.Variants = append([]model.Variant(nil), p.Variants...)
+			p.Variants[j] = v
+			p.Version++
+			c.products[i] = p
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+// DeleteVariant removes the variant of a product with the given SKU.
+func (c *Catalog) DeleteVariant(productID, sku string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.productIndex(productID)
+	if i < 0 {
+		return ErrNotFound
+	}
+	p := c.products[i]
+	for j := range p.Variants {
+		if p.Variants[j].SKU == sku {
+			variants := append([]model.Variant(nil), p.Variants[:j]...)
+			p.Variants = append(variants, p.Variants[j+1:]...)
+			p.Version++
+			c.products[i] = p
+			return nil
+		}
+	}
+	return ErrNotFound
+}
+
+func (c *Catalog) productIndex(id string) int {
+	for i, p := range c.products {
+		if p.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+// checkProduct verifies that p references an existing category and that its
+// SKUs are unique, ignoring the product being replaced.
+func (c *Catalog) checkProduct(p model.Product, replacing string) error {
+	if p.CategoryID != "" && c.categoryIndex(p.CategoryID) < 0 {
+		return ErrNotFound
+	}
+	seen := make(map[string]bool, len(p.Variants))
+	for _, v := range p.Variants {
+		if seen[v.SKU] || c.skuTaken(v.SKU, replacing) {
+			return ErrExists
+		}
+		seen[v.SKU] = true
+	}
+	return nil
+}
+
+func (c *Catalog) skuTaken(sku, exceptProduct string) bool {
+	if c.reservedSKUs[sku] {
+		return true
+	}
+	for _, p := range c.products {
+		if p.ID == exceptProduct {
+			continue
+		}
+		if _, ok := p.Variant(sku); ok {
+			return true
+		}
+	}
+	return false
+}
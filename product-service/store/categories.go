@@ -0,0 +1,140 @@
+package store
+
+import "product-service/model"
+
+// Categories returns a snapshot of all categories.
+func (c *Catalog) Categories() []model.Category {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	return append([]model.Category(nil), c.categories...)
+}
+
+func (c *Catalog) Category(id string) (model.Category, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	i := c.categoryIndex(id)
+	if i < 0 {
+		return model.Category{}, false
+	}
+	return c.categories[i], true
+}
+
+// AddCategory stores a category under an existing parent, or as a root.
+func (c *Catalog) AddCategory(cat model.Category) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.categoryIndex(cat.ID) >= 0 {
+		return ErrExists
+	}
+	if cat.ParentID != "" && c.categoryIndex(cat.ParentID) < 0 {
+		return ErrNotFound
+	}
+	if cat.ParentID == cat.ID {
+		return ErrCycle
+	}
+	c.categories = append(c.categories, cat)
+	return nil
+}
+
+// UpdateCategory replaces a category, refusing to move it under one of its
+// own descendants.
+func (c *Catalog) UpdateCategory(id string, cat model.Category) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.categoryIndex(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	cat.ID = id
+	if cat.ParentID != "" {
+		if c.categoryIndex(cat.ParentID) < 0 {
+			return ErrNotFound
+		}
+		for _, d := range c.descendants(id) {
+			if d == cat.ParentID {
+				return ErrCycle
+			}
+		}
+	}
+	c.categories[i] = cat
+	return nil
+}
+
+// DeleteCategory removes a category that has neither subcategories nor
+// products.
+func (c *Catalog) DeleteCategory(id string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	i := c.categoryIndex(id)
+	if i < 0 {
+		return ErrNotFound
+	}
+	for _, cat := range c.categories {
+		if cat.ParentID == id {
+			return ErrInUse
+		}
+	}
+	for _, p := range c.products {
+		if p.CategoryID == id {
+			return ErrInUse
+		}
+	}
+	c.categories = append(c.categories[:i], c.categories[i+1:]...)
+	return nil
+}
+
+// ProductsInCategory returns the products of a category and of all its
+// subcategories.
+func (c *Catalog) ProductsInCategory(id string) []model.Product {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	in := make(map[string]bool)
+	for _, d := range c.descendants(id) {
+		in[d] = true
+	}
+	var products []model.Product
+	for _, p := range c.products {
+		if in[p.CategoryID] {
+			products = append(products, p)
+		}
+	}
+	return products
+}
+
+// Path returns the IDs from the root down to the given category.
+func (c *Catalog) Path(id string) []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	var path []string
+	for id != "" && len(path) <= len(c.categories) {
+		i := c.categoryIndex(id)
+		if i < 0 {
+			break
+		}
+		path = append([]string{id}, path...)
+		id = c.categories[i].ParentID
+	}
+	return path
+}
+
+// descendants returns id and the IDs of every category below it.
+func (c *Catalog) descendants(id string) []string {
+	ids := []string{id}
+	for i := 0; i < len(ids); i++ {
+		for _, cat := range c.categories {
+			if cat.ParentID == ids[i] {
+				ids = append(ids, cat.ID)
+			}
+		}
+	}
+	return ids
+}
+
+func (c *Catalog) categoryIndex(id string) int {
+	for i, cat := range c.categories {
+		if cat.ID == id {
+			return i
+		}
+	}
+	return -1
+}
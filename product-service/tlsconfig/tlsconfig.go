@@ -0,0 +1,227 @@
+package tlsconfig
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"os"
+	"sync"
+	"time"
+)
+
+// Files names the PEM files that make up a service's TLS identity and the CA
+// it trusts. Any of them may be empty: without a certificate the service
+// serves plaintext, and without a CA peers are not authenticated.
+type Files struct {
+	CertFile string
+	KeyFile  string
+	CAFile   string
+}
+
+// Reloader hands out TLS configurations backed by the files on disk and
+// re-reads them when they change, so certificates can be rotated without a
+// restart. Configurations returned earlier pick up the new material on their
+// next handshake.
+type Reloader struct {
+	files Files
+
+	mu       sync.RWMutex
+	cert     *tls.Certificate
+	pool     *x509.CertPool
+	modTimes [3]time.Time
+}
+
+// New loads the files once. It fails if a certificate is given without a key
+// or if any named file cannot be parsed.
+func New(files Files) (*Reloader, error) {
+	if (files.CertFile == "") != (files.KeyFile == "") {
+		return nil, errors.New("tls: certificate and key must be set together")
+	}
+	r := &Reloader{files: files}
+	if err := r.reload(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// ServerEnabled reports whether a certificate is configured for listeners.
+func (r *Reloader) ServerEnabled() bool {
+	return r.files.CertFile != ""
+}
+
+// ClientEnabled reports whether outgoing connections should use TLS.
+func (r *Reloader) ClientEnabled() bool {
+	return r.files.CertFile != "" || r.files.CAFile != ""
+}
+
+// Watch polls the files every interval until ctx is done, reloading them when
+// a modification time changes. A failed reload keeps the previous material.
+func (r *Reloader) Watch(ctx context.Context, interval time.Duration) {
+	if interval <= 0 || (!r.ServerEnabled() && !r.ClientEnabled()) {
+		return
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := r.reload(); err != nil {
+				slog.Warn("failed to reload TLS files, keeping previous ones", "error", err)
+			}
+		}
+	}
+}
+
+// ServerConfig returns the configuration for a listener. When a CA is set,
+// clients presenting a certificate are verified against it, and with
+// requireClientCert a verified certificate is mandatory (mutual TLS).
+func (r *Reloader) ServerConfig(requireClientCert bool) *tls.Config {
+	cfg := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		GetCertificate: func(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+			return r.certificate()
+		},
+	}
+	if r.files.CAFile == "" {
+		return cfg
+	}
+	// Client certificates are checked by hand against the current pool
+	// rather than through ClientCAs so that a rotated CA takes effect.
+	cfg.ClientAuth = tls.RequestClientCert
+	if requireClientCert {
+		cfg.ClientAuth = tls.RequireAnyClientCert
+	}
+	cfg.VerifyPeerCertificate = func(rawCerts [][]byte, _ [][]*x509.Certificate) error {
+		if len(rawCerts) == 0 {
+			return nil
+		}
+		return r.verify(rawCerts, x509.ExtKeyUsageClientAuth, "")
+	}
+	return cfg
+}
+
+// ClientConfig returns the configuration for outgoing connections. The
+// service's own certificate, if any, is presented to servers asking for one.
+func (r *Reloader) ClientConfig() *tls.Config {
+	cfg := &tls.Config{MinVersion: tls.VersionTLS12}
+	if r.files.CertFile != "" {
+		cfg.GetClientCertificate = func(*tls.CertificateRequestInfo) (*tls.Certificate, error) {
+			return r.certificate()
+		}
+	}
+	if r.files.CAFile == "" {
+		return cfg
+	}
+	// The standard verification only knows a fixed RootCAs pool, so it is
+	// replaced by an equivalent check against the current pool.
+	cfg.InsecureSkipVerify = true
+	cfg.VerifyConnection = func(cs tls.ConnectionState) error {
+		raw := make([][]byte, len(cs.PeerCertificates))
+		for i, cert := range cs.PeerCertificates {
+			raw[i] = cert.Raw
+		}
+		return r.verify(raw, x509.ExtKeyUsageServerAuth, cs.ServerName)
+	}
+	return cfg
+}
+
+// ListenAndServe serves srv over TLS when a certificate is configured and
+// over plaintext otherwise.
+func (r *Reloader) ListenAndServe(srv *http.Server) error {
+	if !r.ServerEnabled() {
+		return srv.ListenAndServe()
+	}
+	srv.TLSConfig = r.ServerConfig(false)
+	return srv.ListenAndServeTLS("", "")
+}
+
+func (r *Reloader) certificate() (*tls.Certificate, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	if r.cert == nil {
+		return nil, errors.New("tls: no certificate configured")
+	}
+	return r.cert, nil
+}
+
+func (r *Reloader) verify(rawCerts [][]byte, usage x509.ExtKeyUsage, dnsName string) error {
+	if len(rawCerts) == 0 {
+		return errors.New("tls: peer presented no certificate")
+	}
+	certs := make([]*x509.Certificate, len(rawCerts))
+	for i, raw := range rawCerts {
+		cert, err := x509.ParseCertificate(raw)
+		if err != nil {
+			return err
+		}
+		certs[i] = cert
+	}
+	intermediates := x509.NewCertPool()
+	for _, cert := range certs[1:] {
+		intermediates.AddCert(cert)
+	}
+
+	r.mu.RLock()
+	pool := r.pool
+	r.mu.RUnlock()
+
+	_, err := certs[0].Verify(x509.VerifyOptions{
+		Roots:         pool,
+		Intermediates: intermediates,
+		DNSName:       dnsName,
+		KeyUsages:     []x509.ExtKeyUsage{usage},
+	})
+	return err
+}
+
+func (r *Reloader) reload() error {
+	var modTimes [3]time.Time
+	for i, name := range []string{r.files.CertFile, r.files.KeyFile, r.files.CAFile} {
+		if name == "" {
+			continue
+		}
+		info, err := os.Stat(name)
+		if err != nil {
+			return err
+		}
+		modTimes[i] = info.ModTime()
+	}
+
+	r.mu.RLock()
+	unchanged := modTimes == r.modTimes
+	r.mu.RUnlock()
+	if unchanged {
+		return nil
+	}
+
+	var cert *tls.Certificate
+	if r.files.CertFile != "" {
+		c, err := tls.LoadX509KeyPair(r.files.CertFile, r.files.KeyFile)
+		if err != nil {
+			return err
+		}
+		cert = &c
+	}
+	var pool *x509.CertPool
+	if r.files.CAFile != "" {
+		pem, err := os.ReadFile(r.files.CAFile)
+		if err != nil {
+			return err
+		}
+		pool = x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return fmt.Errorf("tls: no certificates found in %s", r.files.CAFile)
+		}
+	}
+
+	r.mu.Lock()
+	r.cert, r.pool, r.modTimes = cert, pool, modTimes
+	r.mu.Unlock()
+	return nil
+}
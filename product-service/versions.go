@@ -0,0 +1,277 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"product-service/apiversion"
+	"product-service/model"
+	"product-service/money"
+	"product-service/search"
+	"strings"
+)
+
+// baseCurrency is the currency of prices in API v1, which predates Money and
+// shows prices as plain decimal numbers.
+var baseCurrency = "USD"
+
+// productV1 is a product as API v1 shows it: price is a decimal number in the
+// base currency, such as 999.99. v2 shows the Product view as it is, with
+// prices as Money. Fields added since Money, such as prices, are the same in
+// both.
+type productV1 struct {
+	ID           string                     `json:"id"`
+	Name         string                     `json:"name"`
+	Price        json.Number                `json:"price"`
+	Prices       money.PriceList            `json:"prices,omitempty"`
+	InStock      bool                       `json:"in_stock"`
+	Quantity     int32                      `json:"quantity"`
+	CategoryID   string                     `json:"category_id,omitempty"`
+	Attributes   map[string]model.Attribute `json:"attributes,omitempty"`
+	Variants     []variantV1                `json:"variants,omitempty"`
+	Version      int64                      `json:"version"`
+	StockVersion int64                      `json:"stock_version,omitempty"`
+}
+
+// variantV1 is a variant as API v1 shows it, with its price as on productV1.
+type variantV1 struct {
+	SKU          string                     `json:"sku"`
+	Name         string                     `json:"name"`
+	Price        json.Number                `json:"price,omitempty"`
+	Prices       money.PriceList            `json:"prices,omitempty"`
+	InStock      bool                       `json:"in_stock"`
+	Quantity     int32                      `json:"quantity"`
+	Attributes   map[string]model.Attribute `json:"attributes,omitempty"`
+	StockVersion int64                      `json:"stock_version,omitempty"`
+}
+
+func toV1(p Product) productV1 {
+	v1 := productV1{
+		ID:           p.ID,
+		Name:         p.Name,
+		Price:        legacyPrice(p.Price, p.Prices),
+		Prices:       p.Prices,
+		InStock:      p.InStock,
+		Quantity:     p.Quantity,
+		CategoryID:   p.CategoryID,
+		Attributes:   p.Attributes,
+		Version:      p.Version,
+		StockVersion: p.StockVersion,
+	}
+	for _, variant := range p.Variants {
+		v1.Variants = append(v1.Variants, variantToV1(variant))
+	}
+	return v1
+}
+
+func fromV1(v1 productV1) (model.Product, error) {
+	price, err := money.Parse(v1.Price.String(), baseCurrency)
+	if err != nil {
+		return model.Product{}, err
+	}
+	p := model.Product{
+		ID:           v1.ID,
+		Name:         v1.Name,
+		Price:        price,
+		Prices:       v1.Prices,
+		InStock:      v1.InStock,
+		Quantity:     v1.Quantity,
+		CategoryID:   v1.CategoryID,
+		Attributes:   v1.Attributes,
+		Version:      v1.Version,
+		StockVersion: v1.StockVersion,
+	}
+	for _, variant := range v1.Variants {
+		v, err := variantFromV1(variant)
+		if err != nil {
+			return model.Product{}, err
+		}
+		p.Variants = append(p.Variants, v)
+	}
+	return p, nil
+}
+
+func variantToV1(v model.Variant) variantV1 {
+	v1 := variantV1{
+		SKU:          v.SKU,
+		Name:         v.Name,
+		Prices:       v.Prices,
+		InStock:      v.InStock,
+		Quantity:     v.Quantity,
+		Attributes:   v.Attributes,
+		StockVersion: v.StockVersion,
+	}
+	// Without a price of its own the variant sells at the product price
+	if v.Price != nil {
+		v1.Price = legacyPrice(*v.Price, v.Prices)
+	}
+	return v1
+}
+
+func variantFromV1(v1 variantV1) (model.Variant, error) {
+	v := model.Variant{
+		SKU:          v1.SKU,
+		Name:         v1.Name,
+		Prices:       v1.Prices,
+		InStock:      v1.InStock,
+		Quantity:     v1.Quantity,
+		Attributes:   v1.Attributes,
+		StockVersion: v1.StockVersion,
+	}
+	if v1.Price != "" {
+		price, err := money.Parse(v1.Price.String(), baseCurrency)
+		if err != nil {
+			return model.Variant{}, err
+		}
+		v.Price = &price
+	}
+	return v, nil
+}
+
+// legacyPrice is a price as v1 shows it: the amount in the base currency,
+// from the price list if the price is in another currency and the list has
+// one in the base currency.
+func legacyPrice(price money.Money, prices money.PriceList) json.Number {
+	if price.Currency != baseCurrency {
+		if m, ok := prices.In(baseCurrency); ok {
+			price = m
+		}
+	}
+	return legacyAmount(price)
+}
+
+// legacyAmount is an amount as v1 shows it: a decimal number without
+// trailing zeros, like the floats v1 had.
+func legacyAmount(m money.Money) json.Number {
+	d := m.Decimal()
+	if strings.Contains(d, ".") {
+		d = strings.TrimSuffix(strings.TrimRight(d, "0"), ".")
+	}
+	return json.Number(d)
+}
+
+// keepPrice keeps the stored price of a product replaced or patched through
+// v1 if the price sent is the one v1 shows for it. v1 reads every price in
+// the base currency, so a base price in another currency would otherwise be
+// replaced on each v1 update, whatever the update was for.
+func keepPrice(r *http.Request, updated *model.Product, stored model.Product) {
+	if apiversion.FromRequest(r) >= 2 {
+		return
+	}
+	if shown, err := money.Parse(legacyPrice(stored.Price, stored.Prices).String(), baseCurrency); err == nil && updated.Price == shown {
+		updated.Price = stored.Price
+	}
+}
+
+// keepVariantPrice is keepPrice for a variant.
+func keepVariantPrice(r *http.Request, updated *model.Variant, stored model.Variant) {
+	if apiversion.FromRequest(r) >= 2 || updated.Price == nil || stored.Price == nil {
+		return
+	}
+	if shown, err := money.Parse(legacyPrice(*stored.Price, stored.Prices).String(), baseCurrency); err == nil && *updated.Price == shown {
+		updated.Price = stored.Price
+	}
+}
+
+// decodeProduct reads a product in the shape of the request's API version.
+func decodeProduct(r *http.Request, product *model.Product) error {
+	return decodeProductFrom(r, r.Body, product)
+}
+
+// decodeProductFrom is decodeProduct reading body instead of the request's.
+func decodeProductFrom(r *http.Request, body io.Reader, product *model.Product) error {
+	if apiversion.FromRequest(r) >= 2 {
+		return json.NewDecoder(body).Decode(product)
+	}
+	var v1 productV1
+	if err := json.NewDecoder(body).Decode(&v1); err != nil {
+		return err
+	}
+	p, err := fromV1(v1)
+	if err != nil {
+		return err
+	}
+	*product = p
+	return nil
+}
+
+// decodeVariant reads a variant in the shape of the request's API version.
+func decodeVariant(r *http.Request, variant *model.Variant) error {
+	if apiversion.FromRequest(r) >= 2 {
+		return json.NewDecoder(r.Body).Decode(variant)
+	}
+	var v1 variantV1
+	if err := json.NewDecoder(r.Body).Decode(&v1); err != nil {
+		return err
+	}
+	v, err := variantFromV1(v1)
+	if err != nil {
+		return err
+	}
+	*variant = v
+	return nil
+}
+
+// productBody returns a product in the shape of the request's API version.
+func productBody(r *http.Request, product Product) any {
+	if apiversion.FromRequest(r) >= 2 {
+		return product
+	}
+	return toV1(product)
+}
+
+// productsBody returns a list of products in the shape of the request's API
+// version.
+func productsBody(r *http.Request, list []Product) any {
+	if apiversion.FromRequest(r) >= 2 {
+		return list
+	}
+	v1 := make([]productV1, 0, len(list))
+	for _, p := range list {
+		v1 = append(v1, toV1(p))
+	}
+	return v1
+}
+
+// variantBody returns a variant in the shape of the request's API version.
+func variantBody(r *http.Request, variant model.Variant) any {
+	if apiversion.FromRequest(r) >= 2 {
+		return variant
+	}
+	return variantToV1(variant)
+}
+
+// variantsBody returns a list of variants in the shape of the request's API
+// version.
+func variantsBody(r *http.Request, list []model.Variant) any {
+	if apiversion.FromRequest(r) >= 2 {
+		return list
+	}
+	v1 := make([]variantV1, 0, len(list))
+	for _, v := range list {
+		v1 = append(v1, variantToV1(v))
+	}
+	return v1
+}
+
+// searchBody returns search results in the shape of the request's API
+// version.
+func searchBody(r *http.Request, resp SearchResponse) any {
+	if apiversion.FromRequest(r) >= 2 {
+		return resp
+	}
+	type resultV1 struct {
+		productV1
+		Score float64 `json:"score"`
+	}
+	results := make([]resultV1, 0, len(resp.Results))
+	for _, result := range resp.Results {
+		results = append(results, resultV1{toV1(result.Product), result.Score})
+	}
+	return struct {
+		Query   string        `json:"query"`
+		Total   int           `json:"total"`
+		Results []resultV1    `json:"results"`
+		Facets  search.Facets `json:"facets"`
+	}{resp.Query, resp.Total, results, resp.Facets}
+}
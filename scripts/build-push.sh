@@ -13,8 +13,8 @@ build_and_push() {
     local service=$1
     echo -e "${GREEN}Building ${service}...${NC}"
     
-    # Build the image
-    podman build -t ${DOCKER_REGISTRY}/${service}:${VERSION} .
+    # Build the image from the repository root, for the shared module
+    podman build -t ${DOCKER_REGISTRY}/${service}:${VERSION} -f ${service}/Dockerfile .
     
     if [ $? -eq 0 ]; then
         echo -e "${GREEN}Pushing ${service}...${NC}"
@@ -29,24 +29,16 @@ build_and_push() {
 echo -e "${GREEN}Starting build and push process...${NC}"
 
 # Build and push inventory service
-cd inventory-service
 build_and_push "inventory-service"
-cd ..
 
 # Build and push product service
-cd product-service
 build_and_push "product-service"
-cd ..
 
 # Build and push order service
-cd order-service
 build_and_push "order-service"
-cd ..
 
 # Build and push api gateway
-cd api-gateway
 build_and_push "api-gateway"
-cd ..
 
 echo -e "${GREEN}All services have been built and pushed successfully!${NC}"
 
@@ -0,0 +1,28 @@
+#!/bin/bash
+# Mints an HS256 bearer token for local testing against the API gateway.
+#
+# Usage: ./scripts/dev-token.sh SECRET CUSTOMER_ID [ROLES] [TTL_SECONDS]
+#   ROLES is a comma-separated list such as "admin" or "support".
+set -eu
+
+if [ $# -lt 2 ]; then
+  echo "usage: $0 SECRET CUSTOMER_ID [ROLES] [TTL_SECONDS]" >&2
+  exit 1
+fi
+SECRET=$1
+SUBJECT=$2
+ROLES=${3:-}
+TTL=${4:-3600}
+
+b64url() {
+  openssl base64 -A | tr '+/' '-_' | tr -d '='
+}
+
+ROLES_JSON=$(printf '%s' "$ROLES" | awk -F, '{ for (i = 1; i <= NF; i++) printf "%s\"%s\"", (i > 1 ? "," : ""), $i }')
+EXP=$(( $(date +%s) + TTL ))
+
+HEADER=$(printf '{"alg":"HS256","typ":"JWT"}' | b64url)
+PAYLOAD=$(printf '{"sub":"%s","roles":[%s],"exp":%d}' "$SUBJECT" "$ROLES_JSON" "$EXP" | b64url)
+SIGNATURE=$(printf '%s.%s' "$HEADER" "$PAYLOAD" | openssl dgst -sha256 -hmac "$SECRET" -binary | b64url)
+
+echo "$HEADER.$PAYLOAD.$SIGNATURE"
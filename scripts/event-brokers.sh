@@ -0,0 +1,32 @@
+#!/bin/bash
+# Starts local stand-ins for the event brokers with Docker:
+#   - NATS with JetStream on :4222 and an EVENTS stream capturing "events.>"
+#     (EVENT_BROKER=nats EVENT_BROKER_URL=nats://localhost:4222)
+#   - Redpanda with its Kafka REST proxy on :8092
+#     (EVENT_BROKER=kafka EVENT_BROKER_URL=http://localhost:8092)
+#
+# Usage: ./scripts/event-brokers.sh [up|down]
+set -eu
+
+case "${1:-up}" in
+up)
+  docker run -d --rm --name events-nats -p 4222:4222 nats:2.10 -js
+  sleep 1
+  # Two minutes of duplicate detection on Nats-Msg-Id covers relay retries.
+  docker run --rm --network host natsio/nats-box:latest \
+    nats --server nats://localhost:4222 stream add EVENTS \
+    --subjects 'events.>' --storage file --retention limits \
+    --discard old --max-age 7d --dupe-window 2m --replicas 1 --defaults
+  docker run -d --rm --name events-redpanda -p 9092:9092 -p 8092:8082 \
+    redpandadata/redpanda:latest redpanda start --mode dev-container \
+    --kafka-addr 0.0.0.0:9092 --advertise-kafka-addr localhost:9092 \
+    --pandaproxy-addr 0.0.0.0:8082 --advertise-pandaproxy-addr localhost:8092
+  ;;
+down)
+  docker rm -f events-nats events-redpanda
+  ;;
+*)
+  echo "usage: $0 [up|down]" >&2
+  exit 1
+  ;;
+esac
@@ -0,0 +1,52 @@
+#!/bin/bash
+
+# Generate a local CA and a certificate per service for development.
+# Each certificate is valid for both server and client auth, so the same
+# pair secures a service's listeners and its calls to other services.
+#
+# Usage: ./scripts/gen-certs.sh [output-dir]   (default: ./certs)
+
+set -e
+
+OUT_DIR=${1:-./certs}
+DAYS=365
+SERVICES="inventory-service product-service order-service api-gateway"
+
+mkdir -p "$OUT_DIR"
+
+# Certificate authority
+if [ ! -f "$OUT_DIR/ca.crt" ]; then
+    openssl req -x509 -newkey rsa:4096 -sha256 -nodes \
+        -days $DAYS \
+        -subj "/CN=go-microservices-dev-ca" \
+        -keyout "$OUT_DIR/ca.key" \
+        -out "$OUT_DIR/ca.crt"
+    echo "Created CA in $OUT_DIR/ca.crt"
+fi
+
+# Per-service certificates signed by the CA
+for service in $SERVICES; do
+    openssl req -newkey rsa:2048 -sha256 -nodes \
+        -subj "/CN=$service" \
+        -keyout "$OUT_DIR/$service.key" \
+        -out "$OUT_DIR/$service.csr"
+
+    cat > "$OUT_DIR/$service.ext" <<EXT
+basicConstraints=CA:FALSE
+keyUsage=digitalSignature,keyEncipherment
+extendedKeyUsage=serverAuth,clientAuth
+subjectAltName=DNS:$service,DNS:localhost,IP:127.0.0.1
+EXT
+
+    openssl x509 -req -sha256 \
+        -days $DAYS \
+        -in "$OUT_DIR/$service.csr" \
+        -CA "$OUT_DIR/ca.crt" -CAkey "$OUT_DIR/ca.key" -CAcreateserial \
+        -extfile "$OUT_DIR/$service.ext" \
+        -out "$OUT_DIR/$service.crt"
+
+    rm "$OUT_DIR/$service.csr" "$OUT_DIR/$service.ext"
+    echo "Created certificate for $service"
+done
+
+echo "Set TLS_CERT_FILE, TLS_KEY_FILE and TLS_CA_FILE in each service's .env to enable TLS"
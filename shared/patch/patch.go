@@ -0,0 +1,447 @@
+// Package patch applies partial updates to JSON documents, in the two
+// formats PATCH requests accept:
+//
+//	application/merge-patch+json  RFC 7396: an object of the members to
+//	                              change, null removing a member
+//	application/json-patch+json   RFC 6902: a list of add, remove,
+//	                              replace, move, copy and test operations
+//
+// Plain application/json is read as a merge patch.
+package patch
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// Media types of the patch formats.
+const (
+	MergePatch = "application/merge-patch+json"
+	JSONPatch  = "application/json-patch+json"
+)
+
+// Accepted lists the patch formats, as an Accept-Patch header.
+const Accepted = MergePatch + ", " + JSONPatch
+
+var (
+	// ErrUnsupportedType rejects a patch in neither format.
+	ErrUnsupportedType = errors.New("unsupported patch format")
+	// ErrInvalid rejects a malformed patch.
+	ErrInvalid = errors.New("invalid patch")
+	// ErrTestFailed reports a JSON Patch test operation that did not hold.
+	ErrTestFailed = errors.New("patch test failed")
+	// ErrUnprocessable reports a patch that cannot be applied to the
+	// document, or that leaves it invalid.
+	ErrUnprocessable = errors.New("patch cannot be applied")
+)
+
+// Status returns the HTTP status to answer a failed patch with.
+func Status(err error) int {
+	switch {
+	case errors.Is(err, ErrUnsupportedType):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, ErrInvalid):
+		return http.StatusBadRequest
+	case errors.Is(err, ErrTestFailed):
+		return http.StatusConflict
+	case errors.Is(err, ErrUnprocessable):
+		return http.StatusUnprocessableEntity
+	}
+	return http.StatusInternalServerError
+}
+
+// Patch is a parsed patch in either format.
+type Patch struct {
+	merge any
+	ops   []operation
+}
+
+type operation struct {
+	Op    string          `json:"op"`
+	Path  string          `json:"path"`
+	From  string          `json:"from"`
+	Value json.RawMessage `json:"value"`
+
+	path, from []string
+	value      any
+}
+
+// Parse reads a patch in the format named by contentType.
+func Parse(contentType string, body []byte) (*Patch, error) {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return nil, fmt.Errorf("%w %q", ErrUnsupportedType, contentType)
+	}
+	switch mediaType {
+	case MergePatch, "application/json":
+		v, err := decode(body)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		return &Patch{merge: v}, nil
+	case JSONPatch:
+		var ops []operation
+		if err := json.Unmarshal(body, &ops); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalid, err)
+		}
+		if ops == nil {
+			return nil, fmt.Errorf("%w: expected a list of operations", ErrInvalid)
+		}
+		for i := range ops {
+			if err := ops[i].parse(); err != nil {
+				return nil, fmt.Errorf("%w: operation %d: %v", ErrInvalid, i, err)
+			}
+		}
+		return &Patch{ops: ops}, nil
+	}
+	return nil, fmt.Errorf("%w %q", ErrUnsupportedType, mediaType)
+}
+
+func (op *operation) parse() error {
+	var err error
+	if op.path, err = pointer(op.Path); err != nil {
+		return err
+	}
+	switch op.Op {
+	case "add", "replace", "test":
+		if op.Value == nil {
+			return fmt.Errorf("%s needs a value", op.Op)
+		}
+		op.value, err = decode(op.Value)
+	case "move", "copy":
+		op.from, err = pointer(op.From)
+		if err == nil && op.Op == "move" && len(op.from) < len(op.path) && prefix(op.from, op.path) {
+			err = errors.New("cannot move a value into itself")
+		}
+	case "remove":
+	default:
+		err = fmt.Errorf("unknown op %q", op.Op)
+	}
+	return err
+}
+
+// Touches reports whether applying the patch may change the top-level
+// member name of an object document.
+func (p *Patch) Touches(name string) bool {
+	if p.ops == nil {
+		m, ok := p.merge.(map[string]any)
+		if !ok {
+			return true
+		}
+		_, ok = m[name]
+		return ok
+	}
+	for _, op := range p.ops {
+		if op.Op == "test" {
+			continue
+		}
+		if len(op.path) == 0 || op.path[0] == name {
+			return true
+		}
+		if op.Op == "move" && (len(op.from) == 0 || op.from[0] == name) {
+			return true
+		}
+	}
+	return false
+}
+
+// Apply returns doc with the patch applied. JSON Patch operations apply in
+// order, and if one fails none do.
+func (p *Patch) Apply(doc []byte) ([]byte, error) {
+	v, err := decode(doc)
+	if err != nil {
+		return nil, err
+	}
+	if p.ops == nil {
+		v = merge(v, p.merge)
+	}
+	for i, op := range p.ops {
+		if v, err = op.apply(v); err != nil {
+			return nil, fmt.Errorf("operation %d (%s %s): %w", i, op.Op, op.Path, err)
+		}
+	}
+	return json.Marshal(v)
+}
+
+// merge applies a merge patch to target.
+func merge(target, patch any) any {
+	members, ok := patch.(map[string]any)
+	if !ok {
+		return patch
+	}
+	object, ok := target.(map[string]any)
+	if !ok {
+		object = map[string]any{}
+	}
+	for name, value := range members {
+		if value == nil {
+			delete(object, name)
+		} else {
+			object[name] = merge(object[name], value)
+		}
+	}
+	return object
+}
+
+func (op operation) apply(doc any) (any, error) {
+	switch op.Op {
+	case "add":
+		return add(doc, op.path, op.value)
+	case "remove":
+		doc, _, err := remove(doc, op.path)
+		return doc, err
+	case "replace":
+		doc, _, err := remove(doc, op.path)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, op.value)
+	case "move":
+		doc, value, err := remove(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		return add(doc, op.path, value)
+	case "copy":
+		value, err := get(doc, op.from)
+		if err != nil {
+			return nil, err
+		}
+		// The copy must not share maps or slices with the original
+		value, _ = decode(mustMarshal(value))
+		return add(doc, op.path, value)
+	case "test":
+		value, err := get(doc, op.path)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrTestFailed, err)
+		}
+		if !equal(value, op.value) {
+			return nil, fmt.Errorf("%w: %s is %s", ErrTestFailed, op.Path, mustMarshal(value))
+		}
+		return doc, nil
+	}
+	return nil, fmt.Errorf("%w: unknown op %q", ErrInvalid, op.Op)
+}
+
+func add(doc any, path []string, value any) (any, error) {
+	if len(path) == 0 {
+		return value, nil
+	}
+	return update(doc, path, func(parent any, key string) (any, error) {
+		switch parent := parent.(type) {
+		case map[string]any:
+			parent[key] = value
+			return parent, nil
+		case []any:
+			i := len(parent)
+			if key != "-" {
+				var err error
+				if i, err = index(key, len(parent)+1); err != nil {
+					return nil, err
+				}
+			}
+			parent = append(parent, nil)
+			copy(parent[i+1:], parent[i:])
+			parent[i] = value
+			return parent, nil
+		}
+		return nil, fmt.Errorf("%w: cannot add %q to a %s", ErrUnprocessable, key, kind(parent))
+	})
+}
+
+// remove removes the value at path and returns it.
+func remove(doc any, path []string) (any, any, error) {
+	if len(path) == 0 {
+		return nil, doc, nil
+	}
+	var removed any
+	doc, err := update(doc, path, func(parent any, key string) (any, error) {
+		switch parent := parent.(type) {
+		case map[string]any:
+			value, ok := parent[key]
+			if !ok {
+				return nil, fmt.Errorf("%w: no member %q", ErrUnprocessable, key)
+			}
+			removed = value
+			delete(parent, key)
+			return parent, nil
+		case []any:
+			i, err := index(key, len(parent))
+			if err != nil {
+				return nil, err
+			}
+			removed = parent[i]
+			return append(parent[:i], parent[i+1:]...), nil
+		}
+		return nil, fmt.Errorf("%w: cannot remove %q from a %s", ErrUnprocessable, key, kind(parent))
+	})
+	return doc, removed, err
+}
+
+func get(doc any, path []string) (any, error) {
+	for _, key := range path {
+		var err error
+		if doc, err = child(doc, key); err != nil {
+			return nil, err
+		}
+	}
+	return doc, nil
+}
+
+// update walks path from node and replaces the parent of its last token
+// with what fn makes of it, storing each changed container back into its
+// own parent, since arrays that grow or shrink are new slices.
+func update(node any, path []string, fn func(parent any, key string) (any, error)) (any, error) {
+	if len(path) == 1 {
+		return fn(node, path[0])
+	}
+	next, err := child(node, path[0])
+	if err != nil {
+		return nil, err
+	}
+	if next, err = update(next, path[1:], fn); err != nil {
+		return nil, err
+	}
+	switch node := node.(type) {
+	case map[string]any:
+		node[path[0]] = next
+	case []any:
+		i, _ := index(path[0], len(node))
+		node[i] = next
+	}
+	return node, nil
+}
+
+func child(node any, key string) (any, error) {
+	switch node := node.(type) {
+	case map[string]any:
+		value, ok := node[key]
+		if !ok {
+			return nil, fmt.Errorf("%w: no member %q", ErrUnprocessable, key)
+		}
+		return value, nil
+	case []any:
+		i, err := index(key, len(node))
+		if err != nil {
+			return nil, err
+		}
+		return node[i], nil
+	}
+	return nil, fmt.Errorf("%w: cannot look up %q in a %s", ErrUnprocessable, key, kind(node))
+}
+
+// index parses an array index below n. Indexes have no sign or leading
+// zeros.
+func index(key string, n int) (int, error) {
+	i := 0
+	for j, c := range key {
+		if c < '0' || c > '9' || (j == 0 && c == '0' && len(key) > 1) {
+			return 0, fmt.Errorf("%w: %q is not an array index", ErrUnprocessable, key)
+		}
+		if i = i*10 + int(c-'0'); i >= n {
+			break
+		}
+	}
+	if key == "" || i >= n {
+		return 0, fmt.Errorf("%w: index %s is out of range", ErrUnprocessable, key)
+	}
+	return i, nil
+}
+
+// pointer splits an RFC 6901 JSON pointer into its reference tokens.
+func pointer(s string) ([]string, error) {
+	if s == "" {
+		return []string{}, nil
+	}
+	if s[0] != '/' {
+		return nil, fmt.Errorf("pointer %q does not start with /", s)
+	}
+	tokens := strings.Split(s[1:], "/")
+	for i, token := range tokens {
+		tokens[i] = strings.ReplaceAll(strings.ReplaceAll(token, "~1", "/"), "~0", "~")
+	}
+	return tokens, nil
+}
+
+func prefix(p, of []string) bool {
+	for i := range p {
+		if p[i] != of[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// equal compares decoded JSON values, numbers by value.
+func equal(a, b any) bool {
+	switch a := a.(type) {
+	case json.Number:
+		b, ok := b.(json.Number)
+		if !ok {
+			return false
+		}
+		x, errA := a.Float64()
+		y, errB := b.Float64()
+		return errA == nil && errB == nil && x == y
+	case []any:
+		b, ok := b.([]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for i := range a {
+			if !equal(a[i], b[i]) {
+				return false
+			}
+		}
+		return true
+	case map[string]any:
+		b, ok := b.(map[string]any)
+		if !ok || len(a) != len(b) {
+			return false
+		}
+		for k, v := range a {
+			w, ok := b[k]
+			if !ok || !equal(v, w) {
+				return false
+			}
+		}
+		return true
+	}
+	return a == b
+}
+
+func kind(v any) string {
+	switch v.(type) {
+	case map[string]any:
+		return "object"
+	case []any:
+		return "array"
+	case nil:
+		return "null"
+	}
+	return "value"
+}
+
+// decode parses a JSON document keeping numbers exact.
+func decode(data []byte) (any, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var v any
+	if err := dec.Decode(&v); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after the document")
+	}
+	return v, nil
+}
+
+func mustMarshal(v any) []byte {
+	data, _ := json.Marshal(v)
+	return data
+}
@@ -0,0 +1,297 @@
+package patch
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// TestJSONPatch runs the examples of RFC 6902, appendix A, and a few more
+// for the - index and pointer escaping.
+func TestJSONPatch(t *testing.T) {
+	tests := []struct {
+		name, doc, patch, want string
+		err                    error
+	}{
+		{
+			name:  "A.1 adding an object member",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux"}]`,
+			want:  `{"baz": "qux", "foo": "bar"}`,
+		},
+		{
+			name:  "A.2 adding an array element",
+			doc:   `{"foo": ["bar", "baz"]}`,
+			patch: `[{"op": "add", "path": "/foo/1", "value": "qux"}]`,
+			want:  `{"foo": ["bar", "qux", "baz"]}`,
+		},
+		{
+			name:  "A.3 removing an object member",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "remove", "path": "/baz"}]`,
+			want:  `{"foo": "bar"}`,
+		},
+		{
+			name:  "A.4 removing an array element",
+			doc:   `{"foo": ["bar", "qux", "baz"]}`,
+			patch: `[{"op": "remove", "path": "/foo/1"}]`,
+			want:  `{"foo": ["bar", "baz"]}`,
+		},
+		{
+			name:  "A.5 replacing a value",
+			doc:   `{"baz": "qux", "foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "/baz", "value": "boo"}]`,
+			want:  `{"baz": "boo", "foo": "bar"}`,
+		},
+		{
+			name:  "A.6 moving a value",
+			doc:   `{"foo": {"bar": "baz", "waldo": "fred"}, "qux": {"corge": "grault"}}`,
+			patch: `[{"op": "move", "from": "/foo/waldo", "path": "/qux/thud"}]`,
+			want:  `{"foo": {"bar": "baz"}, "qux": {"corge": "grault", "thud": "fred"}}`,
+		},
+		{
+			name:  "A.7 moving an array element",
+			doc:   `{"foo": ["all", "grass", "cows", "eat"]}`,
+			patch: `[{"op": "move", "from": "/foo/1", "path": "/foo/3"}]`,
+			want:  `{"foo": ["all", "cows", "eat", "grass"]}`,
+		},
+		{
+			name:  "A.8 testing a value: success",
+			doc:   `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+			patch: `[{"op": "test", "path": "/baz", "value": "qux"}, {"op": "test", "path": "/foo/1", "value": 2}]`,
+			want:  `{"baz": "qux", "foo": ["a", 2, "c"]}`,
+		},
+		{
+			name:  "A.9 testing a value: error",
+			doc:   `{"baz": "qux"}`,
+			patch: `[{"op": "test", "path": "/baz", "value": "bar"}]`,
+			err:   ErrTestFailed,
+		},
+		{
+			name:  "A.10 adding a nested member object",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/child", "value": {"grandchild": {}}}]`,
+			want:  `{"foo": "bar", "child": {"grandchild": {}}}`,
+		},
+		{
+			name:  "A.11 ignoring unrecognized elements",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": "qux", "xyz": 123}]`,
+			want:  `{"foo": "bar", "baz": "qux"}`,
+		},
+		{
+			name:  "A.12 adding to a nonexistent target",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz/bat", "value": "qux"}]`,
+			err:   ErrUnprocessable,
+		},
+		{
+			name:  "A.14 ~ escape ordering",
+			doc:   `{"/": 9, "~1": 10}`,
+			patch: `[{"op": "test", "path": "/~01", "value": 10}]`,
+			want:  `{"/": 9, "~1": 10}`,
+		},
+		{
+			name:  "A.15 comparing strings and numbers",
+			doc:   `{"/": 9, "~1": 10}`,
+			patch: `[{"op": "test", "path": "/~01", "value": "10"}]`,
+			err:   ErrTestFailed,
+		},
+		{
+			name:  "A.16 adding an array value",
+			doc:   `{"foo": ["bar"]}`,
+			patch: `[{"op": "add", "path": "/foo/-", "value": ["abc", "def"]}]`,
+			want:  `{"foo": ["bar", ["abc", "def"]]}`,
+		},
+		{
+			name:  "copying a value",
+			doc:   `{"foo": {"bar": 1}}`,
+			patch: `[{"op": "copy", "from": "/foo", "path": "/baz"}, {"op": "replace", "path": "/baz/bar", "value": 2}]`,
+			want:  `{"foo": {"bar": 1}, "baz": {"bar": 2}}`,
+		},
+		{
+			name:  "copying to the end of an array",
+			doc:   `{"foo": ["a", "b"]}`,
+			patch: `[{"op": "copy", "from": "/foo/0", "path": "/foo/-"}]`,
+			want:  `{"foo": ["a", "b", "a"]}`,
+		},
+		{
+			name:  "moving to the end of an array",
+			doc:   `{"foo": ["a", "b", "c"]}`,
+			patch: `[{"op": "move", "from": "/foo/0", "path": "/foo/-"}]`,
+			want:  `{"foo": ["b", "c", "a"]}`,
+		},
+		{
+			name:  "removing the - index",
+			doc:   `{"foo": ["a"]}`,
+			patch: `[{"op": "remove", "path": "/foo/-"}]`,
+			err:   ErrUnprocessable,
+		},
+		{
+			name:  "replacing the - index",
+			doc:   `{"foo": ["a"]}`,
+			patch: `[{"op": "replace", "path": "/foo/-", "value": "b"}]`,
+			err:   ErrUnprocessable,
+		},
+		{
+			name:  "adding past the end of an array",
+			doc:   `{"foo": ["a"]}`,
+			patch: `[{"op": "add", "path": "/foo/2", "value": "b"}]`,
+			err:   ErrUnprocessable,
+		},
+		{
+			name:  "an index with a leading zero",
+			doc:   `{"foo": ["a", "b"]}`,
+			patch: `[{"op": "remove", "path": "/foo/01"}]`,
+			err:   ErrUnprocessable,
+		},
+		{
+			name:  "escaped / and ~ in member names",
+			doc:   `{"a/b": 1, "m~n": 2}`,
+			patch: `[{"op": "replace", "path": "/a~1b", "value": 3}, {"op": "move", "from": "/m~0n", "path": "/~0~1"}]`,
+			want:  `{"a/b": 3, "~/": 2}`,
+		},
+		{
+			name:  "replacing the whole document",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "replace", "path": "", "value": ["baz"]}]`,
+			want:  `["baz"]`,
+		},
+		{
+			name:  "removing a member that does not exist",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "remove", "path": "/baz"}]`,
+			err:   ErrUnprocessable,
+		},
+		{
+			name:  "a failing operation undoes the ones before it",
+			doc:   `{"foo": "bar"}`,
+			patch: `[{"op": "add", "path": "/baz", "value": 1}, {"op": "test", "path": "/foo", "value": "qux"}]`,
+			err:   ErrTestFailed,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, err := Parse(JSONPatch, []byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.Apply([]byte(tt.doc))
+			if tt.err != nil {
+				if !errors.Is(err, tt.err) {
+					t.Fatalf("error = %v, want %v", err, tt.err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, got, tt.want)
+		})
+	}
+}
+
+// TestMergePatch runs the examples of RFC 7396, appendix A.
+func TestMergePatch(t *testing.T) {
+	tests := []struct {
+		doc, patch, want string
+	}{
+		{`{"a": "b"}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "b"}`, `{"b": "c"}`, `{"a": "b", "b": "c"}`},
+		{`{"a": "b"}`, `{"a": null}`, `{}`},
+		{`{"a": "b", "b": "c"}`, `{"a": null}`, `{"b": "c"}`},
+		{`{"a": ["b"]}`, `{"a": "c"}`, `{"a": "c"}`},
+		{`{"a": "c"}`, `{"a": ["b"]}`, `{"a": ["b"]}`},
+		{`{"a": {"b": "c"}}`, `{"a": {"b": "d", "c": null}}`, `{"a": {"b": "d"}}`},
+		{`{"a": [{"b": "c"}]}`, `{"a": [1]}`, `{"a": [1]}`},
+		{`["a", "b"]`, `["c", "d"]`, `["c", "d"]`},
+		{`{"a": "b"}`, `["c"]`, `["c"]`},
+		{`{"a": "foo"}`, `null`, `null`},
+		{`{"a": "foo"}`, `"bar"`, `"bar"`},
+		{`{"e": null}`, `{"a": 1}`, `{"e": null, "a": 1}`},
+		{`[1, 2]`, `{"a": "b", "c": null}`, `{"a": "b"}`},
+		{`{}`, `{"a": {"bb": {"ccc": null}}}`, `{"a": {"bb": {}}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.doc+" "+tt.patch, func(t *testing.T) {
+			p, err := Parse(MergePatch, []byte(tt.patch))
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := p.Apply([]byte(tt.doc))
+			if err != nil {
+				t.Fatal(err)
+			}
+			assertJSON(t, got, tt.want)
+		})
+	}
+}
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		name, contentType, body string
+		err                     error
+	}{
+		{"merge patch", MergePatch, `{"a": 1}`, nil},
+		{"plain JSON as a merge patch", "application/json; charset=utf-8", `{"a": 1}`, nil},
+		{"JSON Patch", JSONPatch, `[]`, nil},
+		{"other media type", "text/plain", `{}`, ErrUnsupportedType},
+		{"no media type", "", `{}`, ErrUnsupportedType},
+		{"merge patch that is not JSON", MergePatch, `{`, ErrInvalid},
+		{"JSON Patch that is not a list", JSONPatch, `{"op": "add"}`, ErrInvalid},
+		{"JSON Patch of null", JSONPatch, `null`, ErrInvalid},
+		{"unknown operation", JSONPatch, `[{"op": "append", "path": "/a"}]`, ErrInvalid},
+		{"add without a value", JSONPatch, `[{"op": "add", "path": "/a"}]`, ErrInvalid},
+		{"pointer without a leading /", JSONPatch, `[{"op": "remove", "path": "a"}]`, ErrInvalid},
+		{"moving a value into itself", JSONPatch, `[{"op": "move", "from": "/a", "path": "/a/b"}]`, ErrInvalid},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := Parse(tt.contentType, []byte(tt.body))
+			if !errors.Is(err, tt.err) {
+				t.Errorf("error = %v, want %v", err, tt.err)
+			}
+		})
+	}
+}
+
+func TestTouches(t *testing.T) {
+	tests := []struct {
+		contentType, body string
+		want              bool
+	}{
+		{MergePatch, `{"name": "x"}`, false},
+		{MergePatch, `{"variants": null}`, true},
+		{MergePatch, `["not", "an", "object"]`, true},
+		{JSONPatch, `[{"op": "replace", "path": "/name", "value": "x"}]`, false},
+		{JSONPatch, `[{"op": "add", "path": "/variants/-", "value": {}}]`, true},
+		{JSONPatch, `[{"op": "move", "from": "/variants/0", "path": "/name"}]`, true},
+		{JSONPatch, `[{"op": "test", "path": "/variants", "value": []}]`, false},
+		{JSONPatch, `[{"op": "replace", "path": "", "value": {}}]`, true},
+	}
+	for _, tt := range tests {
+		p, err := Parse(tt.contentType, []byte(tt.body))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := p.Touches("variants"); got != tt.want {
+			t.Errorf("Touches(variants) of %s = %v, want %v", tt.body, got, tt.want)
+		}
+	}
+}
+
+// assertJSON compares JSON documents by value.
+func assertJSON(t *testing.T, got []byte, want string) {
+	t.Helper()
+	var g, w any
+	if err := json.Unmarshal(got, &g); err != nil {
+		t.Fatalf("result %s: %v", got, err)
+	}
+	if err := json.Unmarshal([]byte(want), &w); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(g, w) {
+		t.Errorf("got %s, want %s", got, want)
+	}
+}